@@ -0,0 +1,46 @@
+// Command auditverify checks the hash chain of the audit log (see migrations/013)
+//
+//	go run ./cmd/auditverify [-config config.yaml]
+//
+// Exits with status 1 if an entry was modified, removed or reordered
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/setting"
+
+	"github.com/joho/godotenv"
+)
+
+func main() {
+	// Same configuration as the server, so it reads the same database
+	if err := godotenv.Load(); err != nil {
+		log.Println("Info: .env file not found, using system environment variables")
+	}
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	setting.ConnectDB(cfg.Database)
+
+	result, err := repo.VerifyAudit(context.Background())
+	if err != nil {
+		log.Fatal("ERROR: Failed to read audit log: ", err)
+	}
+
+	if result.Problem != "" {
+		if result.BrokenAt != 0 {
+			fmt.Printf("FAILED at entry %d: %s\n", result.BrokenAt, result.Problem)
+		} else {
+			fmt.Printf("FAILED: %s\n", result.Problem)
+		}
+		fmt.Printf("%d entries checked\n", result.Checked)
+		os.Exit(1)
+	}
+	fmt.Printf("OK: %d entries, hash chain intact\n", result.Checked)
+}
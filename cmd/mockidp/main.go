@@ -0,0 +1,46 @@
+// Command mockidp is a minimal OpenID Connect provider for trying single sign-on locally
+// Never use it in production: anyone can log in as anyone
+//
+//	go run ./cmd/mockidp [-addr :9000] [-email admin@example.com] [-claims '{"department":"IT"}'] [-auto]
+//
+// Then start the server with OIDC_ENABLED=true OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=siro.
+// The login page lets you choose the identity; with -auto it signs in the flag identity right away.
+// The provider itself is pkg/oidc/oidctest, which the tests use too
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"siro-backend/pkg/oidc/oidctest"
+)
+
+func main() {
+	addr := flag.String("addr", ":9000", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "issuer URL (must match OIDC_ISSUER)")
+	clientID := flag.String("client-id", "siro", "accepted client_id")
+	clientSecret := flag.String("client-secret", "", "required client secret (empty = public client)")
+	sub := flag.String("sub", "mock-user-1", "default subject")
+	email := flag.String("email", "admin@example.com", "default email")
+	name := flag.String("name", "Mock User", "default name")
+	claims := flag.String("claims", "{}", `extra ID token claims as JSON, e.g. {"department":"IT","groups":["siro-admins"]}; {"email_verified":null} leaves it out`)
+	auto := flag.Bool("auto", false, "skip the login page and sign in the default identity")
+	flag.Parse()
+
+	var extra map[string]interface{}
+	if err := json.Unmarshal([]byte(*claims), &extra); err != nil {
+		log.Fatal("ERROR: -claims must be a JSON object: ", err)
+	}
+
+	p, err := oidctest.New(*issuer, *clientID, *clientSecret)
+	if err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	p.Auto = *auto
+	p.Identity = oidctest.Identity{Subject: *sub, Email: *email, Name: *name, Claims: extra}
+	p.Logf = log.Printf
+
+	log.Printf("mock identity provider on %s (issuer %s, client_id %s)", *addr, p.Issuer, p.ClientID)
+	log.Fatal(http.ListenAndServe(*addr, p.Handler()))
+}
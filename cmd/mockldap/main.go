@@ -0,0 +1,43 @@
+// Command mockldap is a minimal in-process LDAP server for trying the LDAP login backend locally
+// It speaks just enough LDAPv3 for it: simple bind, search and unbind, without TLS
+//
+//	go run ./cmd/mockldap [-addr :3389] [-data directory.json]
+//
+// Then start the server with AUTH_BACKENDS=ldap,bcrypt LDAP_URL=ldap://localhost:3389
+// LDAP_BASE_DN=dc=example,dc=com LDAP_BIND_DN=cn=siro,ou=Services,dc=example,dc=com LDAP_BIND_PASSWORD=siro
+// and log in as alice@example.com / alice (member of siro-admins) or bob@example.com / bob.
+// The server itself is internal/auth/ldaptest, which the tests use too
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net"
+	"os"
+	"siro-backend/internal/auth/ldaptest"
+)
+
+func main() {
+	addr := flag.String("addr", ":3389", "listen address")
+	data := flag.String("data", "", "JSON file with the directory ([{dn, password, attributes}]), default is a small sample")
+	flag.Parse()
+
+	s := &ldaptest.Server{Entries: ldaptest.Sample, Logf: log.Printf}
+	if *data != "" {
+		b, err := os.ReadFile(*data)
+		if err != nil {
+			log.Fatal("ERROR: ", err)
+		}
+		if err := json.Unmarshal(b, &s.Entries); err != nil {
+			log.Fatal("ERROR: -data must be a JSON array of entries: ", err)
+		}
+	}
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	log.Printf("mock LDAP server on %s with %d entries", ln.Addr(), len(s.Entries))
+	log.Fatal("ERROR: ", s.Serve(ln))
+}
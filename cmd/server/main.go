@@ -1,15 +1,30 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"log"
+	"log/slog"
+	"net/http"
 	"os"
+	"os/signal"
+	"siro-backend/internal/controller"
 	"siro-backend/internal/initialize"
+	"siro-backend/internal/middlewares"
 	"siro-backend/internal/routers"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/logger"
+	"siro-backend/pkg/setting"
+	"siro-backend/pkg/tracing"
+	"siro-backend/pkg/worker"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 )
 
 func main() {
@@ -18,17 +33,41 @@ func main() {
 		log.Println("Info: .env file not found, using system environment variables")
 	}
 
+	// Load and validate config (defaults < config file < env < flags)
+	cfg, err := config.Load(os.Args[1:])
+	if err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+
+	// Structured JSON logging (request_id / user_id are added from the request context)
+	logger.Init(cfg.Log)
+
+	// OpenTelemetry tracing (no-op unless TRACING_EXPORTER is set)
+	shutdownTracing, err := tracing.Init(context.Background(), cfg.Tracing)
+	if err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+
 	// Initialize database and JWT
-	initialize.Initialize()
+	initialize.Initialize(cfg)
 
 	// Create router
-	r := gin.Default()
-
-	// Get frontend URL from env (for CORS)
-	frontendURL := os.Getenv("FRONTEND_URL")
-	if frontendURL == "" {
-		frontendURL = "http://localhost:3000"
+	// gin.New instead of gin.Default: our own access log replaces gin's text logger
+	r := gin.New()
+	// Only these proxies may set the client address (X-Forwarded-For); by default nobody can
+	if err := r.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatal("ERROR: ", err)
 	}
+	r.Use(middlewares.RequestID())
+	r.Use(otelgin.Middleware(cfg.Tracing.ServiceName, otelgin.WithGinFilter(shouldTrace)))
+	r.Use(middlewares.AccessLog())
+	if cfg.Metrics.Enabled {
+		r.Use(middlewares.HTTPMetrics())
+	}
+	r.Use(gin.Recovery()) // Innermost, so panics still show up as 500 in logs and metrics
+
+	// Frontend URL (for CORS)
+	frontendURL := cfg.Server.FrontendURL
 
 	// CORS
 	corsConfig := cors.Config{
@@ -36,45 +75,81 @@ func main() {
 			return origin == frontendURL || origin == "http://localhost:3000"
 		},
 		AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "If-Match", middlewares.APIKeyHeader, middlewares.RequestIDHeader},
+		ExposeHeaders:    []string{"Content-Length", "ETag", "Deprecation", "Link", middlewares.RequestIDHeader},
 		AllowCredentials: true,
 		MaxAge:           12 * 3600, // Cache preflight requests for 12 hours
 	}
 	r.Use(cors.New(corsConfig))
 
 	// Setup all routes
-	routers.SetupRoutes(r)
+	routers.SetupRoutes(r, cfg)
+
+	// Server host and port
+	// Change SERVER_HOST to 0.0.0.0 in .env if you need network access
+	address := cfg.Server.Address()
+
+	// Show startup message
+	slog.Info("server running",
+		"address", address,
+		"frontend_url", frontendURL,
+		"network_access", cfg.Server.Host != "localhost",
+	)
 
-	// Get port from env
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "8080"
+	// Start server in the background so we can listen for shutdown signals
+	srv := &http.Server{
+		Addr:              address,
+		Handler:           r,
+		ReadHeaderTimeout: 10 * time.Second,
 	}
+	go func() {
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("Server failed to start: ", err)
+		}
+	}()
 
-	// Get server host from environment
-	// Change to 0.0.0.0 in .env if you need network access
-	host := os.Getenv("SERVER_HOST")
-	if host == "" {
-		host = "localhost"
+	// Wait for Ctrl+C or SIGTERM (sent by Docker/systemd on deploy)
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	<-ctx.Done()
+	stop()
+
+	shutdown(srv, shutdownTracing, cfg.Server.ShutdownTimeout.Duration)
+}
+
+// shouldTrace keeps health checks, metric scrapes and static files out of the traces
+func shouldTrace(c *gin.Context) bool {
+	path := c.Request.URL.Path
+	return !(path == "/healthz" || path == "/readyz" || path == "/metrics" || strings.HasPrefix(path, "/uploads/"))
+}
+
+// shutdown drains in-flight requests and background jobs within the timeout, then closes the DB
+func shutdown(srv *http.Server, shutdownTracing func(context.Context) error, timeout time.Duration) {
+	slog.Info("shutting down", "timeout", timeout.String())
+	controller.MarkShuttingDown()
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// 1. Stop accepting new connections and wait for active requests
+	if err := srv.Shutdown(ctx); err != nil {
+		slog.Error("http server did not shut down cleanly", "error", err)
 	}
 
-	// Create address string
-	address := fmt.Sprintf("%s:%s", host, port)
+	// 2. Wait for background jobs (activity logs, ...) started by those requests
+	if err := worker.Wait(ctx); err != nil {
+		slog.Error("background jobs did not finish in time", "error", err)
+	}
 
-	// Show startup message
-	if host == "localhost" {
-		fmt.Printf("Server running on http://localhost:%s\n", port)
-		fmt.Printf("Frontend URL: %s\n", frontendURL)
-		fmt.Printf("(Only accessible from this computer)\n")
-	} else {
-		fmt.Printf("Server running on %s\n", address)
-		fmt.Printf("Frontend URL: %s\n", frontendURL)
-		fmt.Printf("(Accessible from network)\n")
+	// 3. Close the database pool last, background jobs may still use it
+	if err := setting.DB.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
 	}
 
-	// Start server
-	if err := r.Run(address); err != nil {
-		log.Fatal("Server failed to start: ", err)
+	// 4. Flush remaining trace spans
+	if err := shutdownTracing(ctx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
 	}
+
+	slog.Info("server stopped")
 }
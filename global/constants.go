@@ -25,4 +25,12 @@ const (
 	DirUploads   = "uploads"
 	DirAvatar    = "avatar"
 	DirWorkOrder = "workorder"
+
+	// API key scopes (service accounts)
+	ScopeWorkOrdersRead   = "workorders:read"
+	ScopeWorkOrdersCreate = "workorders:create"
+	ScopeUnitsRead        = "units:read"
+
+	// Base path of the current API version
+	APIPrefix = "/api/v1"
 )
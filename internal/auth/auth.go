@@ -0,0 +1,94 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/config"
+	"strings"
+)
+
+// Backend names, as used in auth.backends (AUTH_BACKENDS)
+const (
+	BackendBcrypt = "bcrypt"
+	BackendLDAP   = "ldap"
+)
+
+// ErrInvalidCredentials is returned when the login or password is wrong,
+// or when the backend knows the person but there is no (and can't be a) local user
+var ErrInvalidCredentials = errors.New("invalid credentials")
+
+// Authenticator checks a login and password and returns the local user
+// Errors other than ErrInvalidCredentials mean the backend could not decide (e.g. LDAP is down)
+type Authenticator interface {
+	Name() string
+	Authenticate(ctx context.Context, login, password string) (*Result, error)
+}
+
+// Result is a successful login
+type Result struct {
+	User     *models.User
+	Backend  string       // name of the authenticator that accepted the password
+	Created  bool         // the user was created by this login (auto-provisioning)
+	Previous *models.User // the user before attributes were synced from the directory, nil if nothing changed
+}
+
+// Chain tries each authenticator in order until one accepts the password
+type Chain []Authenticator
+
+// Name returns the backend names joined with commas
+func (ch Chain) Name() string {
+	names := make([]string, len(ch))
+	for i, a := range ch {
+		names[i] = a.Name()
+	}
+	return strings.Join(names, ",")
+}
+
+// Authenticate returns the first success; if no backend accepts the password
+// and one of them failed, its error is returned instead of ErrInvalidCredentials
+func (ch Chain) Authenticate(ctx context.Context, login, password string) (*Result, error) {
+	var failed error
+	for _, a := range ch {
+		res, err := a.Authenticate(ctx, login, password)
+		if err == nil {
+			return res, nil
+		}
+		if !errors.Is(err, ErrInvalidCredentials) {
+			slog.ErrorContext(ctx, "login backend failed", "backend", a.Name(), "error", err)
+			failed = err
+		}
+	}
+	if failed != nil {
+		return nil, failed
+	}
+	return nil, ErrInvalidCredentials
+}
+
+// current is the authenticator used by Authenticate, set by Init
+var current Authenticator = Chain{Bcrypt{}}
+
+// Init builds the authenticator chain from auth.backends
+func Init(cfg config.AuthConfig, ldapCfg config.LDAPConfig) {
+	var ch Chain
+	for _, name := range cfg.Backends {
+		switch name {
+		case BackendBcrypt:
+			ch = append(ch, Bcrypt{})
+		case BackendLDAP:
+			ch = append(ch, NewLDAP(ldapCfg))
+		}
+	}
+	Set(ch)
+}
+
+// Set replaces the authenticator (e.g. a stub in tests)
+func Set(a Authenticator) {
+	current = a
+}
+
+// Authenticate checks a login and password with the configured backends
+func Authenticate(ctx context.Context, login, password string) (*Result, error) {
+	return current.Authenticate(ctx, login, password)
+}
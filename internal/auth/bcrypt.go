@@ -0,0 +1,31 @@
+package auth
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/utils"
+)
+
+// Bcrypt checks the password against users.password_hash
+type Bcrypt struct{}
+
+// Name returns "bcrypt"
+func (Bcrypt) Name() string { return BackendBcrypt }
+
+// Authenticate looks the user up by email and verifies the password hash
+// Users without a password (invited, SSO or LDAP only) never match
+func (Bcrypt) Authenticate(ctx context.Context, login, password string) (*Result, error) {
+	user, err := repo.GetUserByEmail(ctx, login)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, err
+	}
+	if user.PasswordHash == "" || utils.VerifyPassword(user.PasswordHash, password) != nil {
+		return nil, ErrInvalidCredentials
+	}
+	return &Result{User: user, Backend: BackendBcrypt}, nil
+}
@@ -0,0 +1,295 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/utils"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// LDAP checks passwords by binding to LDAP / Active Directory as the user
+// The local user is found by the email attribute of the user's entry
+type LDAP struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAP returns an LDAP authenticator; the server is contacted on every login
+func NewLDAP(cfg config.LDAPConfig) *LDAP {
+	return &LDAP{cfg: cfg}
+}
+
+// Name returns "ldap"
+func (l *LDAP) Name() string { return BackendLDAP }
+
+// profile is what the directory says about a user
+type profile struct {
+	Email, Name, Phone string
+	Role, Unit         string // empty when no mapping applies
+}
+
+// Authenticate finds the user's entry with the service account, binds as the user
+// and then returns, creates or updates the local user
+func (l *LDAP) Authenticate(ctx context.Context, login, password string) (*Result, error) {
+	// An empty password would be an unauthenticated bind, which many servers accept
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := l.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if l.cfg.BindDN != "" {
+		if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("ldap service bind: %w", err)
+		}
+	}
+
+	entry, err := l.findEntry(ctx, conn, login)
+	if err != nil {
+		return nil, err
+	}
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("ldap user bind: %w", err)
+	}
+
+	p, err := l.profile(ctx, entry, login)
+	if err != nil {
+		return nil, err
+	}
+	return l.localUser(ctx, p)
+}
+
+func (l *LDAP) dial() (*ldap.Conn, error) {
+	u, err := url.Parse(l.cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname(), InsecureSkipVerify: l.cfg.InsecureSkipVerify}
+
+	conn, err := ldap.DialURL(l.cfg.URL,
+		ldap.DialWithDialer(&net.Dialer{Timeout: l.cfg.Timeout.Duration}),
+		ldap.DialWithTLSConfig(tlsConfig))
+	if err != nil {
+		return nil, fmt.Errorf("ldap connect: %w", err)
+	}
+	conn.SetTimeout(l.cfg.Timeout.Duration)
+	if l.cfg.StartTLS {
+		if err := conn.StartTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("ldap starttls: %w", err)
+		}
+	}
+	return conn, nil
+}
+
+// findEntry searches the user; no match or more than one match is ErrInvalidCredentials
+func (l *LDAP) findEntry(ctx context.Context, conn *ldap.Conn, login string) (*ldap.Entry, error) {
+	var attrs []string
+	for _, a := range []string{l.cfg.EmailAttribute, l.cfg.NameAttribute, l.cfg.PhoneAttribute, l.cfg.GroupAttribute} {
+		if a != "" {
+			attrs = append(attrs, a)
+		}
+	}
+	filter := strings.ReplaceAll(l.cfg.UserFilter, "{login}", ldap.EscapeFilter(login))
+
+	res, err := conn.Search(ldap.NewSearchRequest(l.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(l.cfg.Timeout.Seconds()), false, filter, attrs, nil))
+	if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) || (err == nil && len(res.Entries) > 1) {
+		slog.WarnContext(ctx, "ldap login matches more than one entry", "filter", filter)
+		return nil, ErrInvalidCredentials
+	}
+	if err != nil {
+		return nil, fmt.Errorf("ldap search: %w", err)
+	}
+	if len(res.Entries) == 0 {
+		return nil, ErrInvalidCredentials
+	}
+	return res.Entries[0], nil
+}
+
+// profile reads the attributes and maps groups to a role and OUs to a unit
+func (l *LDAP) profile(ctx context.Context, entry *ldap.Entry, login string) (profile, error) {
+	p := profile{
+		Email: strings.TrimSpace(entry.GetAttributeValue(l.cfg.EmailAttribute)),
+		Name:  strings.TrimSpace(entry.GetAttributeValue(l.cfg.NameAttribute)),
+		Phone: strings.TrimSpace(entry.GetAttributeValue(l.cfg.PhoneAttribute)),
+	}
+	if p.Email == "" && strings.Contains(login, "@") {
+		p.Email = login
+	}
+
+	if len(l.cfg.GroupRoles) > 0 {
+		p.Role = global.RoleStaff
+		for _, group := range entry.GetAttributeValues(l.cfg.GroupAttribute) {
+			if l.groupRole(group) == global.RoleAdmin {
+				p.Role = global.RoleAdmin
+				break
+			}
+		}
+	}
+
+	units, err := repo.GetUnits(ctx)
+	if err != nil {
+		return p, err
+	}
+	p.Unit = l.ouUnit(entry.DN, units)
+	return p, nil
+}
+
+// groupRole returns the role of a group DN (compared case-insensitively), or "" if it isn't mapped
+func (l *LDAP) groupRole(group string) string {
+	dn, err := ldap.ParseDN(group)
+	if err != nil {
+		return ""
+	}
+	for mapped, role := range l.cfg.GroupRoles {
+		if m, err := ldap.ParseDN(mapped); err == nil && m.EqualFold(dn) {
+			return role
+		}
+	}
+	return ""
+}
+
+// ouUnit returns the unit for the most specific OU of the user's DN that maps to one
+// Without ou_units an OU named like a unit (ignoring case) is that unit; default_unit is the fallback
+func (l *LDAP) ouUnit(userDN string, units []models.Unit) string {
+	unitName := func(name string) string {
+		for _, u := range units {
+			if strings.EqualFold(u.Name, name) {
+				return u.Name
+			}
+		}
+		return ""
+	}
+
+	if dn, err := ldap.ParseDN(userDN); err == nil {
+		for _, rdn := range dn.RDNs {
+			for _, attr := range rdn.Attributes {
+				if !strings.EqualFold(attr.Type, "ou") {
+					continue
+				}
+				if len(l.cfg.OUUnits) == 0 {
+					if unit := unitName(attr.Value); unit != "" {
+						return unit
+					}
+					continue
+				}
+				for ou, unit := range l.cfg.OUUnits {
+					if strings.EqualFold(ou, attr.Value) {
+						return unitName(unit)
+					}
+				}
+			}
+		}
+	}
+	return unitName(l.cfg.DefaultUnit)
+}
+
+// localUser returns the local user with the entry's email, creating it (auto_provision)
+// or copying the directory attributes into it (sync_attributes) if configured
+func (l *LDAP) localUser(ctx context.Context, p profile) (*Result, error) {
+	if p.Email == "" {
+		slog.WarnContext(ctx, "ldap entry has no email", "attribute", l.cfg.EmailAttribute)
+		return nil, ErrInvalidCredentials
+	}
+
+	found, err := repo.GetUserByEmail(ctx, p.Email)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !l.cfg.AutoProvision {
+			slog.InfoContext(ctx, "ldap login without local user", "email", p.Email)
+			return nil, ErrInvalidCredentials
+		}
+		return l.provision(ctx, p)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// GetUserByID has every column UpdateUser writes
+	user, err := repo.GetUserByID(ctx, found.ID)
+	if err != nil {
+		return nil, err
+	}
+	res := &Result{User: user, Backend: BackendLDAP}
+	if !l.cfg.SyncAttributes || user.DeactivatedAt != nil {
+		return res, nil
+	}
+
+	req := models.UserRequest{Name: user.Name, Email: user.Email, Role: user.Role, Unit: user.Unit, Phone: p.Phone}
+	if p.Name != "" {
+		req.Name = p.Name
+	}
+	if p.Role != "" {
+		req.Role = p.Role
+	}
+	if p.Unit != "" {
+		req.Unit = p.Unit
+	}
+	if req.Name == user.Name && req.Phone == user.Phone && req.Role == user.Role && req.Unit == user.Unit {
+		return res, nil
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		slog.WarnContext(ctx, "ldap attributes not synced", "user_id", user.ID, "error", err)
+		return res, nil
+	}
+
+	previous := *user
+	user.Name, user.Phone, user.Role, user.Unit = req.Name, req.Phone, req.Role, req.Unit
+	if err := repo.UpdateUser(ctx, user.ID, *user); err != nil {
+		// Not worth failing the login for; the next login tries again
+		slog.WarnContext(ctx, "ldap attributes not synced", "user_id", user.ID, "error", err)
+		return &Result{User: &previous, Backend: BackendLDAP}, nil
+	}
+	user.Version++
+	res.Previous = &previous
+	return res, nil
+}
+
+// provision creates the local user for a directory entry (Staff unless a group says otherwise)
+func (l *LDAP) provision(ctx context.Context, p profile) (*Result, error) {
+	req := models.UserRequest{Name: p.Name, Email: p.Email, Role: p.Role, Unit: p.Unit, Phone: p.Phone}
+	if req.Name == "" {
+		req.Name = p.Email
+	}
+	if req.Role == "" {
+		req.Role = global.RoleStaff
+	}
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		// Usually no unit: no OU maps to one and there is no default_unit
+		slog.WarnContext(ctx, "ldap user can't be provisioned", "email", p.Email, "error", err)
+		return nil, ErrInvalidCredentials
+	}
+
+	user := &models.User{
+		Name:         req.Name,
+		Email:        req.Email,
+		Role:         req.Role,
+		Unit:         req.Unit,
+		Phone:        req.Phone,
+		Availability: global.AvailOffline,
+		AvatarURL:    fmt.Sprintf("%s/%s/default-avatar.jpg", utils.GetBaseURL(), global.DirUploads),
+	}
+	if err := repo.CreateUser(ctx, user); err != nil {
+		return nil, err
+	}
+	return &Result{User: user, Backend: BackendLDAP, Created: true}, nil
+}
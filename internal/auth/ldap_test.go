@@ -0,0 +1,211 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net"
+	"siro-backend/global"
+	"siro-backend/internal/auth/ldaptest"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// startLDAP runs the mock directory and returns a config pointing at it
+func startLDAP(t *testing.T, entries []ldaptest.Entry) config.LDAPConfig {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+	go (&ldaptest.Server{Entries: entries}).Serve(ln)
+
+	cfg := config.Default().LDAP
+	cfg.URL = "ldap://" + ln.Addr().String()
+	cfg.BaseDN = "dc=example,dc=com"
+	cfg.BindDN = "cn=siro,ou=Services,dc=example,dc=com"
+	cfg.BindPassword = "siro"
+	return cfg
+}
+
+// serviceConn connects and binds as the service account, like Authenticate does
+func serviceConn(t *testing.T, l *LDAP) *ldap.Conn {
+	t.Helper()
+	conn, err := l.dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := conn.Bind(l.cfg.BindDN, l.cfg.BindPassword); err != nil {
+		t.Fatal(err)
+	}
+	return conn
+}
+
+func TestFindEntry(t *testing.T) {
+	// A second entry with bob's email, so logging in as bob@example.com is ambiguous
+	entries := append([]ldaptest.Entry{}, ldaptest.Sample...)
+	entries = append(entries, ldaptest.Entry{DN: "uid=bob2,ou=IT,ou=People,dc=example,dc=com", Password: "bob2",
+		Attributes: map[string][]string{"uid": {"bob2"}, "mail": {"bob@example.com"}}})
+	l := NewLDAP(startLDAP(t, entries))
+	conn := serviceConn(t, l)
+
+	tests := []struct {
+		login string
+		dn    string // "" = ErrInvalidCredentials
+	}{
+		{"alice@example.com", "uid=alice,ou=IT,ou=People,dc=example,dc=com"},
+		{"ALICE", "uid=alice,ou=IT,ou=People,dc=example,dc=com"}, // uid, case-insensitive
+		{"nobody@example.com", ""},
+		{"bob@example.com", ""}, // two matches
+
+		// The login is escaped, so filter syntax in it matches nothing
+		{"*", ""},
+		{"alice*", ""},
+		{"*@example.com", ""},
+		{"alice@example.com)(uid=*", ""},
+		{"x)(|(uid=alice)", ""},
+		{`alice\2a`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.login, func(t *testing.T) {
+			entry, err := l.findEntry(context.Background(), conn, tt.login)
+			if tt.dn == "" {
+				if !errors.Is(err, ErrInvalidCredentials) {
+					t.Errorf("findEntry = %v, %v; want ErrInvalidCredentials", entry, err)
+				}
+				return
+			}
+			if err != nil || entry.DN != tt.dn {
+				t.Fatalf("findEntry = %v, %v; want %s", entry, err, tt.dn)
+			}
+			if got := entry.GetAttributeValue("mail"); got != "alice@example.com" {
+				t.Errorf("mail = %q", got)
+			}
+		})
+	}
+}
+
+func TestAuthenticateFailedBind(t *testing.T) {
+	cfg := startLDAP(t, ldaptest.Sample)
+
+	tests := []struct {
+		name         string
+		change       func(*config.LDAPConfig)
+		login, pass  string
+		invalidCreds bool // ErrInvalidCredentials; otherwise another error (the backend could not decide)
+	}{
+		{"wrong password", nil, "alice@example.com", "wrong", true},
+		{"empty password", nil, "alice@example.com", "", true},
+		{"unknown user", nil, "carol@example.com", "carol", true},
+		{"entry without password", nil, "siro-admins", "x", true},
+		{"service bind fails", func(c *config.LDAPConfig) { c.BindPassword = "wrong" }, "alice@example.com", "alice", false},
+		{"server down", func(c *config.LDAPConfig) { c.URL = "ldap://127.0.0.1:1" }, "alice@example.com", "alice", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := cfg
+			c.UserFilter = "(|(mail={login})(cn={login}))"
+			if tt.change != nil {
+				tt.change(&c)
+			}
+			res, err := NewLDAP(c).Authenticate(context.Background(), tt.login, tt.pass)
+			if res != nil || err == nil {
+				t.Fatalf("Authenticate = %v, %v; want an error", res, err)
+			}
+			if errors.Is(err, ErrInvalidCredentials) != tt.invalidCreds {
+				t.Errorf("Authenticate error = %v, want ErrInvalidCredentials: %v", err, tt.invalidCreds)
+			}
+		})
+	}
+}
+
+func TestGroupRole(t *testing.T) {
+	l := NewLDAP(config.LDAPConfig{GroupRoles: map[string]string{
+		"cn=siro-admins,ou=Groups,dc=example,dc=com": global.RoleAdmin,
+		"CN=Helpdesk,OU=Groups,DC=example,DC=com":    global.RoleStaff,
+	}})
+
+	tests := []struct {
+		group, want string
+	}{
+		{"cn=siro-admins,ou=Groups,dc=example,dc=com", global.RoleAdmin},
+		{"CN=SIRO-Admins, OU=Groups, DC=Example, DC=com", global.RoleAdmin}, // case and spaces don't matter
+		{"cn=helpdesk,ou=groups,dc=example,dc=com", global.RoleStaff},
+		{"cn=siro-admins,ou=Other,dc=example,dc=com", ""},
+		{"cn=siro-admins", ""},
+		{"not a dn", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := l.groupRole(tt.group); got != tt.want {
+			t.Errorf("groupRole(%q) = %q, want %q", tt.group, got, tt.want)
+		}
+	}
+}
+
+func TestOUUnit(t *testing.T) {
+	units := []models.Unit{{Name: "IT"}, {Name: "Finance"}, {Name: "Facilities"}}
+	const alice = "uid=alice,ou=it,ou=People,dc=example,dc=com"
+
+	tests := []struct {
+		name string
+		cfg  config.LDAPConfig
+		dn   string
+		want string
+	}{
+		{"ou named like a unit", config.LDAPConfig{}, alice, "IT"},
+		{"most specific ou wins", config.LDAPConfig{}, "uid=x,ou=Finance,ou=IT,dc=example,dc=com", "Finance"},
+		{"no matching ou", config.LDAPConfig{}, "uid=x,ou=Sales,dc=example,dc=com", ""},
+		{"default unit", config.LDAPConfig{DefaultUnit: "facilities"}, "uid=x,ou=Sales,dc=example,dc=com", "Facilities"},
+		{"unknown default unit", config.LDAPConfig{DefaultUnit: "Sales"}, "uid=x,dc=example,dc=com", ""},
+		{"ou_units mapping", config.LDAPConfig{OUUnits: map[string]string{"people": "Facilities"}}, alice, "Facilities"},
+		// With ou_units, OUs are not matched by name any more
+		{"ou_units ignores names", config.LDAPConfig{OUUnits: map[string]string{"Sales": "Finance"}}, alice, ""},
+		{"ou_units to unknown unit", config.LDAPConfig{OUUnits: map[string]string{"IT": "Gone"}}, alice, ""},
+		{"invalid dn", config.LDAPConfig{DefaultUnit: "IT"}, "not a dn", "IT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewLDAP(tt.cfg).ouUnit(tt.dn, units); got != tt.want {
+				t.Errorf("ouUnit(%q) = %q, want %q", tt.dn, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthenticate(t *testing.T) {
+	mock := testutil.MockDB(t)
+
+	cfg := startLDAP(t, ldaptest.Sample)
+	cfg.GroupRoles = map[string]string{"cn=siro-admins,ou=Groups,dc=example,dc=com": global.RoleAdmin}
+
+	mock.ExpectQuery("FROM units").WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).
+		AddRow(1, "IT", time.Now()))
+	mock.ExpectQuery("FROM users WHERE email").WithArgs("alice@example.com").WillReturnRows(sqlmock.NewRows([]string{
+		"id", "name", "email", "password_hash", "role", "unit", "availability", "can_crud", "avatar_url", "version",
+		"deactivated_at", "anonymized_at", "must_change_password", "invited", "service_account",
+	}).AddRow(3, "Alice", "alice@example.com", "", "Staff", "IT", "Online", true, "", 1, nil, nil, false, false, false))
+	mock.ExpectQuery("FROM users WHERE id").WithArgs(3).WillReturnRows(sqlmock.NewRows([]string{
+		"id", "name", "email", "role", "unit", "phone", "avatar_url", "availability", "can_crud", "version",
+		"deactivated_at", "anonymized_at", "must_change_password", "invited", "external_id", "service_account", "created_at", "updated_at",
+	}).AddRow(3, "Alice", "alice@example.com", "Staff", "IT", "", "", "Online", true, 1, nil, nil, false, false, "", false, time.Now(), time.Now()))
+
+	res, err := NewLDAP(cfg).Authenticate(context.Background(), "alice@example.com", "alice")
+	if err != nil {
+		t.Fatalf("Authenticate: %v", err)
+	}
+	// sync_attributes is off, so the directory's role and name are not copied
+	if res.User.ID != 3 || res.Backend != BackendLDAP || res.Created || res.Previous != nil || res.User.Role != global.RoleStaff {
+		t.Errorf("Authenticate = %+v, user %+v", res, res.User)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Error(err)
+	}
+}
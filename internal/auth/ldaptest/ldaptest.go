@@ -0,0 +1,358 @@
+// Package ldaptest is a minimal in-process LDAP server for tests and for trying the LDAP login
+// backend locally (cmd/mockldap). It speaks just enough LDAPv3 for it: simple bind, search and
+// unbind, without TLS.
+//
+//	ln, _ := net.Listen("tcp", "127.0.0.1:0")
+//	go (&ldaptest.Server{Entries: ldaptest.Sample}).Serve(ln)
+//	// LDAP_URL=ldap://<ln.Addr()>
+package ldaptest
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+)
+
+// Entry is one directory object; a password makes it possible to bind as it
+type Entry struct {
+	DN         string              `json:"dn"`
+	Password   string              `json:"password,omitempty"`
+	Attributes map[string][]string `json:"attributes"`
+}
+
+// Sample is a small directory: the service account cn=siro (password siro), alice (alice,
+// in ou=IT and member of siro-admins) and bob (bob, in ou=Finance), all under dc=example,dc=com
+var Sample = []Entry{
+	{DN: "cn=siro,ou=Services,dc=example,dc=com", Password: "siro", Attributes: map[string][]string{
+		"objectClass": {"person"}, "cn": {"siro"},
+	}},
+	{DN: "cn=siro-admins,ou=Groups,dc=example,dc=com", Attributes: map[string][]string{
+		"objectClass": {"groupOfNames"}, "cn": {"siro-admins"},
+		"member": {"uid=alice,ou=IT,ou=People,dc=example,dc=com"},
+	}},
+	{DN: "uid=alice,ou=IT,ou=People,dc=example,dc=com", Password: "alice", Attributes: map[string][]string{
+		"objectClass": {"inetOrgPerson"}, "uid": {"alice"}, "cn": {"Alice"},
+		"mail": {"alice@example.com"}, "displayName": {"Alice Admin"}, "telephoneNumber": {"081234567890"},
+		"memberOf": {"cn=siro-admins,ou=Groups,dc=example,dc=com"},
+	}},
+	{DN: "uid=bob,ou=Finance,ou=People,dc=example,dc=com", Password: "bob", Attributes: map[string][]string{
+		"objectClass": {"inetOrgPerson"}, "uid": {"bob"}, "cn": {"Bob"},
+		"mail": {"bob@example.com"}, "displayName": {"Bob Staff"},
+	}},
+}
+
+// LDAP operation tags (RFC 4511) and result codes used here
+const (
+	opBindRequest       = 0
+	opBindResponse      = 1
+	opUnbindRequest     = 2
+	opSearchRequest     = 3
+	opSearchResultEntry = 4
+	opSearchResultDone  = 5
+	opExtendedRequest   = 23
+	opExtendedResponse  = 24
+
+	resultSuccess            = 0
+	resultOperationsError    = 1
+	resultProtocolError      = 2
+	resultNoSuchObject       = 32
+	resultInvalidCredentials = 49
+)
+
+// Server is the LDAP server; Entries may be changed between connections
+type Server struct {
+	Entries []Entry
+	Logf    func(format string, args ...interface{}) // optional, e.g. log.Printf
+}
+
+// Serve accepts connections on ln until it is closed
+func (s *Server) Serve(ln net.Listener) error {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go s.serve(conn)
+	}
+}
+
+func (s *Server) logf(format string, args ...interface{}) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
+
+// serve handles the requests of one connection in order
+func (s *Server) serve(conn net.Conn) {
+	defer conn.Close()
+	boundDN := ""
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				s.logf("read: %v", err)
+			}
+			return
+		}
+		if len(packet.Children) < 2 {
+			return
+		}
+		id, _ := packet.Children[0].Value.(int64)
+		op := packet.Children[1]
+
+		switch op.Tag {
+		case opBindRequest:
+			code, dn := s.bind(op)
+			if code == resultSuccess {
+				boundDN = dn
+			}
+			write(conn, id, result(opBindResponse, code))
+		case opSearchRequest:
+			s.search(conn, id, op, boundDN)
+		case opUnbindRequest:
+			return
+		case opExtendedRequest:
+			// StartTLS and the rest are not supported
+			write(conn, id, result(opExtendedResponse, resultProtocolError))
+		default:
+			s.logf("unsupported operation %d", op.Tag)
+			return
+		}
+	}
+}
+
+// bind checks a simple bind; an empty DN is an anonymous bind
+func (s *Server) bind(op *ber.Packet) (int, string) {
+	if len(op.Children) < 3 || op.Children[2].Tag != 0 {
+		return resultProtocolError, ""
+	}
+	dn := stringValue(op.Children[1])
+	password := op.Children[2].Data.String()
+	if dn == "" && password == "" {
+		return resultSuccess, ""
+	}
+	if e := s.find(dn); e != nil && e.Password != "" && e.Password == password {
+		s.logf("bind %s", dn)
+		return resultSuccess, e.DN
+	}
+	s.logf("bind %s: invalid credentials", dn)
+	return resultInvalidCredentials, ""
+}
+
+// search sends the matching entries under the base DN (anonymous binds see nothing)
+func (s *Server) search(conn net.Conn, id int64, op *ber.Packet, boundDN string) {
+	if len(op.Children) < 8 {
+		write(conn, id, result(opSearchResultDone, resultProtocolError))
+		return
+	}
+	base, err := ldap.ParseDN(stringValue(op.Children[0]))
+	if err != nil {
+		write(conn, id, result(opSearchResultDone, resultNoSuchObject))
+		return
+	}
+	scope, _ := op.Children[1].Value.(int64)
+	sizeLimit, _ := op.Children[3].Value.(int64)
+	filter := op.Children[6]
+	var attrs []string
+	for _, a := range op.Children[7].Children {
+		attrs = append(attrs, stringValue(a))
+	}
+
+	if boundDN == "" {
+		write(conn, id, result(opSearchResultDone, resultOperationsError))
+		return
+	}
+
+	sent := 0
+	for i := range s.Entries {
+		e := &s.Entries[i]
+		dn, err := ldap.ParseDN(e.DN)
+		if err != nil || !inScope(base, dn, scope) || !matches(e, filter) {
+			continue
+		}
+		if sizeLimit > 0 && int64(sent) >= sizeLimit {
+			write(conn, id, result(opSearchResultDone, ldap.LDAPResultSizeLimitExceeded))
+			return
+		}
+		write(conn, id, searchEntry(e, attrs))
+		sent++
+	}
+	s.logf("search %s %s: %d entries", base, filterString(filter), sent)
+	write(conn, id, result(opSearchResultDone, resultSuccess))
+}
+
+func (s *Server) find(dn string) *Entry {
+	want, err := ldap.ParseDN(dn)
+	if err != nil {
+		return nil
+	}
+	for i := range s.Entries {
+		if got, err := ldap.ParseDN(s.Entries[i].DN); err == nil && got.EqualFold(want) {
+			return &s.Entries[i]
+		}
+	}
+	return nil
+}
+
+// inScope reports whether dn is within base for scope 0 (base), 1 (one level) or 2 (subtree)
+func inScope(base, dn *ldap.DN, scope int64) bool {
+	switch scope {
+	case 0:
+		return base.EqualFold(dn)
+	case 1:
+		return base.AncestorOfFold(dn) && len(dn.RDNs) == len(base.RDNs)+1
+	default:
+		return base.EqualFold(dn) || base.AncestorOfFold(dn)
+	}
+}
+
+// matches evaluates a search filter: and, or, not, equality, substrings and present
+// Values are compared case-insensitively, like most directory attributes
+func matches(e *Entry, f *ber.Packet) bool {
+	switch f.Tag {
+	case ldap.FilterAnd:
+		for _, c := range f.Children {
+			if !matches(e, c) {
+				return false
+			}
+		}
+		return true
+	case ldap.FilterOr:
+		for _, c := range f.Children {
+			if matches(e, c) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterNot:
+		return len(f.Children) == 1 && !matches(e, f.Children[0])
+	case ldap.FilterPresent:
+		return len(values(e, f.Data.String())) > 0
+	case ldap.FilterEqualityMatch, ldap.FilterApproxMatch:
+		if len(f.Children) != 2 {
+			return false
+		}
+		want := stringValue(f.Children[1])
+		for _, v := range values(e, stringValue(f.Children[0])) {
+			if strings.EqualFold(v, want) {
+				return true
+			}
+		}
+		return false
+	case ldap.FilterSubstrings:
+		if len(f.Children) != 2 {
+			return false
+		}
+		for _, v := range values(e, stringValue(f.Children[0])) {
+			if substringsMatch(strings.ToLower(v), f.Children[1].Children) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+func substringsMatch(v string, parts []*ber.Packet) bool {
+	for _, p := range parts {
+		s := strings.ToLower(p.Data.String())
+		switch p.Tag {
+		case ldap.FilterSubstringsInitial:
+			if !strings.HasPrefix(v, s) {
+				return false
+			}
+			v = v[len(s):]
+		case ldap.FilterSubstringsAny:
+			i := strings.Index(v, s)
+			if i < 0 {
+				return false
+			}
+			v = v[i+len(s):]
+		case ldap.FilterSubstringsFinal:
+			if !strings.HasSuffix(v, s) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// values returns the values of an attribute, whose name is case-insensitive
+func values(e *Entry, attr string) []string {
+	for name, vs := range e.Attributes {
+		if strings.EqualFold(name, attr) {
+			return vs
+		}
+	}
+	return nil
+}
+
+func filterString(f *ber.Packet) string {
+	s, err := ldap.DecompileFilter(f)
+	if err != nil {
+		return "(?)"
+	}
+	return s
+}
+
+// stringValue reads an OCTET STRING, which may have been decoded as a context-specific value
+func stringValue(p *ber.Packet) string {
+	if s, ok := p.Value.(string); ok {
+		return s
+	}
+	return p.Data.String()
+}
+
+func searchEntry(e *Entry, attrs []string) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, opSearchResultEntry, nil, "SearchResultEntry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.DN, "objectName"))
+	list := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attributes")
+	for name, vs := range e.Attributes {
+		if !wanted(name, attrs) {
+			continue
+		}
+		attr := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "attribute")
+		attr.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "type"))
+		set := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "vals")
+		for _, v := range vs {
+			set.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, v, "value"))
+		}
+		attr.AppendChild(set)
+		list.AppendChild(attr)
+	}
+	op.AppendChild(list)
+	return op
+}
+
+// wanted reports whether an attribute was requested; no list or "*" means all of them
+func wanted(name string, attrs []string) bool {
+	if len(attrs) == 0 {
+		return true
+	}
+	for _, a := range attrs {
+		if a == "*" || strings.EqualFold(a, name) {
+			return true
+		}
+	}
+	return false
+}
+
+// result builds an LDAPResult-shaped response (BindResponse, SearchResultDone, ExtendedResponse)
+func result(tag ber.Tag, code int) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "LDAPResult")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "resultCode"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "matchedDN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "diagnosticMessage"))
+	return op
+}
+
+func write(conn net.Conn, id int64, op *ber.Packet) {
+	msg := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAPMessage")
+	msg.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, id, "messageID"))
+	msg.AppendChild(op)
+	_, _ = conn.Write(msg.Bytes()) // a broken connection ends at the next read
+}
@@ -1,15 +1,19 @@
 package controller
 
 import (
-	"log"
+	"errors"
+	"log/slog"
 	"net/http"
+	"siro-backend/internal/auth"
+	"siro-backend/internal/metrics"
+	"siro-backend/internal/middlewares"
 	"siro-backend/internal/models"
 	"siro-backend/internal/repo"
+	"siro-backend/pkg/response"
 	"siro-backend/pkg/utils"
 	"time"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
 // LoginHandler handles user login
@@ -18,157 +22,217 @@ func LoginHandler(c *gin.Context) {
 	// Parse login request
 	var input models.LoginRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
 		return
 	}
 
-	// Find user by email
-	user, err := repo.GetUserByEmail(input.Email)
+	// Check the password with the configured backends (bcrypt, LDAP)
+	res, err := auth.Authenticate(c.Request.Context(), input.Email, input.Password)
+	if errors.Is(err, auth.ErrInvalidCredentials) {
+		metrics.LoginFailed()
+		sendError(c, http.StatusUnauthorized, response.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
 	if err != nil {
-		sendError(c, http.StatusUnauthorized, "Invalid email or password")
+		metrics.LoginFailed()
+		sendError(c, http.StatusServiceUnavailable, response.CodeAuthUnavailable, "Login is temporarily unavailable, please try again later")
+		return
+	}
+	user := res.User
+
+	// Users created or updated from the directory are audited with the backend as the actor
+	c.Set("actorName", res.Backend)
+	if res.Created {
+		recordAudit(c, auditUserCreate, "user", user.ID, userDiff(nil, userAuditFields(*user)))
+	} else if res.Previous != nil {
+		recordAudit(c, auditUserUpdate, "user", user.ID, userDiff(userAuditFields(*res.Previous), userAuditFields(*user)))
+	}
+
+	// Checked after the password, so it doesn't reveal which emails exist
+	if user.DeactivatedAt != nil {
+		metrics.LoginFailed()
+		sendError(c, http.StatusForbidden, response.CodeUserDeactivated, "This account has been deactivated")
 		return
 	}
 
-	// Verify password
-	if err := utils.VerifyPassword(user.PasswordHash, input.Password); err != nil {
-		sendError(c, http.StatusUnauthorized, "Invalid email or password")
+	// The password is right, but a new one has to be chosen first (POST /password/change)
+	// Directory passwords are changed in the directory, so this only applies to local ones
+	if user.MustChangePassword && res.Backend == auth.BackendBcrypt {
+		metrics.LoginFailed()
+		sendError(c, http.StatusForbidden, response.CodePasswordChangeRequired, "You must choose a new password before logging in")
 		return
 	}
 
+	issueTokens(c, user)
+}
+
+// issueTokens starts a new session for the user and sends the login response
+func issueTokens(c *gin.Context, user *models.User) {
 	// Generate both tokens (access token + refresh token)
-	accessToken, refreshToken, accessExpiry, refreshExpiry, err := utils.GenerateAllTokens(user.ID, user.Role, user.CanCRUD)
+	access, refresh, err := utils.GenerateAllTokens(user.ID, user.Role, user.CanCRUD)
 	if err != nil {
-		log.Printf("Error generating tokens for user %d: %v", user.ID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to generate tokens")
+		slog.ErrorContext(c.Request.Context(), "failed to generate tokens", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to generate tokens")
 		return
 	}
 
-	// Save tokens to database (stateful JWT for logout capability)
-	err = repo.SaveToken(user.ID, accessToken, refreshToken, accessExpiry, refreshExpiry)
+	// Save the token IDs to database (stateful JWT for logout capability)
+	err = repo.SaveToken(c.Request.Context(), user.ID, access.ID, refresh.ID, access.ExpiresAt, refresh.ExpiresAt)
 	if err != nil {
-		log.Printf("Error saving tokens for user %d: %v", user.ID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to save session")
+		slog.ErrorContext(c.Request.Context(), "failed to save tokens", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to save session")
 		return
 	}
 
+	metrics.LoginSucceeded()
+
 	// Return all tokens and user info in JSON body
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode":           http.StatusOK,
-		"accessToken":          accessToken,
-		"accessTokenExpiresAt": accessExpiry.Unix(),
-		"refreshToken":         refreshToken,
+	sendFields(c, gin.H{
+		"accessToken":          access.Token,
+		"accessTokenExpiresAt": access.ExpiresAt.Unix(),
+		"refreshToken":         refresh.Token,
 		"user":                 user,
 	})
 }
 
-// RefreshHandler generates a new access token using refresh token
-// Refresh token is read from JSON body and stays unchanged
-func RefreshHandler(c *gin.Context) {
-	// Parse refresh token from request body
-	var input models.RefreshRequest
+// ChangePasswordHandler replaces the password after checking the current one and logs the user in
+// This is how a user with must_change_password gets past LoginHandler
+func ChangePasswordHandler(c *gin.Context) {
+	var input models.ChangePasswordRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Refresh token is required")
+		sendBindError(c, err)
 		return
 	}
 
-	refreshToken := input.RefreshToken
+	user, err := repo.GetUserByEmail(c.Request.Context(), input.Email)
+	if err != nil || utils.VerifyPassword(user.PasswordHash, input.CurrentPassword) != nil {
+		metrics.LoginFailed()
+		sendError(c, http.StatusUnauthorized, response.CodeInvalidCredentials, "Invalid email or password")
+		return
+	}
+	if user.DeactivatedAt != nil {
+		metrics.LoginFailed()
+		sendError(c, http.StatusForbidden, response.CodeUserDeactivated, "This account has been deactivated")
+		return
+	}
 
-	// Parse JWT token to get user ID
-	token, err := jwt.Parse(refreshToken, func(t *jwt.Token) (interface{}, error) {
-		return utils.JwtSecret, nil
-	})
+	hashedPassword, err := utils.HashPassword(input.NewPassword)
 	if err != nil {
-		sendError(c, http.StatusUnauthorized, "Invalid refresh token")
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
+		return
+	}
+	if err := repo.SetPassword(c.Request.Context(), user.ID, hashedPassword); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to change password", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to change password")
 		return
 	}
 
-	// Check if token is valid
-	if token == nil || !token.Valid {
-		sendError(c, http.StatusUnauthorized, "Invalid refresh token")
+	user.MustChangePassword = false
+	user.Version++
+	issueTokens(c, user)
+}
+
+// RefreshHandler generates a new access token using refresh token
+// Refresh token is read from JSON body and stays unchanged
+func RefreshHandler(c *gin.Context) {
+	// Parse refresh token from request body
+	var input models.RefreshRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendError(c, http.StatusBadRequest, response.CodeTokenMissing, "Refresh token is required")
 		return
 	}
 
-	// Extract claims
-	claims, ok := token.Claims.(jwt.MapClaims)
-	if !ok {
-		sendError(c, http.StatusUnauthorized, "Invalid token format")
+	refreshToken := input.RefreshToken
+
+	// Verify the JWT (signature by kid, algorithm, expiry) to get the user ID
+	claims, err := utils.ParseToken(refreshToken)
+	if err != nil {
+		sendError(c, http.StatusUnauthorized, response.CodeTokenInvalid, "Invalid refresh token")
 		return
 	}
 
 	// Get user ID from token
 	userIDFloat, ok := claims["user_id"].(float64)
 	if !ok {
-		sendError(c, http.StatusUnauthorized, "Invalid token: missing user ID")
+		sendError(c, http.StatusUnauthorized, response.CodeTokenInvalid, "Invalid token: missing user ID")
 		return
 	}
 	userID := uint(userIDFloat)
 
-	// Verify refresh token is still valid in database
-	isValid, dbExpiry := repo.CheckRefreshTokenValid(userID, refreshToken)
+	// Verify refresh token is still the one of the session in database (by its jti)
+	isValid, dbExpiry := repo.CheckRefreshTokenValid(c.Request.Context(), userID, utils.TokenID(claims))
 	if !isValid {
-		sendError(c, http.StatusUnauthorized, "Refresh token expired or revoked")
+		sendError(c, http.StatusUnauthorized, response.CodeSessionRevoked, "Refresh token expired or revoked")
 		return
 	}
 
 	// Additional check: Verify database expiry
 	if !dbExpiry.IsZero() && time.Now().After(dbExpiry) {
-		sendError(c, http.StatusUnauthorized, "Refresh token expired")
+		sendError(c, http.StatusUnauthorized, response.CodeTokenExpired, "Refresh token expired")
 		return
 	}
 
 	// Get latest user data from database
-	user, err := repo.GetUserByID(userID)
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
-		sendError(c, http.StatusUnauthorized, "User not found")
+		sendError(c, http.StatusUnauthorized, response.CodeUserNotFound, "User not found")
+		return
+	}
+	// Deactivation deletes the session, this only catches a refresh racing with it
+	if user.DeactivatedAt != nil {
+		sendError(c, http.StatusUnauthorized, response.CodeUserDeactivated, "This account has been deactivated")
 		return
 	}
 
 	// Generate new access token only (refresh token stays the same)
-	newAccessToken, newAccessExpiry, err := utils.GenerateAccessTokenOnly(user.ID, user.Role, user.CanCRUD)
+	newAccess, err := utils.GenerateAccessTokenOnly(user.ID, user.Role, user.CanCRUD)
 	if err != nil {
-		log.Printf("Error generating new access token for user %d: %v", user.ID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to generate access token")
+		slog.ErrorContext(c.Request.Context(), "failed to generate access token", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to generate access token")
 		return
 	}
 
 	// Update only access token in database (refresh token unchanged)
-	err = repo.UpdateAccessTokenOnly(user.ID, newAccessToken, newAccessExpiry)
+	err = repo.UpdateAccessTokenOnly(c.Request.Context(), user.ID, newAccess.ID, newAccess.ExpiresAt)
 	if err != nil {
-		log.Printf("Error updating access token for user %d: %v", user.ID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to update session")
+		slog.ErrorContext(c.Request.Context(), "failed to update access token", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to update session")
 		return
 	}
 
 	// Return new access token and expiry in JSON body
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode":           http.StatusOK,
-		"accessToken":          newAccessToken,
-		"accessTokenExpiresAt": newAccessExpiry.Unix(),
+	sendFields(c, gin.H{
+		"accessToken":          newAccess.Token,
+		"accessTokenExpiresAt": newAccess.ExpiresAt.Unix(),
 	})
 }
 
 // LogoutHandler logs out the current user
-// Deletes tokens from database - user must login again after logout
+// Revokes the session of the access token (by its jti) - user must login again after logout
 // This is normal behavior: when you logout, tokens are deleted and you must login again
 func LogoutHandler(c *gin.Context) {
 	// Get user ID from context (set by auth middleware)
 	userID, exists := getUserID(c)
 	if !exists {
-		sendError(c, http.StatusUnauthorized, "Unauthorized")
+		sendError(c, http.StatusUnauthorized, response.CodeUnauthorized, "Unauthorized")
 		return
 	}
 
-	// Delete tokens from database
-	// After logout, both access and refresh tokens are deleted
+	// Delete the session from database
+	// After logout, both access and refresh tokens stop working
 	// User must login again to get new tokens
-	if err := repo.DeleteToken(userID); err != nil {
-		log.Printf("Warning: Failed to delete token for user %d: %v", userID, err)
+	if err := repo.RevokeSession(c.Request.Context(), userID, c.GetString(middlewares.TokenIDKey)); err != nil {
+		slog.WarnContext(c.Request.Context(), "failed to delete token", "user_id", userID, "error", err)
 		// Continue anyway - logout should succeed even if DB delete fails
 	}
 
 	// Return success response
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode": http.StatusOK,
-		"message":    "Successfully logged out",
-	})
+	sendFields(c, gin.H{"message": "Successfully logged out"})
+}
+
+// JWKS publishes the public keys of RS256/EdDSA tokens so other services can verify them
+// New keys appear here before they sign, so caching the set for a few minutes is safe
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, utils.JWKS())
 }
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// A deactivated user is told so, but only after the password was right
+func TestLoginDeactivated(t *testing.T) {
+	setupTest(t)
+	hash, err := utils.HashPassword("rahasia123")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deactivated := testTime
+
+	tests := []struct {
+		name     string
+		password string
+		status   int
+		code     string
+	}{
+		{"right password", "rahasia123", http.StatusForbidden, response.CodeUserDeactivated},
+		{"wrong password", "salah", http.StatusUnauthorized, response.CodeInvalidCredentials},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			mock.ExpectQuery("FROM users WHERE email").WithArgs("user9@example.com").WillReturnRows(sqlmock.NewRows(userByEmailColumns).
+				AddRow(9, "User 9", "user9@example.com", hash, "Staff", "IT", "Offline", true, "", 2, deactivated, nil, false, false, false))
+
+			r := gin.New()
+			r.POST("/login", LoginHandler)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, jsonRequest(http.MethodPost, "/login", `{"email": "user9@example.com", "password": "`+tt.password+`"}`))
+			if w.Code != tt.status || testutil.ErrorCode(t, w) != tt.code {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+		})
+	}
+}
+
+// A refresh racing with the deactivation (the session still exists) gets no new access token
+func TestRefreshDeactivated(t *testing.T) {
+	setupTest(t)
+	_, refresh, err := utils.GenerateAllTokens(9, "Staff", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deactivated := testTime
+
+	mock := testutil.MockDB(t)
+	mock.ExpectQuery("SELECT refresh_jti, rt_expires_at FROM user_tokens").WithArgs(9).
+		WillReturnRows(sqlmock.NewRows([]string{"refresh_jti", "rt_expires_at"}).AddRow(refresh.ID, time.Now().Add(time.Hour)))
+	expectUser(mock, testUser{ID: 9, Role: "Staff", Unit: "IT", DeactivatedAt: &deactivated})
+
+	r := gin.New()
+	r.POST("/refresh", RefreshHandler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, jsonRequest(http.MethodPost, "/refresh", `{"refreshToken": "`+refresh.Token+`"}`))
+	if w.Code != http.StatusUnauthorized || testutil.ErrorCode(t, w) != response.CodeUserDeactivated {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+}
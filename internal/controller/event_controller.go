@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"log/slog"
+	"net/http"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/response"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetWorkOrderEvents returns the change history of one request and the time it spent in each status
+func GetWorkOrderEvents(c *gin.Context) {
+	user, ok := getCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	orderID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	order, ok := loadWorkOrder(c, user, orderID)
+	if !ok {
+		return
+	}
+
+	events, err := repo.GetWorkOrderEvents(c.Request.Context(), orderID)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to get work order events", "order_id", orderID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch history")
+		return
+	}
+
+	sendSuccess(c, models.WorkOrderHistory{
+		Events:       events,
+		TimeInStatus: repo.TimeInStatus(order.CreatedAt, events, time.Now()),
+	})
+}
+
+// GetEvents returns work order changes across all requests, e.g. everything one user changed (admin only)
+func GetEvents(c *gin.Context) {
+	var filter models.EventFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	q := repo.EventQuery{WorkOrderID: filter.WorkOrder, ActorID: filter.Actor, Types: filter.Type}
+	events, meta, err := repo.GetEvents(c.Request.Context(), q, getPage(c))
+	if err != nil {
+		if sendPageError(c, err) {
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to get events", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch events")
+		return
+	}
+
+	sendPaginatedResponse(c, events, meta)
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/buildinfo"
+	"siro-backend/pkg/setting"
+	"siro-backend/pkg/utils"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// shuttingDown is set when the server received SIGTERM, so /readyz fails
+// and the load balancer stops sending new traffic while connections drain
+var shuttingDown atomic.Bool
+
+// MarkShuttingDown makes /readyz report "not ready" from now on
+func MarkShuttingDown() {
+	shuttingDown.Store(true)
+}
+
+// Healthz reports that the process is alive (no dependencies are checked)
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"statusCode": http.StatusOK,
+		"status":     "ok",
+	})
+}
+
+// Readyz reports whether the server can handle traffic:
+// database reachable, uploads directory writable and all migrations applied
+func Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 3*time.Second)
+	defer cancel()
+
+	checks := gin.H{}
+	ready := true
+
+	if shuttingDown.Load() {
+		checks["server"] = "shutting down"
+		ready = false
+	}
+
+	// 1. Database
+	if err := setting.DB.PingContext(ctx); err != nil {
+		slog.WarnContext(ctx, "readiness: database ping failed", "error", err)
+		checks["database"] = "unreachable"
+		ready = false
+	} else {
+		checks["database"] = "ok"
+	}
+
+	// 2. Upload directory
+	if err := utils.CheckUploadDirWritable(); err != nil {
+		slog.WarnContext(ctx, "readiness: upload dir not writable", "error", err)
+		checks["uploads"] = "not writable"
+		ready = false
+	} else {
+		checks["uploads"] = "ok"
+	}
+
+	// 3. Migrations (only meaningful if the database is up)
+	if checks["database"] == "ok" {
+		pending, err := repo.GetPendingMigrations(ctx)
+		switch {
+		case err != nil:
+			slog.WarnContext(ctx, "readiness: migration check failed", "error", err)
+			checks["migrations"] = "unknown (schema_migrations table missing?)"
+			ready = false
+		case len(pending) > 0:
+			checks["migrations"] = "pending: " + strings.Join(pending, ", ")
+			ready = false
+		default:
+			checks["migrations"] = "ok"
+		}
+	}
+
+	statusCode := http.StatusOK
+	status := "ready"
+	if !ready {
+		statusCode = http.StatusServiceUnavailable
+		status = "not ready"
+	}
+
+	c.JSON(statusCode, gin.H{
+		"statusCode": statusCode,
+		"status":     status,
+		"checks":     checks,
+	})
+}
+
+// GetVersion returns build information of the running binary
+func GetVersion(c *gin.Context) {
+	sendSuccess(c, buildinfo.Get())
+}
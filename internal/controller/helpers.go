@@ -1,14 +1,32 @@
 package controller
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"siro-backend/internal/middlewares"
 	"siro-backend/internal/models"
 	"siro-backend/internal/repo"
+	"siro-backend/pkg/response"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var tracer = otel.Tracer("siro-backend/internal/controller")
+
+// renderJSON runs render (which writes the JSON response) inside its own trace span,
+// so slow encoding of large lists shows up separately from the DB queries
+func renderJSON(c *gin.Context, render func()) {
+	_, span := tracer.Start(c.Request.Context(), "encode json")
+	render()
+	span.SetAttributes(attribute.Int("http.response.body.size", c.Writer.Size()))
+	span.End()
+}
+
 // getUserID extracts user ID from context (set by auth middleware)
 // Returns 0 and false if not found
 func getUserID(c *gin.Context) (uint, bool) {
@@ -25,39 +43,54 @@ func getUserID(c *gin.Context) (uint, bool) {
 func getCurrentUser(c *gin.Context) (*models.User, bool) {
 	userID, exists := getUserID(c)
 	if !exists {
-		sendError(c, http.StatusUnauthorized, "Unauthorized")
+		sendError(c, http.StatusUnauthorized, response.CodeUnauthorized, "Unauthorized")
 		return nil, false
 	}
 
-	user, err := repo.GetUserByID(userID)
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
 	if err != nil {
-		sendError(c, http.StatusUnauthorized, "User not found")
+		sendError(c, http.StatusUnauthorized, response.CodeUserNotFound, "User not found")
+		return nil, false
+	}
+	// Deactivation deletes the sessions, this only catches requests racing with it
+	if user.DeactivatedAt != nil {
+		sendError(c, http.StatusUnauthorized, response.CodeUserDeactivated, "This account has been deactivated")
 		return nil, false
 	}
 
 	return user, true
 }
 
+// apiKeyAllowsUnit reports whether the API key of the request may create work orders for unit
+// Logged-in users and keys whose scope lists no units may use any unit
+func apiKeyAllowsUnit(c *gin.Context, unit string) bool {
+	units := c.GetStringSlice(middlewares.ScopeUnitsKey)
+	if len(units) == 0 {
+		return true
+	}
+	for _, u := range units {
+		if strings.EqualFold(u, unit) {
+			return true
+		}
+	}
+	return false
+}
+
 // parseID extracts and validates ID from URL parameter
 func parseID(c *gin.Context, paramName string) (uint, bool) {
 	idStr := c.Param(paramName)
 	id, err := strconv.Atoi(idStr)
 	if err != nil || id < 1 {
-		sendError(c, http.StatusBadRequest, "Invalid ID format")
+		sendError(c, http.StatusBadRequest, response.CodeInvalidID, "Invalid ID format")
 		return 0, false
 	}
 	return uint(id), true
 }
 
-// PaginationParams represents pagination parameters
-type PaginationParams struct {
-	Page  int
-	Limit int
-}
-
-// getPaginationParams extracts and validates pagination parameters from query string
+// getPage extracts and validates pagination parameters from query string
 // Defaults: page=1, limit=10, max limit=100
-func getPaginationParams(c *gin.Context) PaginationParams {
+// Sending cursor= (empty for the first page) switches to cursor mode, include_total=true adds total_items
+func getPage(c *gin.Context) repo.Page {
 	// Parse page (default: 1)
 	pageStr := c.DefaultQuery("page", "1")
 	page, err := strconv.Atoi(pageStr)
@@ -75,7 +108,27 @@ func getPaginationParams(c *gin.Context) PaginationParams {
 		limit = 100
 	}
 
-	return PaginationParams{Page: page, Limit: limit}
+	cursor, cursorMode := c.GetQuery("cursor")
+	return repo.Page{
+		Number:       page,
+		Limit:        limit,
+		CursorMode:   cursorMode,
+		Cursor:       cursor,
+		IncludeTotal: c.Query("include_total") == "true",
+	}
+}
+
+// sendPageError answers a cursor error with 400 and returns true; other errors return false
+func sendPageError(c *gin.Context, err error) bool {
+	switch {
+	case errors.Is(err, repo.ErrInvalidCursor):
+		sendError(c, http.StatusBadRequest, response.CodeInvalidCursor, "Invalid cursor, start again from the first page")
+	case errors.Is(err, repo.ErrCursorSort):
+		sendError(c, http.StatusBadRequest, response.CodeInvalidCursor, err.Error())
+	default:
+		return false
+	}
+	return true
 }
 
 // sendPaginatedResponse sends a paginated response with status code
@@ -84,25 +137,82 @@ func sendPaginatedResponse(c *gin.Context, data interface{}, meta models.Paginat
 	if data == nil {
 		data = []interface{}{}
 	}
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode": http.StatusOK,
-		"data":       data,
-		"meta":       meta,
-	})
+	renderJSON(c, func() { response.Paginated(c, data, meta) })
 }
 
-// sendError sends an error response with status code in body
-func sendError(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{
-		"statusCode": statusCode,
-		"error":      message,
-	})
+// sendError sends an error response with a machine-readable code (see pkg/response/codes.go)
+func sendError(c *gin.Context, statusCode int, code, message string) {
+	response.Error(c, statusCode, code, message)
+}
+
+// sendBindError sends 400 for a request body that failed ShouldBindJSON
+// Validation errors are listed per field in error.details
+func sendBindError(c *gin.Context, err error) {
+	response.BindError(c, err)
 }
 
 // sendSuccess sends a success response with status code in body
 func sendSuccess(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode": http.StatusOK,
-		"data":       data,
-	})
+	renderJSON(c, func() { response.Success(c, data) })
+}
+
+// sendFields sends 200 for endpoints whose legacy response had its fields at the top level
+// (e.g. accessToken on /login). On /api/v1 the fields are wrapped in "data" like everywhere else
+func sendFields(c *gin.Context, fields gin.H) {
+	response.Flat(c, http.StatusOK, fields)
+}
+
+// sendCreated sends 201 with the newly created resource
+func sendCreated(c *gin.Context, data interface{}) {
+	renderJSON(c, func() { response.Created(c, data) })
+}
+
+// etag formats a row version as a strong ETag value, e.g. "3"
+func etag(version uint) string {
+	return fmt.Sprintf(`"%d"`, version)
+}
+
+// setETag adds the ETag header for the given row version
+func setETag(c *gin.Context, version uint) {
+	c.Header("ETag", etag(version))
+}
+
+// checkIfMatch compares the If-Match header with the current row version
+// Sends 412 with the current data and returns false if it doesn't match
+func checkIfMatch(c *gin.Context, current interface{}, version uint) bool {
+	if ifMatches(c, version) {
+		return true
+	}
+	sendVersionConflict(c, current, version)
+	return false
+}
+
+// ifMatches reports whether the If-Match header names the row version (weak tags included)
+// A missing header or "*" always matches, so older clients keep working
+func ifMatches(c *gin.Context, version uint) bool {
+	ifMatch := strings.TrimSpace(c.GetHeader("If-Match"))
+	if ifMatch == "" || ifMatch == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag(version) {
+			return true
+		}
+	}
+	return false
+}
+
+// sendVersionConflict sends the current representation after a lost update
+// Uses 412 if the client sent If-Match, otherwise 409
+func sendVersionConflict(c *gin.Context, current interface{}, version uint) {
+	statusCode := http.StatusConflict
+	if c.GetHeader("If-Match") != "" {
+		statusCode = http.StatusPreconditionFailed
+	}
+
+	setETag(c, version)
+	response.ErrorWithData(c, statusCode, response.CodeVersionConflict,
+		"This record was modified by someone else. Please review the latest version.", current)
 }
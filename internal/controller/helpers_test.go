@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/validation"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testUnits are the units the "unit" validation tag accepts in tests
+var testUnits = []string{"IT", "Facilities"}
+
+var setupOnce sync.Once
+
+// setupTest prepares what the server sets up at start: validation tags, HS256 tokens and
+// password hashing (at the lowest bcrypt cost, so tests stay fast)
+func setupTest(t *testing.T) {
+	t.Helper()
+	setupOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		if err := validation.Init(func(unit string) bool {
+			for _, u := range testUnits {
+				if u == unit {
+					return true
+				}
+			}
+			return false
+		}); err != nil {
+			t.Fatal(err)
+		}
+		cfg := config.Default().JWT
+		cfg.Secret = strings.Repeat("s", 32)
+		if err := utils.InitJWT(cfg, nil); err != nil {
+			t.Fatal(err)
+		}
+		utils.InitPassword(config.PasswordConfig{BcryptCost: bcrypt.MinCost})
+	})
+}
+
+// capture is a sqlmock argument that accepts any string and remembers it
+type capture struct{ value string }
+
+func (c *capture) Match(v driver.Value) bool {
+	s, ok := v.(string)
+	c.value = s
+	return ok
+}
+
+// expectAudit expects recordAudit to append one entry with this action
+func expectAudit(mock sqlmock.Sqlmock, action string) {
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT last_hash FROM audit_chain_head").
+		WillReturnRows(sqlmock.NewRows([]string{"last_hash"}).AddRow(audit.GenesisHash))
+	mock.ExpectExec("INSERT INTO audit_log").
+		WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), action, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(),
+			sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE audit_chain_head").WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+}
+
+// userByEmailColumns are the columns repo.GetUserByEmail reads
+var userByEmailColumns = []string{"id", "name", "email", "password_hash", "role", "unit", "availability", "can_crud",
+	"avatar_url", "version", "deactivated_at", "anonymized_at", "must_change_password", "invited", "service_account"}
+
+// userByEmailRow is an active Staff user as repo.GetUserByEmail reads it
+func userByEmailRow(id uint, email string) *sqlmock.Rows {
+	return sqlmock.NewRows(userByEmailColumns).
+		AddRow(id, "Budi", email, "", "Staff", "IT", "Online", true, "", 1, nil, nil, false, false, false)
+}
+
+// testTime is a fixed timestamp for rows returned by the mock
+var testTime = time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+
+// userByIDColumns are the columns repo.GetUserByID reads
+var userByIDColumns = []string{"id", "name", "email", "role", "unit", "phone", "avatar_url", "availability", "can_crud", "version",
+	"deactivated_at", "anonymized_at", "must_change_password", "invited", "external_id", "service_account", "created_at", "updated_at"}
+
+// testUser is a user as repo.GetUserByID reads it; the name and email follow from the ID
+type testUser struct {
+	ID             uint
+	Role, Unit     string
+	Version        uint
+	DeactivatedAt  *time.Time
+	AnonymizedAt   *time.Time
+	ServiceAccount bool
+}
+
+func (u testUser) name() string  { return fmt.Sprintf("User %d", u.ID) }
+func (u testUser) email() string { return fmt.Sprintf("user%d@example.com", u.ID) }
+
+func (u testUser) rows() *sqlmock.Rows {
+	version := u.Version
+	if version == 0 {
+		version = 1
+	}
+	return sqlmock.NewRows(userByIDColumns).AddRow(u.ID, u.name(), u.email(), u.Role, u.Unit, "", "", "Online", true, version,
+		u.DeactivatedAt, u.AnonymizedAt, false, false, "", u.ServiceAccount, testTime, testTime)
+}
+
+// expectUser expects repo.GetUserByID to return u
+func expectUser(mock sqlmock.Sqlmock, u testUser) {
+	mock.ExpectQuery(`FROM users WHERE id = \?`).WithArgs(u.ID).WillReturnRows(u.rows())
+}
+
+// serveAs sends req to handler, registered at route, as u (what AuthMiddleware stores for a token)
+func serveAs(u testUser, route string, req *http.Request, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(req.Method, route, func(c *gin.Context) {
+		c.Set("userID", u.ID)
+		c.Set("role", u.Role)
+		c.Set("canCRUD", true)
+	}, handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// jsonRequest is a request with a JSON body (none if body is "")
+func jsonRequest(method, path, body string) *http.Request {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req
+}
+
+// testOrder is a work order as repo.GetWorkOrderById reads it
+type testOrder struct {
+	ID            uint
+	Unit          string // target unit
+	RequesterID   uint
+	RequesterUnit string
+	Public        bool
+	Status        string // Pending if empty
+	AssigneeID    *uint
+	Version       uint // 1 if zero
+}
+
+// woColumns are the columns of repo.selectWOQuery
+var woColumns = []string{"id", "title", "description", "priority", "status", "unit", "photo_url", "is_public",
+	"requester_id", "assignee_id", "taken_at", "completed_at", "completed_by_id", "completion_note", "version", "created_at", "updated_at",
+	"req_name", "req_unit", "req_avatar", "asg_name", "asg_email", "asg_unit", "cmp_name"}
+
+func (o testOrder) rows() *sqlmock.Rows {
+	status, version := o.Status, o.Version
+	if status == "" {
+		status = "Pending"
+	}
+	if version == 0 {
+		version = 1
+	}
+	var assignee interface{}
+	if o.AssigneeID != nil {
+		assignee = *o.AssigneeID
+	}
+	return sqlmock.NewRows(woColumns).AddRow(o.ID, "Printer jammed", "Paper stuck in tray 2", "Medium", status, o.Unit, "", o.Public,
+		o.RequesterID, assignee, nil, nil, nil, "", version, testTime, testTime,
+		"Requester", o.RequesterUnit, "", "", "", "", "")
+}
+
+// expectWorkOrder expects repo.GetWorkOrderById to return o (without tags)
+func expectWorkOrder(mock sqlmock.Sqlmock, o testOrder) {
+	mock.ExpectQuery(`FROM work_orders w[\s\S]+WHERE w.id = \?`).WithArgs(o.ID).WillReturnRows(o.rows())
+	mock.ExpectQuery("FROM work_order_tags WHERE work_order_id IN").WithArgs(o.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"work_order_id", "tag"}))
+}
+
+// expectNoWorkOrder expects repo.GetWorkOrderById to find nothing
+func expectNoWorkOrder(mock sqlmock.Sqlmock, id uint) {
+	mock.ExpectQuery(`FROM work_orders w[\s\S]+WHERE w.id = \?`).WithArgs(id).WillReturnRows(sqlmock.NewRows(woColumns))
+}
+
+func TestCheckIfMatch(t *testing.T) {
+	setupTest(t)
+	type record struct {
+		Name    string `json:"name"`
+		Version uint   `json:"version"`
+	}
+	current := record{Name: "current", Version: 3}
+
+	tests := []struct {
+		ifMatch string
+		match   bool
+	}{
+		{"", true}, // older clients don't send it
+		{"*", true},
+		{`"3"`, true},
+		{`W/"3"`, true},
+		{` "1", W/"3" `, true},
+		{`"2"`, false},
+		{`W/"2"`, false},
+		{`3`, false}, // not a quoted entity tag
+		{`"3 "`, false},
+		{`"1", "2"`, false},
+	}
+	for _, tt := range tests {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPut, "/x", nil)
+		if tt.ifMatch != "" {
+			c.Request.Header.Set("If-Match", tt.ifMatch)
+		}
+
+		if got := checkIfMatch(c, current, current.Version); got != tt.match {
+			t.Errorf("If-Match %q: match = %v, want %v", tt.ifMatch, got, tt.match)
+			continue
+		}
+		if tt.match {
+			if w.Body.Len() != 0 {
+				t.Errorf("If-Match %q: wrote %s", tt.ifMatch, w.Body)
+			}
+			continue
+		}
+		// The client gets the current version to review, and its ETag to retry with
+		var got record
+		env := testutil.DecodeEnvelope(t, w, &got)
+		if w.Code != http.StatusPreconditionFailed || env.Error == nil || env.Error.Code != "VERSION_CONFLICT" || got != current {
+			t.Errorf("If-Match %q: %d %s", tt.ifMatch, w.Code, w.Body)
+		}
+		if w.Header().Get("ETag") != `"3"` {
+			t.Errorf("If-Match %q: ETag %q", tt.ifMatch, w.Header().Get("ETag"))
+		}
+	}
+}
+
+// Without If-Match a lost update is a plain conflict
+func TestSendVersionConflict(t *testing.T) {
+	setupTest(t)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/x", nil)
+	sendVersionConflict(c, gin.H{"version": 4}, 4)
+
+	want := `{"success":false,"data":{"version":4},"error":{"code":"VERSION_CONFLICT","message":"This record was modified by someone else. Please review the latest version."}}`
+	if w.Code != http.StatusConflict || w.Body.String() != want || w.Header().Get("ETag") != `"4"` {
+		t.Errorf("%d %s (ETag %q)", w.Code, w.Body, w.Header().Get("ETag"))
+	}
+}
@@ -0,0 +1,167 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/mailer"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/worker"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Invitation settings, set by InitInvitations
+var (
+	inviteTTL = 72 * time.Hour
+	inviteURL = "http://localhost:3000/invite"
+)
+
+// InitInvitations sets how long invitations last and which frontend page accepts them
+func InitInvitations(cfg config.InviteConfig, serverCfg config.ServerConfig) {
+	inviteTTL = cfg.TTL.Duration
+	inviteURL = cfg.URL
+	if inviteURL == "" {
+		inviteURL = strings.TrimRight(serverCfg.FrontendURL, "/") + "/invite"
+	}
+}
+
+// createInvitation stores a new invitation for an invited user (withdrawing older links) and audits it
+// The returned message still has to be sent with queueEmails
+func createInvitation(c *gin.Context, u *models.User) (*models.Invitation, mailer.Message, error) {
+	token, err := utils.RandomToken()
+	if err != nil {
+		return nil, mailer.Message{}, err
+	}
+	expiresAt := time.Now().Add(inviteTTL).Truncate(time.Second)
+
+	var invitedBy *uint
+	if id, ok := getUserID(c); ok {
+		invitedBy = &id
+	}
+	if err := repo.CreateInvitation(c.Request.Context(), u.ID, invitedBy, utils.HashToken(token), expiresAt); err != nil {
+		return nil, mailer.Message{}, err
+	}
+	recordAudit(c, auditUserInvite, "user", u.ID, "{}")
+
+	sep := "?"
+	if strings.Contains(inviteURL, "?") {
+		sep = "&"
+	}
+	link := inviteURL + sep + "token=" + url.QueryEscape(token)
+
+	msg := mailer.Message{
+		To:      u.Email,
+		Subject: "You have been invited to SIRO",
+		Body: fmt.Sprintf("Hello %s,\n\nAn account has been created for you. Open this link to choose your password:\n\n%s\n\n"+
+			"The link works until %s. If you weren't expecting this email, you can ignore it.\n",
+			u.Name, link, expiresAt.Format("2 January 2006 15:04")),
+	}
+	return &models.Invitation{URL: link, ExpiresAt: expiresAt, Emailed: mailer.Enabled()}, msg, nil
+}
+
+// queueEmails sends the messages one after another in a background job
+// Failures are only logged: the admin still has the links from the response
+func queueEmails(c *gin.Context, msgs []mailer.Message) {
+	if !mailer.Enabled() || len(msgs) == 0 {
+		return
+	}
+	worker.Go(context.WithoutCancel(c.Request.Context()), "mail.invitations", func(ctx context.Context) {
+		for _, msg := range msgs {
+			sendCtx, cancel := context.WithTimeout(ctx, 30*time.Second)
+			if err := mailer.Send(sendCtx, msg); err != nil {
+				slog.ErrorContext(ctx, "failed to send email", "to", msg.To, "subject", msg.Subject, "error", err)
+			}
+			cancel()
+		}
+	})
+}
+
+// InviteUser sends a new invitation to a user who hasn't set a password yet (admin only)
+// Older links of the user stop working
+func InviteUser(c *gin.Context) {
+	user, ok := loadUserForAdmin(c)
+	if !ok {
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		sendError(c, http.StatusConflict, response.CodeUserDeactivated, "User is deactivated, reactivate them first")
+		return
+	}
+	if !user.Invited {
+		sendError(c, http.StatusConflict, response.CodeUserNotInvited, "User has already set a password")
+		return
+	}
+
+	invitation, msg, err := createInvitation(c, user)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to create invitation", "target_user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create invitation")
+		return
+	}
+	queueEmails(c, []mailer.Message{msg})
+	sendSuccess(c, invitation)
+}
+
+// CheckInvitation returns the name and email an invitation is for, so the page can greet the user
+func CheckInvitation(c *gin.Context) {
+	var input models.InvitationTokenRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	info, err := repo.GetInvitation(c.Request.Context(), utils.HashToken(input.Token))
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+	sendSuccess(c, info)
+}
+
+// AcceptInvitation sets the password of an invited user; afterwards they log in normally
+func AcceptInvitation(c *gin.Context) {
+	var input models.AcceptInvitationRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	hashedPassword, err := utils.HashPassword(input.Password)
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
+		return
+	}
+
+	userID, err := repo.AcceptInvitation(c.Request.Context(), utils.HashToken(input.Token), hashedPassword)
+	if err != nil {
+		sendInvitationError(c, err)
+		return
+	}
+
+	slog.InfoContext(c.Request.Context(), "invitation accepted", "target_user_id", userID)
+	sendSuccess(c, gin.H{"message": "Password set, you can log in now"})
+}
+
+// sendInvitationError maps the invitation repo errors to 404 / 410
+func sendInvitationError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, repo.ErrInvitationInvalid):
+		sendError(c, http.StatusNotFound, response.CodeInvitationInvalid, "This invitation link is invalid or was already used")
+	case errors.Is(err, repo.ErrInvitationExpired):
+		sendError(c, http.StatusGone, response.CodeInvitationExpired, "This invitation link has expired, ask an admin for a new one")
+	default:
+		slog.ErrorContext(c.Request.Context(), "failed to load invitation", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to load invitation")
+	}
+}
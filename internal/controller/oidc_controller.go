@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"siro-backend/global"
+	"siro-backend/internal/metrics"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/oidc"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+)
+
+// Single sign-on settings, set by InitOIDC; oidcProvider is nil when SSO is disabled
+var (
+	oidcProvider *oidc.Provider
+	oidcCfg      config.OIDCConfig
+)
+
+// oidcActor is the audit actor name for users linked or created on their first SSO login
+const oidcActor = "sso"
+
+// InitOIDC sets up the OpenID Connect provider; the provider itself is contacted on the first login
+func InitOIDC(cfg config.OIDCConfig, serverCfg config.ServerConfig) {
+	oidcCfg = cfg
+	oidcProvider = nil
+	if !cfg.Enabled {
+		return
+	}
+	redirectURL := cfg.RedirectURL
+	if redirectURL == "" {
+		redirectURL = strings.TrimRight(serverCfg.FrontendURL, "/") + "/oidc/callback"
+	}
+	oidcProvider = oidc.New(oidc.Config{
+		Issuer:       cfg.Issuer,
+		ClientID:     cfg.ClientID,
+		ClientSecret: cfg.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(cfg.Scopes),
+	})
+}
+
+// oidcEnabled sends 404 SSO_DISABLED when single sign-on is not configured
+func oidcEnabled(c *gin.Context) bool {
+	if oidcProvider == nil {
+		sendError(c, http.StatusNotFound, response.CodeSSODisabled, "Single sign-on is not configured")
+		return false
+	}
+	return true
+}
+
+// OIDCAuthorize starts a single sign-on login (authorization code flow with PKCE)
+// The PKCE verifier and nonce stay on the server; the frontend only gets the URL and the state
+func OIDCAuthorize(c *gin.Context) {
+	if !oidcEnabled(c) {
+		return
+	}
+	ctx := c.Request.Context()
+
+	var secrets [3]string
+	for i := range secrets {
+		token, err := utils.RandomToken()
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to start login")
+			return
+		}
+		secrets[i] = token
+	}
+	state, nonce, verifier := secrets[0], secrets[1], secrets[2]
+
+	authURL, err := oidcProvider.AuthURL(ctx, state, nonce, verifier)
+	if err != nil {
+		slog.ErrorContext(ctx, "identity provider discovery failed", "error", err)
+		sendError(c, http.StatusBadGateway, response.CodeSSOFailed, "The identity provider is not reachable")
+		return
+	}
+
+	expiresAt := time.Now().Add(oidcCfg.LoginTTL.Duration).Truncate(time.Second)
+	if err := repo.CreateOIDCLogin(ctx, utils.HashToken(state), verifier, nonce, expiresAt); err != nil {
+		slog.ErrorContext(ctx, "failed to save sso login", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to start login")
+		return
+	}
+
+	sendSuccess(c, models.OIDCAuthorization{URL: authURL, State: state, ExpiresAt: expiresAt})
+}
+
+// OIDCCallback finishes a single sign-on login with the code the provider sent to the frontend
+// and returns the same tokens as /login
+func OIDCCallback(c *gin.Context) {
+	if !oidcEnabled(c) {
+		return
+	}
+	var input models.OIDCCallbackRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+	ctx := c.Request.Context()
+
+	verifier, nonce, err := repo.TakeOIDCLogin(ctx, utils.HashToken(input.State))
+	if errors.Is(err, repo.ErrOIDCLoginInvalid) {
+		metrics.LoginFailed()
+		sendError(c, http.StatusBadRequest, response.CodeSSOStateInvalid, "This login has expired or was already used, please start again")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load sso login", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finish login")
+		return
+	}
+
+	rawIDToken, err := oidcProvider.Exchange(ctx, input.Code, verifier)
+	if err != nil {
+		metrics.LoginFailed()
+		slog.WarnContext(ctx, "sso code exchange failed", "error", err)
+		sendError(c, http.StatusUnauthorized, response.CodeSSOFailed, "The identity provider did not accept the login")
+		return
+	}
+	claims, err := oidcProvider.Verify(ctx, rawIDToken, nonce)
+	if err != nil {
+		metrics.LoginFailed()
+		slog.WarnContext(ctx, "sso id token rejected", "error", err)
+		sendError(c, http.StatusUnauthorized, response.CodeSSOFailed, "The identity provider did not accept the login")
+		return
+	}
+
+	user, ok := resolveOIDCUser(c, claims)
+	if !ok {
+		metrics.LoginFailed()
+		return
+	}
+	if user.DeactivatedAt != nil {
+		metrics.LoginFailed()
+		sendError(c, http.StatusForbidden, response.CodeUserDeactivated, "This account has been deactivated")
+		return
+	}
+
+	issueTokens(c, user)
+}
+
+// resolveOIDCUser finds the user of a verified identity: by the linked subject, else by email
+// (linking it), else by creating one when auto-provisioning is on
+// It sends the error response itself and returns false when there is no user
+func resolveOIDCUser(c *gin.Context, claims oidc.Claims) (*models.User, bool) {
+	ctx := c.Request.Context()
+	c.Set("actorName", oidcActor)
+
+	user, err := repo.GetUserByOIDCSubject(ctx, claims.Subject())
+	if err == nil {
+		return user, true
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		slog.ErrorContext(ctx, "failed to find sso user", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finish login")
+		return nil, false
+	}
+
+	email := strings.TrimSpace(claims.Email())
+	if oidcCfg.LinkByEmail && email != "" && claims.EmailVerified(oidcCfg.TrustMissingEmailVerified) {
+		user, err := repo.GetUserByEmail(ctx, email)
+		switch {
+		case err == nil && user.AnonymizedAt == nil:
+			return linkOIDCUser(c, user, claims.Subject())
+		case err != nil && !errors.Is(err, sql.ErrNoRows):
+			slog.ErrorContext(ctx, "failed to find sso user", "error", err)
+			sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finish login")
+			return nil, false
+		}
+	}
+
+	if !oidcCfg.AutoProvision || email == "" {
+		slog.InfoContext(ctx, "sso login without account", "subject", claims.Subject())
+		sendError(c, http.StatusForbidden, response.CodeSSONoAccount, "No account is linked to this identity, ask an admin to create one")
+		return nil, false
+	}
+	return provisionOIDCUser(c, claims, email)
+}
+
+// linkOIDCUser links an existing user to the identity on their first SSO login
+func linkOIDCUser(c *gin.Context, user *models.User, subject string) (*models.User, bool) {
+	err := repo.LinkOIDCSubject(c.Request.Context(), user.ID, subject)
+	if errors.Is(err, repo.ErrOIDCLinked) || errors.Is(err, repo.ErrDuplicate) {
+		sendError(c, http.StatusForbidden, response.CodeSSONoAccount, "This account is linked to another single sign-on identity")
+		return nil, false
+	}
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to link sso identity", "user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finish login")
+		return nil, false
+	}
+	recordAudit(c, auditUserSSOLink, "user", user.ID, audit.DiffRedacted(nil, map[string]interface{}{"oidc_subject": subject}, "oidc_subject"))
+	user.Version++
+	return user, true
+}
+
+// provisionOIDCUser creates a user from the ID token claims
+// The unit comes from unit_claim (or default_unit) and the role is Admin only if role_claim holds one of admin_values
+func provisionOIDCUser(c *gin.Context, claims oidc.Claims, email string) (*models.User, bool) {
+	ctx := c.Request.Context()
+
+	req := models.UserRequest{
+		Name:  claims.Name(),
+		Email: email,
+		Role:  global.RoleStaff,
+	}
+	if req.Name == "" {
+		req.Name = email
+	}
+	units := unitNames(c)
+	if oidcCfg.UnitClaim != "" {
+		if unit := matchFold(strings.TrimSpace(claims.String(oidcCfg.UnitClaim)), units, ""); slices.Contains(units, unit) {
+			req.Unit = unit
+		}
+	}
+	if req.Unit == "" {
+		req.Unit = matchFold(oidcCfg.DefaultUnit, units, "")
+	}
+	if oidcCfg.RoleClaim != "" {
+		for _, v := range claims.Strings(oidcCfg.RoleClaim) {
+			if slices.ContainsFunc(oidcCfg.AdminValues, func(a string) bool { return strings.EqualFold(a, v) }) {
+				req.Role = global.RoleAdmin
+				break
+			}
+		}
+	}
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		slog.WarnContext(ctx, "sso user can't be provisioned", "subject", claims.Subject(), "error", err)
+		sendError(c, http.StatusForbidden, response.CodeSSONoAccount, "Your account could not be created automatically, ask an admin to create one")
+		return nil, false
+	}
+
+	user := newUserFromRequest(req)
+	user.OIDCSubject = claims.Subject()
+	if err := repo.CreateUser(ctx, user); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			// The email belongs to a user that can't be linked (link_by_email is off or the email is unverified)
+			sendError(c, http.StatusForbidden, response.CodeSSONoAccount, "No account is linked to this identity, ask an admin to create one")
+			return nil, false
+		}
+		slog.ErrorContext(ctx, "failed to provision sso user", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finish login")
+		return nil, false
+	}
+	recordAudit(c, auditUserCreate, "user", user.ID, userDiff(nil, userAuditFields(*user)))
+	return user, true
+}
@@ -0,0 +1,337 @@
+package controller
+
+import (
+	"bytes"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/oidc"
+	"siro-backend/pkg/oidc/oidctest"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// oidcFlow drives a single sign-on login: the server, the mock provider and the browser in between
+type oidcFlow struct {
+	t      *testing.T
+	idp    *oidctest.Provider
+	mock   sqlmock.Sqlmock
+	router *gin.Engine
+
+	verifier, nonce capture // stored by OIDCAuthorize
+}
+
+func newOIDCFlow(t *testing.T, change func(*config.OIDCConfig)) *oidcFlow {
+	t.Helper()
+	setupTest(t)
+	idp, err := oidctest.New("", "siro", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp.Auto = true
+	idp.Identity = oidctest.Identity{Subject: "sub-1", Email: "budi@example.com", Name: "Budi", Claims: map[string]interface{}{"department": "IT"}}
+	srv := httptest.NewServer(idp.Handler())
+	t.Cleanup(srv.Close)
+	idp.Issuer = srv.URL
+
+	cfg := config.Default().OIDC
+	cfg.Enabled = true
+	cfg.Issuer = srv.URL
+	cfg.ClientID = "siro"
+	cfg.RedirectURL = "http://app.test/oidc/callback"
+	if change != nil {
+		change(&cfg)
+	}
+	InitOIDC(cfg, config.ServerConfig{})
+	t.Cleanup(func() { InitOIDC(config.OIDCConfig{}, config.ServerConfig{}) })
+
+	r := gin.New()
+	r.POST("/oidc/authorize", OIDCAuthorize)
+	r.POST("/oidc/callback", OIDCCallback)
+	return &oidcFlow{t: t, idp: idp, mock: testutil.MockDB(t), router: r}
+}
+
+func (f *oidcFlow) post(path string, body interface{}) *httptest.ResponseRecorder {
+	b, _ := json.Marshal(body)
+	req := httptest.NewRequest(http.MethodPost, path, bytes.NewReader(b))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	f.router.ServeHTTP(w, req)
+	return w
+}
+
+// start calls OIDCAuthorize and lets the browser sign in at the provider
+// It returns the code and state the provider sent the browser back with
+func (f *oidcFlow) start(changeAuthURL func(url.Values)) (code, state string) {
+	t := f.t
+	t.Helper()
+	f.mock.ExpectExec("DELETE FROM oidc_logins WHERE expires_at").WillReturnResult(sqlmock.NewResult(0, 0))
+	f.mock.ExpectExec("INSERT INTO oidc_logins").
+		WithArgs(sqlmock.AnyArg(), &f.verifier, &f.nonce, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	w := f.post("/oidc/authorize", nil)
+	if w.Code != http.StatusOK {
+		t.Fatalf("authorize: %d %s", w.Code, w.Body)
+	}
+	var auth models.OIDCAuthorization
+	testutil.DecodeEnvelope(t, w, &auth)
+
+	authURL, err := url.Parse(auth.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q := authURL.Query()
+	if q.Get("state") != auth.State || q.Get("nonce") != f.nonce.value || q.Get("nonce") == "" {
+		t.Fatalf("authorization URL %s does not carry the stored state and nonce", auth.URL)
+	}
+	if q.Get("code_challenge") != oidc.Challenge(f.verifier.value) || q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("authorization URL %s does not carry the PKCE challenge of the stored verifier", auth.URL)
+	}
+	if changeAuthURL != nil {
+		changeAuthURL(q)
+		authURL.RawQuery = q.Encode()
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := resp.Location()
+	if err != nil {
+		t.Fatalf("provider did not redirect back: %d", resp.StatusCode)
+	}
+	if back.Query().Get("state") != auth.State {
+		t.Fatalf("provider sent state %q, want %q", back.Query().Get("state"), auth.State)
+	}
+	return back.Query().Get("code"), auth.State
+}
+
+// expectTakeLogin expects OIDCCallback to use up the stored login
+func (f *oidcFlow) expectTakeLogin(state, verifier, nonce string, expired bool) {
+	f.mock.ExpectBegin()
+	f.mock.ExpectQuery("SELECT id, code_verifier, nonce, expires_at <= NOW\\(\\)").
+		WithArgs(utils.HashToken(state)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "code_verifier", "nonce", "expired"}).AddRow(1, verifier, nonce, expired))
+	f.mock.ExpectExec("DELETE FROM oidc_logins WHERE id").WillReturnResult(sqlmock.NewResult(0, 1))
+	f.mock.ExpectCommit()
+}
+
+func (f *oidcFlow) expectNoLinkedUser() {
+	f.mock.ExpectQuery("SELECT id FROM users WHERE oidc_subject").WithArgs("sub-1").WillReturnError(sql.ErrNoRows)
+}
+
+func (f *oidcFlow) expectSession(userID uint) {
+	f.mock.ExpectExec("INSERT INTO user_tokens").
+		WithArgs(userID, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func (f *oidcFlow) callback(code, state string) *httptest.ResponseRecorder {
+	return f.post("/oidc/callback", models.OIDCCallbackRequest{Code: code, State: state})
+}
+
+// loggedIn checks that the callback answered like /login for the user
+func loggedIn(t *testing.T, w *httptest.ResponseRecorder, userID uint, role string) {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback: %d %s", w.Code, w.Body)
+	}
+	var body struct {
+		AccessToken string      `json:"accessToken"`
+		User        models.User `json:"user"`
+	}
+	testutil.DecodeEnvelope(t, w, &body)
+	claims, err := utils.ParseToken(body.AccessToken)
+	if err != nil {
+		t.Fatalf("access token: %v", err)
+	}
+	if claims["user_id"] != float64(userID) || body.User.ID != userID || body.User.Role != role {
+		t.Errorf("logged in as %v / user %d %s, want user %d %s", claims["user_id"], body.User.ID, body.User.Role, userID, role)
+	}
+}
+
+func TestOIDCLinkByEmail(t *testing.T) {
+	f := newOIDCFlow(t, nil)
+	code, state := f.start(nil)
+
+	f.expectTakeLogin(state, f.verifier.value, f.nonce.value, false)
+	f.expectNoLinkedUser()
+	f.mock.ExpectQuery("FROM users WHERE email").WithArgs("budi@example.com").WillReturnRows(userByEmailRow(7, "budi@example.com"))
+	f.mock.ExpectExec("UPDATE users SET oidc_subject").WithArgs("sub-1", 7).WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(f.mock, auditUserSSOLink)
+	f.expectSession(7)
+
+	loggedIn(t, f.callback(code, state), 7, "Staff")
+}
+
+func TestOIDCProvision(t *testing.T) {
+	f := newOIDCFlow(t, func(c *config.OIDCConfig) {
+		c.AutoProvision = true
+		c.UnitClaim = "department"
+		c.RoleClaim = "groups"
+		c.AdminValues = []string{"siro-admins"}
+	})
+	f.idp.Identity.Claims["groups"] = []string{"staff", "siro-admins"}
+	code, state := f.start(nil)
+
+	f.expectTakeLogin(state, f.verifier.value, f.nonce.value, false)
+	f.expectNoLinkedUser()
+	f.mock.ExpectQuery("FROM users WHERE email").WillReturnError(sql.ErrNoRows)
+	f.mock.ExpectQuery("SELECT id, name, created_at FROM units").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "name", "created_at"}).AddRow(1, "Facilities", testTime).AddRow(2, "IT", testTime))
+	f.mock.ExpectExec("INSERT INTO users").
+		WithArgs("Budi", "budi@example.com", "", false, "Admin", "IT", "", false, sqlmock.AnyArg(), "", "sub-1", false).
+		WillReturnResult(sqlmock.NewResult(42, 1))
+	expectAudit(f.mock, auditUserCreate)
+	f.expectSession(42)
+
+	loggedIn(t, f.callback(code, state), 42, "Admin")
+}
+
+func TestOIDCNoAccount(t *testing.T) {
+	tests := []struct {
+		name   string
+		change func(*config.OIDCConfig)
+		claims map[string]interface{}
+		expect func(*oidcFlow)
+	}{
+		{
+			name:   "unknown email",
+			expect: func(f *oidcFlow) { f.mock.ExpectQuery("FROM users WHERE email").WillReturnError(sql.ErrNoRows) },
+		},
+		{
+			// An unverified email must not link, or anyone could log in as that user
+			name:   "email not verified",
+			claims: map[string]interface{}{"email_verified": false},
+		},
+		{
+			name:   "email_verified missing",
+			claims: map[string]interface{}{"email_verified": nil},
+		},
+		{
+			name:   "linking disabled",
+			change: func(c *config.OIDCConfig) { c.LinkByEmail = false },
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFlow(t, tt.change)
+			f.idp.Identity.Claims = tt.claims
+			code, state := f.start(nil)
+
+			f.expectTakeLogin(state, f.verifier.value, f.nonce.value, false)
+			f.expectNoLinkedUser()
+			if tt.expect != nil {
+				tt.expect(f)
+			}
+			w := f.callback(code, state)
+			if w.Code != http.StatusForbidden || testutil.ErrorCode(t, w) != response.CodeSSONoAccount {
+				t.Errorf("callback: %d %s, want 403 %s", w.Code, w.Body, response.CodeSSONoAccount)
+			}
+		})
+	}
+}
+
+func TestOIDCTrustMissingEmailVerified(t *testing.T) {
+	f := newOIDCFlow(t, func(c *config.OIDCConfig) { c.TrustMissingEmailVerified = true })
+	f.idp.Identity.Claims = map[string]interface{}{"email_verified": nil}
+	code, state := f.start(nil)
+
+	f.expectTakeLogin(state, f.verifier.value, f.nonce.value, false)
+	f.expectNoLinkedUser()
+	f.mock.ExpectQuery("FROM users WHERE email").WillReturnRows(userByEmailRow(7, "budi@example.com"))
+	f.mock.ExpectExec("UPDATE users SET oidc_subject").WillReturnResult(sqlmock.NewResult(0, 1))
+	expectAudit(f.mock, auditUserSSOLink)
+	f.expectSession(7)
+
+	loggedIn(t, f.callback(code, state), 7, "Staff")
+}
+
+func TestOIDCRejected(t *testing.T) {
+	tests := []struct {
+		name   string
+		take   func(f *oidcFlow, state string) // what the stored login holds
+		status int
+		code   string
+	}{
+		{
+			// The provider only hands out the token for the verifier of the challenge it saw
+			name:   "wrong PKCE verifier",
+			take:   func(f *oidcFlow, state string) { f.expectTakeLogin(state, "another-verifier", f.nonce.value, false) },
+			status: http.StatusUnauthorized,
+			code:   response.CodeSSOFailed,
+		},
+		{
+			// The ID token was issued for another login attempt
+			name:   "nonce mismatch",
+			take:   func(f *oidcFlow, state string) { f.expectTakeLogin(state, f.verifier.value, "another-nonce", false) },
+			status: http.StatusUnauthorized,
+			code:   response.CodeSSOFailed,
+		},
+		{
+			name:   "expired state",
+			take:   func(f *oidcFlow, state string) { f.expectTakeLogin(state, f.verifier.value, f.nonce.value, true) },
+			status: http.StatusBadRequest,
+			code:   response.CodeSSOStateInvalid,
+		},
+		{
+			// A used state is deleted, so a replay finds nothing
+			name: "replayed state",
+			take: func(f *oidcFlow, state string) {
+				f.mock.ExpectBegin()
+				f.mock.ExpectQuery("FROM oidc_logins WHERE state_hash").WillReturnError(sql.ErrNoRows)
+				f.mock.ExpectRollback()
+			},
+			status: http.StatusBadRequest,
+			code:   response.CodeSSOStateInvalid,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOIDCFlow(t, nil)
+			code, state := f.start(nil)
+			tt.take(f, state)
+
+			w := f.callback(code, state)
+			if w.Code != tt.status || testutil.ErrorCode(t, w) != tt.code {
+				t.Errorf("callback: %d %s, want %d %s", w.Code, w.Body, tt.status, tt.code)
+			}
+		})
+	}
+}
+
+// TestOIDCInjectedNonce covers a code obtained with another nonce (e.g. a code injected from another session)
+func TestOIDCInjectedNonce(t *testing.T) {
+	f := newOIDCFlow(t, nil)
+	code, state := f.start(func(q url.Values) { q.Set("nonce", "attacker-nonce") })
+	f.expectTakeLogin(state, f.verifier.value, f.nonce.value, false)
+
+	w := f.callback(code, state)
+	if w.Code != http.StatusUnauthorized || testutil.ErrorCode(t, w) != response.CodeSSOFailed {
+		t.Errorf("callback: %d %s, want 401 %s", w.Code, w.Body, response.CodeSSOFailed)
+	}
+}
+
+func TestOIDCDisabled(t *testing.T) {
+	setupTest(t)
+	InitOIDC(config.OIDCConfig{}, config.ServerConfig{})
+	r := gin.New()
+	r.POST("/oidc/authorize", OIDCAuthorize)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/oidc/authorize", nil))
+	if w.Code != http.StatusNotFound || testutil.ErrorCode(t, w) != response.CodeSSODisabled {
+		t.Errorf("authorize: %d %s, want 404 %s", w.Code, w.Body, response.CodeSSODisabled)
+	}
+}
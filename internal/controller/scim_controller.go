@@ -0,0 +1,834 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/scim"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/validation"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// SCIM settings, set by InitSCIM
+var (
+	scimBaseURL     = "http://localhost:8080/scim/v2"
+	scimDefaultUnit = ""
+)
+
+// InitSCIM sets the public URL used in resource locations and the unit for users without a department
+func InitSCIM(cfg config.SCIMConfig, serverCfg config.ServerConfig) {
+	scimBaseURL = strings.TrimRight(serverCfg.BaseURL, "/") + "/scim/v2"
+	scimDefaultUnit = cfg.DefaultUnit
+}
+
+// Groups are the units ("unit-<id>") and the roles ("role-admin", "role-staff")
+// A user is a member of exactly one of each; adding them to a group moves them there
+const (
+	unitGroupPrefix = "unit-"
+	roleGroupPrefix = "role-"
+)
+
+// sendSCIM writes a SCIM response (application/scim+json)
+func sendSCIM(c *gin.Context, status int, v interface{}) {
+	c.Header("Content-Type", scim.ContentType)
+	c.JSON(status, v)
+}
+
+// sendSCIMError writes a SCIM error; errors that aren't *scim.Error are logged and answered with 500
+func sendSCIMError(c *gin.Context, err error) {
+	var se *scim.Error
+	if !errors.As(err, &se) {
+		slog.ErrorContext(c.Request.Context(), "scim request failed", "path", c.FullPath(), "error", err)
+		se = scim.NewError(http.StatusInternalServerError, "", "Internal error")
+	}
+	sendSCIM(c, se.StatusCode(), se)
+}
+
+// bindSCIM decodes the JSON body
+func bindSCIM(c *gin.Context, v interface{}) bool {
+	if err := json.NewDecoder(c.Request.Body).Decode(v); err != nil {
+		sendSCIMError(c, scim.BadRequest(scim.ErrInvalidSyntax, "invalid JSON: %v", err))
+		return false
+	}
+	return true
+}
+
+// scimNotFound is the error for unknown or anonymized resources
+func scimNotFound(kind, id string) *scim.Error {
+	return scim.NewError(http.StatusNotFound, "", fmt.Sprintf("%s %s not found", kind, id))
+}
+
+// scimListQuery applies ?filter, ?startIndex and ?count to the resources
+func scimListQuery[T any](c *gin.Context, resources []T) (scim.ListResponse, error) {
+	if expr := c.Query("filter"); expr != "" {
+		f, err := scim.ParseFilter(expr)
+		if err != nil {
+			return scim.ListResponse{}, err
+		}
+		matched := make([]T, 0, len(resources))
+		for _, r := range resources {
+			m, err := scim.ToMap(r)
+			if err != nil {
+				return scim.ListResponse{}, err
+			}
+			if f.Match(m) {
+				matched = append(matched, r)
+			}
+		}
+		resources = matched
+	}
+	start, limit := scim.Pagination(c.Query("startIndex"), c.Query("count"))
+	return scim.Page(resources, start, limit), nil
+}
+
+// --- Users ---
+
+// toSCIMUser converts a user to the SCIM resource; unitIDs maps unit names to IDs for the groups
+func toSCIMUser(u models.User, unitIDs map[string]uint) scim.User {
+	id := strconv.FormatUint(uint64(u.ID), 10)
+	active := scim.Bool(u.DeactivatedAt == nil)
+	created, updated := u.CreatedAt, u.UpdatedAt
+
+	su := scim.User{
+		Schemas:     []string{scim.SchemaUser, scim.SchemaEnterpriseUser},
+		ID:          id,
+		ExternalID:  u.ExternalID,
+		UserName:    u.Email,
+		Name:        &scim.Name{Formatted: u.Name},
+		DisplayName: u.Name,
+		Emails:      []scim.MultiValue{{Value: u.Email, Type: "work", Primary: true}},
+		Active:      &active,
+		Enterprise:  &scim.EnterpriseUser{Department: u.Unit},
+		Meta: &scim.Meta{
+			ResourceType: "User",
+			Created:      &created,
+			LastModified: &updated,
+			Location:     scimBaseURL + "/Users/" + id,
+			Version:      "W/" + etag(u.Version),
+		},
+	}
+	if u.Phone != "" {
+		su.PhoneNumbers = []scim.MultiValue{{Value: u.Phone, Type: "work", Primary: true}}
+	}
+	if unitID, ok := unitIDs[u.Unit]; ok {
+		groupID := unitGroupPrefix + strconv.FormatUint(uint64(unitID), 10)
+		su.Groups = append(su.Groups, scim.Ref{Value: groupID, Ref: scimBaseURL + "/Groups/" + groupID, Display: u.Unit})
+	}
+	roleID := roleGroupPrefix + strings.ToLower(u.Role)
+	su.Groups = append(su.Groups, scim.Ref{Value: roleID, Ref: scimBaseURL + "/Groups/" + roleID, Display: u.Role})
+	return su
+}
+
+// scimUnitIDs maps unit names to their IDs
+func scimUnitIDs(c *gin.Context) (map[string]uint, []models.Unit, error) {
+	units, err := repo.GetUnits(c.Request.Context())
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make(map[string]uint, len(units))
+	for _, u := range units {
+		ids[u.Name] = u.ID
+	}
+	return ids, units, nil
+}
+
+// scimUsers returns every user that SCIM can see (anonymized users count as deleted)
+func scimUsers(c *gin.Context) ([]models.User, error) {
+	users, err := repo.GetAllUsers(c.Request.Context(), repo.UserQuery{})
+	if err != nil {
+		return nil, err
+	}
+	visible := users[:0]
+	for _, u := range users {
+		if u.AnonymizedAt == nil {
+			visible = append(visible, u)
+		}
+	}
+	return visible, nil
+}
+
+// loadSCIMUser loads the user from the :id parameter
+func loadSCIMUser(c *gin.Context) (*models.User, error) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		return nil, scimNotFound("User", c.Param("id"))
+	}
+	user, err := repo.GetUserByID(c.Request.Context(), uint(id))
+	if err != nil || user.AnonymizedAt != nil || user.ServiceAccount {
+		return nil, scimNotFound("User", c.Param("id"))
+	}
+	return user, nil
+}
+
+// scimIfMatch checks the If-Match header against meta.version of the user, like checkIfMatch
+func scimIfMatch(c *gin.Context, user *models.User) error {
+	if ifMatches(c, user.Version) {
+		return nil
+	}
+	c.Header("ETag", "W/"+etag(user.Version))
+	return scimVersionConflict(c)
+}
+
+// scimVersionConflict is the error for a lost update: 412 if the client sent If-Match, otherwise 409
+func scimVersionConflict(c *gin.Context) *scim.Error {
+	if c.GetHeader("If-Match") != "" {
+		return scim.NewError(http.StatusPreconditionFailed, "", "The user was changed, read it again and retry")
+	}
+	return scim.NewError(http.StatusConflict, "", "The user was changed at the same time, try again")
+}
+
+// sendSCIMUser reloads the user and sends it
+func sendSCIMUser(c *gin.Context, status int, userID uint) {
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	unitIDs, _, err := scimUnitIDs(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	su := toSCIMUser(*user, unitIDs)
+	if status == http.StatusCreated {
+		c.Header("Location", su.Meta.Location)
+	}
+	c.Header("ETag", su.Meta.Version)
+	sendSCIM(c, status, su)
+}
+
+// scimUserRequest maps a SCIM user onto the fields of a user request and validates them
+// current is nil when creating; role and permissions are not part of the SCIM user (see groups)
+func scimUserRequest(c *gin.Context, in scim.User, current *models.User) (models.UserRequest, error) {
+	req := models.UserRequest{
+		Name:     in.Name.Full(),
+		Email:    strings.TrimSpace(in.UserName),
+		Phone:    scim.Primary(in.PhoneNumbers),
+		Password: in.Password,
+		Role:     global.RoleStaff,
+	}
+	if req.Name == "" {
+		req.Name = in.DisplayName
+	}
+	if req.Name == "" {
+		req.Name = req.Email
+	}
+	if in.Enterprise != nil {
+		req.Unit = strings.TrimSpace(in.Enterprise.Department)
+	}
+	if current != nil {
+		req.Role, req.CanCRUD = current.Role, current.CanCRUD
+		if req.Unit == "" {
+			req.Unit = current.Unit
+		}
+	}
+	if req.Unit == "" {
+		req.Unit = scimDefaultUnit
+	}
+	if req.Unit == "" {
+		return req, scim.BadRequest(scim.ErrInvalidValue, "%s:department is required (it is the user's unit)", scim.SchemaEnterpriseUser)
+	}
+	req.Unit = matchFold(req.Unit, unitNames(c), req.Unit)
+
+	if err := binding.Validator.ValidateStruct(&req); err != nil {
+		var ve validator.ValidationErrors
+		if errors.As(err, &ve) {
+			msgs := make([]string, len(ve))
+			for i, fe := range ve {
+				msgs[i] = validation.Message(fe, "en")
+			}
+			return req, scim.BadRequest(scim.ErrInvalidValue, "%s", strings.Join(msgs, "; "))
+		}
+		return req, scim.BadRequest(scim.ErrInvalidValue, "%v", err)
+	}
+	return req, nil
+}
+
+// SCIMListUsers returns the users matching ?filter, e.g. userName eq "a@b.com"
+func SCIMListUsers(c *gin.Context) {
+	users, err := scimUsers(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	unitIDs, _, err := scimUnitIDs(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+
+	resources := make([]scim.User, len(users))
+	for i, u := range users {
+		resources[i] = toSCIMUser(u, unitIDs)
+	}
+	list, err := scimListQuery(c, resources)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIM(c, http.StatusOK, list)
+}
+
+// SCIMGetUser returns one user
+func SCIMGetUser(c *gin.Context) {
+	user, err := loadSCIMUser(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIMUser(c, http.StatusOK, user.ID)
+}
+
+// SCIMCreateUser creates a user; without a password the user is invited (see POST /admin/users/:id/invite)
+// New users get the Staff role; add them to the role-admin group to make them admins
+func SCIMCreateUser(c *gin.Context) {
+	var in scim.User
+	if !bindSCIM(c, &in) {
+		return
+	}
+	req, err := scimUserRequest(c, in, nil)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+
+	user := newUserFromRequest(req)
+	user.ExternalID = in.ExternalID
+	user.Invited = req.Password == ""
+	if req.Password != "" {
+		if user.PasswordHash, err = utils.HashPassword(req.Password); err != nil {
+			sendSCIMError(c, err)
+			return
+		}
+	}
+
+	if err := repo.CreateUser(c.Request.Context(), user); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			sendSCIMError(c, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "userName or externalId is already used"))
+			return
+		}
+		sendSCIMError(c, err)
+		return
+	}
+	recordAudit(c, auditUserCreate, "user", user.ID, userDiff(nil, userAuditFields(*user)))
+
+	if in.Active != nil && !*in.Active {
+		if err := setSCIMActive(c, user, false); err != nil {
+			sendSCIMError(c, err)
+			return
+		}
+	}
+	sendSCIMUser(c, http.StatusCreated, user.ID)
+}
+
+// SCIMReplaceUser replaces a user's attributes (PUT)
+func SCIMReplaceUser(c *gin.Context) {
+	user, err := loadSCIMUser(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := scimIfMatch(c, user); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var in scim.User
+	if !bindSCIM(c, &in) {
+		return
+	}
+	if err := saveSCIMUser(c, user, in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIMUser(c, http.StatusOK, user.ID)
+}
+
+// SCIMPatchUser changes some attributes of a user, e.g. {"op": "replace", "path": "active", "value": false}
+func SCIMPatchUser(c *gin.Context) {
+	user, err := loadSCIMUser(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := scimIfMatch(c, user); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var patch scim.PatchRequest
+	if !bindSCIM(c, &patch) {
+		return
+	}
+	unitIDs, _, err := scimUnitIDs(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+
+	resource, err := scim.ToMap(toSCIMUser(*user, unitIDs))
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := scim.ApplyPatch(resource, patch.Operations); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var in scim.User
+	if err := scim.FromMap(resource, &in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	// Only formatted is stored, so a new givenName / familyName replaces the old formatted name
+	if in.Name != nil && in.Name.Formatted == user.Name && (in.Name.GivenName != "" || in.Name.FamilyName != "") {
+		in.Name.Formatted = ""
+	}
+
+	if err := saveSCIMUser(c, user, in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIMUser(c, http.StatusOK, user.ID)
+}
+
+// SCIMDeleteUser deactivates a user; like DELETE /admin/users/:id the row is kept for history
+func SCIMDeleteUser(c *gin.Context) {
+	user, err := loadSCIMUser(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := scimIfMatch(c, user); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := setSCIMActive(c, user, false); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+// saveSCIMUser writes the attributes of a SCIM user onto an existing user
+func saveSCIMUser(c *gin.Context, user *models.User, in scim.User) error {
+	req, err := scimUserRequest(c, in, user)
+	if err != nil {
+		return err
+	}
+
+	before := userAuditFields(*user)
+	externalChanged := user.ExternalID != in.ExternalID
+	user.Name = req.Name
+	user.Email = req.Email
+	user.Unit = req.Unit
+	user.Phone = req.Phone
+	user.ExternalID = in.ExternalID
+	if req.Password != "" {
+		if user.PasswordHash, err = utils.HashPassword(req.Password); err != nil {
+			return err
+		}
+	}
+
+	diff := userDiff(before, userAuditFields(*user))
+	if diff != "{}" || req.Password != "" || externalChanged {
+		if err := repo.UpdateUser(c.Request.Context(), user.ID, *user); err != nil {
+			if errors.Is(err, repo.ErrDuplicate) {
+				return scim.NewError(http.StatusConflict, scim.ErrUniqueness, "userName or externalId is already used")
+			}
+			if errors.Is(err, repo.ErrVersionConflict) {
+				return scimVersionConflict(c)
+			}
+			return err
+		}
+		user.Version++
+		if diff != "{}" {
+			recordAudit(c, auditUserUpdate, "user", user.ID, diff)
+		}
+		if req.Password != "" {
+			recordAudit(c, auditUserPasswordReset, "user", user.ID, "{}")
+		}
+	}
+
+	if in.Active != nil {
+		return setSCIMActive(c, user, bool(*in.Active))
+	}
+	return nil
+}
+
+// setSCIMActive deactivates or reactivates a user if needed
+func setSCIMActive(c *gin.Context, user *models.User, active bool) error {
+	ctx := c.Request.Context()
+	switch {
+	case !active && user.DeactivatedAt == nil:
+		if err := repo.DeactivateUser(ctx, user.ID); err != nil {
+			return err
+		}
+		recordAudit(c, auditUserDeactivate, "user", user.ID, "{}")
+	case active && user.DeactivatedAt != nil:
+		if err := repo.ReactivateUser(ctx, user.ID); err != nil {
+			return err
+		}
+		recordAudit(c, auditUserReactivate, "user", user.ID, "{}")
+	}
+	return nil
+}
+
+// --- Groups ---
+
+// scimGroups returns the unit and role groups with their members
+func scimGroups(c *gin.Context) ([]scim.Group, error) {
+	users, err := scimUsers(c)
+	if err != nil {
+		return nil, err
+	}
+	_, units, err := scimUnitIDs(c)
+	if err != nil {
+		return nil, err
+	}
+
+	groups := make([]scim.Group, 0, len(units)+len(validation.Roles))
+	for _, unit := range units {
+		id := unitGroupPrefix + strconv.FormatUint(uint64(unit.ID), 10)
+		created := unit.CreatedAt
+		g := scim.Group{
+			Schemas:     []string{scim.SchemaGroup},
+			ID:          id,
+			DisplayName: unit.Name,
+			Members:     []scim.Ref{},
+			Meta:        &scim.Meta{ResourceType: "Group", Created: &created, Location: scimBaseURL + "/Groups/" + id},
+		}
+		for _, u := range users {
+			if u.Unit == unit.Name {
+				g.Members = append(g.Members, scimMember(u))
+			}
+		}
+		groups = append(groups, g)
+	}
+	for _, role := range validation.Roles {
+		id := roleGroupPrefix + strings.ToLower(role)
+		g := scim.Group{
+			Schemas:     []string{scim.SchemaGroup},
+			ID:          id,
+			DisplayName: role,
+			Members:     []scim.Ref{},
+			Meta:        &scim.Meta{ResourceType: "Group", Location: scimBaseURL + "/Groups/" + id},
+		}
+		for _, u := range users {
+			if u.Role == role {
+				g.Members = append(g.Members, scimMember(u))
+			}
+		}
+		groups = append(groups, g)
+	}
+	return groups, nil
+}
+
+func scimMember(u models.User) scim.Ref {
+	id := strconv.FormatUint(uint64(u.ID), 10)
+	return scim.Ref{Value: id, Ref: scimBaseURL + "/Users/" + id, Display: u.Name}
+}
+
+// findSCIMGroup returns the group with the given ID
+func findSCIMGroup(c *gin.Context, id string) (*scim.Group, error) {
+	groups, err := scimGroups(c)
+	if err != nil {
+		return nil, err
+	}
+	for i := range groups {
+		if strings.EqualFold(groups[i].ID, id) {
+			return &groups[i], nil
+		}
+	}
+	return nil, scimNotFound("Group", id)
+}
+
+// withoutMembers drops the members when the client asks for ?excludedAttributes=members
+func withoutMembers(c *gin.Context, groups []scim.Group) []scim.Group {
+	for _, attr := range strings.Split(c.Query("excludedAttributes"), ",") {
+		if strings.EqualFold(strings.TrimSpace(attr), "members") {
+			for i := range groups {
+				groups[i].Members = nil
+			}
+		}
+	}
+	return groups
+}
+
+// SCIMListGroups returns the groups matching ?filter, e.g. displayName eq "IT"
+func SCIMListGroups(c *gin.Context) {
+	groups, err := scimGroups(c)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	list, err := scimListQuery(c, groups)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	list.Resources = withoutMembers(c, list.Resources.([]scim.Group))
+	sendSCIM(c, http.StatusOK, list)
+}
+
+// SCIMGetGroup returns one group
+func SCIMGetGroup(c *gin.Context) {
+	g, err := findSCIMGroup(c, c.Param("id"))
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIM(c, http.StatusOK, withoutMembers(c, []scim.Group{*g})[0])
+}
+
+// SCIMCreateGroup creates a unit; its members are moved into it
+// Roles are fixed, so a group named like a role already exists
+func SCIMCreateGroup(c *gin.Context) {
+	var in scim.Group
+	if !bindSCIM(c, &in) {
+		return
+	}
+	name := strings.TrimSpace(in.DisplayName)
+	if name == "" || len(name) > 255 {
+		sendSCIMError(c, scim.BadRequest(scim.ErrInvalidValue, "displayName is required (max 255 characters)"))
+		return
+	}
+	for _, role := range validation.Roles {
+		if strings.EqualFold(role, name) {
+			sendSCIMError(c, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A role group with this name already exists"))
+			return
+		}
+	}
+
+	unit := models.Unit{Name: name}
+	if err := repo.CreateUnit(c.Request.Context(), &unit); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			sendSCIMError(c, scim.NewError(http.StatusConflict, scim.ErrUniqueness, "A unit with this name already exists"))
+			return
+		}
+		sendSCIMError(c, err)
+		return
+	}
+	recordAudit(c, auditUnitCreate, "unit", unit.ID, audit.Diff(nil, map[string]interface{}{"name": unit.Name}))
+
+	id := unitGroupPrefix + strconv.FormatUint(uint64(unit.ID), 10)
+	current := &scim.Group{ID: id, DisplayName: unit.Name}
+	if err := saveSCIMGroup(c, current, in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	g, err := findSCIMGroup(c, id)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	c.Header("Location", g.Meta.Location)
+	sendSCIM(c, http.StatusCreated, g)
+}
+
+// SCIMReplaceGroup sets the members of a group (PUT)
+func SCIMReplaceGroup(c *gin.Context) {
+	current, err := findSCIMGroup(c, c.Param("id"))
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var in scim.Group
+	if !bindSCIM(c, &in) {
+		return
+	}
+	replaceSCIMGroup(c, current, in)
+}
+
+// SCIMPatchGroup adds or removes members, e.g. {"op": "add", "path": "members", "value": [{"value": "12"}]}
+func SCIMPatchGroup(c *gin.Context) {
+	current, err := findSCIMGroup(c, c.Param("id"))
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var patch scim.PatchRequest
+	if !bindSCIM(c, &patch) {
+		return
+	}
+
+	resource, err := scim.ToMap(current)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	if err := scim.ApplyPatch(resource, patch.Operations); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	var in scim.Group
+	if err := scim.FromMap(resource, &in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	replaceSCIMGroup(c, current, in)
+}
+
+// SCIMDeleteGroup is refused: units are referenced by work orders and roles are fixed
+func SCIMDeleteGroup(c *gin.Context) {
+	if _, err := findSCIMGroup(c, c.Param("id")); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIMError(c, scim.BadRequest(scim.ErrMutability, "Units and roles can't be deleted"))
+}
+
+func replaceSCIMGroup(c *gin.Context, current *scim.Group, in scim.Group) {
+	if in.DisplayName != "" && in.DisplayName != current.DisplayName {
+		sendSCIMError(c, scim.BadRequest(scim.ErrMutability, "Groups can't be renamed"))
+		return
+	}
+	if err := saveSCIMGroup(c, current, in); err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	g, err := findSCIMGroup(c, current.ID)
+	if err != nil {
+		sendSCIMError(c, err)
+		return
+	}
+	sendSCIM(c, http.StatusOK, withoutMembers(c, []scim.Group{*g})[0])
+}
+
+// saveSCIMGroup moves users in and out of a group so its members match in.Members
+// Users can't be removed from their unit or from the Staff role without joining another one,
+// because every user has exactly one; removing an admin from role-admin makes them Staff
+func saveSCIMGroup(c *gin.Context, current *scim.Group, in scim.Group) error {
+	wanted := map[string]bool{}
+	for _, m := range in.Members {
+		wanted[m.Value] = true
+	}
+	had := map[string]bool{}
+	for _, m := range current.Members {
+		had[m.Value] = true
+	}
+
+	var added, removed []*models.User
+	for id := range wanted {
+		if had[id] {
+			continue
+		}
+		user, err := scimMemberUser(c, id)
+		if err != nil {
+			return err
+		}
+		added = append(added, user)
+	}
+	for id := range had {
+		if wanted[id] {
+			continue
+		}
+		user, err := scimMemberUser(c, id)
+		if err != nil {
+			return err
+		}
+		removed = append(removed, user)
+	}
+
+	isRole := strings.HasPrefix(current.ID, roleGroupPrefix)
+	if len(removed) > 0 && !(isRole && current.DisplayName == global.RoleAdmin) {
+		return scim.BadRequest(scim.ErrMutability,
+			"Users can't leave %s without joining another %s; add them to the other group instead", current.DisplayName, map[bool]string{true: "role", false: "unit"}[isRole])
+	}
+
+	for _, user := range added {
+		if err := moveSCIMUser(c, user, isRole, current.DisplayName); err != nil {
+			return err
+		}
+	}
+	for _, user := range removed {
+		if err := moveSCIMUser(c, user, true, global.RoleStaff); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scimMemberUser loads a group member by its user ID
+func scimMemberUser(c *gin.Context, id string) (*models.User, error) {
+	n, err := strconv.ParseUint(id, 10, 32)
+	if err == nil {
+		if user, err := repo.GetUserByID(c.Request.Context(), uint(n)); err == nil && user.AnonymizedAt == nil && !user.ServiceAccount {
+			return user, nil
+		}
+	}
+	return nil, scim.BadRequest(scim.ErrInvalidValue, "member %q is not a user", id)
+}
+
+// moveSCIMUser sets the role (isRole) or unit of a user
+func moveSCIMUser(c *gin.Context, user *models.User, isRole bool, value string) error {
+	before := userAuditFields(*user)
+	if isRole {
+		user.Role = value
+	} else {
+		user.Unit = value
+	}
+	diff := userDiff(before, userAuditFields(*user))
+	if diff == "{}" {
+		return nil
+	}
+
+	if err := repo.UpdateUser(c.Request.Context(), user.ID, *user); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			return scim.NewError(http.StatusConflict, "", "A member was changed at the same time, try again")
+		}
+		return err
+	}
+	user.Version++
+	recordAudit(c, auditUserUpdate, "user", user.ID, diff)
+	return nil
+}
+
+// --- Discovery ---
+
+// SCIMServiceProviderConfig describes which SCIM features are supported
+func SCIMServiceProviderConfig(c *gin.Context) {
+	sendSCIM(c, http.StatusOK, gin.H{
+		"schemas":        []string{scim.SchemaServiceProviderConfig},
+		"patch":          gin.H{"supported": true},
+		"bulk":           gin.H{"supported": false, "maxOperations": 0, "maxPayloadSize": 0},
+		"filter":         gin.H{"supported": true, "maxResults": scim.MaxCount},
+		"changePassword": gin.H{"supported": true},
+		"sort":           gin.H{"supported": false},
+		"etag":           gin.H{"supported": true},
+		"authenticationSchemes": []gin.H{{
+			"type": "oauthbearertoken", "name": "Bearer token", "primary": true,
+			"description": "The SCIM_TOKEN configured on the server",
+		}},
+		"meta": gin.H{"resourceType": "ServiceProviderConfig", "location": scimBaseURL + "/ServiceProviderConfig"},
+	})
+}
+
+// SCIMResourceTypes lists the User and Group resource types
+func SCIMResourceTypes(c *gin.Context) {
+	types := []gin.H{
+		{
+			"schemas": []string{scim.SchemaResourceType}, "id": "User", "name": "User", "endpoint": "/Users",
+			"schema":           scim.SchemaUser,
+			"schemaExtensions": []gin.H{{"schema": scim.SchemaEnterpriseUser, "required": false}},
+			"meta":             gin.H{"resourceType": "ResourceType", "location": scimBaseURL + "/ResourceTypes/User"},
+		},
+		{
+			"schemas": []string{scim.SchemaResourceType}, "id": "Group", "name": "Group", "endpoint": "/Groups",
+			"schema": scim.SchemaGroup,
+			"meta":   gin.H{"resourceType": "ResourceType", "location": scimBaseURL + "/ResourceTypes/Group"},
+		},
+	}
+	sendSCIM(c, http.StatusOK, scim.Page(types, 1, len(types)))
+}
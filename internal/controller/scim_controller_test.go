@@ -0,0 +1,269 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/global"
+	"siro-backend/internal/middlewares"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/scim"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"github.com/go-sql-driver/mysql"
+)
+
+// serveSCIM sends req to handler, registered at route, as the SCIM client
+func serveSCIM(route string, req *http.Request, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(req.Method, route, func(c *gin.Context) {
+		c.Set("actorName", middlewares.SCIMActor)
+	}, handler)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// scimRequest is a SCIM request with a JSON body (none if body is "")
+func scimRequest(method, path, body, ifMatch string) *http.Request {
+	req := jsonRequest(method, path, body)
+	if ifMatch != "" {
+		req.Header.Set("If-Match", ifMatch)
+	}
+	return req
+}
+
+// decodeSCIM decodes the body of a SCIM response into v
+func decodeSCIM(t *testing.T, w *httptest.ResponseRecorder, v interface{}) {
+	t.Helper()
+	if err := json.Unmarshal(w.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", w.Body, err)
+	}
+}
+
+// scimErrorOf decodes a SCIM error response and checks its status
+func scimErrorOf(t *testing.T, w *httptest.ResponseRecorder, status int) scim.Error {
+	t.Helper()
+	if w.Code != status {
+		t.Fatalf("status = %d, want %d, body %s", w.Code, status, w.Body)
+	}
+	var e scim.Error
+	decodeSCIM(t, w, &e)
+	if e.StatusCode() != status {
+		t.Errorf("error status = %q, want %d", e.Status, status)
+	}
+	return e
+}
+
+// userListColumns are the columns repo.GetAllUsers reads
+var userListColumns = []string{"id", "name", "email", "role", "unit", "phone", "availability", "can_crud", "avatar_url", "version",
+	"deactivated_at", "anonymized_at", "must_change_password", "invited", "external_id", "created_at", "updated_at"}
+
+// expectAllUsers expects repo.GetAllUsers (without filters) to return users
+func expectAllUsers(mock sqlmock.Sqlmock, users ...testUser) {
+	rows := sqlmock.NewRows(userListColumns)
+	for _, u := range users {
+		rows.AddRow(u.ID, u.name(), u.email(), u.Role, u.Unit, "", "Online", true, "", 1,
+			u.DeactivatedAt, u.AnonymizedAt, false, false, "", testTime, testTime)
+	}
+	mock.ExpectQuery(`FROM users WHERE service_account = FALSE ORDER BY id`).WillReturnRows(rows)
+}
+
+// expectUserUpdate expects repo.UpdateUser to save u (at version 1) with the given role and unit
+func expectUserUpdate(mock sqlmock.Sqlmock, u testUser, role, unit string, affected int64) {
+	mock.ExpectExec("UPDATE users SET name=").
+		WithArgs(u.name(), u.email(), unit, "", role, true, "", "", false, "", u.ID, 1).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+}
+
+const scimNewUser = `{"schemas": ["urn:ietf:params:scim:schemas:core:2.0:User"], "userName": "budi@example.com",
+	"name": {"formatted": "Budi"}, "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "it"}}`
+
+func TestSCIMCreateDuplicate(t *testing.T) {
+	setupTest(t)
+	mock := testutil.MockDB(t)
+	expectUnits(mock)
+	mock.ExpectExec("INSERT INTO users").
+		WithArgs("Budi", "budi@example.com", "", false, global.RoleStaff, "IT", "", false, sqlmock.AnyArg(), "", "", false).
+		WillReturnError(&mysql.MySQLError{Number: 1062, Message: "Duplicate entry"})
+
+	w := serveSCIM("/Users", scimRequest(http.MethodPost, "/Users", scimNewUser, ""), SCIMCreateUser)
+	if e := scimErrorOf(t, w, http.StatusConflict); e.ScimType != scim.ErrUniqueness {
+		t.Errorf("scimType = %q, want %q", e.ScimType, scim.ErrUniqueness)
+	}
+}
+
+// active=false deactivates (sessions and keys included); the reloaded user has a new version
+func TestSCIMPatchActive(t *testing.T) {
+	setupTest(t)
+	deactivated := testTime
+	u := testUser{ID: 9, Role: global.RoleStaff, Unit: "IT"}
+
+	mock := testutil.MockDB(t)
+	expectUser(mock, u)
+	expectUnits(mock) // the current resource
+	expectUnits(mock) // the unit of the patched resource
+	expectDeactivate(mock, 9)
+	expectAudit(mock, auditUserDeactivate)
+	u.DeactivatedAt, u.Version = &deactivated, 2
+	expectUser(mock, u)
+	expectUnits(mock)
+
+	body := `{"schemas": ["urn:ietf:params:scim:api:messages:2.0:PatchOp"], "Operations": [{"op": "replace", "path": "active", "value": "False"}]}`
+	w := serveSCIM("/Users/:id", scimRequest(http.MethodPatch, "/Users/9", body, `W/"1"`), SCIMPatchUser)
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+	var got scim.User
+	decodeSCIM(t, w, &got)
+	if got.Active == nil || *got.Active {
+		t.Errorf("active = %v, want false", got.Active)
+	}
+	if tag := w.Header().Get("ETag"); tag != `W/"2"` || got.Meta.Version != tag {
+		t.Errorf("ETag = %q, meta.version = %q, want W/\"2\"", tag, got.Meta.Version)
+	}
+}
+
+// Every user is in exactly one unit and one role group: joining one moves the user there
+func TestSCIMGroupMembership(t *testing.T) {
+	setupTest(t)
+	staff := testUser{ID: 9, Role: global.RoleStaff, Unit: "IT"}
+	promoted := testUser{ID: 9, Role: global.RoleAdmin, Unit: "IT"}
+	add := `{"Operations": [{"op": "add", "path": "members", "value": [{"value": "9"}]}]}`
+	empty := `{"Operations": [{"op": "replace", "path": "members", "value": []}]}`
+
+	tests := []struct {
+		name       string
+		group      string
+		body       string
+		user       testUser
+		role, unit string // what the user is saved with, "" if nothing is saved
+		status     int
+		members    int
+	}{
+		{"join a unit", "unit-2", add, staff, global.RoleStaff, "Facilities", http.StatusOK, 1},
+		{"join the admins", "role-admin", add, staff, global.RoleAdmin, "IT", http.StatusOK, 1},
+		{"leave the admins", "role-admin", empty, promoted, global.RoleStaff, "IT", http.StatusOK, 0},
+		{"leave a unit", "unit-1", empty, staff, "", "", http.StatusBadRequest, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectAllUsers(mock, tt.user)
+			expectUnits(mock)
+			expectUser(mock, tt.user)
+			if tt.role != "" {
+				expectUserUpdate(mock, tt.user, tt.role, tt.unit, 1)
+				expectAudit(mock, auditUserUpdate)
+				expectAllUsers(mock, testUser{ID: 9, Role: tt.role, Unit: tt.unit})
+				expectUnits(mock)
+			}
+
+			w := serveSCIM("/Groups/:id", scimRequest(http.MethodPatch, "/Groups/"+tt.group, tt.body, ""), SCIMPatchGroup)
+			if tt.status != http.StatusOK {
+				if e := scimErrorOf(t, w, tt.status); e.ScimType != scim.ErrMutability {
+					t.Errorf("scimType = %q, want %q", e.ScimType, scim.ErrMutability)
+				}
+				return
+			}
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d, body %s", w.Code, w.Body)
+			}
+			var g scim.Group
+			decodeSCIM(t, w, &g)
+			if len(g.Members) != tt.members {
+				t.Errorf("members = %+v, want %d", g.Members, tt.members)
+			}
+		})
+	}
+}
+
+// Anonymized users count as deleted and service accounts aren't provisioned by SCIM
+func TestSCIMHiddenUsers(t *testing.T) {
+	setupTest(t)
+	anonymized := testTime
+	hidden := map[string]testUser{
+		"anonymized":      {ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &anonymized, AnonymizedAt: &anonymized},
+		"service account": {ID: 9, Role: global.RoleStaff, Unit: "IT", ServiceAccount: true},
+	}
+	endpoints := []struct {
+		method  string
+		body    string
+		handler gin.HandlerFunc
+	}{
+		{http.MethodGet, "", SCIMGetUser},
+		{http.MethodPut, scimNewUser, SCIMReplaceUser},
+		{http.MethodPatch, `{"Operations": [{"op": "replace", "path": "active", "value": true}]}`, SCIMPatchUser},
+		{http.MethodDelete, "", SCIMDeleteUser},
+	}
+	for name, u := range hidden {
+		for _, ep := range endpoints {
+			t.Run(name+" "+ep.method, func(t *testing.T) {
+				mock := testutil.MockDB(t)
+				expectUser(mock, u)
+				w := serveSCIM("/Users/:id", scimRequest(ep.method, "/Users/9", ep.body, ""), ep.handler)
+				scimErrorOf(t, w, http.StatusNotFound)
+			})
+		}
+	}
+}
+
+// meta.version is a weak ETag that PUT, PATCH and DELETE check
+func TestSCIMIfMatch(t *testing.T) {
+	setupTest(t)
+	u := testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", Version: 2}
+	patch := `{"Operations": [{"op": "replace", "path": "active", "value": false}]}`
+
+	for _, ep := range []struct {
+		method  string
+		body    string
+		handler gin.HandlerFunc
+	}{
+		{http.MethodPut, scimNewUser, SCIMReplaceUser},
+		{http.MethodPatch, patch, SCIMPatchUser},
+		{http.MethodDelete, "", SCIMDeleteUser},
+	} {
+		t.Run("stale "+ep.method, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectUser(mock, u)
+			w := serveSCIM("/Users/:id", scimRequest(ep.method, "/Users/9", ep.body, `W/"1"`), ep.handler)
+			scimErrorOf(t, w, http.StatusPreconditionFailed)
+			if tag := w.Header().Get("ETag"); tag != `W/"2"` {
+				t.Errorf("ETag = %q, want W/\"2\"", tag)
+			}
+		})
+	}
+
+	t.Run("current", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, u)
+		expectDeactivate(mock, 9)
+		expectAudit(mock, auditUserDeactivate)
+		w := serveSCIM("/Users/:id", scimRequest(http.MethodDelete, "/Users/9", "", `W/"2"`), SCIMDeleteUser)
+		if w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	// Changed between reading and saving: 412 when the client sent If-Match, 409 otherwise
+	for _, tt := range []struct {
+		ifMatch string
+		status  int
+	}{
+		{`W/"1"`, http.StatusPreconditionFailed},
+		{"", http.StatusConflict},
+	} {
+		t.Run("lost race "+tt.ifMatch, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT"})
+			expectUnits(mock)
+			mock.ExpectExec("UPDATE users SET name=").
+				WithArgs("Budi", "budi@example.com", "IT", "", global.RoleStaff, true, "", "", false, "", 9, 1).
+				WillReturnResult(sqlmock.NewResult(0, 0))
+			w := serveSCIM("/Users/:id", scimRequest(http.MethodPut, "/Users/9", scimNewUser, tt.ifMatch), SCIMReplaceUser)
+			scimErrorOf(t, w, tt.status)
+		})
+	}
+}
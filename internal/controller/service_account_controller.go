@@ -0,0 +1,204 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiKeyPrefix starts every API key, so leaked keys are easy to recognise (e.g. by secret scanners)
+const apiKeyPrefix = "siro_"
+
+// loadServiceAccount loads the service account from the :id parameter; other users answer 404
+func loadServiceAccount(c *gin.Context) (*models.User, bool) {
+	id, ok := parseID(c, "id")
+	if !ok {
+		return nil, false
+	}
+	user, err := repo.GetUserByID(c.Request.Context(), id)
+	if err != nil || !user.ServiceAccount {
+		sendError(c, http.StatusNotFound, response.CodeServiceAccountNotFound, "Service account not found")
+		return nil, false
+	}
+	return user, true
+}
+
+// GetServiceAccounts returns all service accounts with their API keys (admin only)
+// The keys themselves are never returned, only their prefix
+func GetServiceAccounts(c *gin.Context) {
+	accounts, err := repo.GetServiceAccounts(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to get service accounts", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch service accounts")
+		return
+	}
+	sendSuccess(c, accounts)
+}
+
+// CreateServiceAccount creates a service account for an integration (admin only)
+// It is a Staff user of the given unit without a password, so it can only use API keys
+func CreateServiceAccount(c *gin.Context) {
+	var input models.ServiceAccountRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	suffix, err := utils.RandomToken()
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create service account")
+		return
+	}
+	user := models.User{
+		Name:           input.Name,
+		Email:          fmt.Sprintf("svc-%s@service-accounts.invalid", strings.ToLower(suffix[:16])),
+		Role:           global.RoleStaff,
+		Unit:           input.Unit,
+		CanCRUD:        true,
+		AvatarURL:      fmt.Sprintf("%s/%s/default-avatar.jpg", utils.GetBaseURL(), global.DirUploads),
+		ServiceAccount: true,
+	}
+	if err := repo.CreateUser(c.Request.Context(), &user); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to create service account", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create service account")
+		return
+	}
+
+	recordAudit(c, auditServiceAccountCreate, "service_account", user.ID,
+		audit.Diff(nil, map[string]interface{}{"name": user.Name, "unit": user.Unit}))
+	sendCreated(c, models.ServiceAccount{
+		ID:        user.ID,
+		Name:      user.Name,
+		Unit:      user.Unit,
+		CreatedAt: time.Now().Truncate(time.Second),
+		Keys:      []models.APIKey{},
+	})
+}
+
+// DeactivateServiceAccount deactivates a service account and revokes all its keys (admin only)
+func DeactivateServiceAccount(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+
+	if err := repo.DeactivateServiceAccount(c.Request.Context(), account.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to deactivate service account", "target_user_id", account.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to deactivate service account")
+		return
+	}
+
+	if account.DeactivatedAt == nil {
+		recordAudit(c, auditServiceAccountDeactivate, "service_account", account.ID, "{}")
+	}
+	sendSuccess(c, gin.H{"message": "Service account deactivated and its API keys revoked"})
+}
+
+// CreateAPIKey creates an API key for a service account (admin only)
+// The key is only in this response; afterwards only its prefix is shown
+func CreateAPIKey(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+	if account.DeactivatedAt != nil {
+		sendError(c, http.StatusConflict, response.CodeUserDeactivated, "Service account is deactivated")
+		return
+	}
+
+	var input models.APIKeyRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	seen := map[string]bool{}
+	for _, s := range input.Scopes {
+		if seen[s.Scope] {
+			sendError(c, http.StatusBadRequest, response.CodeBadRequest, "Scope "+s.Scope+" is listed twice")
+			return
+		}
+		seen[s.Scope] = true
+		if len(s.Units) > 0 && s.Scope != global.ScopeWorkOrdersCreate {
+			sendError(c, http.StatusBadRequest, response.CodeBadRequest, "Only "+global.ScopeWorkOrdersCreate+" can be limited to units")
+			return
+		}
+	}
+	if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+		sendError(c, http.StatusBadRequest, response.CodeBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	token, err := utils.RandomToken()
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create API key")
+		return
+	}
+	key := apiKeyPrefix + token
+	k := models.APIKey{
+		ServiceAccountID: account.ID,
+		Name:             input.Name,
+		Prefix:           key[:12],
+		Scopes:           input.Scopes,
+		AllowedIPs:       input.AllowedIPs,
+		ExpiresAt:        input.ExpiresAt,
+	}
+
+	var createdBy *uint
+	if id, ok := getUserID(c); ok {
+		createdBy = &id
+	}
+	if err := repo.CreateAPIKey(c.Request.Context(), &k, utils.HashToken(key), createdBy); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to create api key", "target_user_id", account.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create API key")
+		return
+	}
+
+	recordAudit(c, auditAPIKeyCreate, "api_key", k.ID, audit.Diff(nil, map[string]interface{}{
+		"service_account_id": k.ServiceAccountID,
+		"name":               k.Name,
+		"prefix":             k.Prefix,
+		"scopes":             k.Scopes,
+		"allowed_ips":        k.AllowedIPs,
+		"expires_at":         k.ExpiresAt,
+	}))
+	k.Key = key
+	sendCreated(c, k)
+}
+
+// RevokeAPIKey stops an API key from working (admin only); revoking twice is harmless
+func RevokeAPIKey(c *gin.Context) {
+	account, ok := loadServiceAccount(c)
+	if !ok {
+		return
+	}
+	keyID, ok := parseID(c, "keyId")
+	if !ok {
+		return
+	}
+
+	if err := repo.RevokeAPIKey(c.Request.Context(), account.ID, keyID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			sendError(c, http.StatusNotFound, response.CodeNotFound, "API key not found")
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to revoke api key", "api_key_id", keyID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to revoke API key")
+		return
+	}
+
+	recordAudit(c, auditAPIKeyRevoke, "api_key", keyID, "{}")
+	sendSuccess(c, gin.H{"message": "API key revoked"})
+}
@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/response"
+
+	"github.com/gin-gonic/gin"
+)
+
+// GetUnits returns all units (for dropdowns in the frontend)
+func GetUnits(c *gin.Context) {
+	units, err := repo.GetUnits(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to get units", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch units")
+		return
+	}
+	sendSuccess(c, units)
+}
+
+// CreateUnit adds a new unit (admin only)
+// Users and work orders can only use units that exist
+func CreateUnit(c *gin.Context) {
+	var input models.UnitRequest
+	if err := c.ShouldBindJSON(&input); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	unit := models.Unit{Name: input.Name}
+	if err := repo.CreateUnit(c.Request.Context(), &unit); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			// The unique index also rejects names that only differ in case
+			sendError(c, http.StatusConflict, response.CodeUnitExists, "Unit already exists")
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to create unit", "name", input.Name, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create unit")
+		return
+	}
+
+	recordAudit(c, auditUnitCreate, "unit", unit.ID, audit.Diff(nil, map[string]interface{}{"name": unit.Name}))
+	sendCreated(c, unit)
+}
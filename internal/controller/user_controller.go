@@ -1,14 +1,18 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net/http"
 	"os"
 	"path/filepath"
 	"siro-backend/global"
 	"siro-backend/internal/models"
 	"siro-backend/internal/repo"
+	"siro-backend/pkg/mailer"
+	"siro-backend/pkg/response"
 	"siro-backend/pkg/utils"
 	"strings"
 
@@ -17,7 +21,7 @@ import (
 
 // deleteOldAvatar removes an old avatar file from disk
 // Called when a user uploads a new avatar
-func deleteOldAvatar(avatarURL string) {
+func deleteOldAvatar(ctx context.Context, avatarURL string) {
 	// Check if URL contains the upload directory path
 	targetDir := fmt.Sprintf("/%s/%s/", global.DirUploads, global.DirAvatar)
 	if !strings.Contains(avatarURL, targetDir) {
@@ -39,16 +43,27 @@ func deleteOldAvatar(avatarURL string) {
 	// Try to delete the file
 	// If it fails, log error but don't crash the app
 	if err := os.Remove(filePath); err != nil {
-		log.Printf("Warning: Failed to delete old avatar file %s: %v", filePath, err)
+		slog.WarnContext(ctx, "failed to delete old avatar file", "path", filePath, "error", err)
 	}
 }
 
+// sendUserConflict reloads a user after a failed version check and returns it to the client
+func sendUserConflict(c *gin.Context, userID uint) {
+	current, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil {
+		sendError(c, http.StatusNotFound, response.CodeUserNotFound, "User not found")
+		return
+	}
+	sendVersionConflict(c, current, current.Version)
+}
+
 // GetMe returns the current user's information
 func GetMe(c *gin.Context) {
 	user, ok := getCurrentUser(c)
 	if !ok {
 		return
 	}
+	setETag(c, user.Version)
 	sendSuccess(c, user)
 }
 
@@ -62,7 +77,11 @@ func UpdateMe(c *gin.Context) {
 	// Parse request body
 	var input models.UserRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
+		return
+	}
+
+	if !checkIfMatch(c, user, user.Version) {
 		return
 	}
 
@@ -74,7 +93,7 @@ func UpdateMe(c *gin.Context) {
 	if input.AvatarURL != "" {
 		// Delete old avatar if user is uploading a new one
 		if user.AvatarURL != "" && user.AvatarURL != input.AvatarURL {
-			deleteOldAvatar(user.AvatarURL)
+			deleteOldAvatar(c.Request.Context(), user.AvatarURL)
 		}
 		user.AvatarURL = input.AvatarURL
 	}
@@ -82,17 +101,24 @@ func UpdateMe(c *gin.Context) {
 	if input.Password != "" {
 		hashedPassword, err := utils.HashPassword(input.Password)
 		if err != nil {
-			sendError(c, http.StatusInternalServerError, "Failed to hash password")
+			sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
 			return
 		}
 		user.PasswordHash = hashedPassword
+		user.MustChangePassword = false
 	}
 
-	if err := repo.UpdateUser(user.ID, *user); err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to update profile")
+	if err := repo.UpdateUser(c.Request.Context(), user.ID, *user); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			sendUserConflict(c, user.ID)
+			return
+		}
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to update profile")
 		return
 	}
 
+	user.Version++
+	setETag(c, user.Version)
 	sendSuccess(c, user)
 }
 
@@ -100,14 +126,14 @@ func UpdateMe(c *gin.Context) {
 func UploadFile(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		sendError(c, http.StatusBadRequest, "File required (max 2MB)")
+		sendError(c, http.StatusBadRequest, response.CodeFileRequired, "File required (max "+utils.MaxUploadSizeLabel()+")")
 		return
 	}
 
 	uploadConfig := utils.DefaultImageConfig(global.DirAvatar)
 	relativePath, err := utils.SaveUploadedFile(file, uploadConfig)
 	if err != nil {
-		sendError(c, http.StatusBadRequest, err.Error())
+		sendError(c, http.StatusBadRequest, response.CodeFileInvalid, err.Error())
 		return
 	}
 
@@ -122,9 +148,9 @@ func GetStaffList(c *gin.Context) {
 		return
 	}
 
-	staff, err := repo.GetUsersByUnit(user.Unit)
+	staff, err := repo.GetUsersByUnit(c.Request.Context(), user.Unit)
 	if err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to fetch staff")
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch staff")
 		return
 	}
 	sendSuccess(c, staff)
@@ -139,23 +165,12 @@ func UpdateAvailability(c *gin.Context) {
 
 	var input models.AvailabilityRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input")
+		sendBindError(c, err)
 		return
 	}
 
-	validStatuses := map[string]bool{
-		global.AvailOnline:  true,
-		global.AvailBusy:    true,
-		global.AvailAway:    true,
-		global.AvailOffline: true,
-	}
-	if !validStatuses[input.Status] {
-		sendError(c, http.StatusBadRequest, "Invalid status. Must be: Online, Busy, Away, or Offline")
-		return
-	}
-
-	if err := repo.UpdateAvailability(userID, input.Status); err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to update availability")
+	if err := repo.UpdateAvailability(c.Request.Context(), userID, input.Status); err != nil {
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to update availability")
 		return
 	}
 
@@ -164,56 +179,89 @@ func UpdateAvailability(c *gin.Context) {
 
 // --- ADMIN ONLY HANDLERS ---
 
-// GetAllUsers returns all users (admin only)
+// GetAllUsers returns all users, optionally filtered by role, unit and status (admin only)
 func GetAllUsers(c *gin.Context) {
-	users, err := repo.GetAllUsers()
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		sendBindError(c, err)
+		return
+	}
+
+	users, err := repo.GetAllUsers(c.Request.Context(), userQuery(filter))
 	if err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to fetch users")
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch users")
 		return
 	}
 	sendSuccess(c, users)
 }
 
+// GetUser returns a single user with its ETag (admin only)
+func GetUser(c *gin.Context) {
+	userID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || user.ServiceAccount {
+		sendError(c, http.StatusNotFound, response.CodeUserNotFound, "User not found")
+		return
+	}
+
+	setETag(c, user.Version)
+	sendSuccess(c, user)
+}
+
 // CreateUser creates a new user (admin only)
+// Without a password the user is created as invited; with "invite": true the invitation link is
+// sent (or returned, when email is not configured) so they can choose their own password
 func CreateUser(c *gin.Context) {
 	var input models.UserRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
 		return
 	}
 
-	hashedPassword, err := utils.HashPassword(input.Password)
-	if err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to hash password")
+	if input.Invite && input.Password != "" {
+		sendError(c, http.StatusBadRequest, response.CodeBadRequest, "Leave the password empty when inviting a user")
 		return
 	}
 
-	defaultAvatar := fmt.Sprintf("%s/%s/default-avatar.jpg", utils.GetBaseURL(), global.DirUploads)
-	if input.AvatarURL != "" {
-		defaultAvatar = input.AvatarURL
+	newUser := *newUserFromRequest(input)
+	if input.Password != "" {
+		hashedPassword, err := utils.HashPassword(input.Password)
+		if err != nil {
+			sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
+			return
+		}
+		newUser.PasswordHash = hashedPassword
+		newUser.MustChangePassword = input.MustChangePassword
 	}
+	newUser.Invited = newUser.PasswordHash == ""
 
-	newUser := models.User{
-		Name:         input.Name,
-		Email:        input.Email,
-		Role:         input.Role,
-		Unit:         input.Unit,
-		Phone:        input.Phone,
-		CanCRUD:      input.CanCRUD,
-		PasswordHash: hashedPassword,
-		Availability: global.AvailOffline,
-		AvatarURL:    defaultAvatar,
+	if err := repo.CreateUser(c.Request.Context(), &newUser); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			sendError(c, http.StatusConflict, response.CodeEmailExists, "Email is already used by another user")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create user")
+		return
 	}
 
-	if err := repo.CreateUser(&newUser); err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to create user")
-		return
+	recordAudit(c, auditUserCreate, "user", newUser.ID, userDiff(nil, userAuditFields(newUser)))
+
+	if input.Invite {
+		invitation, msg, err := createInvitation(c, &newUser)
+		if err != nil {
+			// The user exists; the admin can retry with POST /admin/users/:id/invite
+			slog.ErrorContext(c.Request.Context(), "failed to create invitation", "target_user_id", newUser.ID, "error", err)
+		} else {
+			newUser.Invitation = invitation
+			queueEmails(c, []mailer.Message{msg})
+		}
 	}
 
-	c.JSON(http.StatusCreated, gin.H{
-		"statusCode": http.StatusCreated,
-		"data":       newUser,
-	})
+	sendCreated(c, newUser)
 }
 
 // UpdateUser updates an existing user (admin only)
@@ -225,15 +273,25 @@ func UpdateUser(c *gin.Context) {
 
 	var input models.UserRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
 		return
 	}
 
-	user, err := repo.GetUserByID(userID)
-	if err != nil {
-		sendError(c, http.StatusNotFound, "User not found")
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || user.ServiceAccount {
+		sendError(c, http.StatusNotFound, response.CodeUserNotFound, "User not found")
+		return
+	}
+
+	if user.AnonymizedAt != nil {
+		sendError(c, http.StatusConflict, response.CodeUserAnonymized, "User data was erased and can't be edited")
+		return
+	}
+
+	if !checkIfMatch(c, user, user.Version) {
 		return
 	}
+	before := userAuditFields(*user)
 
 	// Update user fields
 	user.Name = input.Name
@@ -242,12 +300,14 @@ func UpdateUser(c *gin.Context) {
 	user.Unit = input.Unit
 	user.Phone = input.Phone
 	user.CanCRUD = input.CanCRUD
+	mustChangeSet := input.MustChangePassword && !user.MustChangePassword
+	user.MustChangePassword = input.MustChangePassword
 
 	// Handle avatar update
 	if input.AvatarURL != "" {
 		// Delete old avatar if user is uploading a new one
 		if user.AvatarURL != "" && user.AvatarURL != input.AvatarURL {
-			deleteOldAvatar(user.AvatarURL)
+			deleteOldAvatar(c.Request.Context(), user.AvatarURL)
 		}
 		user.AvatarURL = input.AvatarURL
 	}
@@ -255,36 +315,134 @@ func UpdateUser(c *gin.Context) {
 	if input.Password != "" {
 		hashedPassword, err := utils.HashPassword(input.Password)
 		if err != nil {
-			sendError(c, http.StatusInternalServerError, "Failed to hash password")
+			sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
 			return
 		}
 		user.PasswordHash = hashedPassword
 	}
 
-	if err := repo.UpdateUser(user.ID, *user); err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to update user")
+	if err := repo.UpdateUser(c.Request.Context(), user.ID, *user); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			sendUserConflict(c, user.ID)
+			return
+		}
+		if errors.Is(err, repo.ErrDuplicate) {
+			sendError(c, http.StatusConflict, response.CodeEmailExists, "Email is already used by another user")
+			return
+		}
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to update user")
 		return
 	}
 
+	if after := userAuditFields(*user); userDiff(before, after) != "{}" {
+		recordAudit(c, auditUserUpdate, "user", user.ID, userDiff(before, after))
+	}
+	if input.Password != "" {
+		recordAudit(c, auditUserPasswordReset, "user", user.ID, "{}")
+	}
+	if mustChangeSet {
+		// End the current sessions, so the new password is needed right away
+		if err := repo.DeleteToken(c.Request.Context(), user.ID); err != nil {
+			slog.WarnContext(c.Request.Context(), "failed to revoke sessions", "target_user_id", user.ID, "error", err)
+		}
+	}
+
+	user.Version++
+	setETag(c, user.Version)
 	sendSuccess(c, user)
 }
 
-// DeleteUser deletes a user (admin only)
+// DeleteUser deactivates a user (admin only)
+// Users are never removed, because work orders and logs refer to them; see AnonymizeUser for erasure
 func DeleteUser(c *gin.Context) {
-	userID, ok := parseID(c, "id")
+	user, ok := loadUserForAdmin(c)
+	if !ok {
+		return
+	}
+
+	if adminID, _ := getUserID(c); adminID == user.ID {
+		sendError(c, http.StatusBadRequest, response.CodeBadRequest, "You cannot deactivate your own account")
+		return
+	}
+
+	if err := repo.DeactivateUser(c.Request.Context(), user.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to deactivate user", "target_user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to deactivate user")
+		return
+	}
+
+	if user.DeactivatedAt == nil {
+		recordAudit(c, auditUserDeactivate, "user", user.ID, "{}")
+	}
+	sendSuccess(c, gin.H{"message": "User deactivated successfully"})
+}
+
+// ReactivateUser lets a deactivated user log in again (admin only)
+func ReactivateUser(c *gin.Context) {
+	user, ok := loadUserForAdmin(c)
 	if !ok {
 		return
 	}
 
-	user, err := repo.GetUserByID(userID)
-	if err == nil && user.AvatarURL != "" {
-		deleteOldAvatar(user.AvatarURL)
+	if user.AnonymizedAt != nil {
+		sendError(c, http.StatusConflict, response.CodeUserAnonymized, "User data was erased, the account can't be reactivated")
+		return
+	}
+
+	if err := repo.ReactivateUser(c.Request.Context(), user.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to reactivate user", "target_user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to reactivate user")
+		return
+	}
+
+	if user.DeactivatedAt != nil {
+		recordAudit(c, auditUserReactivate, "user", user.ID, "{}")
+	}
+	sendSuccess(c, gin.H{"message": "User reactivated successfully"})
+}
+
+// AnonymizeUser erases the personal data of a user for an erasure request (admin only)
+// The user is deactivated too; their work orders remain, shown as "Deleted user #id"
+func AnonymizeUser(c *gin.Context) {
+	user, ok := loadUserForAdmin(c)
+	if !ok {
+		return
+	}
+
+	if adminID, _ := getUserID(c); adminID == user.ID {
+		sendError(c, http.StatusBadRequest, response.CodeBadRequest, "You cannot anonymize your own account")
+		return
+	}
+	if user.AnonymizedAt != nil {
+		sendError(c, http.StatusConflict, response.CodeUserAnonymized, "User is already anonymized")
+		return
 	}
 
-	if err := repo.DeleteUser(userID); err != nil {
-		sendError(c, http.StatusInternalServerError, "Failed to delete user")
+	if err := repo.AnonymizeUser(c.Request.Context(), user.ID); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to anonymize user", "target_user_id", user.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to anonymize user")
 		return
 	}
+	if user.AvatarURL != "" {
+		deleteOldAvatar(c.Request.Context(), user.AvatarURL)
+	}
+
+	// Only the fact is recorded: copying the erased values into the audit log would defeat the purpose
+	recordAudit(c, auditUserAnonymize, "user", user.ID, "{}")
+	sendSuccess(c, gin.H{"message": "User anonymized successfully"})
+}
+
+// loadUserForAdmin loads the user from the :id parameter, or sends 400/404
+func loadUserForAdmin(c *gin.Context) (*models.User, bool) {
+	userID, ok := parseID(c, "id")
+	if !ok {
+		return nil, false
+	}
 
-	sendSuccess(c, gin.H{"message": "User deleted successfully"})
+	user, err := repo.GetUserByID(c.Request.Context(), userID)
+	if err != nil || user.ServiceAccount {
+		sendError(c, http.StatusNotFound, response.CodeUserNotFound, "User not found")
+		return nil, false
+	}
+	return user, true
 }
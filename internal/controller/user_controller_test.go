@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"net/http"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/response"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+var admin = testUser{ID: 1, Role: global.RoleAdmin, Unit: "IT"}
+
+// expectDeactivate expects repo.DeactivateUser of user id: sessions and keys end in the same transaction
+func expectDeactivate(mock sqlmock.Sqlmock, id uint) {
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE users SET deactivated_at=NOW()").WithArgs(global.AvailOffline, id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("DELETE FROM user_tokens").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE api_keys SET revoked_at").WithArgs(id).WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+}
+
+func TestDeleteUser(t *testing.T) {
+	setupTest(t)
+	const route = "/admin/users/:id"
+	deactivated := testTime
+
+	t.Run("deactivates", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT"})
+		expectDeactivate(mock, 9)
+		expectAudit(mock, auditUserDeactivate)
+		if w := serveAs(admin, route, jsonRequest(http.MethodDelete, "/admin/users/9", ""), DeleteUser); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	// Doing it twice is harmless and isn't audited again
+	t.Run("already deactivated", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &deactivated})
+		expectDeactivate(mock, 9)
+		if w := serveAs(admin, route, jsonRequest(http.MethodDelete, "/admin/users/9", ""), DeleteUser); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("own account", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, admin)
+		w := serveAs(admin, route, jsonRequest(http.MethodDelete, "/admin/users/1", ""), DeleteUser)
+		if w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+
+	// Service accounts are managed under /admin/service-accounts
+	t.Run("service account", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", ServiceAccount: true})
+		w := serveAs(admin, route, jsonRequest(http.MethodDelete, "/admin/users/9", ""), DeleteUser)
+		if w.Code != http.StatusNotFound || testutil.ErrorCode(t, w) != response.CodeUserNotFound {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestReactivateUser(t *testing.T) {
+	setupTest(t)
+	const route = "/admin/users/:id/reactivate"
+	deactivated := testTime
+
+	t.Run("reactivates", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &deactivated})
+		mock.ExpectExec("UPDATE users SET deactivated_at=NULL").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectAudit(mock, auditUserReactivate)
+		if w := serveAs(admin, route, jsonRequest(http.MethodPost, "/admin/users/9/reactivate", ""), ReactivateUser); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("anonymized", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &deactivated, AnonymizedAt: &deactivated})
+		w := serveAs(admin, route, jsonRequest(http.MethodPost, "/admin/users/9/reactivate", ""), ReactivateUser)
+		if w.Code != http.StatusConflict || testutil.ErrorCode(t, w) != response.CodeUserAnonymized {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+}
+
+func TestAnonymizeUser(t *testing.T) {
+	setupTest(t)
+	const route = "/admin/users/:id/anonymize"
+	anonymized := testTime
+
+	t.Run("anonymizes", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT"})
+		mock.ExpectBegin()
+		mock.ExpectExec("UPDATE users SET name=\\?, email=\\?").WithArgs("Deleted user #9", "deleted-9@anonymized.invalid", global.AvailOffline, 9).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE activity_logs SET user_name").WithArgs("Deleted user #9", 9).WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectExec("DELETE FROM user_tokens").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE api_keys SET revoked_at").WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		// Only the fact is audited, the erased values stay out of the log
+		mock.ExpectBegin()
+		mock.ExpectQuery("SELECT last_hash FROM audit_chain_head").WillReturnRows(sqlmock.NewRows([]string{"last_hash"}).AddRow(audit.GenesisHash))
+		mock.ExpectExec("INSERT INTO audit_log").
+			WithArgs(sqlmock.AnyArg(), sqlmock.AnyArg(), auditUserAnonymize, sqlmock.AnyArg(), sqlmock.AnyArg(), "{}",
+				sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE audit_chain_head").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		if w := serveAs(admin, route, jsonRequest(http.MethodPost, "/admin/users/9/anonymize", ""), AnonymizeUser); w.Code != http.StatusOK {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("twice", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &anonymized, AnonymizedAt: &anonymized})
+		w := serveAs(admin, route, jsonRequest(http.MethodPost, "/admin/users/9/anonymize", ""), AnonymizeUser)
+		if w.Code != http.StatusConflict || testutil.ErrorCode(t, w) != response.CodeUserAnonymized {
+			t.Fatalf("status = %d, body %s", w.Code, w.Body)
+		}
+	})
+
+	t.Run("own account", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, admin)
+		if w := serveAs(admin, route, jsonRequest(http.MethodPost, "/admin/users/1/anonymize", ""), AnonymizeUser); w.Code != http.StatusBadRequest {
+			t.Fatalf("status = %d, want 400", w.Code)
+		}
+	})
+}
+
+// A deactivated user's old access token stops working even before the session check catches it
+func TestGetMeDeactivated(t *testing.T) {
+	setupTest(t)
+	deactivated := testTime
+	u := testUser{ID: 9, Role: global.RoleStaff, Unit: "IT", DeactivatedAt: &deactivated}
+
+	mock := testutil.MockDB(t)
+	expectUser(mock, u)
+	w := serveAs(u, "/me", jsonRequest(http.MethodGet, "/me", ""), GetMe)
+	if w.Code != http.StatusUnauthorized || testutil.ErrorCode(t, w) != response.CodeUserDeactivated {
+		t.Fatalf("status = %d, body %s", w.Code, w.Body)
+	}
+}
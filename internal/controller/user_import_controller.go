@@ -0,0 +1,419 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/mailer"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/spreadsheet"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/validation"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// userColumns are the columns of the import file
+// Import needs at least name, email and unit; the others are optional
+var userColumns = []string{"name", "email", "role", "unit", "phone", "can_crud", "password"}
+
+// ImportUsers creates users from a CSV or XLSX file (admin only)
+// With ?dry_run=true the file is only checked. Every row is validated like POST /admin/users,
+// plus duplicate emails in the file and in the database; if any row fails nothing is created.
+// Rows without a password are created as invited users; ?invite=true also sends their invitations
+func ImportUsers(c *gin.Context) {
+	ctx := c.Request.Context()
+	dryRun := c.Query("dry_run") == "true"
+	invite := c.Query("invite") == "true"
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		sendError(c, http.StatusBadRequest, response.CodeFileRequired, "File required (.csv or .xlsx, max "+utils.MaxUploadSizeLabel()+")")
+		return
+	}
+	format, err := spreadsheet.FormatOf(file.Filename)
+	if err == nil && file.Size > utils.MaxUploadSize() {
+		err = fmt.Errorf("file too large (max %s)", utils.MaxUploadSizeLabel())
+	}
+	if err != nil {
+		sendError(c, http.StatusBadRequest, response.CodeFileInvalid, err.Error())
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		sendError(c, http.StatusBadRequest, response.CodeFileInvalid, "Failed to read file")
+		return
+	}
+	defer f.Close()
+
+	rows, err := spreadsheet.Read(f, format)
+	if err != nil {
+		sendError(c, http.StatusBadRequest, response.CodeFileInvalid, err.Error())
+		return
+	}
+
+	result, inputs := parseUserImport(c, rows)
+	result.DryRun = dryRun
+
+	if len(result.Errors) == 0 {
+		result.Errors = checkImportEmails(c, inputs)
+	}
+	if len(result.Errors) > 0 {
+		if dryRun {
+			sendSuccess(c, result)
+		} else {
+			response.ErrorWithData(c, http.StatusUnprocessableEntity, response.CodeImportInvalid,
+				fmt.Sprintf("%d problem(s) found, no users were created", len(result.Errors)), result)
+		}
+		return
+	}
+
+	users := make([]*models.User, len(inputs))
+	for i, in := range inputs {
+		users[i] = newUserFromRequest(in.req)
+		users[i].Invited = in.req.Password == ""
+	}
+	if dryRun {
+		for _, u := range users {
+			result.Users = append(result.Users, *u)
+		}
+		sendSuccess(c, result)
+		return
+	}
+
+	if err := hashImportPasswords(ctx, users, inputs); err != nil {
+		slog.ErrorContext(ctx, "failed to hash import passwords", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to hash password")
+		return
+	}
+
+	if err := repo.CreateUsers(ctx, users); err != nil {
+		if errors.Is(err, repo.ErrDuplicate) {
+			// Someone created one of these emails after the check above
+			sendError(c, http.StatusConflict, response.CodeEmailExists, "An email in the file is already used, no users were created")
+			return
+		}
+		slog.ErrorContext(ctx, "failed to import users", "rows", len(users), "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to import users")
+		return
+	}
+
+	var emails []mailer.Message
+	for _, u := range users {
+		recordAudit(c, auditUserCreate, "user", u.ID, userDiff(nil, userAuditFields(*u)))
+		if invite && u.Invited {
+			invitation, msg, err := createInvitation(c, u)
+			if err != nil {
+				// The users exist; the admin can retry with POST /admin/users/:id/invite
+				slog.ErrorContext(ctx, "failed to create invitation", "target_user_id", u.ID, "error", err)
+			} else {
+				u.Invitation = invitation
+				emails = append(emails, msg)
+			}
+		}
+		result.Users = append(result.Users, *u)
+	}
+	queueEmails(c, emails)
+
+	result.Created = len(users)
+	sendCreated(c, result)
+}
+
+// importRow is one valid row of an import file
+type importRow struct {
+	row int // row number in the file
+	req models.UserRequest
+}
+
+// parseUserImport maps the rows to user requests and validates them
+// The first non-blank row is the header; column order doesn't matter and unknown columns are ignored
+func parseUserImport(c *gin.Context, rows [][]string) (models.UserImportResult, []importRow) {
+	result := models.UserImportResult{Errors: []models.ImportRowError{}, Users: []models.User{}}
+
+	header := -1
+	columns := map[string]int{}
+	for i, row := range rows {
+		if isBlankRow(row) {
+			continue
+		}
+		for j, name := range row {
+			columns[strings.ToLower(strings.TrimSpace(name))] = j
+		}
+		header = i
+		break
+	}
+	for _, required := range []string{"name", "email", "unit"} {
+		if _, ok := columns[required]; !ok {
+			result.Errors = append(result.Errors, models.ImportRowError{
+				Row: header + 1, Field: required, Message: "Missing column " + required + " (expected: " + strings.Join(userColumns, ", ") + ")",
+			})
+		}
+	}
+	if len(result.Errors) > 0 {
+		return result, nil
+	}
+
+	units := unitNames(c)
+	lang := c.GetHeader("Accept-Language")
+	var inputs []importRow
+
+	for i := header + 1; i < len(rows); i++ {
+		row := rows[i]
+		if isBlankRow(row) {
+			continue
+		}
+		result.Rows++
+
+		cell := func(name string) string {
+			if j, ok := columns[name]; ok && j < len(row) {
+				return strings.TrimSpace(row[j])
+			}
+			return ""
+		}
+
+		req := models.UserRequest{
+			Name:     cell("name"),
+			Email:    cell("email"),
+			Role:     matchFold(cell("role"), validation.Roles, global.RoleStaff),
+			Unit:     matchFold(cell("unit"), units, cell("unit")),
+			Phone:    cell("phone"),
+			Password: cell("password"),
+		}
+		canCRUD, err := parseYesNo(cell("can_crud"))
+		if err != nil {
+			result.Errors = append(result.Errors, models.ImportRowError{Row: i + 1, Field: "can_crud", Message: err.Error()})
+			continue
+		}
+		req.CanCRUD = canCRUD
+
+		if err := binding.Validator.ValidateStruct(&req); err != nil {
+			var ve validator.ValidationErrors
+			if errors.As(err, &ve) {
+				for _, fe := range ve {
+					result.Errors = append(result.Errors, models.ImportRowError{Row: i + 1, Field: fe.Field(), Message: validation.Message(fe, lang)})
+				}
+			} else {
+				result.Errors = append(result.Errors, models.ImportRowError{Row: i + 1, Message: err.Error()})
+			}
+			continue
+		}
+		inputs = append(inputs, importRow{row: i + 1, req: req})
+	}
+
+	if result.Rows == 0 {
+		result.Errors = append(result.Errors, models.ImportRowError{Row: header + 2, Message: "The file has no users"})
+	}
+	return result, inputs
+}
+
+// checkImportEmails reports emails that appear twice in the file or already belong to a user
+func checkImportEmails(c *gin.Context, inputs []importRow) []models.ImportRowError {
+	errs := []models.ImportRowError{}
+	firstRow := map[string]int{}
+	emails := make([]string, 0, len(inputs))
+
+	for _, in := range inputs {
+		email := strings.ToLower(in.req.Email)
+		if first, ok := firstRow[email]; ok {
+			errs = append(errs, models.ImportRowError{Row: in.row, Field: "email", Message: fmt.Sprintf("Same email as row %d", first)})
+			continue
+		}
+		firstRow[email] = in.row
+		emails = append(emails, email)
+	}
+
+	existing, err := repo.ExistingEmails(c.Request.Context(), emails)
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to check emails", "error", err)
+		return append(errs, models.ImportRowError{Message: "Failed to check emails, try again"})
+	}
+	for _, in := range inputs {
+		if existing[strings.ToLower(in.req.Email)] && firstRow[strings.ToLower(in.req.Email)] == in.row {
+			errs = append(errs, models.ImportRowError{Row: in.row, Field: "email", Message: "Email is already used by another user"})
+		}
+	}
+	return errs
+}
+
+// hashImportPasswords sets the password hash of the users whose row has a password
+// bcrypt takes about a second per password at the default cost, so up to GOMAXPROCS run at once
+// instead of one after the other; it stops early when ctx is done (the client went away)
+func hashImportPasswords(ctx context.Context, users []*models.User, inputs []importRow) error {
+	var pending []int
+	for i, in := range inputs {
+		if in.req.Password != "" {
+			pending = append(pending, i)
+		}
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+	)
+	jobs := make(chan int)
+	for w := 0; w < min(runtime.GOMAXPROCS(0), len(pending)); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				hash, err := utils.HashPassword(inputs[i].req.Password)
+				if err != nil {
+					mu.Lock()
+					if firstErr == nil {
+						firstErr = err
+					}
+					mu.Unlock()
+					continue
+				}
+				users[i].PasswordHash = hash
+			}
+		}()
+	}
+
+send:
+	for _, i := range pending {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break send
+		}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
+
+// newUserFromRequest builds the user to insert (without the password hash)
+func newUserFromRequest(req models.UserRequest) *models.User {
+	avatar := fmt.Sprintf("%s/%s/default-avatar.jpg", utils.GetBaseURL(), global.DirUploads)
+	if req.AvatarURL != "" {
+		avatar = req.AvatarURL
+	}
+	return &models.User{
+		Name:         req.Name,
+		Email:        req.Email,
+		Role:         req.Role,
+		Unit:         req.Unit,
+		Phone:        req.Phone,
+		CanCRUD:      req.CanCRUD,
+		Availability: global.AvailOffline,
+		AvatarURL:    avatar,
+	}
+}
+
+// ExportUsers downloads the users as CSV or XLSX, with the same filters as GET /admin/users (admin only)
+// It has the import columns except password, plus id, availability and deactivated_at. The import
+// ignores those extra columns, so an edited export can be imported elsewhere (as invited users)
+func ExportUsers(c *gin.Context) {
+	var filter models.UserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		sendBindError(c, err)
+		return
+	}
+	format := c.DefaultQuery("format", spreadsheet.CSV)
+	if format != spreadsheet.CSV && format != spreadsheet.XLSX {
+		sendError(c, http.StatusBadRequest, response.CodeBadRequest, "format must be csv or xlsx")
+		return
+	}
+
+	users, err := repo.GetAllUsers(c.Request.Context(), userQuery(filter))
+	if err != nil {
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch users")
+		return
+	}
+
+	rows := [][]string{{"id", "name", "email", "role", "unit", "phone", "can_crud", "availability", "deactivated_at"}}
+	for _, u := range users {
+		deactivated := ""
+		if u.DeactivatedAt != nil {
+			deactivated = u.DeactivatedAt.Format(time.DateTime)
+		}
+		rows = append(rows, []string{
+			strconv.FormatUint(uint64(u.ID), 10), u.Name, u.Email, u.Role, u.Unit, u.Phone,
+			strconv.FormatBool(u.CanCRUD), u.Availability, deactivated,
+		})
+	}
+
+	contentType := spreadsheet.CSVContentType
+	if format == spreadsheet.XLSX {
+		contentType = spreadsheet.XLSXContentType
+	}
+	filename := fmt.Sprintf("users-%s.%s", time.Now().Format("2006-01-02"), format)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("Content-Type", contentType)
+	c.Status(http.StatusOK)
+	if err := spreadsheet.Write(c.Writer, format, "Users", rows); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to write export", "format", format, "error", err)
+	}
+}
+
+// userQuery turns the (already validated) filter into a repo query
+func userQuery(f models.UserFilter) repo.UserQuery {
+	return repo.UserQuery{Roles: f.Role, Units: f.Unit, Status: f.Status}
+}
+
+// unitNames returns the names of all units (empty on error, then the unit check reports every row)
+func unitNames(c *gin.Context) []string {
+	units, err := repo.GetUnits(c.Request.Context())
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to get units", "error", err)
+		return nil
+	}
+	names := make([]string, len(units))
+	for i, u := range units {
+		names[i] = u.Name
+	}
+	return names
+}
+
+// matchFold returns the value of allowed that equals v ignoring case, v itself if none does,
+// or def when v is empty. So "staff" becomes "Staff" and "it" becomes "IT"
+func matchFold(v string, allowed []string, def string) string {
+	if v == "" {
+		return def
+	}
+	for _, a := range allowed {
+		if strings.EqualFold(a, v) {
+			return a
+		}
+	}
+	return v
+}
+
+// parseYesNo accepts true/false, 1/0, yes/no and ya/tidak; empty means false
+func parseYesNo(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "", "false", "0", "no", "n", "tidak":
+		return false, nil
+	case "true", "1", "yes", "y", "ya":
+		return true, nil
+	}
+	return false, fmt.Errorf("%q is not yes or no", v)
+}
+
+func isBlankRow(row []string) bool {
+	for _, v := range row {
+		if strings.TrimSpace(v) != "" {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,300 @@
+package controller
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/utils"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// importContext is the context of an import request in the given language
+func importContext(lang string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodPost, "/api/v1/admin/users/import", nil)
+	c.Request.Header.Set("Accept-Language", lang)
+	return c
+}
+
+// expectUnits expects repo.GetUnits to return the test units
+func expectUnits(mock sqlmock.Sqlmock) {
+	rows := sqlmock.NewRows([]string{"id", "name", "created_at"})
+	for i, u := range testUnits {
+		rows.AddRow(i+1, u, testTime)
+	}
+	mock.ExpectQuery("SELECT id, name, created_at FROM units").WillReturnRows(rows)
+}
+
+// rowError is an ImportRowError without the message, which depends on the language
+type rowError struct {
+	Row   int
+	Field string
+}
+
+func rowErrors(errs []models.ImportRowError) []rowError {
+	out := []rowError{}
+	for _, e := range errs {
+		out = append(out, rowError{e.Row, e.Field})
+	}
+	return out
+}
+
+func TestParseUserImport(t *testing.T) {
+	setupTest(t)
+	tooLong := strings.Repeat("p", 73)
+
+	tests := []struct {
+		name     string
+		rows     [][]string
+		units    bool // whether the units are read
+		want     []importRow
+		wantRows int
+		errors   []rowError
+	}{
+		{
+			name: "header after blank rows, any column order and case",
+			rows: [][]string{
+				{},
+				{"", " "},
+				{" Email ", "NAME", "Unit", "Role", "can_crud", "phone", "password", "notes"},
+				{"budi@example.com", " Budi ", "it", "admin", "Ya", "0812-3456-7890", "secret123", "ignored"},
+				{},
+				{"siti@example.com", "Siti", "Facilities"},
+			},
+			units: true,
+			want: []importRow{
+				{row: 4, req: models.UserRequest{Name: "Budi", Email: "budi@example.com", Role: "Admin", Unit: "IT",
+					Phone: "0812-3456-7890", Password: "secret123", CanCRUD: true}},
+				{row: 6, req: models.UserRequest{Name: "Siti", Email: "siti@example.com", Role: "Staff", Unit: "Facilities"}},
+			},
+			wantRows: 2,
+			errors:   []rowError{},
+		},
+		{
+			name: "invalid rows are reported by row and field",
+			rows: [][]string{
+				{"name", "email", "unit", "role", "phone", "can_crud", "password"},
+				{"", "not-an-email", "HR", "Boss", "123abc", "no", ""},
+				{"Ani", "ani@example.com", "IT", "", "", "maybe", ""},
+				{"Dewi", "dewi@example.com", "IT", "staff", "", "0", ""},
+				{"Eko", "eko@example.com", "IT", "", "", "", tooLong},
+			},
+			units: true,
+			want: []importRow{
+				{row: 4, req: models.UserRequest{Name: "Dewi", Email: "dewi@example.com", Role: "Staff", Unit: "IT"}},
+			},
+			wantRows: 4,
+			errors: []rowError{
+				{2, "name"}, {2, "email"}, {2, "role"}, {2, "unit"}, {2, "phone"},
+				{3, "can_crud"},
+				{5, "password"},
+			},
+		},
+		{
+			// The extra columns of an export are ignored; there is no password, so users are invited
+			name: "export file",
+			rows: [][]string{
+				{"id", "name", "email", "role", "unit", "phone", "can_crud", "availability", "deactivated_at"},
+				{"12", "Budi", "budi@example.com", "Admin", "IT", "0812-3456-7890", "true", "Online", ""},
+			},
+			units: true,
+			want: []importRow{
+				{row: 2, req: models.UserRequest{Name: "Budi", Email: "budi@example.com", Role: "Admin", Unit: "IT",
+					Phone: "0812-3456-7890", CanCRUD: true}},
+			},
+			wantRows: 1,
+			errors:   []rowError{},
+		},
+		{
+			name:   "missing columns",
+			rows:   [][]string{{}, {"Name", "Phone"}, {"Budi", ""}},
+			errors: []rowError{{2, "email"}, {2, "unit"}},
+		},
+		{
+			name:   "header only",
+			rows:   [][]string{{"name", "email", "unit"}, {"", ""}},
+			units:  true,
+			errors: []rowError{{2, ""}},
+		},
+		{
+			name:   "empty file",
+			rows:   nil,
+			errors: []rowError{{0, "name"}, {0, "email"}, {0, "unit"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			if tt.units {
+				expectUnits(mock)
+			}
+			result, inputs := parseUserImport(importContext("en"), tt.rows)
+			if !reflect.DeepEqual(inputs, tt.want) {
+				t.Errorf("inputs = %+v\nwant %+v", inputs, tt.want)
+			}
+			if result.Rows != tt.wantRows {
+				t.Errorf("Rows = %d, want %d", result.Rows, tt.wantRows)
+			}
+			if got := rowErrors(result.Errors); !reflect.DeepEqual(got, tt.errors) {
+				t.Errorf("errors = %v, want %v (%+v)", got, tt.errors, result.Errors)
+			}
+		})
+	}
+}
+
+func TestParseUserImportMessages(t *testing.T) {
+	setupTest(t)
+	rows := [][]string{{"name", "email", "unit", "phone"}, {"Budi", "budi@example.com", "IT", "abc"}}
+	tests := map[string]string{
+		"en":             "phone must be a valid phone number",
+		"id-ID,id;q=0.9": "phone harus berupa nomor telepon yang valid",
+	}
+	for lang, want := range tests {
+		mock := testutil.MockDB(t)
+		expectUnits(mock)
+		result, _ := parseUserImport(importContext(lang), rows)
+		if len(result.Errors) != 1 || result.Errors[0].Message != want {
+			t.Errorf("%s: errors = %+v, want %q", lang, result.Errors, want)
+		}
+	}
+}
+
+func TestCheckImportEmails(t *testing.T) {
+	setupTest(t)
+	inputs := []importRow{
+		{row: 2, req: models.UserRequest{Email: "a@example.com"}},
+		{row: 3, req: models.UserRequest{Email: "B@example.com"}},
+		{row: 4, req: models.UserRequest{Email: "A@EXAMPLE.COM"}},
+		{row: 5, req: models.UserRequest{Email: "c@example.com"}},
+		{row: 6, req: models.UserRequest{Email: "b@example.com"}},
+		{row: 7, req: models.UserRequest{Email: "d@example.com"}},
+		{row: 8, req: models.UserRequest{Email: "D@example.com"}},
+	}
+	emailQuery := `SELECT email FROM users WHERE email IN \(\?, \?, \?, \?\)`
+	emailArgs := []driver.Value{"a@example.com", "b@example.com", "c@example.com", "d@example.com"}
+
+	t.Run("duplicates and existing emails", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(emailQuery).WithArgs(emailArgs...).
+			WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("C@example.com").AddRow("d@example.com"))
+
+		got := checkImportEmails(importContext("en"), inputs)
+		want := []models.ImportRowError{
+			{Row: 4, Field: "email", Message: "Same email as row 2"},
+			{Row: 6, Field: "email", Message: "Same email as row 3"},
+			{Row: 8, Field: "email", Message: "Same email as row 7"},
+			{Row: 5, Field: "email", Message: "Email is already used by another user"},
+			{Row: 7, Field: "email", Message: "Email is already used by another user"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("errors = %+v\nwant %+v", got, want)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(emailQuery).WithArgs(emailArgs...).WillReturnError(errors.New("connection refused"))
+
+		got := checkImportEmails(importContext("en"), inputs)
+		if len(got) != 4 || got[3].Row != 0 || got[3].Message != "Failed to check emails, try again" {
+			t.Errorf("errors = %+v, want the 3 duplicates and a retry message", got)
+		}
+	})
+
+	t.Run("no rows", func(t *testing.T) {
+		testutil.MockDB(t) // no query expected
+		if got := checkImportEmails(importContext("en"), nil); got == nil || len(got) != 0 {
+			t.Errorf("errors = %#v, want an empty list", got)
+		}
+	})
+}
+
+func TestParseYesNo(t *testing.T) {
+	tests := []struct {
+		in   string
+		want bool
+	}{
+		{"", false}, {"false", false}, {"FALSE", false}, {"0", false}, {"no", false}, {"N", false}, {"tidak", false}, {"Tidak", false},
+		{"true", true}, {"True", true}, {"1", true}, {"yes", true}, {"Y", true}, {"ya", true}, {"YA", true},
+	}
+	for _, tt := range tests {
+		got, err := parseYesNo(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("parseYesNo(%q) = %v, %v, want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"maybe", "2", "-1", "yess", "benar", " yes"} {
+		if _, err := parseYesNo(in); err == nil {
+			t.Errorf("parseYesNo(%q) accepted it", in)
+		}
+	}
+}
+
+func TestHashImportPasswords(t *testing.T) {
+	setupTest(t)
+	newUsers := func(passwords ...string) ([]*models.User, []importRow) {
+		users := make([]*models.User, len(passwords))
+		inputs := make([]importRow, len(passwords))
+		for i, p := range passwords {
+			users[i] = &models.User{}
+			inputs[i] = importRow{row: i + 2, req: models.UserRequest{Password: p}}
+		}
+		return users, inputs
+	}
+
+	t.Run("only rows with a password", func(t *testing.T) {
+		var passwords []string
+		for i := 0; i < 25; i++ {
+			if i%3 == 0 {
+				passwords = append(passwords, "")
+			} else {
+				passwords = append(passwords, "secret-"+string(rune('a'+i)))
+			}
+		}
+		users, inputs := newUsers(passwords...)
+		if err := hashImportPasswords(context.Background(), users, inputs); err != nil {
+			t.Fatal(err)
+		}
+		for i, u := range users {
+			switch {
+			case passwords[i] == "" && u.PasswordHash != "":
+				t.Errorf("row %d has no password but got a hash", i)
+			case passwords[i] != "" && utils.VerifyPassword(u.PasswordHash, passwords[i]) != nil:
+				t.Errorf("row %d: hash %q does not match %q", i, u.PasswordHash, passwords[i])
+			}
+		}
+	})
+
+	t.Run("no passwords", func(t *testing.T) {
+		users, inputs := newUsers("", "")
+		if err := hashImportPasswords(context.Background(), users, inputs); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("hash error", func(t *testing.T) {
+		users, inputs := newUsers("secret-a", strings.Repeat("p", 73), "secret-c")
+		if err := hashImportPasswords(context.Background(), users, inputs); !errors.Is(err, bcrypt.ErrPasswordTooLong) {
+			t.Errorf("err = %v, want ErrPasswordTooLong", err)
+		}
+	})
+
+	t.Run("canceled", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		users, inputs := newUsers("secret-a", "secret-b", "secret-c")
+		if err := hashImportPasswords(ctx, users, inputs); !errors.Is(err, context.Canceled) {
+			t.Errorf("err = %v, want context.Canceled", err)
+		}
+	})
+}
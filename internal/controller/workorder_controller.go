@@ -1,18 +1,45 @@
 package controller
 
 import (
+	"errors"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"net/http"
 	"siro-backend/global"
 	"siro-backend/internal/models"
 	"siro-backend/internal/repo"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/search"
 	"siro-backend/pkg/utils"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// sendWorkOrderConflict reloads a request after a failed version check and returns it to the client
+func sendWorkOrderConflict(c *gin.Context, orderID uint) {
+	current, err := repo.GetWorkOrderById(c.Request.Context(), orderID)
+	if err != nil {
+		sendError(c, http.StatusNotFound, response.CodeWorkOrderNotFound, "Request not found")
+		return
+	}
+	sendVersionConflict(c, current, current.Version)
+}
+
+// loadWorkOrder fetches a request the user is allowed to see (see repo.Viewer)
+// Requests of other units answer 404 too, so their existence isn't revealed
+func loadWorkOrder(c *gin.Context, user *models.User, orderID uint) (models.WorkOrder, bool) {
+	order, err := repo.GetWorkOrderById(c.Request.Context(), orderID)
+	if err != nil || !repo.ViewerOf(user).CanView(order) {
+		sendError(c, http.StatusNotFound, response.CodeWorkOrderNotFound, "Request not found")
+		return models.WorkOrder{}, false
+	}
+	return order, true
+}
+
 // GetStats returns dashboard statistics for the current user's unit
 func GetStats(c *gin.Context) {
 	user, ok := getCurrentUser(c)
@@ -20,10 +47,10 @@ func GetStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := repo.GetDashboardStats(user.Unit)
+	stats, err := repo.GetDashboardStats(c.Request.Context(), user.Unit)
 	if err != nil {
-		log.Printf("Error getting stats for unit %s: %v", user.Unit, err)
-		sendError(c, http.StatusInternalServerError, "Failed to calculate stats")
+		slog.ErrorContext(c.Request.Context(), "failed to get stats", "unit", user.Unit, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to calculate stats")
 		return
 	}
 
@@ -37,11 +64,13 @@ func GetActivities(c *gin.Context) {
 		return
 	}
 
-	pagination := getPaginationParams(c)
-	logs, meta, err := repo.GetActivities(user.Unit, pagination.Page, pagination.Limit)
+	logs, meta, err := repo.GetActivities(c.Request.Context(), user.Unit, getPage(c))
 	if err != nil {
-		log.Printf("Error getting activities: %v", err)
-		sendError(c, http.StatusInternalServerError, "Failed to fetch activities")
+		if sendPageError(c, err) {
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to get activities", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch activities")
 		return
 	}
 
@@ -59,26 +88,30 @@ func CreateWorkOrder(c *gin.Context) {
 	role, _ := c.Get("role")
 	canCRUD, _ := c.Get("canCRUD")
 	if role != global.RoleAdmin && !canCRUD.(bool) {
-		sendError(c, http.StatusForbidden, "Permission denied")
+		sendError(c, http.StatusForbidden, response.CodePermissionDenied, "Permission denied")
 		return
 	}
 
 	// Parse request body
 	var input models.WorkOrderRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
 		return
 	}
 
 	// Validate unit
 	if input.Unit == "" {
-		sendError(c, http.StatusBadRequest, "Unit must be selected")
+		sendError(c, http.StatusBadRequest, response.CodeUnitRequired, "Unit must be selected")
 		return
 	}
 
 	// SECURITY CHECK: Cannot create request for own unit
 	if input.Unit == user.Unit {
-		sendError(c, http.StatusBadRequest, "You cannot create a request for your own unit")
+		sendError(c, http.StatusBadRequest, response.CodeOwnUnitRequest, "You cannot create a request for your own unit")
+		return
+	}
+	if !apiKeyAllowsUnit(c, input.Unit) {
+		sendError(c, http.StatusForbidden, response.CodeAPIKeyForbidden, "This API key can't create requests for this unit")
 		return
 	}
 
@@ -90,78 +123,214 @@ func CreateWorkOrder(c *gin.Context) {
 		RequesterID: user.ID,
 		Unit:        input.Unit,
 		PhotoURL:    input.PhotoURL,
+		Tags:        normalizeTags(input.Tags),
+		IsPublic:    input.IsPublic,
 		Status:      global.StatusPending,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	if err := repo.CreateWorkOrder(&newOrder); err != nil {
-		log.Printf("Error creating request: %v", err)
-		sendError(c, http.StatusInternalServerError, "Failed to create request")
+	if err := repo.CreateWorkOrder(c.Request.Context(), &newOrder, repo.APIActor(user.ID)); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to create request", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to create request")
 		return
 	}
 
 	// Get full request details
-	fullOrder, err := repo.GetWorkOrderById(newOrder.ID)
+	fullOrder, err := repo.GetWorkOrderById(c.Request.Context(), newOrder.ID)
 	if err != nil {
-		log.Printf("Error retrieving created request %d: %v", newOrder.ID, err)
-		sendError(c, http.StatusInternalServerError, "Request created but failed to retrieve details")
+		slog.ErrorContext(c.Request.Context(), "failed to retrieve created request", "order_id", newOrder.ID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Request created but failed to retrieve details")
 		return
 	}
 
 	// Log activity
-	repo.LogActivity(user.ID, user.Name, fmt.Sprintf("created request to %s:", input.Unit), fullOrder.Title, global.StatusPending, fullOrder.ID)
+	repo.LogActivity(c.Request.Context(), user.ID, user.Name, fmt.Sprintf("created request to %s:", input.Unit), fullOrder.Title, global.StatusPending, fullOrder.ID)
 
-	c.JSON(http.StatusCreated, gin.H{
-		"statusCode": http.StatusCreated,
-		"data":       fullOrder,
-	})
+	sendCreated(c, fullOrder)
 }
 
 // UploadWorkOrderEvidence handles file upload for request evidence
 func UploadWorkOrderEvidence(c *gin.Context) {
 	file, err := c.FormFile("file")
 	if err != nil {
-		sendError(c, http.StatusBadRequest, "No file uploaded")
+		sendError(c, http.StatusBadRequest, response.CodeFileRequired, "No file uploaded")
 		return
 	}
 
 	uploadConfig := utils.DefaultImageConfig(global.DirWorkOrder)
 	relativePath, err := utils.SaveUploadedFile(file, uploadConfig)
 	if err != nil {
-		sendError(c, http.StatusBadRequest, err.Error())
+		sendError(c, http.StatusBadRequest, response.CodeFileInvalid, err.Error())
 		return
 	}
 
 	fullURL := utils.GetBaseURL() + relativePath
-	c.JSON(http.StatusOK, gin.H{
-		"statusCode": http.StatusOK,
-		"message":    "File uploaded successfully",
-		"url":        fullURL,
+	sendFields(c, gin.H{
+		"message": "File uploaded successfully",
+		"url":     fullURL,
 	})
 }
 
 // GetWorkOrders returns paginated list of requests with filters
 func GetWorkOrders(c *gin.Context) {
-	pagination := getPaginationParams(c)
+	user, ok := getCurrentUser(c)
+	if !ok {
+		return
+	}
 
-	filters := map[string]string{
-		"status":         c.Query("status"),
-		"unit":           c.Query("unit"),
-		"requester_unit": c.Query("requester_unit"),
-		"date":           c.Query("date"),
+	var filter models.WorkOrderFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		sendBindError(c, err)
+		return
 	}
 
-	orders, meta, err := repo.GetWorkOrders(filters, pagination.Page, pagination.Limit)
+	orders, meta, err := repo.GetWorkOrders(c.Request.Context(), buildWorkOrderQuery(filter, user), getPage(c))
 	if err != nil {
-		log.Printf("Error getting requests: %v", err)
-		sendError(c, http.StatusInternalServerError, "Failed to fetch requests")
+		if sendPageError(c, err) {
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to get requests", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch requests")
 		return
 	}
 
+	if h := search.NewHighlighter(search.Terms(filter.Query)); h != nil {
+		for i := range orders {
+			orders[i].Highlights = highlightWorkOrder(h, orders[i])
+		}
+	}
+
 	sendPaginatedResponse(c, orders, meta)
 }
 
+// GetWorkOrder returns one request with full user data and its timeline
+func GetWorkOrder(c *gin.Context) {
+	user, ok := getCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	orderID, ok := parseID(c, "id")
+	if !ok {
+		return
+	}
+
+	order, err := repo.GetWorkOrderDetail(c.Request.Context(), orderID)
+	if err != nil || !repo.ViewerOf(user).CanView(order) {
+		sendError(c, http.StatusNotFound, response.CodeWorkOrderNotFound, "Request not found")
+		return
+	}
+
+	setETag(c, order.Version)
+	sendSuccess(c, order)
+}
+
+// buildWorkOrderQuery turns the (already validated) query parameters into a repo query
+// "me" in assignee / requester means the current user
+func buildWorkOrderQuery(f models.WorkOrderFilter, user *models.User) repo.WorkOrderQuery {
+	q := repo.WorkOrderQuery{
+		Viewer:         repo.ViewerOf(user),
+		Statuses:       f.Status,
+		Priorities:     f.Priority,
+		Units:          f.Unit,
+		RequesterUnits: f.RequesterUnit,
+		Tags:           normalizeTags(f.Tags),
+		Today:          f.Date == "today",
+		SLABreached:    f.SLABreached,
+		Search:         f.Query,
+		Sort:           f.Sort,
+	}
+
+	switch f.Assignee {
+	case "":
+	case "unassigned":
+		q.Unassigned = true
+	default:
+		q.AssigneeID = userRef(f.Assignee, user)
+	}
+	if f.Requester != "" {
+		q.RequesterID = userRef(f.Requester, user)
+	}
+
+	// Date ranges are whole days: created_to=2026-01-31 includes the 31st
+	q.CreatedFrom = parseDay(f.CreatedFrom, 0)
+	q.CreatedBefore = parseDay(f.CreatedTo, 1)
+	q.DoneFrom = parseDay(f.CompletedFrom, 0)
+	q.DoneBefore = parseDay(f.CompletedTo, 1)
+	return q
+}
+
+// userRef resolves "me" or a numeric user ID
+func userRef(ref string, user *models.User) *uint {
+	if ref == "me" {
+		return &user.ID
+	}
+	id, _ := strconv.ParseUint(ref, 10, 32)
+	uid := uint(id)
+	return &uid
+}
+
+// parseDay parses YYYY-MM-DD (server time zone) and adds days; nil if empty
+func parseDay(day string, addDays int) *time.Time {
+	if day == "" {
+		return nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", day, time.Local)
+	if err != nil {
+		return nil
+	}
+	t = t.AddDate(0, 0, addDays)
+	return &t
+}
+
+// normalizeTags lowercases and trims tags and drops empty and duplicate ones
+func normalizeTags(tags []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		out = append(out, tag)
+	}
+	return out
+}
+
+// GetTags returns all tags in use on requests the user can see (for autocomplete)
+func GetTags(c *gin.Context) {
+	user, ok := getCurrentUser(c)
+	if !ok {
+		return
+	}
+
+	tags, err := repo.GetTags(c.Request.Context(), repo.ViewerOf(user))
+	if err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to get tags", "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to fetch tags")
+		return
+	}
+	sendSuccess(c, tags)
+}
+
+// highlightWorkOrder returns the highlighted snippets of the fields that matched the search
+func highlightWorkOrder(h *search.Highlighter, wo models.WorkOrder) map[string]string {
+	fields := map[string]string{
+		"title":           wo.Title,
+		"description":     wo.Description,
+		"completion_note": wo.CompletionNote,
+	}
+	highlights := map[string]string{}
+	for name, text := range fields {
+		if marked := h.Highlight(text, 160); marked != "" {
+			highlights[name] = marked
+		}
+	}
+	return highlights
+}
+
 // TakeRequest allows a staff member to take/claim a request
 func TakeRequest(c *gin.Context) {
 	user, ok := getCurrentUser(c)
@@ -174,29 +343,43 @@ func TakeRequest(c *gin.Context) {
 		return
 	}
 
-	order, err := repo.GetWorkOrderById(orderID)
-	if err != nil {
-		sendError(c, http.StatusNotFound, "Request not found")
+	order, ok := loadWorkOrder(c, user, orderID)
+	if !ok {
 		return
 	}
 
 	// SECURITY CHECK: You can only take a request if it is assigned to YOUR unit.
 	if order.Unit != user.Unit {
-		sendError(c, http.StatusForbidden, "You cannot take a request assigned to another unit.")
+		sendError(c, http.StatusForbidden, response.CodeUnitMismatch, "You cannot take a request assigned to another unit.")
+		return
+	}
+
+	if !checkIfMatch(c, order, order.Version) {
 		return
 	}
 
 	if order.Status == global.StatusCompleted {
-		sendError(c, http.StatusBadRequest, "Request already completed")
+		sendError(c, http.StatusBadRequest, response.CodeWorkOrderAlreadyCompleted, "Request already completed")
 		return
 	}
 
-	if err := repo.TakeWorkOrder(orderID, user.ID); err != nil {
-		sendError(c, http.StatusConflict, "Failed to take request. It may have been taken by someone else.")
+	if order.AssigneeID != nil {
+		sendError(c, http.StatusConflict, response.CodeWorkOrderAlreadyTaken, "Failed to take request. It may have been taken by someone else.")
 		return
 	}
 
-	repo.LogActivity(user.ID, user.Name, "is working on:", order.Title, global.StatusInProgress, order.ID)
+	if err := repo.TakeWorkOrder(c.Request.Context(), orderID, user.ID, order.Version, repo.APIActor(user.ID)); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			sendWorkOrderConflict(c, orderID)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to take request", "order_id", orderID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to take request")
+		return
+	}
+
+	repo.LogActivity(c.Request.Context(), user.ID, user.Name, "is working on:", order.Title, global.StatusInProgress, order.ID)
+	setETag(c, order.Version+1)
 	sendSuccess(c, gin.H{"message": "Request taken successfully"})
 }
 
@@ -214,48 +397,61 @@ func AssignStaff(c *gin.Context) {
 
 	var input models.AssignRequest
 	if err := c.ShouldBindJSON(&input); err != nil {
-		sendError(c, http.StatusBadRequest, "Invalid input: "+err.Error())
+		sendBindError(c, err)
 		return
 	}
 
 	// Fetch Order First to check permissions
-	order, err := repo.GetWorkOrderById(orderID)
-	if err != nil {
-		sendError(c, http.StatusNotFound, "Request not found")
+	order, ok := loadWorkOrder(c, admin, orderID)
+	if !ok {
 		return
 	}
 
 	// SECURITY CHECK: Only users from the target unit can assign staff.
 	if order.Unit != admin.Unit {
-		sendError(c, http.StatusForbidden, "You cannot assign staff to a request for another unit.")
+		sendError(c, http.StatusForbidden, response.CodeUnitMismatch, "You cannot assign staff to a request for another unit.")
+		return
+	}
+
+	if !checkIfMatch(c, order, order.Version) {
 		return
 	}
 
 	// Verify Assignee
-	assignee, err := repo.GetUserByID(input.AssigneeID)
-	if err != nil {
-		sendError(c, http.StatusNotFound, "Staff member not found")
+	assignee, err := repo.GetUserByID(c.Request.Context(), input.AssigneeID)
+	if err != nil || assignee.ServiceAccount {
+		sendError(c, http.StatusNotFound, response.CodeUserNotFound, "Staff member not found")
+		return
+	}
+
+	if assignee.DeactivatedAt != nil {
+		sendError(c, http.StatusBadRequest, response.CodeUserDeactivated, "Staff member has been deactivated")
 		return
 	}
 
 	// SECURITY CHECK: Assignee must be from the same unit
 	if assignee.Unit != admin.Unit {
-		sendError(c, http.StatusBadRequest, "Assignee must be from the same unit")
+		sendError(c, http.StatusBadRequest, response.CodeUnitMismatch, "Assignee must be from the same unit")
 		return
 	}
 
 	if order.Status == global.StatusCompleted {
-		sendError(c, http.StatusBadRequest, "Request already completed")
+		sendError(c, http.StatusBadRequest, response.CodeWorkOrderAlreadyCompleted, "Request already completed")
 		return
 	}
 
-	if err := repo.AssignWorkOrder(orderID, input.AssigneeID); err != nil {
-		log.Printf("Error assigning request %d to user %d: %v", orderID, input.AssigneeID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to assign staff")
+	if err := repo.AssignWorkOrder(c.Request.Context(), orderID, input.AssigneeID, order.Version, repo.APIActor(admin.ID)); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			sendWorkOrderConflict(c, orderID)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to assign request", "order_id", orderID, "assignee_id", input.AssigneeID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to assign staff")
 		return
 	}
 
-	repo.LogActivity(admin.ID, admin.Name, fmt.Sprintf("assigned request to %s:", assignee.Name), order.Title, global.StatusInProgress, order.ID)
+	repo.LogActivity(c.Request.Context(), admin.ID, admin.Name, fmt.Sprintf("assigned request to %s:", assignee.Name), order.Title, global.StatusInProgress, order.ID)
+	setETag(c, order.Version+1)
 	sendSuccess(c, gin.H{"message": "Staff assigned successfully"})
 }
 
@@ -271,41 +467,51 @@ func FinalizeOrder(c *gin.Context) {
 		return
 	}
 
+	// The body is optional (no note), but a note that fails validation is not dropped silently
 	var input models.FinalizeRequest
-	if err := c.ShouldBindJSON(&input); err != nil {
-		input.Note = "" // Note is optional
+	if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+		sendBindError(c, err)
+		return
 	}
 
-	order, err := repo.GetWorkOrderById(orderID)
-	if err != nil {
-		sendError(c, http.StatusNotFound, "Request not found")
+	order, ok := loadWorkOrder(c, user, orderID)
+	if !ok {
 		return
 	}
 
 	// SECURITY CHECK: Only the unit responsible for the work can finalize it.
 	if order.Unit != user.Unit {
-		sendError(c, http.StatusForbidden, "You cannot finalize a request belonging to another unit.")
+		sendError(c, http.StatusForbidden, response.CodeUnitMismatch, "You cannot finalize a request belonging to another unit.")
+		return
+	}
+
+	if !checkIfMatch(c, order, order.Version) {
 		return
 	}
 
 	if order.AssigneeID == nil {
-		sendError(c, http.StatusBadRequest, "Request has not been assigned yet")
+		sendError(c, http.StatusBadRequest, response.CodeWorkOrderNotAssigned, "Request has not been assigned yet")
 		return
 	}
 
 	// Check permission: only assignee or admin can finalize
 	role, _ := c.Get("role")
 	if *order.AssigneeID != user.ID && role != global.RoleAdmin {
-		sendError(c, http.StatusForbidden, "Access denied")
+		sendError(c, http.StatusForbidden, response.CodePermissionDenied, "Access denied")
 		return
 	}
 
-	if err := repo.FinalizeWorkOrder(orderID, input.Note, user.ID); err != nil {
-		log.Printf("Error finalizing request %d: %v", orderID, err)
-		sendError(c, http.StatusInternalServerError, "Failed to finalize request")
+	if err := repo.FinalizeWorkOrder(c.Request.Context(), orderID, input.Note, user.ID, order.Version, repo.APIActor(user.ID)); err != nil {
+		if errors.Is(err, repo.ErrVersionConflict) {
+			sendWorkOrderConflict(c, orderID)
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "failed to finalize request", "order_id", orderID, "error", err)
+		sendError(c, http.StatusInternalServerError, response.CodeInternal, "Failed to finalize request")
 		return
 	}
 
-	repo.LogActivity(user.ID, user.Name, "completed request:", order.Title, global.StatusCompleted, order.ID)
+	repo.LogActivity(c.Request.Context(), user.ID, user.Name, "completed request:", order.Title, global.StatusCompleted, order.ID)
+	setETag(c, order.Version+1)
 	sendSuccess(c, gin.H{"message": "Request finalized successfully"})
 }
@@ -0,0 +1,208 @@
+package controller
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/worker"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+// woEndpoint is a work order route that must not reveal orders the user can't see
+type woEndpoint struct {
+	name    string
+	method  string
+	route   string
+	path    string
+	body    string
+	handler gin.HandlerFunc
+	detail  bool // loads the full detail (requester and activities) before checking
+}
+
+var woEndpoints = []woEndpoint{
+	{"detail", http.MethodGet, "/workorders/:id", "/workorders/7", "", GetWorkOrder, true},
+	{"events", http.MethodGet, "/workorders/:id/events", "/workorders/7/events", "", GetWorkOrderEvents, false},
+	{"take", http.MethodPatch, "/workorders/:id/take", "/workorders/7/take", "", TakeRequest, false},
+	{"assign", http.MethodPatch, "/workorders/:id/assign", "/workorders/7/assign", `{"assigneeId": 6}`, AssignStaff, false},
+	{"finalize", http.MethodPatch, "/workorders/:id/finalize", "/workorders/7/finalize", "", FinalizeOrder, false},
+}
+
+// expectDetail expects what repo.GetWorkOrderDetail reads after the work order itself
+func expectDetail(mock sqlmock.Sqlmock, o testOrder) {
+	expectUser(mock, testUser{ID: o.RequesterID, Role: global.RoleStaff, Unit: o.RequesterUnit})
+	mock.ExpectQuery("FROM activity_logs WHERE request_id = ?").WithArgs(o.ID).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_name", "action", "request_id", "details", "status", "timestamp"}))
+}
+
+// A hidden work order answers exactly like one that doesn't exist, on every route
+func TestHiddenWorkOrderIsNotFound(t *testing.T) {
+	setupTest(t)
+	viewer := testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}
+	hidden := testOrder{ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "HR"}
+
+	for _, ep := range woEndpoints {
+		t.Run(ep.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectUser(mock, viewer)
+			expectNoWorkOrder(mock, 7)
+			missing := serveAs(viewer, ep.route, jsonRequest(ep.method, ep.path, ep.body), ep.handler)
+
+			expectUser(mock, viewer)
+			expectWorkOrder(mock, hidden)
+			if ep.detail {
+				expectDetail(mock, hidden)
+			}
+			w := serveAs(viewer, ep.route, jsonRequest(ep.method, ep.path, ep.body), ep.handler)
+
+			if w.Code != http.StatusNotFound || testutil.ErrorCode(t, w) != "WORKORDER_NOT_FOUND" {
+				t.Errorf("hidden: %d %s, want 404 WORKORDER_NOT_FOUND", w.Code, w.Body)
+			}
+			if w.Body.String() != missing.Body.String() || w.Code != missing.Code {
+				t.Errorf("hidden answers %d %s, missing answers %d %s", w.Code, w.Body, missing.Code, missing.Body)
+			}
+		})
+	}
+}
+
+func TestWorkOrderDetailVisibility(t *testing.T) {
+	setupTest(t)
+	tests := []struct {
+		name   string
+		viewer testUser
+		order  testOrder
+	}{
+		{"admin of another unit", testUser{ID: 5, Role: global.RoleAdmin, Unit: "HR"}, testOrder{ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "Facilities"}},
+		{"target unit", testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}, testOrder{ID: 7, Unit: "IT", RequesterID: 9, RequesterUnit: "HR"}},
+		{"requester unit", testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}, testOrder{ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "IT"}},
+		{"public", testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}, testOrder{ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "HR", Public: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectUser(mock, tt.viewer)
+			expectWorkOrder(mock, tt.order)
+			expectDetail(mock, tt.order)
+
+			w := serveAs(tt.viewer, "/workorders/:id", jsonRequest(http.MethodGet, "/workorders/7", ""), GetWorkOrder)
+			if w.Code != http.StatusOK || w.Header().Get("ETag") != `"1"` {
+				t.Errorf("%d %s (ETag %q)", w.Code, w.Body, w.Header().Get("ETag"))
+			}
+		})
+	}
+}
+
+// Seeing a work order of another unit (as requester or because it is public) doesn't allow working on it
+func TestVisibleWorkOrderOfAnotherUnit(t *testing.T) {
+	setupTest(t)
+	viewer := testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}
+	orders := map[string]testOrder{
+		"requester unit": {ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "IT"},
+		"public":         {ID: 7, Unit: "Facilities", RequesterID: 9, RequesterUnit: "HR", Public: true},
+	}
+	for name, order := range orders {
+		for _, ep := range woEndpoints[2:] {
+			t.Run(name+" "+ep.name, func(t *testing.T) {
+				mock := testutil.MockDB(t)
+				expectUser(mock, viewer)
+				expectWorkOrder(mock, order)
+
+				w := serveAs(viewer, ep.route, jsonRequest(ep.method, ep.path, ep.body), ep.handler)
+				if w.Code != http.StatusForbidden || testutil.ErrorCode(t, w) != "UNIT_MISMATCH" {
+					t.Errorf("%d %s, want 403 UNIT_MISMATCH", w.Code, w.Body)
+				}
+			})
+		}
+	}
+}
+
+// expectTake expects repo.TakeWorkOrder of order 7 at version for user 5; affected 0 means someone else was faster
+func expectTake(mock sqlmock.Sqlmock, version uint, affected int64) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT status, assignee_id, completed_by_id, .* FROM work_orders WHERE id = \? FOR UPDATE`).WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "assignee_id", "completed_by_id", "completion_note"}).AddRow("Pending", nil, nil, ""))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE work_orders SET status=?, assignee_id=?, taken_at=NOW(), updated_at=NOW(), version=version+1 WHERE id=? AND version=? AND assignee_id IS NULL")).
+		WithArgs(global.StatusInProgress, 5, 7, version).
+		WillReturnResult(sqlmock.NewResult(0, affected))
+	if affected == 0 {
+		mock.ExpectRollback()
+		return
+	}
+	mock.ExpectExec("INSERT INTO work_order_events").WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+}
+
+func TestTakeRequestVersion(t *testing.T) {
+	setupTest(t)
+	staff := testUser{ID: 5, Role: global.RoleStaff, Unit: "IT"}
+	order := testOrder{ID: 7, Unit: "IT", RequesterID: 9, RequesterUnit: "HR", Version: 3}
+	take := func(ifMatch string) *httptest.ResponseRecorder {
+		req := jsonRequest(http.MethodPatch, "/workorders/7/take", "")
+		if ifMatch != "" {
+			req.Header.Set("If-Match", ifMatch)
+		}
+		w := serveAs(staff, "/workorders/:id/take", req, TakeRequest)
+		if err := worker.Wait(context.Background()); err != nil {
+			t.Fatal(err)
+		}
+		return w
+	}
+
+	for _, ifMatch := range []string{"", `"3"`, `W/"3"`, "*"} {
+		t.Run("taken with If-Match "+ifMatch, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			expectUser(mock, staff)
+			expectWorkOrder(mock, order)
+			expectTake(mock, 3, 1)
+			mock.ExpectExec("INSERT INTO activity_logs").WillReturnResult(sqlmock.NewResult(1, 1))
+
+			w := take(ifMatch)
+			if w.Code != http.StatusOK || w.Header().Get("ETag") != `"4"` {
+				t.Errorf("%d %s (ETag %q)", w.Code, w.Body, w.Header().Get("ETag"))
+			}
+		})
+	}
+
+	t.Run("stale If-Match", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, staff)
+		expectWorkOrder(mock, order)
+
+		w := take(`"2"`)
+		var current struct{ Version uint }
+		testutil.DecodeEnvelope(t, w, &current)
+		if w.Code != http.StatusPreconditionFailed || testutil.ErrorCode(t, w) != "VERSION_CONFLICT" || current.Version != 3 || w.Header().Get("ETag") != `"3"` {
+			t.Errorf("%d %s (ETag %q)", w.Code, w.Body, w.Header().Get("ETag"))
+		}
+	})
+
+	// Both requests passed the checks, the other one updated the row first
+	t.Run("lost race", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectUser(mock, staff)
+		expectWorkOrder(mock, order)
+		expectTake(mock, 3, 0)
+		taken := order
+		taken.Version, taken.Status, taken.AssigneeID = 4, global.StatusInProgress, new(uint)
+		*taken.AssigneeID = 6
+		expectWorkOrder(mock, taken)
+
+		w := take("")
+		var current struct {
+			Version    uint
+			AssigneeID *uint `json:"assigneeId"`
+		}
+		testutil.DecodeEnvelope(t, w, &current)
+		if w.Code != http.StatusConflict || testutil.ErrorCode(t, w) != "VERSION_CONFLICT" || w.Header().Get("ETag") != `"4"` {
+			t.Errorf("%d %s (ETag %q)", w.Code, w.Body, w.Header().Get("ETag"))
+		}
+		if current.Version != 4 || current.AssigneeID == nil || *current.AssigneeID != 6 {
+			t.Errorf("conflict data %+v, want the current version", current)
+		}
+	})
+}
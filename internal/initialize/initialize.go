@@ -1,12 +1,68 @@
 package initialize
 
 import (
+	"context"
+	"log"
+	"log/slog"
+	"siro-backend/internal/auth"
+	"siro-backend/internal/controller"
+	"siro-backend/internal/metrics"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/jwtkeys"
+	"siro-backend/pkg/mailer"
 	"siro-backend/pkg/setting"
 	"siro-backend/pkg/utils"
+	"siro-backend/pkg/validation"
+	"time"
 )
 
 // Initializes all necessary components
-func Initialize() {
-	utils.InitJWT()
-	setting.ConnectDB()
+// Each module receives only its own part of the config
+func Initialize(cfg *config.Config) {
+	utils.InitPassword(cfg.Password)
+	utils.InitUploads(cfg.Upload, cfg.Server)
+	setting.ConnectDB(cfg.Database)
+	if err := utils.InitJWT(cfg.JWT, jwtKeyStore{}); err != nil {
+		log.Fatal("ERROR: ", err)
+	}
+	repo.InitSLA(cfg.SLA)
+	mailer.Init(cfg.Mail)
+	controller.InitInvitations(cfg.Invite, cfg.Server)
+	controller.InitSCIM(cfg.SCIM, cfg.Server)
+	controller.InitOIDC(cfg.OIDC, cfg.Server)
+	auth.Init(cfg.Auth, cfg.LDAP)
+
+	if err := validation.Init(unitExists); err != nil {
+		log.Fatal("ERROR: Failed to register validators: ", err)
+	}
+
+	if cfg.Metrics.Enabled {
+		metrics.Init()
+	}
+}
+
+// unitExists is used by the "unit" validation tag
+// The validator has no request context, so the lookup gets its own short timeout
+func unitExists(unit string) bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	exists, err := repo.UnitExists(ctx, unit)
+	if err != nil {
+		slog.Error("failed to check unit", "unit", unit, "error", err)
+		return false
+	}
+	return exists
+}
+
+// jwtKeyStore keeps the RS256/EdDSA signing keys in the jwt_keys table
+type jwtKeyStore struct{}
+
+func (jwtKeyStore) Keys(ctx context.Context) ([]jwtkeys.Record, error) {
+	return repo.GetJWTKeys(ctx)
+}
+
+func (jwtKeyStore) Add(ctx context.Context, r jwtkeys.Record) error {
+	return repo.CreateJWTKey(ctx, r)
 }
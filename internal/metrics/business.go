@@ -0,0 +1,72 @@
+package metrics
+
+import (
+	"context"
+	"log/slog"
+	"siro-backend/internal/repo"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// businessCollector reads work order and session gauges from the database on every scrape
+// so the numbers are always current and nothing has to be updated by the handlers
+type businessCollector struct {
+	openWorkOrders *prometheus.Desc
+	slaBreaches    *prometheus.Desc
+	activeSessions *prometheus.Desc
+}
+
+func newBusinessCollector() *businessCollector {
+	return &businessCollector{
+		openWorkOrders: prometheus.NewDesc(
+			"workorders_open",
+			"Number of unfinished work orders, by target unit and status.",
+			[]string{"unit", "status"}, nil,
+		),
+		slaBreaches: prometheus.NewDesc(
+			"workorders_sla_breached",
+			"Number of unfinished work orders older than the SLA target of their priority, by target unit.",
+			[]string{"unit"}, nil,
+		),
+		activeSessions: prometheus.NewDesc(
+			"auth_active_sessions",
+			"Number of users with a refresh token that has not expired.",
+			nil, nil,
+		),
+	}
+}
+
+func (bc *businessCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- bc.openWorkOrders
+	ch <- bc.slaBreaches
+	ch <- bc.activeSessions
+}
+
+func (bc *businessCollector) Collect(ch chan<- prometheus.Metric) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// A failed query only skips that metric, the rest of the scrape still works
+	if counts, err := repo.CountOpenWorkOrders(ctx); err != nil {
+		slog.ErrorContext(ctx, "metrics: failed to count open work orders", "error", err)
+	} else {
+		for _, oc := range counts {
+			ch <- prometheus.MustNewConstMetric(bc.openWorkOrders, prometheus.GaugeValue, float64(oc.Count), oc.Unit, oc.Status)
+		}
+	}
+
+	if breaches, err := repo.CountSLABreaches(ctx); err != nil {
+		slog.ErrorContext(ctx, "metrics: failed to count SLA breaches", "error", err)
+	} else {
+		for unit, count := range breaches {
+			ch <- prometheus.MustNewConstMetric(bc.slaBreaches, prometheus.GaugeValue, float64(count), unit)
+		}
+	}
+
+	if sessions, err := repo.CountActiveSessions(ctx); err != nil {
+		slog.ErrorContext(ctx, "metrics: failed to count active sessions", "error", err)
+	} else {
+		ch <- prometheus.MustNewConstMetric(bc.activeSessions, prometheus.GaugeValue, float64(sessions))
+	}
+}
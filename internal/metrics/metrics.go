@@ -0,0 +1,58 @@
+package metrics
+
+import (
+	"net/http"
+	"siro-backend/pkg/setting"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	// HTTPRequests counts handled requests per route and status
+	HTTPRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "http_requests_total",
+		Help: "Number of HTTP requests handled, by method, route and status.",
+	}, []string{"method", "route", "status"})
+
+	// HTTPDuration measures request latency per route and status
+	HTTPDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "http_request_duration_seconds",
+		Help:    "HTTP request latency in seconds, by method, route and status.",
+		Buckets: prometheus.DefBuckets,
+	}, []string{"method", "route", "status"})
+
+	// LoginAttempts counts logins by result ("success" or "failure")
+	LoginAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Name: "auth_login_attempts_total",
+		Help: "Number of login attempts, by result.",
+	}, []string{"result"})
+)
+
+// Init registers all collectors with the default Prometheus registry
+// Must be called after the database is connected
+func Init() {
+	prometheus.MustRegister(
+		HTTPRequests,
+		HTTPDuration,
+		LoginAttempts,
+		collectors.NewDBStatsCollector(setting.DB, "mysql"),
+		newBusinessCollector(),
+	)
+}
+
+// Handler returns the HTTP handler that serves /metrics
+func Handler() http.Handler {
+	return promhttp.Handler()
+}
+
+// LoginSucceeded records a successful login
+func LoginSucceeded() {
+	LoginAttempts.WithLabelValues("success").Inc()
+}
+
+// LoginFailed records a failed login
+func LoginFailed() {
+	LoginAttempts.WithLabelValues("failure").Inc()
+}
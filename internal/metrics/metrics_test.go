@@ -0,0 +1,111 @@
+package metrics
+
+import (
+	"errors"
+	"siro-backend/internal/testutil"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func expectOpen(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM work_orders").
+		WillReturnRows(sqlmock.NewRows([]string{"unit", "status", "count"}).AddRow("IT", "Pending", 3).AddRow("Facilities", "In Progress", 1))
+}
+
+func expectBreaches(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM work_orders w").
+		WillReturnRows(sqlmock.NewRows([]string{"unit", "count"}).AddRow("IT", 2))
+}
+
+func expectSessions(mock sqlmock.Sqlmock) {
+	mock.ExpectQuery("FROM user_tokens").WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+}
+
+const (
+	openText = `
+# HELP workorders_open Number of unfinished work orders, by target unit and status.
+# TYPE workorders_open gauge
+workorders_open{status="In Progress",unit="Facilities"} 1
+workorders_open{status="Pending",unit="IT"} 3
+`
+	breachText = `
+# HELP workorders_sla_breached Number of unfinished work orders older than the SLA target of their priority, by target unit.
+# TYPE workorders_sla_breached gauge
+workorders_sla_breached{unit="IT"} 2
+`
+	sessionText = `
+# HELP auth_active_sessions Number of users with a refresh token that has not expired.
+# TYPE auth_active_sessions gauge
+auth_active_sessions 7
+`
+)
+
+var businessMetrics = []string{"workorders_open", "workorders_sla_breached", "auth_active_sessions"}
+
+func TestBusinessCollector(t *testing.T) {
+	mock := testutil.MockDB(t)
+	expectOpen(mock)
+	expectBreaches(mock)
+	expectSessions(mock)
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(newBusinessCollector())
+	if err := promtest.GatherAndCompare(reg, strings.NewReader(openText+breachText+sessionText), businessMetrics...); err != nil {
+		t.Error(err)
+	}
+}
+
+// TestBusinessCollectorQueryFails checks that a failed query only leaves out its own metric
+func TestBusinessCollectorQueryFails(t *testing.T) {
+	tests := []struct {
+		name   string
+		expect func(mock sqlmock.Sqlmock)
+		want   string
+	}{
+		{"open work orders", func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery("FROM work_orders").WillReturnError(errors.New("connection refused"))
+			expectBreaches(mock)
+			expectSessions(mock)
+		}, breachText + sessionText},
+		{"SLA breaches", func(mock sqlmock.Sqlmock) {
+			expectOpen(mock)
+			mock.ExpectQuery("FROM work_orders w").WillReturnError(errors.New("connection refused"))
+			expectSessions(mock)
+		}, openText + sessionText},
+		{"sessions", func(mock sqlmock.Sqlmock) {
+			expectOpen(mock)
+			expectBreaches(mock)
+			mock.ExpectQuery("FROM user_tokens").WillReturnError(errors.New("connection refused"))
+		}, openText + breachText},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.expect(testutil.MockDB(t))
+			reg := prometheus.NewPedanticRegistry()
+			reg.MustRegister(newBusinessCollector())
+			if err := promtest.GatherAndCompare(reg, strings.NewReader(tt.want), businessMetrics...); err != nil {
+				t.Error(err)
+			}
+		})
+	}
+}
+
+func TestLoginAttempts(t *testing.T) {
+	success := promtest.ToFloat64(LoginAttempts.WithLabelValues("success"))
+	failure := promtest.ToFloat64(LoginAttempts.WithLabelValues("failure"))
+
+	LoginSucceeded()
+	LoginFailed()
+	LoginFailed()
+
+	if got := promtest.ToFloat64(LoginAttempts.WithLabelValues("success")) - success; got != 1 {
+		t.Errorf("success counted %v times, want 1", got)
+	}
+	if got := promtest.ToFloat64(LoginAttempts.WithLabelValues("failure")) - failure; got != 2 {
+		t.Errorf("failure counted %v times, want 2", got)
+	}
+}
@@ -0,0 +1,122 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/netip"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/repo"
+	"siro-backend/pkg/logger"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/worker"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// APIKeyHeader carries the key of a service account, instead of a bearer token
+const APIKeyHeader = "X-API-Key"
+
+// ScopeUnitsKey is the context key with the units a key may create work orders for (unset = any unit)
+const ScopeUnitsKey = "scopeUnits"
+
+// APIKeyRoutes are the routes API keys can call and the scope each one needs,
+// by method and path without the /api/v1 prefix. Every other route answers 403 to API keys.
+var APIKeyRoutes = map[string]string{
+	"GET /workorders":            global.ScopeWorkOrdersRead,
+	"GET /workorders/stats":      global.ScopeWorkOrdersRead,
+	"GET /workorders/tags":       global.ScopeWorkOrdersRead,
+	"GET /workorders/:id":        global.ScopeWorkOrdersRead,
+	"GET /workorders/:id/events": global.ScopeWorkOrdersRead,
+	"POST /workorders":           global.ScopeWorkOrdersCreate,
+	"POST /upload/workorder":     global.ScopeWorkOrdersCreate,
+	"GET /units":                 global.ScopeUnitsRead,
+}
+
+// apiKeyAuth authenticates a request by its X-API-Key header and checks the key's IP allowlist and scopes
+// The service account then acts like a logged-in user (userID, role, canCRUD)
+func apiKeyAuth(c *gin.Context, key string) {
+	ctx := c.Request.Context()
+	k, account, err := repo.GetAPIKeyByHash(ctx, utils.HashToken(key))
+	if errors.Is(err, sql.ErrNoRows) {
+		response.Abort(c, http.StatusUnauthorized, response.CodeAPIKeyInvalid, "Invalid, revoked or expired API key")
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to check api key", "error", err)
+		response.Abort(c, http.StatusInternalServerError, response.CodeInternal, "Failed to check API key")
+		return
+	}
+
+	ip := c.ClientIP()
+	if !ipAllowed(k.AllowedIPs, ip) {
+		slog.WarnContext(ctx, "api key used from an address outside its allowlist", "api_key_id", k.ID, "ip", ip)
+		response.Abort(c, http.StatusForbidden, response.CodeAPIKeyIPNotAllowed, "This API key can't be used from your address")
+		return
+	}
+
+	scope := grantedScope(k, c.Request.Method+" "+strings.TrimPrefix(c.FullPath(), global.APIPrefix))
+	if scope == nil {
+		response.Abort(c, http.StatusForbidden, response.CodeAPIKeyForbidden, "This API key is not allowed to call this endpoint")
+		return
+	}
+
+	// At most one write per minute and address, so busy integrations don't write on every request
+	if k.LastUsedAt == nil || time.Since(*k.LastUsedAt) > time.Minute || k.LastUsedIP != ip {
+		worker.Go(context.WithoutCancel(ctx), "api_key.touch", func(ctx context.Context) {
+			if err := repo.TouchAPIKey(ctx, k.ID, ip); err != nil {
+				slog.WarnContext(ctx, "failed to record api key use", "api_key_id", k.ID, "error", err)
+			}
+		})
+	}
+
+	c.Set("userID", account.ID)
+	c.Set("role", account.Role)
+	c.Set("canCRUD", account.CanCRUD)
+	if len(scope.Units) > 0 {
+		c.Set(ScopeUnitsKey, scope.Units)
+	}
+	c.Request = c.Request.WithContext(logger.WithUserID(ctx, account.ID))
+	c.Next()
+}
+
+// grantedScope returns the scope of k that allows route ("METHOD /path"), or nil
+func grantedScope(k *models.APIKey, route string) *models.APIKeyScope {
+	needed, ok := APIKeyRoutes[route]
+	if !ok {
+		return nil
+	}
+	for i := range k.Scopes {
+		if k.Scopes[i].Scope == needed {
+			return &k.Scopes[i]
+		}
+	}
+	return nil
+}
+
+// ipAllowed reports whether ip matches one of the allowed IPs or CIDRs; an empty list allows any address
+func ipAllowed(allowed []string, ip string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil {
+		return false
+	}
+	addr = addr.Unmap()
+	for _, a := range allowed {
+		if prefix, err := netip.ParsePrefix(a); err == nil && prefix.Contains(addr) {
+			return true
+		}
+		if allowedAddr, err := netip.ParseAddr(a); err == nil && allowedAddr.Unmap() == addr {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,182 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"siro-backend/pkg/worker"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+const testAPIKey = "siro_test_0123456789abcdef"
+
+// apiKeyRow is a key of service account 9 as repo.GetAPIKeyByHash reads it
+func apiKeyRow(scopes, allowedIPs string, lastUsedAt interface{}, lastUsedIP string) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "name", "prefix", "scopes", "allowed_ips", "expires_at", "last_used_at",
+		"last_used_ip", "revoked_at", "created_at", "name", "role", "unit", "can_crud"}).
+		AddRow(3, 9, "helpdesk", "siro_test", scopes, allowedIPs, nil, lastUsedAt, lastUsedIP, nil, time.Now(),
+			"Helpdesk", global.RoleStaff, "IT", true)
+}
+
+// expectAPIKey expects the lookup of testAPIKey
+func expectAPIKey(mock sqlmock.Sqlmock) *sqlmock.ExpectedQuery {
+	return mock.ExpectQuery(`FROM api_keys k JOIN users u ON u.id = k.user_id\s+WHERE k.key_hash = \?`).
+		WithArgs(utils.HashToken(testAPIKey))
+}
+
+// apiKeyRequest sends an API key request from 10.0.0.5 through AuthMiddleware
+func apiKeyRequest(t *testing.T, method, route, path string, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, nil)
+	req.RemoteAddr = "10.0.0.5:40000"
+	req.Header.Set(APIKeyHeader, testAPIKey)
+	w := serve(req, route, handler, AuthMiddleware())
+	if err := worker.Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	readScope := `[{"scope":"workorders:read"}]`
+	recently := time.Now().Add(-10 * time.Second)
+
+	t.Run("allowed", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectAPIKey(mock).WillReturnRows(apiKeyRow(readScope, `[]`, nil, ""))
+		mock.ExpectExec(`UPDATE api_keys SET last_used_at = NOW\(\), last_used_ip = \? WHERE id = \?`).
+			WithArgs("10.0.0.5", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+
+		var got gin.H
+		w := apiKeyRequest(t, http.MethodGet, "/api/v1/workorders/:id", "/api/v1/workorders/7", func(c *gin.Context) {
+			_, limited := c.Get(ScopeUnitsKey)
+			got = gin.H{"userID": c.GetUint("userID"), "role": c.GetString("role"), "canCRUD": c.GetBool("canCRUD"), "limited": limited}
+			c.Status(http.StatusOK)
+		})
+		want := gin.H{"userID": uint(9), "role": global.RoleStaff, "canCRUD": true, "limited": false}
+		if w.Code != http.StatusOK || !reflect.DeepEqual(got, want) {
+			t.Errorf("status %d, context %v, want %v", w.Code, got, want)
+		}
+	})
+
+	t.Run("units of the scope", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectAPIKey(mock).WillReturnRows(apiKeyRow(`[{"scope":"workorders:read"},{"scope":"workorders:create","units":["IT"]}]`,
+			`["10.0.0.0/24"]`, recently, "10.0.0.5"))
+
+		var units []string
+		w := apiKeyRequest(t, http.MethodPost, "/api/v1/workorders", "/api/v1/workorders", func(c *gin.Context) {
+			units = c.GetStringSlice(ScopeUnitsKey)
+			c.Status(http.StatusCreated)
+		})
+		if w.Code != http.StatusCreated || !reflect.DeepEqual(units, []string{"IT"}) {
+			t.Errorf("status %d, units %v", w.Code, units)
+		}
+	})
+
+	t.Run("use recorded again from another address", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectAPIKey(mock).WillReturnRows(apiKeyRow(readScope, `[]`, recently, "10.0.0.6"))
+		mock.ExpectExec(`UPDATE api_keys`).WithArgs("10.0.0.5", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		if w := apiKeyRequest(t, http.MethodGet, "/api/v1/workorders", "/api/v1/workorders", ok); w.Code != http.StatusOK {
+			t.Errorf("status %d", w.Code)
+		}
+	})
+
+	t.Run("use recorded again after a minute", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectAPIKey(mock).WillReturnRows(apiKeyRow(readScope, `[]`, time.Now().Add(-2*time.Minute), "10.0.0.5"))
+		mock.ExpectExec(`UPDATE api_keys`).WithArgs("10.0.0.5", 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		if w := apiKeyRequest(t, http.MethodGet, "/api/v1/workorders", "/api/v1/workorders", ok); w.Code != http.StatusOK {
+			t.Errorf("status %d", w.Code)
+		}
+	})
+
+	t.Run("failed use update does not fail the request", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectAPIKey(mock).WillReturnRows(apiKeyRow(readScope, `[]`, nil, ""))
+		mock.ExpectExec(`UPDATE api_keys`).WillReturnError(errors.New("lock wait timeout"))
+		if w := apiKeyRequest(t, http.MethodGet, "/api/v1/workorders", "/api/v1/workorders", ok); w.Code != http.StatusOK {
+			t.Errorf("status %d", w.Code)
+		}
+	})
+
+	// Refused requests never reach the handler and never record a use
+	refused := []struct {
+		name          string
+		method, route string
+		expect        func(q *sqlmock.ExpectedQuery)
+		status        int
+		code          string
+	}{
+		{"unknown, revoked or expired key", http.MethodGet, "/api/v1/workorders",
+			func(q *sqlmock.ExpectedQuery) { q.WillReturnError(sql.ErrNoRows) }, http.StatusUnauthorized, response.CodeAPIKeyInvalid},
+		{"database error", http.MethodGet, "/api/v1/workorders",
+			func(q *sqlmock.ExpectedQuery) { q.WillReturnError(errors.New("connection refused")) }, http.StatusInternalServerError, response.CodeInternal},
+		{"outside the allowlist", http.MethodGet, "/api/v1/workorders",
+			func(q *sqlmock.ExpectedQuery) {
+				q.WillReturnRows(apiKeyRow(readScope, `["10.0.1.0/24","192.168.0.5"]`, nil, ""))
+			},
+			http.StatusForbidden, response.CodeAPIKeyIPNotAllowed},
+		{"scope missing", http.MethodPost, "/api/v1/workorders",
+			func(q *sqlmock.ExpectedQuery) { q.WillReturnRows(apiKeyRow(readScope, `[]`, nil, "")) }, http.StatusForbidden, response.CodeAPIKeyForbidden},
+		{"route not open to keys", http.MethodDelete, "/api/v1/workorders/:id",
+			func(q *sqlmock.ExpectedQuery) {
+				q.WillReturnRows(apiKeyRow(`[{"scope":"workorders:read"},{"scope":"workorders:create"},{"scope":"units:read"}]`, `[]`, nil, ""))
+			}, http.StatusForbidden, response.CodeAPIKeyForbidden},
+		{"admin route", http.MethodGet, "/api/v1/admin/users",
+			func(q *sqlmock.ExpectedQuery) { q.WillReturnRows(apiKeyRow(readScope, `[]`, nil, "")) }, http.StatusForbidden, response.CodeAPIKeyForbidden},
+	}
+	for _, tt := range refused {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			tt.expect(expectAPIKey(mock))
+			path := tt.route
+			if path == "/api/v1/workorders/:id" {
+				path = "/api/v1/workorders/7"
+			}
+			w := apiKeyRequest(t, tt.method, tt.route, path, func(c *gin.Context) { t.Error("handler called") })
+			if w.Code != tt.status || testutil.ErrorCode(t, w) != tt.code {
+				t.Errorf("status %d %s, want %d %s", w.Code, w.Body.String(), tt.status, tt.code)
+			}
+		})
+	}
+}
+
+func TestIPAllowed(t *testing.T) {
+	tests := []struct {
+		allowed []string
+		ip      string
+		want    bool
+	}{
+		{nil, "203.0.113.9", true},
+		{[]string{}, "not an ip", true},
+		{[]string{"10.0.0.5"}, "10.0.0.5", true},
+		{[]string{"10.0.0.5"}, "10.0.0.6", false},
+		{[]string{"10.0.0.0/24"}, "10.0.0.255", true},
+		{[]string{"10.0.0.0/24"}, "10.0.1.1", false},
+		{[]string{"10.0.0.5"}, "::ffff:10.0.0.5", true}, // IPv4-mapped IPv6
+		{[]string{"::ffff:10.0.0.5"}, "10.0.0.5", true},
+		{[]string{"2001:db8::/32"}, "2001:db8::1", true},
+		{[]string{"2001:db8::/32"}, "2001:db9::1", false},
+		{[]string{"garbage", "10.0.0.5"}, "10.0.0.5", true},
+		{[]string{"10.0.0.5"}, "", false},
+		{[]string{"10.0.0.5"}, "10.0.0.5:8080", false},
+	}
+	for _, tt := range tests {
+		if got := ipAllowed(tt.allowed, tt.ip); got != tt.want {
+			t.Errorf("ipAllowed(%q, %q) = %v, want %v", tt.allowed, tt.ip, got, tt.want)
+		}
+	}
+}
@@ -1,17 +1,20 @@
 package middlewares
 
 import (
-	"fmt"
 	"net/http"
 	"siro-backend/global"
 	"siro-backend/internal/repo"
+	"siro-backend/pkg/logger"
+	"siro-backend/pkg/response"
 	"siro-backend/pkg/utils"
 	"strings"
 
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 )
 
+// TokenIDKey is the context key with the jti of the access token, used to revoke the session on logout
+const TokenIDKey = "tokenID"
+
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		// --- BYPASS OPTIONS (PREFLIGHT) ---
@@ -22,70 +25,66 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// Service accounts send an API key instead of a token
+		if key := c.GetHeader(APIKeyHeader); key != "" {
+			apiKeyAuth(c, key)
+			return
+		}
+
 		// 1. Ambil Header Authorization
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Authorization header required"})
+			response.Abort(c, http.StatusUnauthorized, response.CodeTokenMissing, "Authorization header required")
 			return
 		}
 
 		// 2. Format harus "Bearer <token>"
 		parts := strings.Split(authHeader, " ")
 		if len(parts) != 2 || parts[0] != "Bearer" {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token format"})
+			response.Abort(c, http.StatusUnauthorized, response.CodeTokenInvalid, "Invalid token format")
 			return
 		}
 
 		tokenString := parts[1]
 
-		// 3. Parse Token
-		token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-			if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method")
-			}
-			return utils.JwtSecret, nil
-		})
+		// 3. Parse Token (kunci dipilih dari header kid untuk RS256/EdDSA)
+		claims, err := utils.ParseToken(tokenString)
+		if err != nil {
+			response.Abort(c, http.StatusUnauthorized, response.CodeTokenInvalid, "Invalid or expired token")
+			return
+		}
 
-		if err != nil || !token.Valid {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		// 4. Ekstrak Claims: user_id
+		if idFloat, ok := claims["user_id"].(float64); ok {
+			c.Set("userID", uint(idFloat))
+			c.Request = c.Request.WithContext(logger.WithUserID(c.Request.Context(), uint(idFloat)))
+		} else {
+			response.Abort(c, http.StatusUnauthorized, response.CodeTokenInvalid, "Invalid token claims: user_id")
 			return
 		}
 
-		// 4. Ekstrak Claims
-		if claims, ok := token.Claims.(jwt.MapClaims); ok {
-			// Handle user_id
-			if idFloat, ok := claims["user_id"].(float64); ok {
-				c.Set("userID", uint(idFloat))
-			} else {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims: user_id"})
-				return
-			}
-
-			// Handle role
-			if role, ok := claims["role"].(string); ok {
-				c.Set("role", role)
-			} else {
-				c.Set("role", "")
-			}
-
-			// Handle canCRUD (Sesuai dengan key di token.go)
-			if canCRUD, ok := claims["canCRUD"].(bool); ok {
-				c.Set("canCRUD", canCRUD)
-			} else {
-				c.Set("canCRUD", false)
-			}
-
-			// Validasi Database (Strict)
-			userID := uint(claims["user_id"].(float64))
-			if !repo.CheckAccessTokenValid(userID, tokenString) {
-				c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session expired or logged out"})
-				return
-			}
+		// Handle role
+		if role, ok := claims["role"].(string); ok {
+			c.Set("role", role)
+		} else {
+			c.Set("role", "")
+		}
 
+		// Handle canCRUD (Sesuai dengan key di token.go)
+		if canCRUD, ok := claims["canCRUD"].(bool); ok {
+			c.Set("canCRUD", canCRUD)
 		} else {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid token claims"})
+			c.Set("canCRUD", false)
+		}
+
+		// Validasi Database (Strict): jti harus masih sama dengan access token sesi user
+		userID := uint(claims["user_id"].(float64))
+		jti := utils.TokenID(claims)
+		if !repo.CheckAccessTokenValid(c.Request.Context(), userID, jti) {
+			response.Abort(c, http.StatusUnauthorized, response.CodeSessionRevoked, "Session expired or logged out")
 			return
 		}
+		c.Set(TokenIDKey, jti)
 
 		c.Next()
 	}
@@ -101,7 +100,7 @@ func AdminOnly() gin.HandlerFunc {
 
 		role, exists := c.Get("role")
 		if !exists || role != global.RoleAdmin {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "Forbidden: Admins only"})
+			response.Abort(c, http.StatusForbidden, response.CodeAdminOnly, "Forbidden: Admins only")
 			return
 		}
 		c.Next()
@@ -0,0 +1,148 @@
+package middlewares
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/utils"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gin-gonic/gin"
+)
+
+var jwtOnce sync.Once
+
+// setupJWT signs and checks tokens with HS256, as the server does without RS256/EdDSA keys
+func setupJWT(t *testing.T) {
+	t.Helper()
+	var err error
+	jwtOnce.Do(func() {
+		cfg := config.Default().JWT
+		cfg.Secret = strings.Repeat("s", 32)
+		err = utils.InitJWT(cfg, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// bearer returns a GET request to /me with the Authorization header set
+func bearer(header string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/me", nil)
+	if header != "" {
+		req.Header.Set("Authorization", header)
+	}
+	return req
+}
+
+// expectSession makes the stored access jti of user 5 be jti
+func expectSession(mock sqlmock.Sqlmock, jti string) {
+	mock.ExpectQuery(`SELECT access_jti FROM user_tokens WHERE user_id = \?`).WithArgs(5).
+		WillReturnRows(sqlmock.NewRows([]string{"access_jti"}).AddRow(jti))
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	setupJWT(t)
+	access, refresh, err := utils.GenerateAllTokens(5, global.RoleAdmin, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("valid session", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectSession(mock, access.ID)
+
+		var jti string
+		w := serve(bearer("Bearer "+access.Token), "/me", func(c *gin.Context) {
+			jti = c.GetString(TokenIDKey)
+			ok(c)
+		}, AuthMiddleware())
+		want := `{"canCRUD":true,"role":"Admin","userID":5}`
+		if w.Code != http.StatusOK || w.Body.String() != want {
+			t.Errorf("got %d %s, want %s", w.Code, w.Body.String(), want)
+		}
+		if jti != access.ID {
+			t.Errorf("%s = %q, want %q", TokenIDKey, jti, access.ID)
+		}
+	})
+
+	t.Run("preflight", func(t *testing.T) {
+		testutil.MockDB(t)
+		req := httptest.NewRequest(http.MethodOptions, "/me", nil)
+		if w := serve(req, "/me", func(c *gin.Context) { t.Error("handler called") }, AuthMiddleware()); w.Code != http.StatusNoContent {
+			t.Errorf("status %d, want 204", w.Code)
+		}
+	})
+
+	refused := []struct {
+		name   string
+		header string
+		expect func(mock sqlmock.Sqlmock)
+		code   string
+	}{
+		{"no header", "", nil, response.CodeTokenMissing},
+		{"no scheme", access.Token, nil, response.CodeTokenInvalid},
+		{"other scheme", "Basic " + access.Token, nil, response.CodeTokenInvalid},
+		{"extra space", "Bearer  " + access.Token, nil, response.CodeTokenInvalid},
+		{"bad signature", "Bearer " + access.Token[:len(access.Token)-2] + "xx", nil, response.CodeTokenInvalid},
+		{"not a token", "Bearer abc.def.ghi", nil, response.CodeTokenInvalid},
+		{"logged in elsewhere", "Bearer " + access.Token, func(mock sqlmock.Sqlmock) { expectSession(mock, "newer-session") }, response.CodeSessionRevoked},
+		{"logged out", "Bearer " + access.Token, func(mock sqlmock.Sqlmock) {
+			mock.ExpectQuery(`SELECT access_jti FROM user_tokens`).WillReturnError(errors.New("sql: no rows in result set"))
+		}, response.CodeSessionRevoked},
+		{"refresh token", "Bearer " + refresh.Token, func(mock sqlmock.Sqlmock) { expectSession(mock, access.ID) }, response.CodeSessionRevoked},
+	}
+	for _, tt := range refused {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			if tt.expect != nil {
+				tt.expect(mock)
+			}
+			w := serve(bearer(tt.header), "/me", func(c *gin.Context) { t.Error("handler called") }, AuthMiddleware())
+			if w.Code != http.StatusUnauthorized || testutil.ErrorCode(t, w) != tt.code {
+				t.Errorf("got %d %s, want 401 %s", w.Code, w.Body.String(), tt.code)
+			}
+		})
+	}
+}
+
+func TestAdminOnly(t *testing.T) {
+	setRole := func(role interface{}) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			if role != nil {
+				c.Set("role", role)
+			}
+		}
+	}
+	tests := []struct {
+		name   string
+		method string
+		role   interface{}
+		status int
+	}{
+		{"admin", http.MethodGet, global.RoleAdmin, http.StatusOK},
+		{"staff", http.MethodGet, global.RoleStaff, http.StatusForbidden},
+		{"lowercase", http.MethodGet, "admin", http.StatusForbidden},
+		{"no role", http.MethodGet, nil, http.StatusForbidden},
+		{"preflight", http.MethodOptions, nil, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/admin", nil)
+			w := serve(req, "/admin", func(c *gin.Context) { c.Status(http.StatusOK) }, setRole(tt.role), AdminOnly())
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusForbidden && testutil.ErrorCode(t, w) != response.CodeAdminOnly {
+				t.Errorf("body %s, want %s", w.Body.String(), response.CodeAdminOnly)
+			}
+		})
+	}
+}
@@ -0,0 +1,26 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// serve sends req through a router with the middlewares in front of handler at method path
+func serve(req *http.Request, path string, handler gin.HandlerFunc, mw ...gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	r.Handle(req.Method, path, append(mw, handler)...)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+// ok answers 200 with what the middlewares stored in the context
+func ok(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"userID": c.GetUint("userID"), "role": c.GetString("role"), "canCRUD": c.GetBool("canCRUD")})
+}
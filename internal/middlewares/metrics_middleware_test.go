@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/internal/metrics"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/response"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	promtest "github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestHTTPMetrics(t *testing.T) {
+	r := gin.New()
+	r.Use(HTTPMetrics())
+	r.GET("/api/v1/workorders/:id", func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	requests := func(route, status string) float64 {
+		return promtest.ToFloat64(metrics.HTTPRequests.WithLabelValues(http.MethodGet, route, status))
+	}
+	routeBefore := requests("/api/v1/workorders/:id", "200")
+	unmatchedBefore := requests("unmatched", "404")
+	observedBefore := observations(t, "/api/v1/workorders/:id", "200")
+
+	// the route template is the label, so every id lands in one series
+	for _, path := range []string{"/api/v1/workorders/1", "/api/v1/workorders/2", "/nope", "/api/v1/workorders/3"} {
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, path, nil))
+	}
+
+	if got := requests("/api/v1/workorders/:id", "200") - routeBefore; got != 3 {
+		t.Errorf("route counted %v times, want 3", got)
+	}
+	if got := requests("unmatched", "404") - unmatchedBefore; got != 1 {
+		t.Errorf("unmatched counted %v times, want 1", got)
+	}
+	if got := observations(t, "/api/v1/workorders/:id", "200") - observedBefore; got != 3 {
+		t.Errorf("latency observed %d times, want 3", got)
+	}
+}
+
+// observations returns how many latencies were recorded for a GET route and status
+func observations(t *testing.T, route, status string) uint64 {
+	t.Helper()
+	var m dto.Metric
+	if err := metrics.HTTPDuration.WithLabelValues(http.MethodGet, route, status).(prometheus.Histogram).Write(&m); err != nil {
+		t.Fatal(err)
+	}
+	return m.GetHistogram().GetSampleCount()
+}
+
+func TestMetricsAuth(t *testing.T) {
+	tests := []struct {
+		name   string
+		token  string
+		header string
+		status int
+	}{
+		{"open without a token", "", "", http.StatusOK},
+		{"open ignores the header", "", "Bearer whatever", http.StatusOK},
+		{"right token", "scrape-secret", "Bearer scrape-secret", http.StatusOK},
+		{"no header", "scrape-secret", "", http.StatusUnauthorized},
+		{"wrong token", "scrape-secret", "Bearer scrape-secreT", http.StatusUnauthorized},
+		{"token without Bearer", "scrape-secret", "scrape-secret", http.StatusUnauthorized},
+		{"prefix of the token", "scrape-secret", "Bearer scrape", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			w := serve(req, "/metrics", func(c *gin.Context) { c.String(http.StatusOK, "metrics") }, MetricsAuth(tt.token))
+			if w.Code != tt.status {
+				t.Fatalf("status %d, want %d", w.Code, tt.status)
+			}
+			if tt.status == http.StatusUnauthorized && testutil.ErrorCode(t, w) != response.CodeUnauthorized {
+				t.Errorf("body %s", w.Body.String())
+			}
+		})
+	}
+}
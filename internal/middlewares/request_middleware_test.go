@@ -0,0 +1,113 @@
+package middlewares
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/pkg/logger"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name     string
+		incoming string
+		reused   bool
+	}{
+		{"generated", "", false},
+		{"reused", "upstream-123", true},
+		{"too long", strings.Repeat("x", 129), false},
+		{"longest reused", strings.Repeat("x", 128), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/ping", nil)
+			if tt.incoming != "" {
+				req.Header.Set(RequestIDHeader, tt.incoming)
+			}
+			var inContext, inGin string
+			w := serve(req, "/ping", func(c *gin.Context) {
+				inContext = logger.RequestID(c.Request.Context())
+				inGin = c.GetString("requestID")
+			}, RequestID())
+
+			id := w.Header().Get(RequestIDHeader)
+			if inContext != id || inGin != id {
+				t.Errorf("header %q, context %q, gin %q", id, inContext, inGin)
+			}
+			if tt.reused && id != tt.incoming {
+				t.Errorf("id = %q, want the incoming %q", id, tt.incoming)
+			}
+			if !tt.reused && (id == tt.incoming || len(id) != 32) {
+				t.Errorf("id = %q, want a new 32 character id", id)
+			}
+		})
+	}
+
+	a, b := newRequestID(), newRequestID()
+	if a == b {
+		t.Errorf("two requests got the same id %q", a)
+	}
+}
+
+// captureLog sends the default slog logger to a buffer for the test
+func captureLog(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	old := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(&buf, nil)))
+	t.Cleanup(func() { slog.SetDefault(old) })
+	return &buf
+}
+
+func TestAccessLog(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		err    string // added with c.Error, "" = none
+		level  string
+	}{
+		{"success", http.StatusOK, "", "INFO"},
+		{"client error", http.StatusNotFound, "", "INFO"},
+		{"server error", http.StatusInternalServerError, "database is down", "ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			buf := captureLog(t)
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/workorders/7?x=1", nil)
+			req.RemoteAddr = "10.0.0.9:5000"
+			serve(req, "/api/v1/workorders/:id", func(c *gin.Context) {
+				if tt.err != "" {
+					_ = c.Error(errors.New(tt.err))
+				}
+				c.String(tt.status, "hello")
+			}, AccessLog())
+
+			var line map[string]interface{}
+			if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+				t.Fatalf("log %q: %v", buf.String(), err)
+			}
+			want := map[string]interface{}{
+				"msg": "http request", "level": tt.level, "method": "GET", "path": "/api/v1/workorders/7",
+				"route": "/api/v1/workorders/:id", "status": float64(tt.status), "bytes": float64(5), "client_ip": "10.0.0.9",
+			}
+			for k, v := range want {
+				if line[k] != v {
+					t.Errorf("%s = %v, want %v", k, line[k], v)
+				}
+			}
+			if _, ok := line["latency_ms"].(float64); !ok {
+				t.Errorf("latency_ms = %v", line["latency_ms"])
+			}
+			if errs, _ := line["errors"].(string); (tt.err == "" && errs != "") || !strings.Contains(errs, tt.err) {
+				t.Errorf("errors = %v", line["errors"])
+			}
+		})
+	}
+}
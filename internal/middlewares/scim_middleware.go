@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"siro-backend/pkg/scim"
+
+	"github.com/gin-gonic/gin"
+)
+
+// SCIMActor is the actor name recorded in the audit log for changes made by the provisioning client
+const SCIMActor = "scim"
+
+// SCIMAuth checks the bearer token of the SCIM provisioning client
+// Errors use the SCIM error format, which provisioning clients expect
+func SCIMAuth(token string) gin.HandlerFunc {
+	expected := []byte("Bearer " + token)
+	return func(c *gin.Context) {
+		if subtle.ConstantTimeCompare([]byte(c.GetHeader("Authorization")), expected) != 1 {
+			c.Header("Content-Type", scim.ContentType)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, scim.NewError(http.StatusUnauthorized, "", "Invalid SCIM token"))
+			return
+		}
+		c.Set("actorName", SCIMActor)
+		c.Next()
+	}
+}
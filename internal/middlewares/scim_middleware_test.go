@@ -0,0 +1,59 @@
+package middlewares
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/pkg/scim"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestSCIMAuth(t *testing.T) {
+	const token = "0123456789abcdef0123456789abcdef"
+	tests := []struct {
+		name   string
+		header string
+		ok     bool
+	}{
+		{"right token", "Bearer " + token, true},
+		{"no header", "", false},
+		{"wrong token", "Bearer " + token[:31] + "X", false},
+		{"lower-case bearer", "bearer " + token, false},
+		{"token only", token, false},
+		{"empty bearer", "Bearer ", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/scim/v2/Users", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			var actor string
+			w := serve(req, "/scim/v2/Users", func(c *gin.Context) {
+				actor = c.GetString("actorName")
+				c.Status(http.StatusOK)
+			}, SCIMAuth(token))
+
+			if tt.ok {
+				if w.Code != http.StatusOK || actor != SCIMActor {
+					t.Errorf("status %d, actor %q", w.Code, actor)
+				}
+				return
+			}
+			if w.Code != http.StatusUnauthorized || actor != "" {
+				t.Fatalf("status %d, actor %q, want 401 before the handler", w.Code, actor)
+			}
+			// provisioning clients expect a SCIM error, not the API envelope
+			if ct := w.Header().Get("Content-Type"); ct != scim.ContentType {
+				t.Errorf("Content-Type = %q", ct)
+			}
+			var e scim.Error
+			if err := json.Unmarshal(w.Body.Bytes(), &e); err != nil || e.Status != "401" ||
+				len(e.Schemas) != 1 || e.Schemas[0] != scim.SchemaError {
+				t.Errorf("body %s (%v)", w.Body.String(), err)
+			}
+		})
+	}
+}
@@ -4,17 +4,77 @@ import "time"
 
 // User
 type User struct {
-	ID           uint      `json:"id"`
-	Name         string    `json:"name"`
-	Email        string    `json:"email"`
-	Role         string    `json:"role"`
-	Unit         string    `json:"unit"`
-	Phone        string    `json:"phone"`
-	AvatarURL    string    `json:"avatar"`
-	Availability string    `json:"availability"`
-	CanCRUD      bool      `json:"canCRUD"`
-	PasswordHash string    `json:"-"`
-	CreatedAt    time.Time `json:"-"`
+	ID             uint      `json:"id"`
+	Name           string    `json:"name"`
+	Email          string    `json:"email"`
+	Role           string    `json:"role"`
+	Unit           string    `json:"unit"`
+	Phone          string    `json:"phone"`
+	AvatarURL      string    `json:"avatar"`
+	Availability   string    `json:"availability"`
+	CanCRUD        bool      `json:"canCRUD"`
+	Version        uint      `json:"version"`
+	PasswordHash   string    `json:"-"`
+	CreatedAt      time.Time `json:"-"`
+	UpdatedAt      time.Time `json:"-"`
+	ExternalID     string    `json:"-"` // ID in the identity provider (SCIM externalId)
+	OIDCSubject    string    `json:"-"` // "sub" of the linked single sign-on identity
+	ServiceAccount bool      `json:"-"` // an integration that uses API keys, see ServiceAccount
+
+	DeactivatedAt *time.Time `json:"deactivated_at"` // set = can't log in, hidden from staff lists
+	AnonymizedAt  *time.Time `json:"anonymized_at"`  // set = personal data erased, can't be reactivated
+
+	Invited            bool        `json:"invited"`              // no password yet, waiting for the invitation to be accepted
+	MustChangePassword bool        `json:"must_change_password"` // login is refused until a new password is set
+	Invitation         *Invitation `json:"invitation,omitempty"` // only right after inviting
+}
+
+// Invitation is the link an invited user opens to set their password
+type Invitation struct {
+	URL       string    `json:"url"`
+	ExpiresAt time.Time `json:"expires_at"`
+	Emailed   bool      `json:"emailed"` // false when email is not configured: give the link to the user yourself
+}
+
+// ServiceAccount is an integration (e.g. the building management system) that calls the API with API keys
+// It is a user without a password, so its work orders have a requester and a unit like any other
+type ServiceAccount struct {
+	ID            uint       `json:"id"`
+	Name          string     `json:"name"`
+	Unit          string     `json:"unit"`
+	DeactivatedAt *time.Time `json:"deactivated_at"`
+	CreatedAt     time.Time  `json:"created_at"`
+	Keys          []APIKey   `json:"keys"`
+}
+
+// APIKey is a key of a service account; only Prefix is kept to recognise it, the key itself is hashed
+type APIKey struct {
+	ID               uint          `json:"id"`
+	ServiceAccountID uint          `json:"service_account_id"`
+	Name             string        `json:"name"`
+	Prefix           string        `json:"prefix"`
+	Scopes           []APIKeyScope `json:"scopes"`
+	AllowedIPs       []string      `json:"allowed_ips"` // IPs or CIDRs; empty = any address
+	ExpiresAt        *time.Time    `json:"expires_at"`
+	LastUsedAt       *time.Time    `json:"last_used_at"`
+	LastUsedIP       string        `json:"last_used_ip"`
+	RevokedAt        *time.Time    `json:"revoked_at"`
+	CreatedAt        time.Time     `json:"created_at"`
+	Key              string        `json:"key,omitempty"` // only in the response that creates the key
+}
+
+// APIKeyScope allows an API key one kind of request
+// Units limits workorders:create to work orders for those units (empty = any unit)
+type APIKeyScope struct {
+	Scope string   `json:"scope" binding:"required,apiscope"`
+	Units []string `json:"units,omitempty" binding:"omitempty,max=50,dive,required,max=255,unit"`
+}
+
+// InvitationInfo is what the invitation page shows before the password is set
+type InvitationInfo struct {
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	ExpiresAt time.Time `json:"expires_at"`
 }
 
 // UserToken
@@ -51,8 +111,52 @@ type WorkOrder struct {
 
 	CompletionNote string `json:"completion_note"`
 
+	IsPublic bool `json:"is_public"` // visible to every unit, not only the target and requester unit
+
+	Tags  []string  `json:"tags"`
+	DueAt time.Time `json:"due_at"` // created_at + SLA target of the priority
+
+	Version   uint      `json:"version"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+
+	// Highlights holds the matching parts of title / description / completion_note
+	// with <mark> tags (HTML-escaped), only set when searching with ?q=
+	Highlights map[string]string `json:"highlights,omitempty"`
+
+	// Timeline is the history of the work order, oldest first; only set by GET /workorders/:id
+	Timeline []TimelineEvent `json:"timeline,omitempty"`
+}
+
+// TimelineEvent is one entry in the history of a work order
+type TimelineEvent struct {
+	Type    string    `json:"type"` // created, taken, assigned, completed, attachment, sla_breached or activity
+	At      time.Time `json:"at"`
+	ActorID *uint     `json:"actorId,omitempty"`
+	Actor   string    `json:"actor,omitempty"`
+	Message string    `json:"message"`
+	Status  string    `json:"status,omitempty"` // status after the event
+	URL     string    `json:"url,omitempty"`    // attachment link
+}
+
+// WorkOrderEvent is one change to a work order, with the changed fields before and after
+type WorkOrderEvent struct {
+	ID          uint                   `json:"id"`
+	WorkOrderID uint                   `json:"workOrderId"`
+	Type        string                 `json:"type"` // created, taken, assigned, completed
+	ActorID     *uint                  `json:"actorId"`
+	ActorName   string                 `json:"actor"`
+	Source      string                 `json:"source"` // api or migration
+	Before      map[string]interface{} `json:"before"`
+	After       map[string]interface{} `json:"after"`
+	CreatedAt   time.Time              `json:"created_at"`
+}
+
+// WorkOrderHistory is the change history of one work order
+// TimeInStatus is the number of seconds spent in each open status (the current one counts up to now)
+type WorkOrderHistory struct {
+	Events       []WorkOrderEvent `json:"events"`
+	TimeInStatus map[string]int64 `json:"time_in_status"`
 }
 
 type DashboardStats struct {
@@ -74,34 +178,84 @@ type ActivityLog struct {
 	Timestamp time.Time `json:"timestamp"`
 }
 
+// Unit
+type Unit struct {
+	ID        uint      `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 // --- Request Structs ---
 
 type LoginRequest struct {
-	Email    string `json:"email" binding:"required,email"`
-	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email,max=255"`
+	Password string `json:"password" binding:"required,max=72"`
 }
 
 type RefreshRequest struct {
 	RefreshToken string `json:"refreshToken" binding:"required"`
 }
 
+// Length limits match the columns in migrations/
+// TEXT holds 65535 bytes, which is 16383 characters in the worst case of utf8mb4
 type WorkOrderRequest struct {
-	Title       string `json:"title" binding:"required"`
-	Description string `json:"description"`
-	Priority    string `json:"priority" binding:"required"`
-	Unit        string `json:"unit"`
-	PhotoURL    string `json:"photo"`
+	Title       string   `json:"title" binding:"required,max=255"`
+	Description string   `json:"description" binding:"max=16383"`
+	Priority    string   `json:"priority" binding:"required,priority"`
+	Unit        string   `json:"unit" binding:"omitempty,max=255,unit"`
+	PhotoURL    string   `json:"photo" binding:"omitempty,max=500"`
+	Tags        []string `json:"tags" binding:"omitempty,max=10,dive,required,max=50"`
+	IsPublic    bool     `json:"is_public"`
 }
 
+// Password max is 72 because bcrypt ignores everything after 72 bytes
 type UserRequest struct {
-	Name      string `json:"name" binding:"required"`
-	Email     string `json:"email" binding:"required,email"`
-	Password  string `json:"password"`
-	Role      string `json:"role" binding:"required"`
-	Unit      string `json:"unit" binding:"required"`
-	Phone     string `json:"phone"`
+	Name      string `json:"name" binding:"required,max=255"`
+	Email     string `json:"email" binding:"required,email,max=255"`
+	Password  string `json:"password" binding:"omitempty,max=72"`
+	Role      string `json:"role" binding:"required,role"`
+	Unit      string `json:"unit" binding:"required,max=255,unit"`
+	Phone     string `json:"phone" binding:"omitempty,max=50,phone"`
 	CanCRUD   bool   `json:"canCRUD"`
-	AvatarURL string `json:"avatar"`
+	AvatarURL string `json:"avatar" binding:"omitempty,max=500"`
+
+	// Admin only, ignored by PUT /me
+	Invite             bool `json:"invite"`               // create without password and send an invitation (POST only)
+	MustChangePassword bool `json:"must_change_password"` // force a new password at the next login
+}
+
+// OIDCAuthorization starts a single sign-on login
+// The frontend keeps State (e.g. in sessionStorage), sends the browser to URL
+// and checks that the state coming back to its callback page is the same
+type OIDCAuthorization struct {
+	URL       string    `json:"url"`
+	State     string    `json:"state"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// OIDCCallbackRequest carries what the provider sent back to the frontend's callback page
+type OIDCCallbackRequest struct {
+	Code  string `json:"code" binding:"required,max=2048"`
+	State string `json:"state" binding:"required,max=128"`
+}
+
+// InvitationTokenRequest carries the token from an invitation link
+// It is sent in the body rather than the URL, so it doesn't end up in access logs
+type InvitationTokenRequest struct {
+	Token string `json:"token" binding:"required,max=100"`
+}
+
+// AcceptInvitationRequest sets the password of an invited user
+type AcceptInvitationRequest struct {
+	Token    string `json:"token" binding:"required,max=100"`
+	Password string `json:"password" binding:"required,min=8,max=72"`
+}
+
+// ChangePasswordRequest replaces the password of a user who must change it before logging in
+type ChangePasswordRequest struct {
+	Email           string `json:"email" binding:"required,email,max=255"`
+	CurrentPassword string `json:"currentPassword" binding:"required,max=72"`
+	NewPassword     string `json:"newPassword" binding:"required,min=8,max=72,nefield=CurrentPassword"`
 }
 
 type AssignRequest struct {
@@ -109,18 +263,105 @@ type AssignRequest struct {
 }
 
 type AvailabilityRequest struct {
-	Status string `json:"status" binding:"required"`
+	Status string `json:"status" binding:"required,availability"`
 }
 
 type FinalizeRequest struct {
-	Note string `json:"note"`
+	Note string `json:"note" binding:"max=16383"`
+}
+
+type UnitRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+}
+
+// ServiceAccountRequest creates a service account; its unit is the requesting unit of its work orders
+type ServiceAccountRequest struct {
+	Name string `json:"name" binding:"required,max=255"`
+	Unit string `json:"unit" binding:"required,max=255,unit"`
+}
+
+// APIKeyRequest creates an API key for a service account
+type APIKeyRequest struct {
+	Name       string        `json:"name" binding:"required,max=100"`
+	Scopes     []APIKeyScope `json:"scopes" binding:"required,min=1,max=10,dive"`
+	AllowedIPs []string      `json:"allowed_ips" binding:"omitempty,max=50,dive,ip|cidr"`
+	ExpiresAt  *time.Time    `json:"expires_at"` // empty = never
+}
+
+// WorkOrderFilter holds the query parameters of GET /workorders
+// List parameters accept comma-separated values: ?status=Pending,In Progress
+type WorkOrderFilter struct {
+	Status        []string `form:"status" collection_format:"csv" json:"status" binding:"omitempty,dive,statusfilter"`
+	Priority      []string `form:"priority" collection_format:"csv" json:"priority" binding:"omitempty,dive,priority"`
+	Unit          []string `form:"unit" collection_format:"csv" json:"unit" binding:"omitempty,dive,max=255"`
+	RequesterUnit []string `form:"requester_unit" collection_format:"csv" json:"requester_unit" binding:"omitempty,dive,max=255"`
+	Tags          []string `form:"tags" collection_format:"csv" json:"tags" binding:"omitempty,dive,max=50"`
+
+	Assignee  string `form:"assignee" json:"assignee" binding:"omitempty,assigneeref"` // "me", "unassigned" or a user ID
+	Requester string `form:"requester" json:"requester" binding:"omitempty,userref"`   // "me" or a user ID
+
+	CreatedFrom   string `form:"created_from" json:"created_from" binding:"omitempty,datetime=2006-01-02"`
+	CreatedTo     string `form:"created_to" json:"created_to" binding:"omitempty,datetime=2006-01-02"`
+	CompletedFrom string `form:"completed_from" json:"completed_from" binding:"omitempty,datetime=2006-01-02"`
+	CompletedTo   string `form:"completed_to" json:"completed_to" binding:"omitempty,datetime=2006-01-02"`
+	Date          string `form:"date" json:"date" binding:"omitempty,eq=today"`
+
+	SLABreached *bool    `form:"sla_breached" json:"sla_breached"`
+	Query       string   `form:"q" json:"q" binding:"omitempty,max=200"`
+	Sort        []string `form:"sort" collection_format:"csv" json:"sort" binding:"omitempty,max=4,dive,wosort"`
+}
+
+// EventFilter are the query parameters of GET /admin/events
+type EventFilter struct {
+	WorkOrder *uint    `form:"work_order" json:"work_order" binding:"omitempty,min=1"`
+	Actor     *uint    `form:"actor" json:"actor" binding:"omitempty,min=1"`
+	Type      []string `form:"type" collection_format:"csv" json:"type" binding:"omitempty,dive,oneof=created taken assigned completed"`
+}
+
+// AuditFilter are the query parameters of GET /admin/audit
+type AuditFilter struct {
+	Actor      *uint    `form:"actor" json:"actor" binding:"omitempty,min=1"`
+	Action     []string `form:"action" collection_format:"csv" json:"action" binding:"omitempty,dive,max=64"`
+	TargetType string   `form:"target_type" json:"target_type" binding:"omitempty,max=32"`
+	TargetID   string   `form:"target_id" json:"target_id" binding:"omitempty,max=64"`
+	From       string   `form:"from" json:"from" binding:"omitempty,datetime=2006-01-02"`
+	To         string   `form:"to" json:"to" binding:"omitempty,datetime=2006-01-02"`
+}
+
+// UserFilter are the query parameters of GET /admin/users and GET /admin/users/export
+type UserFilter struct {
+	Role   []string `form:"role" collection_format:"csv" json:"role" binding:"omitempty,dive,role"`
+	Unit   []string `form:"unit" collection_format:"csv" json:"unit" binding:"omitempty,dive,max=255"`
+	Status string   `form:"status" json:"status" binding:"omitempty,oneof=active deactivated"`
+}
+
+// UserImportResult is the answer of POST /admin/users/import
+// Nothing is created when there are errors; Users are the created users (in a dry run: the ones that would be)
+type UserImportResult struct {
+	DryRun  bool             `json:"dry_run"`
+	Rows    int              `json:"rows"` // data rows, blank rows not counted
+	Created int              `json:"created"`
+	Errors  []ImportRowError `json:"errors"`
+	Users   []User           `json:"users"`
+}
+
+// ImportRowError is a problem in one row of an import file (row numbers as shown in Excel, header = 1)
+type ImportRowError struct {
+	Row     int    `json:"row"`
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
 }
 
+// PaginationMeta describes a page of a list
+// Offset mode (?page=) fills current_page, total_pages and total_items
+// Cursor mode (?cursor=) fills next_cursor / prev_cursor, and total_items only with include_total=true
 type PaginationMeta struct {
-	CurrentPage int `json:"current_page"`
-	TotalPages  int `json:"total_pages"`
-	TotalItems  int `json:"total_items"`
-	Limit       int `json:"limit"`
+	CurrentPage int    `json:"current_page,omitempty"`
+	TotalPages  *int   `json:"total_pages,omitempty"`
+	TotalItems  *int   `json:"total_items,omitempty"`
+	Limit       int    `json:"limit"`
+	NextCursor  string `json:"next_cursor,omitempty"`
+	PrevCursor  string `json:"prev_cursor,omitempty"`
 }
 
 type PaginatedResponse struct {
@@ -0,0 +1,357 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/buildinfo"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/scim"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Auth says which credentials a route needs
+type Auth int
+
+const (
+	AuthUser    Auth = iota // Bearer access token (default)
+	AuthAdmin               // Bearer access token of an Admin
+	AuthNone                // Public
+	AuthMetrics             // Bearer METRICS_TOKEN (only if configured)
+	AuthSCIM                // Bearer SCIM_TOKEN, SCIM media type (only if enabled)
+)
+
+// Param is a query parameter
+type Param struct {
+	Name        string
+	Description string
+	Type        string   // "string" or "integer"
+	Enum        []string // allowed values, if limited
+	List        bool     // comma-separated list, e.g. status=Pending,Completed
+}
+
+// Operation documents one route
+type Operation struct {
+	Method  string
+	Path    string // Gin syntax, e.g. /api/v1/workorders/:id/take
+	Tag     string
+	Summary string
+	Auth    Auth
+	Scope   string // API keys with this scope may call the route too (see middlewares.APIKeyRoutes)
+	Query   []Param
+
+	Body     interface{} // JSON request body (nil = none)
+	Upload   bool        // multipart/form-data with a "file" field
+	IfMatch  bool        // accepts If-Match and may answer 409/412
+	Conflict bool        // may answer 409 (e.g. the name already exists)
+
+	Status      int         // success status, 200 if zero
+	Response    interface{} // value of "data" (or the whole body when Raw)
+	Paginated   bool        // response has "meta" with pagination info
+	Raw         bool        // response is not wrapped in the envelope
+	ContentType string      // success content type, application/json if empty
+}
+
+// Key returns "METHOD /path" as used by gin's route table
+func (op Operation) Key() string {
+	return op.Method + " " + op.Path
+}
+
+// Documented returns the keys of all documented routes
+func Documented() map[string]bool {
+	keys := make(map[string]bool, len(Operations))
+	for _, op := range Operations {
+		keys[op.Key()] = true
+	}
+	return keys
+}
+
+// Build returns the OpenAPI 3.1 document for the route table
+func Build(serverURL string) object {
+	b := newSchemaBuilder()
+	paths := object{}
+
+	for _, op := range Operations {
+		path, params := convertPath(op.Path)
+		item, ok := paths[path].(object)
+		if !ok {
+			item = object{}
+			paths[path] = item
+		}
+		item[strings.ToLower(op.Method)] = b.operation(op, params)
+	}
+
+	// Shared error shapes
+	b.components["ErrorResponse"] = object{
+		"type":     "object",
+		"required": []string{"success", "error"},
+		"properties": object{
+			"success": object{"const": false},
+			"error":   b.ref(response.ErrorBody{}),
+			"data":    object{"description": "Current version of the record (only for VERSION_CONFLICT)"},
+		},
+	}
+
+	return object{
+		"openapi": "3.1.0",
+		"info": object{
+			"title":       "Siro Backend API",
+			"version":     buildinfo.Get().Version,
+			"description": "Work order system. Error codes are listed in pkg/response/codes.go.",
+		},
+		"servers": []object{{"url": serverURL}},
+		"paths":   paths,
+		"components": object{
+			"schemas": b.components,
+			"securitySchemes": object{
+				"bearerAuth":   object{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+				"metricsToken": object{"type": "http", "scheme": "bearer", "description": "METRICS_TOKEN"},
+				"scimToken":    object{"type": "http", "scheme": "bearer", "description": "SCIM_TOKEN"},
+				"apiKey":       object{"type": "apiKey", "in": "header", "name": "X-API-Key", "description": "API key of a service account"},
+			},
+			"responses": errorResponses(),
+		},
+	}
+}
+
+func (b *schemaBuilder) operation(op Operation, pathParams []object) object {
+	o := object{
+		"tags":        []string{op.Tag},
+		"summary":     op.Summary,
+		"operationId": operationID(op),
+	}
+
+	params := pathParams
+	for _, q := range op.Query {
+		schema := object{"type": q.Type}
+		if len(q.Enum) > 0 {
+			schema["enum"] = q.Enum
+		}
+		param := object{"name": q.Name, "in": "query", "description": q.Description, "schema": schema}
+		if q.List {
+			param["schema"] = object{"type": "array", "items": schema}
+			param["style"] = "form"
+			param["explode"] = false
+		}
+		params = append(params, param)
+	}
+	if op.IfMatch {
+		params = append(params, object{
+			"name": "If-Match", "in": "header", "description": `ETag of the version being edited, e.g. "3"`,
+			"schema": object{"type": "string"},
+		})
+	}
+	if len(params) > 0 {
+		o["parameters"] = params
+	}
+
+	bodyType := "application/json"
+	if op.Auth == AuthSCIM {
+		bodyType = scim.ContentType
+	}
+	switch {
+	case op.Body != nil:
+		o["requestBody"] = object{"required": true, "content": object{
+			bodyType: object{"schema": b.ref(op.Body)},
+		}}
+	case op.Upload:
+		o["requestBody"] = object{"required": true, "content": object{
+			"multipart/form-data": object{"schema": object{
+				"type":       "object",
+				"required":   []string{"file"},
+				"properties": object{"file": object{"type": "string", "format": "binary"}},
+			}},
+		}}
+	}
+
+	switch op.Auth {
+	case AuthUser, AuthAdmin:
+		o["security"] = []object{{"bearerAuth": []string{}}}
+		if op.Scope != "" {
+			o["security"] = []object{{"bearerAuth": []string{}}, {"apiKey": []string{}}}
+			o["description"] = "API keys need the " + op.Scope + " scope."
+		}
+	case AuthMetrics:
+		o["security"] = []object{{"metricsToken": []string{}}, {}}
+	case AuthSCIM:
+		o["security"] = []object{{"scimToken": []string{}}}
+	}
+
+	o["responses"] = b.responses(op, len(pathParams) > 0)
+	return o
+}
+
+func (b *schemaBuilder) responses(op Operation, hasID bool) object {
+	status := op.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	contentType := op.ContentType
+	if contentType == "" {
+		contentType = "application/json"
+	}
+
+	success := object{"description": http.StatusText(status)}
+	if op.Response != nil || !op.Raw {
+		success["content"] = object{contentType: object{"schema": b.successSchema(op)}}
+	} else if status != http.StatusNoContent {
+		success["content"] = object{contentType: object{}}
+	}
+	res := object{strconv.Itoa(status): success}
+
+	if op.Raw {
+		if op.Auth == AuthMetrics {
+			res["401"] = errorRef("Unauthorized")
+		}
+		if op.Auth == AuthSCIM {
+			// SCIM errors have their own format (RFC 7644 section 3.12)
+			res["default"] = object{"description": "SCIM error", "content": object{
+				scim.ContentType: object{"schema": b.ref(scimError{})},
+			}}
+		}
+		if op.Path == "/readyz" {
+			res["503"] = object{"description": "Not ready", "content": object{
+				"application/json": object{"schema": b.ref(readyResponse{})},
+			}}
+		}
+		return res
+	}
+
+	if op.Body != nil || op.Upload || hasID || len(op.Query) > 0 {
+		res["400"] = errorRef("BadRequest")
+	}
+	if op.Auth != AuthNone {
+		res["401"] = errorRef("Unauthorized")
+		res["403"] = errorRef("Forbidden")
+	}
+	if hasID {
+		res["404"] = errorRef("NotFound")
+	}
+	if op.IfMatch || op.Conflict {
+		res["409"] = errorRef("Conflict")
+	}
+	if op.IfMatch {
+		res["412"] = errorRef("PreconditionFailed")
+	}
+	res["500"] = errorRef("InternalError")
+	return res
+}
+
+// successSchema wraps the response type in {success, data, meta}
+func (b *schemaBuilder) successSchema(op Operation) object {
+	if op.Raw {
+		return b.ref(op.Response)
+	}
+
+	props := object{"success": object{"const": true}}
+	if op.Response != nil {
+		props["data"] = b.ref(op.Response)
+	}
+	required := []string{"success", "data"}
+	if op.Paginated {
+		props["meta"] = b.ref(models.PaginationMeta{})
+		required = append(required, "meta")
+	}
+	return object{"type": "object", "required": required, "properties": props}
+}
+
+// errorResponses are the reusable error responses under #/components/responses
+func errorResponses() object {
+	schema := object{"application/json": object{"schema": object{"$ref": "#/components/schemas/ErrorResponse"}}}
+	res := object{}
+	for name, desc := range map[string]string{
+		"BadRequest":         "Invalid input (VALIDATION_FAILED, INVALID_JSON, INVALID_ID, ...)",
+		"Unauthorized":       "Missing or invalid token (TOKEN_MISSING, TOKEN_INVALID, SESSION_REVOKED, ...)",
+		"Forbidden":          "Not allowed (ADMIN_ONLY, PERMISSION_DENIED, UNIT_MISMATCH)",
+		"NotFound":           "Record not found",
+		"Conflict":           "Changed by someone else (VERSION_CONFLICT), already taken or already exists",
+		"PreconditionFailed": "If-Match does not match the current version (VERSION_CONFLICT)",
+		"InternalError":      "Unexpected server error (INTERNAL_ERROR)",
+	} {
+		res[name] = object{"description": desc, "content": schema}
+	}
+	return res
+}
+
+func errorRef(name string) object {
+	return object{"$ref": "#/components/responses/" + name}
+}
+
+// convertPath turns /users/:id into /users/{id} and returns the path parameters
+func convertPath(path string) (string, []object) {
+	var params []object
+	parts := strings.Split(path, "/")
+	for i, p := range parts {
+		if p == "" || (p[0] != ':' && p[0] != '*') {
+			continue
+		}
+		name := p[1:]
+		schema := object{"type": "string"}
+		if name == "id" || strings.HasSuffix(name, "Id") {
+			schema = object{"type": "integer", "minimum": 1}
+		}
+		params = append(params, object{"name": name, "in": "path", "required": true, "schema": schema})
+		parts[i] = "{" + name + "}"
+	}
+	return strings.Join(parts, "/"), params
+}
+
+// operationID builds a unique id like "patchWorkordersIdTake"
+func operationID(op Operation) string {
+	id := strings.ToLower(op.Method)
+	for _, segment := range strings.Split(op.Path, "/") {
+		segment = strings.TrimLeft(segment, ":*")
+		if segment == "api" || segment == "v1" {
+			continue
+		}
+		for _, p := range strings.FieldsFunc(segment, func(r rune) bool { return r == '.' || r == '_' }) {
+			id += strings.ToUpper(p[:1]) + p[1:]
+		}
+	}
+	return id
+}
+
+// Handler serves the OpenAPI document as JSON (built once on the first request)
+func Handler(serverURL string) gin.HandlerFunc {
+	var (
+		once sync.Once
+		doc  []byte
+		err  error
+	)
+	return func(c *gin.Context) {
+		once.Do(func() { doc, err = json.Marshal(Build(serverURL)) })
+		if err != nil {
+			response.Error(c, http.StatusInternalServerError, response.CodeInternal, "Failed to build OpenAPI document")
+			return
+		}
+		c.Data(http.StatusOK, "application/json; charset=utf-8", doc)
+	}
+}
+
+// SwaggerUI serves an HTML page that renders /openapi.json
+func SwaggerUI(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(swaggerHTML))
+}
+
+const swaggerHTML = `<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>Siro Backend API</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.onload = () => {
+      window.ui = SwaggerUIBundle({ url: "/openapi.json", dom_id: "#swagger-ui" });
+    };
+  </script>
+</body>
+</html>
+`
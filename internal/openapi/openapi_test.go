@@ -0,0 +1,424 @@
+package openapi
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/scim"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Structs that exercise the schema builder
+type (
+	testAddress struct {
+		City string `json:"city"`
+	}
+	testNode struct {
+		Name     string      `json:"name"`
+		Children []*testNode `json:"children"`
+	}
+	testRequest struct {
+		Name     string            `json:"name" binding:"required,max=255"`
+		Email    string            `json:"email" binding:"required,email"`
+		Priority string            `json:"priority" binding:"oneof=High Medium Low"`
+		Count    int               `json:"count" binding:"min=1,max=10"`
+		Tags     []string          `json:"tags" binding:"omitempty,max=5,dive,required,max=50"`
+		Labels   map[string]string `json:"labels" binding:"min=1"`
+		Address  testAddress       `json:"address"`
+		Previous *testAddress      `json:"previous"`
+		Inline   struct {
+			On bool `json:"on"`
+		} `json:"inline"`
+		DueAt   *time.Time  `json:"dueAt"`
+		Score   float64     `json:"score"`
+		ID      uint        `json:"id"`
+		Extra   interface{} `json:"extra"`
+		NoTag   string
+		Skipped string `json:"-"`
+		hidden  string
+	}
+)
+
+// build returns the document after a JSON round trip, as clients see it
+func build(t *testing.T) map[string]interface{} {
+	t.Helper()
+	data, err := json.Marshal(Build("https://siro.example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+// lookup follows a path of keys through nested JSON objects
+func lookup(t *testing.T, v interface{}, keys ...string) interface{} {
+	t.Helper()
+	for _, k := range keys {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			t.Fatalf("%s: not an object", strings.Join(keys, "."))
+		}
+		if v, ok = m[k]; !ok {
+			t.Fatalf("%s: no key %q", strings.Join(keys, "."), k)
+		}
+	}
+	return v
+}
+
+func TestSchemaTypes(t *testing.T) {
+	b := newSchemaBuilder()
+	if got := b.ref(testRequest{}); !reflect.DeepEqual(got, object{"$ref": "#/components/schemas/TestRequest"}) {
+		t.Fatalf("ref = %v", got)
+	}
+	s := b.components["TestRequest"].(object)
+	props := s["properties"].(object)
+
+	tests := map[string]object{
+		"name":     {"type": "string", "maxLength": 255},
+		"email":    {"type": "string", "format": "email"},
+		"priority": {"type": "string", "enum": []string{"High", "Medium", "Low"}},
+		"count":    {"type": "integer", "minimum": 1, "maximum": 10},
+		// rules after dive are for the items, not the list
+		"tags":     {"type": "array", "items": object{"type": "string"}, "maxItems": 5},
+		"labels":   {"type": "object", "additionalProperties": object{"type": "string"}, "minItems": 1},
+		"address":  {"$ref": "#/components/schemas/TestAddress"},
+		"previous": {"oneOf": []object{{"$ref": "#/components/schemas/TestAddress"}, {"type": "null"}}},
+		"inline":   {"type": "object", "properties": object{"on": object{"type": "boolean"}}},
+		"dueAt":    {"oneOf": []object{{"type": "string", "format": "date-time"}, {"type": "null"}}},
+		"score":    {"type": "number"},
+		"id":       {"type": "integer", "minimum": 0},
+		"extra":    {},
+		"NoTag":    {"type": "string"},
+	}
+	for name, want := range tests {
+		if got := props[name]; !reflect.DeepEqual(got, want) {
+			t.Errorf("%s = %v, want %v", name, got, want)
+		}
+	}
+	if len(props) != len(tests) {
+		t.Errorf("%d properties, want %d (json:\"-\" and unexported fields are left out)", len(props), len(tests))
+	}
+	if got := s["required"]; !reflect.DeepEqual(got, []string{"name", "email"}) {
+		t.Errorf("required = %v", got)
+	}
+	if _, ok := b.components["TestAddress"]; !ok {
+		t.Error("TestAddress was not added to the components")
+	}
+}
+
+func TestSchemaSelfReference(t *testing.T) {
+	b := newSchemaBuilder()
+	b.ref(testNode{})
+	want := object{"type": "object", "properties": object{
+		"name": object{"type": "string"},
+		"children": object{"type": "array", "items": object{
+			"oneOf": []object{{"$ref": "#/components/schemas/TestNode"}, {"type": "null"}},
+		}},
+	}}
+	if got := b.components["TestNode"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("TestNode = %v\nwant %v", got, want)
+	}
+}
+
+func TestConvertPath(t *testing.T) {
+	tests := []struct {
+		in, want string
+		params   []object
+	}{
+		{"/healthz", "/healthz", nil},
+		{"/api/v1/workorders/:id/take", "/api/v1/workorders/{id}/take", []object{
+			{"name": "id", "in": "path", "required": true, "schema": object{"type": "integer", "minimum": 1}},
+		}},
+		{"/api/v1/users/:userId/keys/:name", "/api/v1/users/{userId}/keys/{name}", []object{
+			{"name": "userId", "in": "path", "required": true, "schema": object{"type": "integer", "minimum": 1}},
+			{"name": "name", "in": "path", "required": true, "schema": object{"type": "string"}},
+		}},
+		{"/uploads/*filepath", "/uploads/{filepath}", []object{
+			{"name": "filepath", "in": "path", "required": true, "schema": object{"type": "string"}},
+		}},
+	}
+	for _, tt := range tests {
+		path, params := convertPath(tt.in)
+		if path != tt.want || !reflect.DeepEqual(params, tt.params) {
+			t.Errorf("convertPath(%q) = %q, %v, want %q, %v", tt.in, path, params, tt.want, tt.params)
+		}
+	}
+}
+
+func TestOperationID(t *testing.T) {
+	tests := map[string]Operation{
+		"patchWorkordersIdTake":    {Method: http.MethodPatch, Path: "/api/v1/workorders/:id/take"},
+		"getWell-knownJwksJson":    {Method: http.MethodGet, Path: "/.well-known/jwks.json"},
+		"getScimV2Users":           {Method: http.MethodGet, Path: "/scim/v2/users"},
+		"deleteAdminApiKeysIdKeys": {Method: http.MethodDelete, Path: "/api/v1/admin/api_keys/:id/keys"},
+	}
+	for want, op := range tests {
+		if got := operationID(op); got != want {
+			t.Errorf("operationID(%s) = %q, want %q", op.Key(), got, want)
+		}
+	}
+
+	// Clients generate method names from these, so they must be unique
+	seen := map[string]string{}
+	for _, op := range Operations {
+		id := operationID(op)
+		if other, ok := seen[id]; ok {
+			t.Errorf("%s and %s share the operationId %q", other, op.Key(), id)
+		}
+		seen[id] = op.Key()
+	}
+}
+
+func TestOperationResponses(t *testing.T) {
+	b := newSchemaBuilder()
+	keys := func(res object) []string {
+		var out []string
+		for k := range res {
+			out = append(out, k)
+		}
+		sort.Strings(out)
+		return out
+	}
+
+	tests := []struct {
+		name string
+		op   Operation
+		want []string
+	}{
+		{"public without input", Operation{Method: http.MethodGet, Path: "/healthz", Auth: AuthNone}, []string{"200", "500"}},
+		{"user with query", Operation{Method: http.MethodGet, Path: "/api/v1/workorders", Query: pageParams},
+			[]string{"200", "400", "401", "403", "500"}},
+		{"admin create", Operation{Method: http.MethodPost, Path: "/api/v1/admin/units", Auth: AuthAdmin, Body: models.UnitRequest{}, Status: http.StatusCreated, Conflict: true},
+			[]string{"201", "400", "401", "403", "409", "500"}},
+		{"edit with If-Match", Operation{Method: http.MethodPut, Path: "/api/v1/workorders/:id", Body: models.UnitRequest{}, IfMatch: true},
+			[]string{"200", "400", "401", "403", "404", "409", "412", "500"}},
+		{"delete", Operation{Method: http.MethodDelete, Path: "/api/v1/users/:id", Auth: AuthAdmin, Status: http.StatusNoContent, Raw: true}, []string{"204"}},
+		{"metrics", Operation{Method: http.MethodGet, Path: "/metrics", Auth: AuthMetrics, Raw: true, ContentType: "text/plain"}, []string{"200", "401"}},
+		{"readyz", Operation{Method: http.MethodGet, Path: "/readyz", Auth: AuthNone, Raw: true, Response: readyResponse{}}, []string{"200", "503"}},
+		{"SCIM", Operation{Method: http.MethodGet, Path: "/scim/v2/Users", Auth: AuthSCIM, Raw: true, Response: scimUserList{}}, []string{"200", "default"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, params := convertPath(tt.op.Path)
+			res := b.responses(tt.op, len(params) > 0)
+			if got := keys(res); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("responses = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOperationSecurity(t *testing.T) {
+	b := newSchemaBuilder()
+	bearer := []object{{"bearerAuth": []string{}}}
+	tests := []struct {
+		name string
+		op   Operation
+		want interface{}
+	}{
+		{"public", Operation{Method: http.MethodGet, Path: "/healthz", Auth: AuthNone}, nil},
+		{"user", Operation{Method: http.MethodGet, Path: "/api/v1/me"}, bearer},
+		{"admin", Operation{Method: http.MethodGet, Path: "/api/v1/admin/users", Auth: AuthAdmin}, bearer},
+		{"API key scope", Operation{Method: http.MethodGet, Path: "/api/v1/workorders", Scope: "workorders:read"},
+			[]object{{"bearerAuth": []string{}}, {"apiKey": []string{}}}},
+		// {} means the token is optional: it is only checked when METRICS_TOKEN is set
+		{"metrics", Operation{Method: http.MethodGet, Path: "/metrics", Auth: AuthMetrics, Raw: true}, []object{{"metricsToken": []string{}}, {}}},
+		{"SCIM", Operation{Method: http.MethodGet, Path: "/scim/v2/Users", Auth: AuthSCIM, Raw: true}, []object{{"scimToken": []string{}}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, params := convertPath(tt.op.Path)
+			o := b.operation(tt.op, params)
+			if got := o["security"]; !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("security = %v, want %v", got, tt.want)
+			}
+			if tt.op.Scope != "" && !strings.Contains(o["description"].(string), tt.op.Scope) {
+				t.Errorf("description %q does not name the scope", o["description"])
+			}
+		})
+	}
+}
+
+func TestOperationParameters(t *testing.T) {
+	b := newSchemaBuilder()
+	op := Operation{
+		Method: http.MethodPatch, Path: "/api/v1/workorders/:id", IfMatch: true, Body: models.UnitRequest{},
+		Query: []Param{
+			{Name: "status", Type: "string", Enum: []string{"Pending", "Completed"}, List: true},
+			{Name: "page", Type: "integer"},
+		},
+	}
+	_, params := convertPath(op.Path)
+	o := b.operation(op, params)
+
+	got := o["parameters"].([]object)
+	if len(got) != 4 {
+		t.Fatalf("%d parameters, want 4: %v", len(got), got)
+	}
+	if got[0]["name"] != "id" || got[0]["in"] != "path" {
+		t.Errorf("first parameter = %v, want the path id", got[0])
+	}
+	wantList := object{"type": "array", "items": object{"type": "string", "enum": []string{"Pending", "Completed"}}}
+	if !reflect.DeepEqual(got[1]["schema"], wantList) || got[1]["style"] != "form" || got[1]["explode"] != false {
+		t.Errorf("list parameter = %v", got[1])
+	}
+	if !reflect.DeepEqual(got[2]["schema"], object{"type": "integer"}) {
+		t.Errorf("page parameter = %v", got[2])
+	}
+	if got[3]["name"] != "If-Match" || got[3]["in"] != "header" {
+		t.Errorf("last parameter = %v, want the If-Match header", got[3])
+	}
+
+	body := o["requestBody"].(object)["content"].(object)
+	if _, ok := body["application/json"]; !ok {
+		t.Errorf("request body content = %v", body)
+	}
+
+	// SCIM bodies use the SCIM media type, uploads are multipart
+	scimOp := b.operation(Operation{Method: http.MethodPost, Path: "/scim/v2/Users", Auth: AuthSCIM, Body: scimUser{}, Raw: true}, nil)
+	if _, ok := scimOp["requestBody"].(object)["content"].(object)[scim.ContentType]; !ok {
+		t.Errorf("SCIM request body = %v", scimOp["requestBody"])
+	}
+	upload := b.operation(Operation{Method: http.MethodPost, Path: "/api/v1/upload", Upload: true}, nil)
+	if _, ok := upload["requestBody"].(object)["content"].(object)["multipart/form-data"]; !ok {
+		t.Errorf("upload request body = %v", upload["requestBody"])
+	}
+}
+
+func TestSuccessSchema(t *testing.T) {
+	b := newSchemaBuilder()
+
+	got := b.successSchema(Operation{Response: []models.Unit{}, Paginated: true})
+	want := object{
+		"type":     "object",
+		"required": []string{"success", "data", "meta"},
+		"properties": object{
+			"success": object{"const": true},
+			"data":    object{"type": "array", "items": object{"$ref": "#/components/schemas/Unit"}},
+			"meta":    object{"$ref": "#/components/schemas/PaginationMeta"},
+		},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("paginated = %v\nwant %v", got, want)
+	}
+
+	if got := b.successSchema(Operation{Response: healthResponse{}, Raw: true}); !reflect.DeepEqual(got, object{"$ref": "#/components/schemas/HealthResponse"}) {
+		t.Errorf("raw = %v", got)
+	}
+}
+
+// TestBuildReferences checks that every $ref in the document points at something that exists
+func TestBuildReferences(t *testing.T) {
+	doc := build(t)
+	if doc["openapi"] != "3.1.0" {
+		t.Errorf("openapi = %v", doc["openapi"])
+	}
+	if got := lookup(t, doc, "servers").([]interface{}); len(got) != 1 || lookup(t, got[0], "url") != "https://siro.example.com" {
+		t.Errorf("servers = %v", got)
+	}
+
+	var refs []string
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			if ref, ok := v["$ref"].(string); ok {
+				refs = append(refs, ref)
+			}
+			for _, child := range v {
+				walk(child)
+			}
+		case []interface{}:
+			for _, child := range v {
+				walk(child)
+			}
+		}
+	}
+	walk(doc)
+	if len(refs) == 0 {
+		t.Fatal("no references found")
+	}
+	for _, ref := range refs {
+		path, ok := strings.CutPrefix(ref, "#/")
+		if !ok {
+			t.Errorf("reference %q is not local", ref)
+			continue
+		}
+		lookup(t, doc, strings.Split(path, "/")...)
+	}
+}
+
+func TestBuildOperations(t *testing.T) {
+	doc := build(t)
+	paths := lookup(t, doc, "paths").(map[string]interface{})
+
+	count := 0
+	for _, item := range paths {
+		count += len(item.(map[string]interface{}))
+	}
+	if count != len(Operations) {
+		t.Errorf("%d operations in the document, want %d", count, len(Operations))
+	}
+
+	for _, op := range Operations {
+		path, _ := convertPath(op.Path)
+		o := lookup(t, paths, path, strings.ToLower(op.Method)).(map[string]interface{})
+		if o["summary"] != op.Summary || o["operationId"] != operationID(op) {
+			t.Errorf("%s: summary %v, operationId %v", op.Key(), o["summary"], o["operationId"])
+		}
+		if strings.Contains(path, ":") {
+			t.Errorf("%s: path %q still has gin syntax", op.Key(), path)
+		}
+	}
+
+	// A model used by the API is described from its struct and binding tags
+	login := lookup(t, doc, "components", "schemas", "LoginRequest").(map[string]interface{})
+	if got := lookup(t, login, "properties", "email", "format"); got != "email" {
+		t.Errorf("LoginRequest.email format = %v", got)
+	}
+	if got := lookup(t, login, "properties", "password", "maxLength"); got != float64(72) {
+		t.Errorf("LoginRequest.password maxLength = %v", got)
+	}
+}
+
+func TestHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.GET("/openapi.json", Handler("https://siro.example.com"))
+	r.GET("/docs", SwaggerUI)
+
+	var first []byte
+	for i := 0; i < 2; i++ {
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+		if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/json; charset=utf-8" {
+			t.Fatalf("status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+		}
+		if i == 0 {
+			first = w.Body.Bytes()
+		} else if string(first) != w.Body.String() {
+			t.Error("the document changed between requests")
+		}
+	}
+	var doc map[string]interface{}
+	if err := json.Unmarshal(first, &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/docs", nil))
+	if w.Code != http.StatusOK || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/html") ||
+		!strings.Contains(w.Body.String(), `url: "/openapi.json"`) {
+		t.Errorf("GET /docs: status %d, content type %q", w.Code, w.Header().Get("Content-Type"))
+	}
+}
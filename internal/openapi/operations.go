@@ -0,0 +1,221 @@
+package openapi
+
+import (
+	"net/http"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/buildinfo"
+	"siro-backend/pkg/jwtkeys"
+	"siro-backend/pkg/scim"
+	"siro-backend/pkg/validation"
+)
+
+// Response bodies that don't have their own model struct
+type (
+	loginResponse struct {
+		AccessToken          string      `json:"accessToken"`
+		AccessTokenExpiresAt int64       `json:"accessTokenExpiresAt"`
+		RefreshToken         string      `json:"refreshToken"`
+		User                 models.User `json:"user"`
+	}
+	refreshResponse struct {
+		AccessToken          string `json:"accessToken"`
+		AccessTokenExpiresAt int64  `json:"accessTokenExpiresAt"`
+	}
+	messageResponse struct {
+		Message string `json:"message"`
+	}
+	uploadResponse struct {
+		URL string `json:"url"`
+	}
+	evidenceUploadResponse struct {
+		Message string `json:"message"`
+		URL     string `json:"url"`
+	}
+	healthResponse struct {
+		StatusCode int    `json:"statusCode"`
+		Status     string `json:"status"`
+	}
+	readyResponse struct {
+		StatusCode int               `json:"statusCode"`
+		Status     string            `json:"status"`
+		Checks     map[string]string `json:"checks"`
+	}
+)
+
+// SCIM resources, renamed so they don't clash with the API's own schemas (e.g. User)
+type (
+	scimUser  scim.User
+	scimGroup scim.Group
+	scimPatch scim.PatchRequest
+	scimError scim.Error
+
+	scimUserList struct {
+		Schemas      []string   `json:"schemas"`
+		TotalResults int        `json:"totalResults"`
+		StartIndex   int        `json:"startIndex"`
+		ItemsPerPage int        `json:"itemsPerPage"`
+		Resources    []scimUser `json:"Resources"`
+	}
+	scimGroupList struct {
+		Schemas      []string    `json:"schemas"`
+		TotalResults int         `json:"totalResults"`
+		StartIndex   int         `json:"startIndex"`
+		ItemsPerPage int         `json:"itemsPerPage"`
+		Resources    []scimGroup `json:"Resources"`
+	}
+)
+
+// Query parameters of the SCIM list endpoints
+var scimParams = []Param{
+	{Name: "filter", Description: `SCIM filter, e.g. userName eq "a@example.com"`, Type: "string"},
+	{Name: "startIndex", Description: "1-based index of the first result (default 1)", Type: "integer"},
+	{Name: "count", Description: "Results per page (default 100, max 1000)", Type: "integer"},
+}
+
+// Query parameters shared by list endpoints
+var pageParams = []Param{
+	{Name: "page", Description: "Page number (default 1)", Type: "integer"},
+	{Name: "limit", Description: "Items per page (default 10, max 100)", Type: "integer"},
+	{Name: "cursor", Description: "Cursor mode: empty for the first page, then meta.next_cursor / meta.prev_cursor (page is ignored)", Type: "string"},
+	{Name: "include_total", Description: "In cursor mode, also return meta.total_items", Type: "string", Enum: []string{"true", "false"}},
+}
+
+// Filters shared by the user list and export
+var userParams = []Param{
+	{Name: "role", Description: "Role", Type: "string", Enum: validation.Roles, List: true},
+	{Name: "unit", Description: "Unit", Type: "string", List: true},
+	{Name: "status", Description: "Active or deactivated users (default both)", Type: "string", Enum: []string{"active", "deactivated"}},
+}
+
+// sortValues lists every field both ascending and descending ("-field")
+func sortValues(fields []string) []string {
+	values := make([]string, 0, len(fields)*2)
+	for _, f := range fields {
+		values = append(values, f, "-"+f)
+	}
+	return values
+}
+
+// api prefixes a path with the current API version
+func api(path string) string {
+	return global.APIPrefix + path
+}
+
+// Operations is the documented route table
+// Every route registered in routers.SetupRoutes must appear here (checked by routers tests)
+var Operations = []Operation{
+	// Probes and tooling
+	{Method: http.MethodGet, Path: "/healthz", Tag: "Health", Summary: "Process is alive", Auth: AuthNone, Raw: true, Response: healthResponse{}},
+	{Method: http.MethodGet, Path: "/readyz", Tag: "Health", Summary: "Database reachable, uploads writable, migrations applied (503 otherwise)", Auth: AuthNone, Raw: true, Response: readyResponse{}},
+	{Method: http.MethodGet, Path: "/version", Tag: "Health", Summary: "Build information", Auth: AuthNone, Response: buildinfo.Info{}},
+	{Method: http.MethodGet, Path: "/.well-known/jwks.json", Tag: "Auth", Summary: "Public keys that verify access and refresh tokens (JWKS; empty with HS256)", Auth: AuthNone, Raw: true, Response: jwtkeys.JWKS{}},
+	{Method: http.MethodGet, Path: "/metrics", Tag: "Health", Summary: "Prometheus metrics (text format)", Auth: AuthMetrics, Raw: true, ContentType: "text/plain"},
+	{Method: http.MethodGet, Path: "/openapi.json", Tag: "Health", Summary: "This OpenAPI document", Auth: AuthNone, Raw: true},
+	{Method: http.MethodGet, Path: "/docs", Tag: "Health", Summary: "Swagger UI", Auth: AuthNone, Raw: true, ContentType: "text/html"},
+	{Method: http.MethodGet, Path: "/" + global.DirUploads + "/*filepath", Tag: "Files", Summary: "Download an uploaded file", Auth: AuthNone, Raw: true, ContentType: "application/octet-stream"},
+
+	// Authentication
+	{Method: http.MethodPost, Path: api("/login"), Tag: "Auth", Summary: "Login with email and password", Auth: AuthNone, Body: models.LoginRequest{}, Response: loginResponse{}},
+	{Method: http.MethodPost, Path: api("/refresh"), Tag: "Auth", Summary: "Get a new access token with the refresh token", Auth: AuthNone, Body: models.RefreshRequest{}, Response: refreshResponse{}},
+	{Method: http.MethodPost, Path: api("/password/change"), Tag: "Auth", Summary: "Choose a new password (required when login answers PASSWORD_CHANGE_REQUIRED) and log in", Auth: AuthNone, Body: models.ChangePasswordRequest{}, Response: loginResponse{}},
+	{Method: http.MethodPost, Path: api("/invitations/check"), Tag: "Auth", Summary: "Who an invitation is for (404 used/invalid, 410 expired)", Auth: AuthNone, Body: models.InvitationTokenRequest{}, Response: models.InvitationInfo{}},
+	{Method: http.MethodPost, Path: api("/invitations/accept"), Tag: "Auth", Summary: "Set the password of an invited user", Auth: AuthNone, Body: models.AcceptInvitationRequest{}, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/oidc/authorize"), Tag: "Auth", Summary: "Start a single sign-on login: send the browser to url, keep state (404 SSO_DISABLED if not configured)", Auth: AuthNone, Response: models.OIDCAuthorization{}},
+	{Method: http.MethodPost, Path: api("/oidc/callback"), Tag: "Auth", Summary: "Finish a single sign-on login with the code and state from the provider and log in", Auth: AuthNone, Body: models.OIDCCallbackRequest{}, Response: loginResponse{}},
+	{Method: http.MethodPost, Path: api("/logout"), Tag: "Auth", Summary: "Logout and revoke the current session", Response: messageResponse{}},
+
+	// Current user
+	{Method: http.MethodGet, Path: api("/me"), Tag: "Users", Summary: "Current user (with ETag)", Response: models.User{}},
+	{Method: http.MethodPut, Path: api("/me"), Tag: "Users", Summary: "Update the current user", Body: models.UserRequest{}, IfMatch: true, Response: models.User{}},
+	{Method: http.MethodPost, Path: api("/upload"), Tag: "Users", Summary: "Upload an avatar image", Upload: true, Response: uploadResponse{}},
+	{Method: http.MethodGet, Path: api("/staff"), Tag: "Users", Summary: "Staff of the current user's unit", Response: []models.User{}},
+	{Method: http.MethodPatch, Path: api("/staff/:id/availability"), Tag: "Users", Summary: "Update availability of a staff member", Body: models.AvailabilityRequest{}, Response: messageResponse{}},
+	{Method: http.MethodGet, Path: api("/units"), Tag: "Units", Summary: "All units", Scope: global.ScopeUnitsRead, Response: []models.Unit{}},
+	{Method: http.MethodGet, Path: api("/activities"), Tag: "Activities", Summary: "Activity log of the current unit", Query: pageParams, Paginated: true, Response: []models.ActivityLog{}},
+
+	// Work orders
+	{Method: http.MethodGet, Path: api("/workorders/stats"), Tag: "Work Orders", Summary: "Dashboard counters", Scope: global.ScopeWorkOrdersRead, Response: models.DashboardStats{}},
+	{Method: http.MethodGet, Path: api("/workorders/tags"), Tag: "Work Orders", Summary: "All tags in use", Scope: global.ScopeWorkOrdersRead, Response: []string{}},
+	{Method: http.MethodGet, Path: api("/workorders"), Tag: "Work Orders", Summary: "List work orders", Scope: global.ScopeWorkOrdersRead, Paginated: true, Response: []models.WorkOrder{},
+		Query: append([]Param{
+			{Name: "status", Description: "Status, or \"active\" for everything not completed", Type: "string", Enum: validation.StatusFilters, List: true},
+			{Name: "priority", Description: "Priority", Type: "string", Enum: validation.Priorities, List: true},
+			{Name: "unit", Description: "Target unit", Type: "string", List: true},
+			{Name: "requester_unit", Description: "Unit of the requester", Type: "string", List: true},
+			{Name: "tags", Description: "Has any of these tags", Type: "string", List: true},
+			{Name: "assignee", Description: "\"me\", \"unassigned\" or a user ID", Type: "string"},
+			{Name: "requester", Description: "\"me\" or a user ID", Type: "string"},
+			{Name: "created_from", Description: "Created on or after this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "created_to", Description: "Created on or before this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "completed_from", Description: "Completed on or after this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "completed_to", Description: "Completed on or before this day (YYYY-MM-DD)", Type: "string"},
+			{Name: "date", Description: "Only work orders created today", Type: "string", Enum: []string{"today"}},
+			{Name: "sla_breached", Description: "Completed after its due time, or still open past it", Type: "boolean"},
+			{Name: "q", Description: "Full-text search in title, description and completion note (results ranked by relevance, matches in highlights)", Type: "string"},
+			{Name: "sort", Description: "Sort fields, - for descending (priority = High first, due = SLA deadline). Default: relevance when searching, else -created_at", Type: "string", Enum: sortValues(validation.WorkOrderSorts), List: true},
+		}, pageParams...)},
+	{Method: http.MethodGet, Path: api("/workorders/:id"), Tag: "Work Orders", Summary: "Work order with full user data and timeline", Scope: global.ScopeWorkOrdersRead, Response: models.WorkOrder{}},
+	{Method: http.MethodGet, Path: api("/workorders/:id/events"), Tag: "Work Orders", Summary: "Change history and time spent in each status", Scope: global.ScopeWorkOrdersRead, Response: models.WorkOrderHistory{}},
+	{Method: http.MethodPost, Path: api("/workorders"), Tag: "Work Orders", Summary: "Create a work order for another unit", Scope: global.ScopeWorkOrdersCreate, Status: http.StatusCreated, Body: models.WorkOrderRequest{}, Response: models.WorkOrder{}},
+	{Method: http.MethodPatch, Path: api("/workorders/:id/take"), Tag: "Work Orders", Summary: "Take an unassigned work order", IfMatch: true, Response: messageResponse{}},
+	{Method: http.MethodPatch, Path: api("/workorders/:id/assign"), Tag: "Work Orders", Summary: "Assign a staff member of the same unit", Body: models.AssignRequest{}, IfMatch: true, Response: messageResponse{}},
+	{Method: http.MethodPatch, Path: api("/workorders/:id/finalize"), Tag: "Work Orders", Summary: "Complete a work order", Body: models.FinalizeRequest{}, IfMatch: true, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/upload/workorder"), Tag: "Work Orders", Summary: "Upload a photo for a work order", Scope: global.ScopeWorkOrdersCreate, Upload: true, Response: evidenceUploadResponse{}},
+
+	// Admin
+	{Method: http.MethodGet, Path: api("/admin/users"), Tag: "Admin", Summary: "List all users", Auth: AuthAdmin, Query: userParams, Response: []models.User{}},
+	{Method: http.MethodPost, Path: api("/admin/users/import"), Tag: "Admin", Summary: "Create users from a CSV or XLSX file (all or nothing)", Auth: AuthAdmin, Status: http.StatusCreated, Upload: true, Response: models.UserImportResult{},
+		Query: []Param{
+			{Name: "dry_run", Description: "Only validate the file (200 with the problems found)", Type: "string", Enum: []string{"true", "false"}},
+			{Name: "invite", Description: "Send invitations to the users without a password", Type: "string", Enum: []string{"true", "false"}},
+		}},
+	{Method: http.MethodGet, Path: api("/admin/users/export"), Tag: "Admin", Summary: "Download users as CSV or XLSX", Auth: AuthAdmin, Raw: true, ContentType: "text/csv",
+		Query: append([]Param{{Name: "format", Description: "File format (default csv)", Type: "string", Enum: []string{"csv", "xlsx"}}}, userParams...)},
+	{Method: http.MethodGet, Path: api("/admin/users/:id"), Tag: "Admin", Summary: "Get a user (with ETag)", Auth: AuthAdmin, Response: models.User{}},
+	{Method: http.MethodPost, Path: api("/admin/users"), Tag: "Admin", Summary: "Create a user", Auth: AuthAdmin, Status: http.StatusCreated, Body: models.UserRequest{}, Response: models.User{}},
+	{Method: http.MethodPut, Path: api("/admin/users/:id"), Tag: "Admin", Summary: "Update a user", Auth: AuthAdmin, Body: models.UserRequest{}, IfMatch: true, Response: models.User{}},
+	{Method: http.MethodDelete, Path: api("/admin/users/:id"), Tag: "Admin", Summary: "Deactivate a user (can't log in, history is kept)", Auth: AuthAdmin, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/admin/users/:id/reactivate"), Tag: "Admin", Summary: "Reactivate a deactivated user", Auth: AuthAdmin, Conflict: true, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/admin/users/:id/anonymize"), Tag: "Admin", Summary: "Erase a user's personal data (irreversible)", Auth: AuthAdmin, Conflict: true, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/admin/users/:id/invite"), Tag: "Admin", Summary: "Send a new invitation to a user without a password (older links stop working)", Auth: AuthAdmin, Conflict: true, Response: models.Invitation{}},
+	{Method: http.MethodGet, Path: api("/admin/events"), Tag: "Admin", Summary: "Work order changes, e.g. per actor", Auth: AuthAdmin, Paginated: true, Response: []models.WorkOrderEvent{},
+		Query: append([]Param{
+			{Name: "work_order", Description: "Work order ID", Type: "integer"},
+			{Name: "actor", Description: "User ID of who made the change", Type: "integer"},
+			{Name: "type", Description: "Event types", Type: "string", Enum: []string{"created", "taken", "assigned", "completed"}, List: true},
+		}, pageParams...)},
+	{Method: http.MethodGet, Path: api("/admin/audit"), Tag: "Admin", Summary: "Audit log of administrative actions", Auth: AuthAdmin, Paginated: true, Response: []audit.LogEntry{},
+		Query: append([]Param{
+			{Name: "actor", Description: "User ID of the admin", Type: "integer"},
+			{Name: "action", Description: "Actions, e.g. user.update,user.password_reset", Type: "string", List: true},
+			{Name: "target_type", Description: "e.g. user or unit", Type: "string"},
+			{Name: "target_id", Description: "ID of the target", Type: "string"},
+			{Name: "from", Description: "From day (YYYY-MM-DD, inclusive)", Type: "string"},
+			{Name: "to", Description: "To day (YYYY-MM-DD, inclusive)", Type: "string"},
+		}, pageParams...)},
+	{Method: http.MethodGet, Path: api("/admin/service-accounts"), Tag: "Admin", Summary: "Service accounts with their API keys (prefix only)", Auth: AuthAdmin, Response: []models.ServiceAccount{}},
+	{Method: http.MethodPost, Path: api("/admin/service-accounts"), Tag: "Admin", Summary: "Create a service account for an integration", Auth: AuthAdmin, Status: http.StatusCreated, Body: models.ServiceAccountRequest{}, Response: models.ServiceAccount{}},
+	{Method: http.MethodDelete, Path: api("/admin/service-accounts/:id"), Tag: "Admin", Summary: "Deactivate a service account and revoke its API keys", Auth: AuthAdmin, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/admin/service-accounts/:id/keys"), Tag: "Admin", Summary: "Create an API key (the key is only in this response)", Auth: AuthAdmin, Status: http.StatusCreated, Conflict: true, Body: models.APIKeyRequest{}, Response: models.APIKey{}},
+	{Method: http.MethodDelete, Path: api("/admin/service-accounts/:id/keys/:keyId"), Tag: "Admin", Summary: "Revoke an API key", Auth: AuthAdmin, Response: messageResponse{}},
+	{Method: http.MethodPost, Path: api("/admin/units"), Tag: "Admin", Summary: "Create a unit", Auth: AuthAdmin, Status: http.StatusCreated, Conflict: true, Body: models.UnitRequest{}, Response: models.Unit{}},
+
+	// SCIM 2.0 provisioning (only if SCIM_ENABLED)
+	{Method: http.MethodGet, Path: "/scim/v2/ServiceProviderConfig", Tag: "SCIM", Summary: "Supported SCIM features", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType},
+	{Method: http.MethodGet, Path: "/scim/v2/ResourceTypes", Tag: "SCIM", Summary: "User and Group resource types", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType},
+	{Method: http.MethodGet, Path: "/scim/v2/Users", Tag: "SCIM", Summary: "List users", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Query: scimParams, Response: scimUserList{}},
+	{Method: http.MethodPost, Path: "/scim/v2/Users", Tag: "SCIM", Summary: "Create a user (invited if no password is given)", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Status: http.StatusCreated, Body: scimUser{}, Response: scimUser{}},
+	{Method: http.MethodGet, Path: "/scim/v2/Users/:id", Tag: "SCIM", Summary: "Get a user", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Response: scimUser{}},
+	{Method: http.MethodPut, Path: "/scim/v2/Users/:id", Tag: "SCIM", Summary: "Replace a user", Auth: AuthSCIM, Raw: true, IfMatch: true, ContentType: scim.ContentType, Body: scimUser{}, Response: scimUser{}},
+	{Method: http.MethodPatch, Path: "/scim/v2/Users/:id", Tag: "SCIM", Summary: "Change some attributes of a user", Auth: AuthSCIM, Raw: true, IfMatch: true, ContentType: scim.ContentType, Body: scimPatch{}, Response: scimUser{}},
+	{Method: http.MethodDelete, Path: "/scim/v2/Users/:id", Tag: "SCIM", Summary: "Deactivate a user", Auth: AuthSCIM, Raw: true, IfMatch: true, Status: http.StatusNoContent},
+	{Method: http.MethodGet, Path: "/scim/v2/Groups", Tag: "SCIM", Summary: "List units and roles", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType,
+		Query: append([]Param{{Name: "excludedAttributes", Description: "members to leave out the member lists", Type: "string"}}, scimParams...), Response: scimGroupList{}},
+	{Method: http.MethodPost, Path: "/scim/v2/Groups", Tag: "SCIM", Summary: "Create a unit", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Status: http.StatusCreated, Body: scimGroup{}, Response: scimGroup{}},
+	{Method: http.MethodGet, Path: "/scim/v2/Groups/:id", Tag: "SCIM", Summary: "Get a unit or role with its members", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Response: scimGroup{}},
+	{Method: http.MethodPut, Path: "/scim/v2/Groups/:id", Tag: "SCIM", Summary: "Set the members of a unit or role", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Body: scimGroup{}, Response: scimGroup{}},
+	{Method: http.MethodPatch, Path: "/scim/v2/Groups/:id", Tag: "SCIM", Summary: "Add or remove members of a unit or role", Auth: AuthSCIM, Raw: true, ContentType: scim.ContentType, Body: scimPatch{}, Response: scimGroup{}},
+	{Method: http.MethodDelete, Path: "/scim/v2/Groups/:id", Tag: "SCIM", Summary: "Always refused (units and roles can't be deleted)", Auth: AuthSCIM, Raw: true, Status: http.StatusNoContent},
+}
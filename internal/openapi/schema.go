@@ -0,0 +1,134 @@
+package openapi
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// object is a JSON object in the generated document
+type object = map[string]interface{}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// schemaBuilder turns Go structs into JSON Schemas (OpenAPI 3.1 uses JSON Schema 2020-12)
+// Every named struct becomes a component under #/components/schemas and is referenced by name
+type schemaBuilder struct {
+	components object
+}
+
+func newSchemaBuilder() *schemaBuilder {
+	return &schemaBuilder{components: object{}}
+}
+
+// ref returns the schema for a value, e.g. ref(models.User{}) -> {"$ref": "#/components/schemas/User"}
+func (b *schemaBuilder) ref(v interface{}) object {
+	return b.schema(reflect.TypeOf(v))
+}
+
+func (b *schemaBuilder) schema(t reflect.Type) object {
+	switch t.Kind() {
+	case reflect.Ptr:
+		// *uint, *time.Time ... are null when not set
+		return object{"oneOf": []object{b.schema(t.Elem()), {"type": "null"}}}
+	case reflect.Bool:
+		return object{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return object{"type": "integer"}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return object{"type": "integer", "minimum": 0}
+	case reflect.Float32, reflect.Float64:
+		return object{"type": "number"}
+	case reflect.String:
+		return object{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return object{"type": "array", "items": b.schema(t.Elem())}
+	case reflect.Map:
+		return object{"type": "object", "additionalProperties": b.schema(t.Elem())}
+	case reflect.Interface:
+		return object{}
+	case reflect.Struct:
+		if t == timeType {
+			return object{"type": "string", "format": "date-time"}
+		}
+		if t.Name() == "" {
+			return b.structSchema(t)
+		}
+		name := schemaName(t)
+		if _, done := b.components[name]; !done {
+			b.components[name] = object{} // placeholder, so self references don't loop
+			b.components[name] = b.structSchema(t)
+		}
+		return object{"$ref": "#/components/schemas/" + name}
+	}
+	return object{}
+}
+
+// schemaName is the component name of a struct, e.g. loginResponse -> LoginResponse
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+// structSchema lists the JSON fields of a struct
+// Rules from the `binding` tag (required, email, oneof, min, max) are copied into the schema
+func (b *schemaBuilder) structSchema(t reflect.Type) object {
+	props := object{}
+	var required []string
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		s := b.schema(f.Type)
+		for _, rule := range strings.Split(f.Tag.Get("binding"), ",") {
+			key, param, _ := strings.Cut(rule, "=")
+			if key == "dive" {
+				break // the remaining rules are for the slice items
+			}
+			switch key {
+			case "required":
+				required = append(required, name)
+			case "email":
+				s["format"] = "email"
+			case "oneof":
+				s["enum"] = strings.Fields(param)
+			case "min", "max":
+				if n, err := strconv.Atoi(param); err == nil {
+					s[lengthKeyword(f.Type, key)] = n
+				}
+			}
+		}
+		props[name] = s
+	}
+
+	s := object{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+// lengthKeyword maps the validator min/max rules to the JSON Schema keyword for the field type
+func lengthKeyword(t reflect.Type, rule string) string {
+	switch t.Kind() {
+	case reflect.String:
+		return rule + "Length"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return rule + "Items"
+	}
+	if rule == "min" {
+		return "minimum"
+	}
+	return "maximum"
+}
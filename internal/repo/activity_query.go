@@ -1,57 +1,71 @@
 package repo
 
 import (
-	"fmt"
-	"math"
+	"context"
+	"log/slog"
 	"siro-backend/internal/models"
 	"siro-backend/pkg/setting"
+	"siro-backend/pkg/worker"
 	"time"
 )
 
-func CreateActivityLog(log models.ActivityLog) error {
+func CreateActivityLog(ctx context.Context, log models.ActivityLog) error {
+	ctx, span := startQuery(ctx, "activity_logs.create")
 	query := `INSERT INTO activity_logs (user_id, user_name, action, request_id, details, status, timestamp)
               VALUES (?, ?, ?, ?, ?, ?, NOW())`
 
-	_, err := setting.DB.Exec(query, log.UserID, log.UserName, log.Action, log.RequestID, log.Details, log.Status)
+	res, err := setting.DB.ExecContext(ctx, query, log.UserID, log.UserName, log.Action, log.RequestID, log.Details, log.Status)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
 
 // GetActivities returns paginated activity logs filtered by user's unit
 // Only shows activities where the user's unit is involved (as requester unit OR target unit)
-func GetActivities(userUnit string, page, limit int) ([]models.ActivityLog, models.PaginationMeta, error) {
-	// Base query with JOIN to work_orders to filter by unit
-	// Show activities where:
-	// 1. The work order's target unit matches user's unit, OR
-	// 2. The requester's unit matches user's unit
-	baseQuery := `
-		SELECT DISTINCT a.id, a.user_id, a.user_name, a.action, a.request_id, a.details, a.status, a.timestamp
+// Newest first; cursor mode pages by (timestamp, id)
+func GetActivities(ctx context.Context, userUnit string, page Page) ([]models.ActivityLog, models.PaginationMeta, error) {
+	// Every log belongs to one work order and every work order to one requester,
+	// so the joins don't repeat rows and no DISTINCT is needed
+	const from = `
 		FROM activity_logs a
 		INNER JOIN work_orders w ON a.request_id = w.id
-		LEFT JOIN users req ON w.requester_id = req.id
-		WHERE w.unit = ? OR req.unit = ?
-	`
+		LEFT JOIN users req ON w.requester_id = req.id`
 
-	// Count total matching activities
-	countQuery := `
-		SELECT COUNT(DISTINCT a.id)
-		FROM activity_logs a
-		INNER JOIN work_orders w ON a.request_id = w.id
-		LEFT JOIN users req ON w.requester_id = req.id
-		WHERE w.unit = ? OR req.unit = ?
-	`
+	var where conditions
+	where.add("(w.unit = ? OR req.unit = ?)", userUnit, userUnit)
 
 	var totalItems int
-	err := setting.DB.QueryRow(countQuery, userUnit, userUnit).Scan(&totalItems)
-	if err != nil {
-		return nil, models.PaginationMeta{}, err
+	if !page.CursorMode || page.IncludeTotal {
+		countCtx, countSpan := startQuery(ctx, "activity_logs.count")
+		err := setting.DB.QueryRowContext(countCtx, "SELECT COUNT(*)"+from+where.sql(), where.args...).Scan(&totalItems)
+		endQuery(countSpan, oneRow(err), err)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
 	}
 
-	// Get paginated data
-	offset := (page - 1) * limit
-	query := baseQuery + " ORDER BY a.timestamp DESC LIMIT ? OFFSET ?"
+	query := "SELECT a.id, a.user_id, a.user_name, a.action, a.request_id, a.details, a.status, a.timestamp" + from
+	var (
+		args []interface{}
+		ks   keyset
+	)
+	if page.CursorMode {
+		var err error
+		ks, err = newKeyset(page, "-timestamp", "a.timestamp", "a.id", true)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+		ks.addCondition(&where)
+		query += where.sql() + ks.orderBy() + " LIMIT ?"
+		args = append(where.args, page.Limit+1)
+	} else {
+		query += where.sql() + " ORDER BY a.timestamp DESC, a.id DESC LIMIT ? OFFSET ?"
+		args = append(where.args, page.Limit, page.offset())
+	}
 
-	rows, err := setting.DB.Query(query, userUnit, userUnit, limit, offset)
+	selectCtx, selectSpan := startQuery(ctx, "activity_logs.list")
+	rows, err := setting.DB.QueryContext(selectCtx, query, args...)
 	if err != nil {
+		endQuery(selectSpan, 0, err)
 		return nil, models.PaginationMeta{}, err
 	}
 	defer rows.Close()
@@ -63,22 +77,25 @@ func GetActivities(userUnit string, page, limit int) ([]models.ActivityLog, mode
 			logs = append(logs, l)
 		}
 	}
+	endQuery(selectSpan, int64(len(logs)), rows.Err())
 
-	// Calculate pagination metadata
-	totalPages := int(math.Ceil(float64(totalItems) / float64(limit)))
-	meta := models.PaginationMeta{
-		CurrentPage: page,
-		TotalPages:  totalPages,
-		TotalItems:  totalItems,
-		Limit:       limit,
+	if !page.CursorMode {
+		return logs, page.offsetMeta(totalItems), nil
+	}
+	logs, meta := keysetPage(logs, ks, page.Limit, func(l models.ActivityLog) (time.Time, uint) {
+		return l.Timestamp, l.ID
+	})
+	if page.IncludeTotal {
+		meta.TotalItems = &totalItems
 	}
-
 	return logs, meta, nil
 }
 
 // LogActivity: Global async logger helper
-func LogActivity(userID uint, userName, action, details, status string, reqID uint) {
-	go func() {
+// ctx is only used for log correlation (request_id, user_id), it is not cancelled with the request
+// Runs as a tracked background job so graceful shutdown waits for it
+func LogActivity(ctx context.Context, userID uint, userName, action, details, status string, reqID uint) {
+	worker.Go(context.WithoutCancel(ctx), "log_activity", func(ctx context.Context) {
 		newLog := models.ActivityLog{
 			UserID:    userID,
 			UserName:  userName,
@@ -88,8 +105,8 @@ func LogActivity(userID uint, userName, action, details, status string, reqID ui
 			RequestID: reqID,
 			Timestamp: time.Now(),
 		}
-		if err := CreateActivityLog(newLog); err != nil {
-			fmt.Printf("[LOG ERROR] Failed to save activity: %v\n", err)
+		if err := CreateActivityLog(ctx, newLog); err != nil {
+			slog.ErrorContext(ctx, "failed to save activity", "order_id", reqID, "error", err)
 		}
-	}()
+	})
 }
@@ -0,0 +1,189 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"time"
+)
+
+const apiKeyColumns = `k.id, k.user_id, k.name, k.prefix, k.scopes, k.allowed_ips, k.expires_at, k.last_used_at,
+	COALESCE(k.last_used_ip, ''), k.revoked_at, k.created_at`
+
+// rowScanner is implemented by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanAPIKey reads apiKeyColumns (plus extra) into k
+func scanAPIKey(row rowScanner, k *models.APIKey, extra ...interface{}) error {
+	var scopes, allowedIPs []byte
+	dest := append([]interface{}{&k.ID, &k.ServiceAccountID, &k.Name, &k.Prefix, &scopes, &allowedIPs, &k.ExpiresAt, &k.LastUsedAt,
+		&k.LastUsedIP, &k.RevokedAt, &k.CreatedAt}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(scopes, &k.Scopes); err != nil {
+		return err
+	}
+	return json.Unmarshal(allowedIPs, &k.AllowedIPs)
+}
+
+// CreateAPIKey stores a key of a service account; only the hash of the key is saved
+func CreateAPIKey(ctx context.Context, k *models.APIKey, keyHash string, createdBy *uint) error {
+	if k.AllowedIPs == nil {
+		k.AllowedIPs = []string{}
+	}
+	scopes, err := json.Marshal(k.Scopes)
+	if err != nil {
+		return err
+	}
+	allowedIPs, err := json.Marshal(k.AllowedIPs)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startQuery(ctx, "api_keys.create")
+	res, err := setting.DB.ExecContext(ctx, `INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes, allowed_ips, expires_at, created_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`, k.ServiceAccountID, k.Name, k.Prefix, keyHash, string(scopes), string(allowedIPs), k.ExpiresAt, createdBy)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	k.ID = uint(id)
+	k.CreatedAt = time.Now().Truncate(time.Second)
+	return nil
+}
+
+// GetAPIKeyByHash returns a usable key and the service account it belongs to
+// Unknown, revoked and expired keys and keys of deactivated accounts are sql.ErrNoRows
+func GetAPIKeyByHash(ctx context.Context, keyHash string) (*models.APIKey, *models.User, error) {
+	ctx, span := startQuery(ctx, "api_keys.get_by_hash")
+	var (
+		k models.APIKey
+		u models.User
+	)
+	row := setting.DB.QueryRowContext(ctx, `SELECT `+apiKeyColumns+`, u.name, u.role, u.unit, u.can_crud
+		FROM api_keys k JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = ? AND k.revoked_at IS NULL AND (k.expires_at IS NULL OR k.expires_at > NOW())
+		AND u.service_account = TRUE AND u.deactivated_at IS NULL`, keyHash)
+	err := scanAPIKey(row, &k, &u.Name, &u.Role, &u.Unit, &u.CanCRUD)
+	endQuery(span, oneRow(err), err)
+	if err != nil {
+		return nil, nil, err
+	}
+	u.ID = k.ServiceAccountID
+	u.ServiceAccount = true
+	return &k, &u, nil
+}
+
+// TouchAPIKey records when and from where a key was last used
+// Callers skip it when the key was used from the same address within the last minute
+func TouchAPIKey(ctx context.Context, id uint, ip string) error {
+	ctx, span := startQuery(ctx, "api_keys.touch")
+	res, err := setting.DB.ExecContext(ctx, "UPDATE api_keys SET last_used_at = NOW(), last_used_ip = ? WHERE id = ?", ip, id)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+// GetServiceAccounts returns all service accounts with their keys, including deactivated accounts and revoked keys
+func GetServiceAccounts(ctx context.Context) ([]models.ServiceAccount, error) {
+	accCtx, span := startQuery(ctx, "users.list_service_accounts")
+	rows, err := setting.DB.QueryContext(accCtx, `SELECT id, name, unit, deactivated_at, created_at
+		FROM users WHERE service_account = TRUE ORDER BY id`)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := []models.ServiceAccount{}
+	index := map[uint]int{}
+	for rows.Next() {
+		a := models.ServiceAccount{Keys: []models.APIKey{}}
+		if err := rows.Scan(&a.ID, &a.Name, &a.Unit, &a.DeactivatedAt, &a.CreatedAt); err != nil {
+			endQuery(span, int64(len(accounts)), err)
+			return nil, err
+		}
+		index[a.ID] = len(accounts)
+		accounts = append(accounts, a)
+	}
+	endQuery(span, int64(len(accounts)), rows.Err())
+	if err := rows.Err(); err != nil || len(accounts) == 0 {
+		return accounts, err
+	}
+
+	keyCtx, span := startQuery(ctx, "api_keys.list")
+	keyRows, err := setting.DB.QueryContext(keyCtx, `SELECT `+apiKeyColumns+` FROM api_keys k ORDER BY k.id`)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer keyRows.Close()
+
+	var n int64
+	for keyRows.Next() {
+		var k models.APIKey
+		if err := scanAPIKey(keyRows, &k); err != nil {
+			endQuery(span, n, err)
+			return nil, err
+		}
+		if i, ok := index[k.ServiceAccountID]; ok {
+			accounts[i].Keys = append(accounts[i].Keys, k)
+		}
+		n++
+	}
+	endQuery(span, n, keyRows.Err())
+	return accounts, keyRows.Err()
+}
+
+// RevokeAPIKey stops a key of a service account from working; revoking twice is harmless
+// Returns sql.ErrNoRows if the account has no such key
+func RevokeAPIKey(ctx context.Context, userID, keyID uint) error {
+	selCtx, span := startQuery(ctx, "api_keys.get")
+	var id uint
+	err := setting.DB.QueryRowContext(selCtx, "SELECT id FROM api_keys WHERE id = ? AND user_id = ?", keyID, userID).Scan(&id)
+	endQuery(span, oneRow(err), err)
+	if err != nil {
+		return err
+	}
+
+	updCtx, span := startQuery(ctx, "api_keys.revoke")
+	res, err := setting.DB.ExecContext(updCtx, "UPDATE api_keys SET revoked_at = NOW() WHERE id = ? AND revoked_at IS NULL", keyID)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+// DeactivateServiceAccount deactivates the account and revokes all its keys
+func DeactivateServiceAccount(ctx context.Context, id uint) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updCtx, span := startQuery(ctx, "users.deactivate")
+	res, err := tx.ExecContext(updCtx, `UPDATE users SET deactivated_at=NOW(), availability=?, version=version+1
+		WHERE id=? AND service_account = TRUE AND deactivated_at IS NULL`, global.AvailOffline, id)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	if err := revokeAPIKeysTx(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// revokeAPIKeysTx revokes all keys of an account inside tx
+func revokeAPIKeysTx(ctx context.Context, tx *sql.Tx, userID uint) error {
+	ctx, span := startQuery(ctx, "api_keys.revoke_all")
+	res, err := tx.ExecContext(ctx, "UPDATE api_keys SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL", userID)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
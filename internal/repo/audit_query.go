@@ -0,0 +1,234 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/audit"
+	"siro-backend/pkg/setting"
+	"time"
+)
+
+// auditTimeLayout is how audit_log.created_at is written and read. The column holds UTC whatever
+// the loc of the connection, so a changed time zone or a DST switch of the server doesn't move
+// the stored time, which is part of the hash.
+const auditTimeLayout = "2006-01-02 15:04:05.000000"
+
+// auditTime formats t for created_at
+func auditTime(t time.Time) interface{} {
+	return t.UTC().Format(auditTimeLayout)
+}
+
+// InsertAudit appends e to the audit log, chained to the newest entry
+// ID, CreatedAt, PrevHash and Hash are filled in
+func InsertAudit(ctx context.Context, e *audit.LogEntry) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	// Locking the head row makes concurrent writers wait for each other
+	headCtx, span := startQuery(ctx, "audit_chain_head.lock")
+	err = tx.QueryRowContext(headCtx, "SELECT last_hash FROM audit_chain_head WHERE id = 1 FOR UPDATE").Scan(&e.PrevHash)
+	endQuery(span, oneRow(err), err)
+	if err != nil {
+		return err
+	}
+
+	e.CreatedAt = time.Now().UTC().Truncate(time.Microsecond) // DATETIME(6) precision
+	e.Hash = e.ComputeHash()
+
+	insCtx, span := startQuery(ctx, "audit_log.create")
+	res, err := tx.ExecContext(insCtx, `INSERT INTO audit_log
+		(actor_id, actor_name, action, target_type, target_id, diff, ip, user_agent, created_at, prev_hash, hash)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ActorID, e.ActorName, e.Action, e.TargetType, e.TargetID, e.Diff, e.IP, e.UserAgent, auditTime(e.CreatedAt), e.PrevHash, e.Hash)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	e.ID = uint(id)
+
+	updCtx, span := startQuery(ctx, "audit_chain_head.update")
+	res, err = tx.ExecContext(updCtx, "UPDATE audit_chain_head SET last_hash = ? WHERE id = 1", e.Hash)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AuditQuery selects audit entries; empty fields don't filter
+type AuditQuery struct {
+	ActorID    *uint
+	Actions    []string
+	TargetType string
+	TargetID   string
+	From       *time.Time // inclusive
+	Before     *time.Time // exclusive
+}
+
+const selectAuditQuery = `SELECT id, actor_id, actor_name, action, target_type, target_id, diff, ip, user_agent,
+		DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s.%f'), prev_hash, hash
+	FROM audit_log`
+
+// listAuditQuery is selectAuditQuery, but users as actors get their current name from users,
+// so it follows AnonymizeUser. Only the name of clients without a user is stored in the entry.
+const listAuditQuery = `SELECT id, actor_id,
+		COALESCE(NULLIF(actor_name, ''), (SELECT u.name FROM users u WHERE u.id = audit_log.actor_id), ''),
+		action, target_type, target_id, diff, ip, user_agent, DATE_FORMAT(created_at, '%Y-%m-%d %H:%i:%s.%f'), prev_hash, hash
+	FROM audit_log`
+
+// GetAudit returns one page of audit entries, newest first
+func GetAudit(ctx context.Context, q AuditQuery, page Page) ([]audit.LogEntry, models.PaginationMeta, error) {
+	var where conditions
+	if q.ActorID != nil {
+		where.add("actor_id = ?", *q.ActorID)
+	}
+	where.in("action", q.Actions)
+	if q.TargetType != "" {
+		where.add("target_type = ?", q.TargetType)
+	}
+	if q.TargetID != "" {
+		where.add("target_id = ?", q.TargetID)
+	}
+	if q.From != nil {
+		where.add("created_at >= ?", auditTime(*q.From))
+	}
+	if q.Before != nil {
+		where.add("created_at < ?", auditTime(*q.Before))
+	}
+
+	var totalItems int
+	if !page.CursorMode || page.IncludeTotal {
+		countCtx, countSpan := startQuery(ctx, "audit_log.count")
+		err := setting.DB.QueryRowContext(countCtx, "SELECT COUNT(*) FROM audit_log"+where.sql(), where.args...).Scan(&totalItems)
+		endQuery(countSpan, oneRow(err), err)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+	}
+
+	var (
+		query = listAuditQuery
+		args  []interface{}
+		ks    keyset
+	)
+	if page.CursorMode {
+		var err error
+		ks, err = newKeyset(page, "-created_at", "created_at", "id", true)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+		ks.timeArg = auditTime
+		ks.addCondition(&where)
+		query += where.sql() + ks.orderBy() + " LIMIT ?"
+		args = append(where.args, page.Limit+1)
+	} else {
+		query += where.sql() + " ORDER BY created_at DESC, id DESC LIMIT ? OFFSET ?"
+		args = append(where.args, page.Limit, page.offset())
+	}
+
+	listCtx, span := startQuery(ctx, "audit_log.list")
+	rows, err := setting.DB.QueryContext(listCtx, query, args...)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, models.PaginationMeta{}, err
+	}
+	defer rows.Close()
+
+	entries := []audit.LogEntry{}
+	for rows.Next() {
+		e, err := scanAudit(rows)
+		if err != nil {
+			endQuery(span, int64(len(entries)), err)
+			return nil, models.PaginationMeta{}, err
+		}
+		entries = append(entries, e)
+	}
+	endQuery(span, int64(len(entries)), rows.Err())
+
+	if !page.CursorMode {
+		return entries, page.offsetMeta(totalItems), nil
+	}
+	entries, meta := keysetPage(entries, ks, page.Limit, func(e audit.LogEntry) (time.Time, uint) {
+		return e.CreatedAt, e.ID
+	})
+	if page.IncludeTotal {
+		meta.TotalItems = &totalItems
+	}
+	return entries, meta, nil
+}
+
+func scanAudit(rows *sql.Rows) (audit.LogEntry, error) {
+	var (
+		e         audit.LogEntry
+		actorID   sql.NullInt64
+		createdAt string
+	)
+	err := rows.Scan(&e.ID, &actorID, &e.ActorName, &e.Action, &e.TargetType, &e.TargetID, &e.Diff, &e.IP, &e.UserAgent,
+		&createdAt, &e.PrevHash, &e.Hash)
+	if err != nil {
+		return e, err
+	}
+	if actorID.Valid {
+		id := uint(actorID.Int64)
+		e.ActorID = &id
+	}
+	e.CreatedAt, err = time.ParseInLocation(auditTimeLayout, createdAt, time.UTC)
+	return e, err
+}
+
+// AuditVerifyResult is the outcome of VerifyAudit
+type AuditVerifyResult struct {
+	Checked  int    // number of entries read
+	BrokenAt uint   // id of the first bad entry (0 = none)
+	Problem  string // what is wrong, "" if the chain is intact
+}
+
+// VerifyAudit walks the whole audit log in order and recomputes every hash
+// It stops at the first entry that was changed, removed (gap in the chain) or reordered,
+// and also checks that the newest entry matches audit_chain_head (rows cut off the end)
+func VerifyAudit(ctx context.Context) (AuditVerifyResult, error) {
+	var result AuditVerifyResult
+
+	ctx, span := startQuery(ctx, "audit_log.verify")
+	rows, err := setting.DB.QueryContext(ctx, selectAuditQuery+" ORDER BY id")
+	if err != nil {
+		endQuery(span, 0, err)
+		return result, err
+	}
+	defer rows.Close()
+
+	chain := audit.NewChain()
+	for rows.Next() {
+		e, err := scanAudit(rows)
+		if err != nil {
+			endQuery(span, int64(result.Checked), err)
+			return result, err
+		}
+		result.Checked++
+
+		if problem := chain.Check(e); problem != "" {
+			result.BrokenAt, result.Problem = e.ID, problem
+			endQuery(span, int64(result.Checked), nil)
+			return result, nil
+		}
+	}
+	endQuery(span, int64(result.Checked), rows.Err())
+	if err := rows.Err(); err != nil {
+		return result, err
+	}
+
+	var head string
+	if err := setting.DB.QueryRowContext(ctx, "SELECT last_hash FROM audit_chain_head WHERE id = 1").Scan(&head); err != nil {
+		return result, err
+	}
+	if head != chain.Head() {
+		result.Problem = fmt.Sprintf("newest entry hash %.12s… does not match audit_chain_head %.12s… (entries removed from the end)", chain.Head(), head)
+	}
+	return result, nil
+}
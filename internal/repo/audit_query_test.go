@@ -0,0 +1,165 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"siro-backend/internal/testutil"
+	"siro-backend/pkg/audit"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestAuditTime(t *testing.T) {
+	// 07:30 in Jakarta is stored as 00:30 UTC and read back as the same instant
+	at := time.Date(2026, 10, 19, 7, 30, 0, 123456000, time.FixedZone("WIB", 7*3600))
+	stored := auditTime(at).(string)
+	if stored != "2026-10-19 00:30:00.123456" {
+		t.Fatalf("auditTime = %q", stored)
+	}
+	read, err := time.ParseInLocation(auditTimeLayout, stored, time.UTC)
+	if err != nil || !read.Equal(at) {
+		t.Errorf("read back %v (%v), want %v", read, err, at)
+	}
+}
+
+// auditChain returns n correctly chained entries
+func auditChain(n int) []audit.LogEntry {
+	entries := make([]audit.LogEntry, n)
+	prev := audit.GenesisHash
+	for i := range entries {
+		actor := uint(1)
+		e := audit.LogEntry{
+			ID: uint(i + 1), ActorID: &actor, ActorName: "Admin", Action: "user.update",
+			TargetType: "user", TargetID: "7", Diff: `{"role":{"from":"Staff","to":"Admin"}}`, IP: "10.0.0.1",
+			CreatedAt: time.Date(2026, 10, 19, 0, 30, i, 123456000, time.UTC), PrevHash: prev,
+		}
+		e.Hash = e.ComputeHash()
+		prev = e.Hash
+		entries[i] = e
+	}
+	return entries
+}
+
+// auditRows are entries as selectAuditQuery returns them
+func auditRows(entries []audit.LogEntry) *sqlmock.Rows {
+	rows := sqlmock.NewRows([]string{"id", "actor_id", "actor_name", "action", "target_type", "target_id", "diff", "ip",
+		"user_agent", "created_at", "prev_hash", "hash"})
+	for _, e := range entries {
+		var actor interface{}
+		if e.ActorID != nil {
+			actor = int64(*e.ActorID)
+		}
+		rows.AddRow(e.ID, actor, e.ActorName, e.Action, e.TargetType, e.TargetID, e.Diff, e.IP, e.UserAgent,
+			auditTime(e.CreatedAt), e.PrevHash, e.Hash)
+	}
+	return rows
+}
+
+func TestVerifyAudit(t *testing.T) {
+	ctx := context.Background()
+	const selectAll = `SELECT id, actor_id, .* FROM audit_log ORDER BY id`
+	const selectHead = `SELECT last_hash FROM audit_chain_head WHERE id = 1`
+	head := func(hash string) *sqlmock.Rows { return sqlmock.NewRows([]string{"last_hash"}).AddRow(hash) }
+
+	tests := []struct {
+		name     string
+		entries  func(e []audit.LogEntry) []audit.LogEntry
+		head     func(e []audit.LogEntry) string // "" = the head is not read
+		checked  int
+		brokenAt uint
+		problem  string
+	}{
+		{"intact", func(e []audit.LogEntry) []audit.LogEntry { return e },
+			func(e []audit.LogEntry) string { return e[3].Hash }, 4, 0, ""},
+		{"empty log", func(e []audit.LogEntry) []audit.LogEntry { return nil },
+			func(e []audit.LogEntry) string { return audit.GenesisHash }, 0, 0, ""},
+		{"modified", func(e []audit.LogEntry) []audit.LogEntry { e[2].Diff = `{}`; return e },
+			nil, 3, 3, "entry modified"},
+		{"actor removed", func(e []audit.LogEntry) []audit.LogEntry { e[0].ActorID = nil; return e },
+			nil, 1, 1, "entry modified"},
+		{"removed", func(e []audit.LogEntry) []audit.LogEntry { return append(e[:1:1], e[2:]...) },
+			nil, 2, 3, "entry removed or reordered"},
+		{"reordered", func(e []audit.LogEntry) []audit.LogEntry { e[1], e[2] = e[2], e[1]; return e },
+			nil, 2, 3, "entry removed or reordered"},
+		{"removed from the end", func(e []audit.LogEntry) []audit.LogEntry { return e[:3] },
+			func(e []audit.LogEntry) string { return e[3].Hash }, 3, 0, "entries removed from the end"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			all := auditChain(4)
+			mock.ExpectQuery(selectAll).WillReturnRows(auditRows(tt.entries(auditChain(4))))
+			if tt.head != nil {
+				mock.ExpectQuery(selectHead).WillReturnRows(head(tt.head(all)))
+			}
+
+			got, err := VerifyAudit(ctx)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Checked != tt.checked || got.BrokenAt != tt.brokenAt || !strings.Contains(got.Problem, tt.problem) ||
+				(tt.problem == "") != (got.Problem == "") {
+				t.Errorf("VerifyAudit = %+v, want %d checked, broken at %d, problem %q", got, tt.checked, tt.brokenAt, tt.problem)
+			}
+		})
+	}
+
+	t.Run("query error", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(selectAll).WillReturnError(errors.New("connection refused"))
+		if _, err := VerifyAudit(ctx); err == nil {
+			t.Error("no error")
+		}
+	})
+
+	t.Run("bad time", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		rows := auditRows(auditChain(1))
+		rows.AddRow(2, nil, "", "user.create", "user", "8", "{}", "", "", "yesterday", "", "")
+		mock.ExpectQuery(selectAll).WillReturnRows(rows)
+		if got, err := VerifyAudit(ctx); err == nil || got.Checked != 1 {
+			t.Errorf("VerifyAudit = %+v, %v, want an error after 1 entry", got, err)
+		}
+	})
+
+	t.Run("no head row", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(selectAll).WillReturnRows(auditRows(nil))
+		mock.ExpectQuery(selectHead).WillReturnRows(sqlmock.NewRows([]string{"last_hash"}))
+		if _, err := VerifyAudit(ctx); err == nil {
+			t.Error("no error")
+		}
+	})
+}
+
+func TestInsertAudit(t *testing.T) {
+	mock := testutil.MockDB(t)
+	prev := auditChain(1)[0]
+	actor := uint(1)
+	e := audit.LogEntry{ActorID: &actor, ActorName: "Admin", Action: "unit.create", TargetType: "unit", TargetID: "3", Diff: `{}`}
+
+	mock.ExpectBegin()
+	mock.ExpectQuery(`SELECT last_hash FROM audit_chain_head WHERE id = 1 FOR UPDATE`).
+		WillReturnRows(sqlmock.NewRows([]string{"last_hash"}).AddRow(prev.Hash))
+	mock.ExpectExec(`INSERT INTO audit_log`).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectExec(`UPDATE audit_chain_head SET last_hash = \? WHERE id = 1`).
+		WithArgs(sqlmock.AnyArg()).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	if err := InsertAudit(context.Background(), &e); err != nil {
+		t.Fatal(err)
+	}
+	if e.ID != 2 || e.PrevHash != prev.Hash || e.Hash != e.ComputeHash() || e.CreatedAt.Location() != time.UTC {
+		t.Errorf("entry = %+v", e)
+	}
+	// the new entry continues the chain
+	chain := audit.NewChain()
+	for _, entry := range []audit.LogEntry{prev, e} {
+		if problem := chain.Check(entry); problem != "" {
+			t.Fatalf("entry %d: %s", entry.ID, problem)
+		}
+	}
+}
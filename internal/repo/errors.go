@@ -0,0 +1,35 @@
+package repo
+
+import (
+	"errors"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+// ErrVersionConflict is returned when a row was changed by someone else
+// between reading it and writing it (optimistic concurrency check failed)
+var ErrVersionConflict = errors.New("version conflict")
+
+// ErrUserAnonymized is returned when changing a user whose personal data was erased
+var ErrUserAnonymized = errors.New("user is anonymized")
+
+// ErrDuplicate is returned when an insert hits a UNIQUE index
+var ErrDuplicate = errors.New("duplicate entry")
+
+// isDuplicate reports whether err is MySQL error 1062 (duplicate entry)
+func isDuplicate(err error) bool {
+	var me *mysql.MySQLError
+	return errors.As(err, &me) && me.Number == 1062
+}
+
+// ErrInvitationInvalid is returned for unknown, used or withdrawn invitation tokens
+var ErrInvitationInvalid = errors.New("invitation is invalid")
+
+// ErrInvitationExpired is returned for invitation tokens past their expiry
+var ErrInvitationExpired = errors.New("invitation has expired")
+
+// ErrOIDCLoginInvalid is returned for unknown, used or expired single sign-on states
+var ErrOIDCLoginInvalid = errors.New("single sign-on login is invalid or expired")
+
+// ErrOIDCLinked is returned when linking a user that is already linked to another identity
+var ErrOIDCLinked = errors.New("user is linked to another identity")
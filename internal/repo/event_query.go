@@ -0,0 +1,294 @@
+package repo
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"slices"
+	"time"
+)
+
+// Event sources: where a change came from
+const (
+	SourceAPI       = "api"
+	SourceMigration = "migration" // backfilled by migrations/012
+)
+
+// Actor is who caused a change and through which source
+type Actor struct {
+	UserID *uint
+	Source string
+}
+
+// APIActor returns the actor for a change made by a logged-in user
+func APIActor(userID uint) Actor {
+	return Actor{UserID: &userID, Source: SourceAPI}
+}
+
+// recordEvent stores one work_order_events row inside tx, so it is saved together with the change
+// before and after hold only the fields that were changed (nil for "no previous value")
+func recordEvent(ctx context.Context, tx *sql.Tx, woID uint, eventType string, actor Actor, before, after map[string]interface{}) error {
+	oldJSON, err := jsonOrNull(before)
+	if err != nil {
+		return err
+	}
+	newJSON, err := jsonOrNull(after)
+	if err != nil {
+		return err
+	}
+
+	ctx, span := startQuery(ctx, "work_order_events.create")
+	res, err := tx.ExecContext(ctx, `INSERT INTO work_order_events (work_order_id, event_type, actor_id, source, old_values, new_values, created_at)
+		VALUES (?, ?, ?, ?, ?, ?, NOW())`, woID, eventType, actor.UserID, actor.Source, oldJSON, newJSON)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+func jsonOrNull(values map[string]interface{}) (interface{}, error) {
+	if values == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(values)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
+// woChange is one UPDATE of a work order, see updateWorkOrder
+type woChange struct {
+	span      string                 // trace span name, e.g. "workorders.take"
+	eventType string                 // EventTaken, EventAssigned, ...
+	set       string                 // SET clause without updated_at / version, e.g. "status=?, assignee_id=?"
+	args      []interface{}          // arguments of set
+	where     string                 // extra condition, e.g. "assignee_id IS NULL" (optional)
+	after     map[string]interface{} // the new values, by column name
+}
+
+// updateWorkOrder applies a change if the row is still at version and records the event
+// The row is locked first, so the "before" values are exactly what the update replaced
+// Returns ErrVersionConflict if the version (or ch.where) doesn't match
+func updateWorkOrder(ctx context.Context, woID, version uint, actor Actor, ch woChange) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	current, err := lockWorkOrder(ctx, tx, woID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrVersionConflict // deleted in the meantime
+	}
+	if err != nil {
+		return err
+	}
+
+	query := "UPDATE work_orders SET " + ch.set + ", updated_at=NOW(), version=version+1 WHERE id=? AND version=?"
+	if ch.where != "" {
+		query += " AND " + ch.where
+	}
+	args := append(append([]interface{}{}, ch.args...), woID, version)
+
+	updCtx, span := startQuery(ctx, ch.span)
+	res, err := tx.ExecContext(updCtx, query, args...)
+	aff := rowsAffected(res, err)
+	endQuery(span, aff, err)
+	if err != nil {
+		return err
+	}
+	if aff == 0 {
+		return ErrVersionConflict
+	}
+
+	before := make(map[string]interface{}, len(ch.after))
+	for field := range ch.after {
+		before[field] = current[field]
+	}
+	if err := recordEvent(ctx, tx, woID, ch.eventType, actor, before, ch.after); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// lockWorkOrder reads the fields that mutations change and locks the row until tx ends
+func lockWorkOrder(ctx context.Context, tx *sql.Tx, woID uint) (map[string]interface{}, error) {
+	var (
+		status, note     string
+		assignee, doneBy sql.NullInt64
+	)
+	ctx, span := startQuery(ctx, "workorders.lock")
+	err := tx.QueryRowContext(ctx, "SELECT status, assignee_id, completed_by_id, COALESCE(completion_note, '') FROM work_orders WHERE id = ? FOR UPDATE", woID).
+		Scan(&status, &assignee, &doneBy, &note)
+	endQuery(span, oneRow(err), err)
+	if err != nil {
+		return nil, err
+	}
+	return map[string]interface{}{
+		"status":          status,
+		"assignee_id":     nullableID(assignee),
+		"completed_by_id": nullableID(doneBy),
+		"completion_note": note,
+	}, nil
+}
+
+func nullableID(v sql.NullInt64) interface{} {
+	if !v.Valid {
+		return nil
+	}
+	return uint(v.Int64)
+}
+
+// EventQuery selects events; empty fields don't filter
+type EventQuery struct {
+	WorkOrderID *uint
+	ActorID     *uint
+	Types       []string
+}
+
+const selectEventQuery = `SELECT e.id, e.work_order_id, e.event_type, e.actor_id, COALESCE(u.name, ''), e.source,
+		e.old_values, e.new_values, e.created_at
+	FROM work_order_events e
+	LEFT JOIN users u ON e.actor_id = u.id`
+
+// GetWorkOrderEvents returns all events of one work order, oldest first
+func GetWorkOrderEvents(ctx context.Context, woID uint) ([]models.WorkOrderEvent, error) {
+	ctx, span := startQuery(ctx, "work_order_events.by_work_order")
+	rows, err := setting.DB.QueryContext(ctx, selectEventQuery+" WHERE e.work_order_id = ? ORDER BY e.created_at, e.id", woID)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	endQuery(span, int64(len(events)), err)
+	return events, err
+}
+
+// GetEvents returns one page of events matching q, newest first (e.g. everything one user changed)
+func GetEvents(ctx context.Context, q EventQuery, page Page) ([]models.WorkOrderEvent, models.PaginationMeta, error) {
+	var where conditions
+	if q.WorkOrderID != nil {
+		where.add("e.work_order_id = ?", *q.WorkOrderID)
+	}
+	if q.ActorID != nil {
+		where.add("e.actor_id = ?", *q.ActorID)
+	}
+	where.in("e.event_type", q.Types)
+
+	var totalItems int
+	if !page.CursorMode || page.IncludeTotal {
+		countCtx, countSpan := startQuery(ctx, "work_order_events.count")
+		err := setting.DB.QueryRowContext(countCtx, "SELECT COUNT(*) FROM work_order_events e"+where.sql(), where.args...).Scan(&totalItems)
+		endQuery(countSpan, oneRow(err), err)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+	}
+
+	var (
+		query = selectEventQuery
+		args  []interface{}
+		ks    keyset
+	)
+	if page.CursorMode {
+		var err error
+		ks, err = newKeyset(page, "-created_at", "e.created_at", "e.id", true)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+		ks.addCondition(&where)
+		query += where.sql() + ks.orderBy() + " LIMIT ?"
+		args = append(where.args, page.Limit+1)
+	} else {
+		query += where.sql() + " ORDER BY e.created_at DESC, e.id DESC LIMIT ? OFFSET ?"
+		args = append(where.args, page.Limit, page.offset())
+	}
+
+	listCtx, span := startQuery(ctx, "work_order_events.list")
+	rows, err := setting.DB.QueryContext(listCtx, query, args...)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, models.PaginationMeta{}, err
+	}
+	defer rows.Close()
+
+	events, err := scanEvents(rows)
+	endQuery(span, int64(len(events)), err)
+	if err != nil {
+		return nil, models.PaginationMeta{}, err
+	}
+
+	if !page.CursorMode {
+		return events, page.offsetMeta(totalItems), nil
+	}
+	events, meta := keysetPage(events, ks, page.Limit, func(e models.WorkOrderEvent) (time.Time, uint) {
+		return e.CreatedAt, e.ID
+	})
+	if page.IncludeTotal {
+		meta.TotalItems = &totalItems
+	}
+	return events, meta, nil
+}
+
+func scanEvents(rows *sql.Rows) ([]models.WorkOrderEvent, error) {
+	events := []models.WorkOrderEvent{}
+	for rows.Next() {
+		var (
+			e                models.WorkOrderEvent
+			actorID          sql.NullInt64
+			oldJSON, newJSON []byte
+		)
+		if err := rows.Scan(&e.ID, &e.WorkOrderID, &e.Type, &actorID, &e.ActorName, &e.Source, &oldJSON, &newJSON, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if actorID.Valid {
+			id := uint(actorID.Int64)
+			e.ActorID = &id
+		}
+		if len(oldJSON) > 0 {
+			_ = json.Unmarshal(oldJSON, &e.Before)
+		}
+		if len(newJSON) > 0 {
+			_ = json.Unmarshal(newJSON, &e.After)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// TimeInStatus adds up how long a work order spent in each open status, based on its events
+// The order starts as Pending at createdAt; Completed is final and not counted
+// Events are replayed by time (then id), whatever order they are passed in
+func TimeInStatus(createdAt time.Time, events []models.WorkOrderEvent, now time.Time) map[string]int64 {
+	sorted := slices.Clone(events)
+	slices.SortStableFunc(sorted, func(a, b models.WorkOrderEvent) int {
+		if c := a.CreatedAt.Compare(b.CreatedAt); c != 0 {
+			return c
+		}
+		return cmp.Compare(a.ID, b.ID)
+	})
+
+	totals := map[string]int64{}
+	status, since := global.StatusPending, createdAt
+
+	for _, e := range sorted {
+		next, ok := e.After["status"].(string)
+		if !ok || next == status {
+			continue
+		}
+		if e.CreatedAt.After(since) {
+			totals[status] += int64(e.CreatedAt.Sub(since).Seconds())
+		}
+		status, since = next, e.CreatedAt
+	}
+	if status != global.StatusCompleted && now.After(since) {
+		totals[status] += int64(now.Sub(since).Seconds())
+	}
+	return totals
+}
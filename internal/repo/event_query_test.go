@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"maps"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestTimeInStatus(t *testing.T) {
+	created := time.Date(2026, 10, 1, 8, 0, 0, 0, time.UTC)
+	at := func(id uint, min int, status string) models.WorkOrderEvent {
+		return models.WorkOrderEvent{ID: id, CreatedAt: created.Add(time.Duration(min) * time.Minute), After: map[string]interface{}{"status": status}}
+	}
+	now := created.Add(5 * time.Hour)
+
+	tests := []struct {
+		name   string
+		events []models.WorkOrderEvent
+		want   map[string]int64
+	}{
+		{"no events", nil, map[string]int64{global.StatusPending: 5 * 3600}},
+		{"one transition", []models.WorkOrderEvent{at(1, 30, global.StatusInProgress)},
+			map[string]int64{global.StatusPending: 30 * 60, global.StatusInProgress: 270 * 60}},
+		{"completed", []models.WorkOrderEvent{at(1, 30, global.StatusInProgress), at(2, 90, global.StatusCompleted)},
+			map[string]int64{global.StatusPending: 30 * 60, global.StatusInProgress: 60 * 60}},
+		// A reassignment keeps the status and doesn't split the time
+		{"same status again", []models.WorkOrderEvent{at(1, 30, global.StatusInProgress), at(2, 60, global.StatusInProgress), at(3, 90, global.StatusCompleted)},
+			map[string]int64{global.StatusPending: 30 * 60, global.StatusInProgress: 60 * 60}},
+		{"events without status", []models.WorkOrderEvent{{ID: 1, CreatedAt: created.Add(time.Hour), After: map[string]interface{}{"completion_note": "x"}}},
+			map[string]int64{global.StatusPending: 5 * 3600}},
+		{"out of order", []models.WorkOrderEvent{at(2, 90, global.StatusCompleted), at(1, 30, global.StatusInProgress)},
+			map[string]int64{global.StatusPending: 30 * 60, global.StatusInProgress: 60 * 60}},
+		// Same second: the id decides which came first
+		{"same time", []models.WorkOrderEvent{at(3, 30, global.StatusCompleted), at(2, 30, global.StatusInProgress)},
+			map[string]int64{global.StatusPending: 30 * 60}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := TimeInStatus(created, tt.events, now); !maps.Equal(got, tt.want) {
+				t.Errorf("TimeInStatus = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimeInStatusKeepsInput(t *testing.T) {
+	created := time.Now().Add(-time.Hour)
+	events := []models.WorkOrderEvent{
+		{ID: 2, CreatedAt: created.Add(20 * time.Minute), After: map[string]interface{}{"status": global.StatusCompleted}},
+		{ID: 1, CreatedAt: created.Add(10 * time.Minute), After: map[string]interface{}{"status": global.StatusInProgress}},
+	}
+	TimeInStatus(created, events, time.Now())
+	if events[0].ID != 2 {
+		t.Error("TimeInStatus reordered the caller's events")
+	}
+}
+
+// The event is written in the transaction of the update: committed with it, or rolled back with it
+func TestUpdateWorkOrderRecordsEvent(t *testing.T) {
+	ctx := context.Background()
+	update := regexp.QuoteMeta("UPDATE work_orders SET status=?, assignee_id=?, updated_at=NOW(), version=version+1 WHERE id=? AND version=?")
+	insert := regexp.QuoteMeta("INSERT INTO work_order_events (work_order_id, event_type, actor_id, source, old_values, new_values, created_at)")
+
+	t.Run("committed together", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusPending, nil)
+		mock.ExpectExec(update).WithArgs(global.StatusInProgress, 6, 7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insert).
+			WithArgs(7, EventAssigned, 5, SourceAPI, `{"assignee_id":null,"status":"Pending"}`, `{"assignee_id":6,"status":"In Progress"}`).
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		if err := AssignWorkOrder(ctx, 7, 6, 3, APIActor(5)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("event fails", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusPending, nil)
+		mock.ExpectExec(update).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(insert).WillReturnError(errors.New("disk full"))
+		mock.ExpectRollback()
+		if err := AssignWorkOrder(ctx, 7, 6, 3, APIActor(5)); err == nil {
+			t.Fatal("expected the event error")
+		}
+	})
+}
@@ -0,0 +1,110 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"time"
+)
+
+// pendingInvitation matches invitations that can still be accepted (aliases i and u)
+// The user must still have no password and not be deactivated
+const pendingInvitation = `i.token_hash = ? AND i.accepted_at IS NULL AND u.password_hash = '' AND u.deactivated_at IS NULL`
+
+// CreateInvitation stores a new invitation for the user and withdraws the older ones,
+// so only the most recent link works
+func CreateInvitation(ctx context.Context, userID uint, invitedBy *uint, tokenHash string, expiresAt time.Time) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	delCtx, span := startQuery(ctx, "user_invitations.withdraw")
+	res, err := tx.ExecContext(delCtx, "DELETE FROM user_invitations WHERE user_id = ? AND accepted_at IS NULL", userID)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	insCtx, span := startQuery(ctx, "user_invitations.create")
+	res, err = tx.ExecContext(insCtx, `INSERT INTO user_invitations (user_id, token_hash, invited_by, expires_at)
+		VALUES (?, ?, ?, ?)`, userID, tokenHash, invitedBy, expiresAt)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// GetInvitation returns who an invitation is for
+// Returns ErrInvitationInvalid or ErrInvitationExpired if it can't be accepted
+func GetInvitation(ctx context.Context, tokenHash string) (*models.InvitationInfo, error) {
+	ctx, span := startQuery(ctx, "user_invitations.get")
+	var (
+		info    models.InvitationInfo
+		expired bool
+	)
+	err := setting.DB.QueryRowContext(ctx, `SELECT u.name, u.email, i.expires_at, i.expires_at <= NOW()
+		FROM user_invitations i JOIN users u ON u.id = i.user_id
+		WHERE `+pendingInvitation, tokenHash).Scan(&info.Name, &info.Email, &info.ExpiresAt, &expired)
+	endQuery(span, oneRow(err), err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrInvitationInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	if expired {
+		return nil, ErrInvitationExpired
+	}
+	return &info, nil
+}
+
+// AcceptInvitation sets the invited user's password and uses up the invitation
+// Returns the user ID, or ErrInvitationInvalid / ErrInvitationExpired
+func AcceptInvitation(ctx context.Context, tokenHash, passwordHash string) (uint, error) {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var (
+		invitationID, userID uint
+		expired              bool
+	)
+	// Locked, so a double click can't accept the same invitation twice
+	selCtx, span := startQuery(ctx, "user_invitations.lock")
+	err = tx.QueryRowContext(selCtx, `SELECT i.id, i.user_id, i.expires_at <= NOW()
+		FROM user_invitations i JOIN users u ON u.id = i.user_id
+		WHERE `+pendingInvitation+` FOR UPDATE`, tokenHash).Scan(&invitationID, &userID, &expired)
+	endQuery(span, oneRow(err), err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrInvitationInvalid
+	}
+	if err != nil {
+		return 0, err
+	}
+	if expired {
+		return 0, ErrInvitationExpired
+	}
+
+	updCtx, span := startQuery(ctx, "users.set_password")
+	res, err := tx.ExecContext(updCtx, `UPDATE users SET password_hash = ?, must_change_password = FALSE, version = version + 1
+		WHERE id = ?`, passwordHash, userID)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return 0, err
+	}
+
+	accCtx, span := startQuery(ctx, "user_invitations.accept")
+	res, err = tx.ExecContext(accCtx, "UPDATE user_invitations SET accepted_at = NOW() WHERE id = ?", invitationID)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
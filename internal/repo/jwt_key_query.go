@@ -0,0 +1,47 @@
+package repo
+
+import (
+	"context"
+	"siro-backend/pkg/jwtkeys"
+	"siro-backend/pkg/setting"
+)
+
+// GetJWTKeys returns the token signing keys that have not expired, oldest first
+func GetJWTKeys(ctx context.Context) ([]jwtkeys.Record, error) {
+	ctx, span := startQuery(ctx, "jwt_keys.list")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT kid, algorithm, public_key, private_key, activates_at, expires_at
+		FROM jwt_keys WHERE expires_at > NOW() ORDER BY activates_at`)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []jwtkeys.Record
+	for rows.Next() {
+		var k jwtkeys.Record
+		if err := rows.Scan(&k.ID, &k.Algorithm, &k.PublicKey, &k.PrivateKey, &k.ActivatesAt, &k.ExpiresAt); err != nil {
+			endQuery(span, int64(len(keys)), err)
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	endQuery(span, int64(len(keys)), rows.Err())
+	return keys, rows.Err()
+}
+
+// CreateJWTKey stores a new signing key; expired keys are deleted on the way
+func CreateJWTKey(ctx context.Context, k jwtkeys.Record) error {
+	delCtx, span := startQuery(ctx, "jwt_keys.purge")
+	res, err := setting.DB.ExecContext(delCtx, "DELETE FROM jwt_keys WHERE expires_at <= NOW()")
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	insCtx, span := startQuery(ctx, "jwt_keys.create")
+	res, err = setting.DB.ExecContext(insCtx, `INSERT INTO jwt_keys (kid, algorithm, public_key, private_key, activates_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?)`, k.ID, k.Algorithm, k.PublicKey, k.PrivateKey, k.ActivatesAt, k.ExpiresAt)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
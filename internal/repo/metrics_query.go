@@ -0,0 +1,77 @@
+package repo
+
+import (
+	"context"
+	"siro-backend/global"
+	"siro-backend/pkg/setting"
+)
+
+// OpenWorkOrderCount is the number of unfinished work orders for one unit and status
+type OpenWorkOrderCount struct {
+	Unit   string
+	Status string
+	Count  int
+}
+
+// CountOpenWorkOrders groups unfinished work orders by target unit and status
+func CountOpenWorkOrders(ctx context.Context) ([]OpenWorkOrderCount, error) {
+	ctx, span := startQuery(ctx, "workorders.count_open")
+	rows, err := setting.DB.QueryContext(ctx, `
+		SELECT unit, status, COUNT(*)
+		FROM work_orders
+		WHERE status <> ?
+		GROUP BY unit, status`, global.StatusCompleted)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []OpenWorkOrderCount
+	for rows.Next() {
+		var oc OpenWorkOrderCount
+		if err := rows.Scan(&oc.Unit, &oc.Status, &oc.Count); err != nil {
+			endQuery(span, int64(len(counts)), err)
+			return nil, err
+		}
+		counts = append(counts, oc)
+	}
+	endQuery(span, int64(len(counts)), rows.Err())
+	return counts, rows.Err()
+}
+
+// CountSLABreaches returns the number of open work orders that breached their SLA (see SLABreached), per unit
+// Completed ones are left out, so the gauge goes down again once late work is done
+func CountSLABreaches(ctx context.Context) (map[string]int, error) {
+	cond, args := slaBreachCondition()
+	ctx, span := startQuery(ctx, "workorders.count_sla_breaches")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT w.unit, COUNT(*) FROM work_orders w WHERE w.status <> ? AND `+cond+` GROUP BY w.unit`,
+		append([]interface{}{global.StatusCompleted}, args...)...)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	breaches := map[string]int{}
+	for rows.Next() {
+		var unit string
+		var count int
+		if err := rows.Scan(&unit, &count); err != nil {
+			endQuery(span, int64(len(breaches)), err)
+			return nil, err
+		}
+		breaches[unit] = count
+	}
+	endQuery(span, int64(len(breaches)), rows.Err())
+	return breaches, rows.Err()
+}
+
+// CountActiveSessions returns the number of users with a refresh token that has not expired
+func CountActiveSessions(ctx context.Context) (int, error) {
+	ctx, span := startQuery(ctx, "user_tokens.count_active")
+	var count int
+	err := setting.DB.QueryRowContext(ctx, `SELECT COUNT(*) FROM user_tokens WHERE rt_expires_at > NOW()`).Scan(&count)
+	endQuery(span, oneRow(err), err)
+	return count, err
+}
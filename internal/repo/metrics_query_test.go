@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"reflect"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"sync"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spansOnce sync.Once
+	spans     *tracetest.InMemoryExporter
+)
+
+// recordSpans makes the repo tracer record into an in-memory exporter, emptied for each test
+func recordSpans(t *testing.T) *tracetest.InMemoryExporter {
+	t.Helper()
+	spansOnce.Do(func() {
+		spans = tracetest.NewInMemoryExporter()
+		otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans)))
+	})
+	spans.Reset()
+	return spans
+}
+
+// checkSpan checks that exactly one query span was recorded, with its row count and status
+func checkSpan(t *testing.T, exp *tracetest.InMemoryExporter, name string, rows int64, failed bool) {
+	t.Helper()
+	got := exp.GetSpans()
+	if len(got) != 1 {
+		t.Fatalf("%d spans, want 1 (%s)", len(got), name)
+	}
+	span := got[0]
+	if span.Name != "db "+name {
+		t.Errorf("span %q, want %q", span.Name, "db "+name)
+	}
+	attrs := map[attribute.Key]attribute.Value{}
+	for _, a := range span.Attributes {
+		attrs[a.Key] = a.Value
+	}
+	if attrs["db.statement.name"].AsString() != name || attrs["db.system"].AsString() != "mysql" {
+		t.Errorf("span attributes %v", span.Attributes)
+	}
+	if attrs["db.rows"].AsInt64() != rows {
+		t.Errorf("db.rows = %d, want %d", attrs["db.rows"].AsInt64(), rows)
+	}
+	if (span.Status.Code == codes.Error) != failed {
+		t.Errorf("span status %v, want failed=%v", span.Status, failed)
+	}
+}
+
+func TestCountOpenWorkOrders(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counts", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(`SELECT unit, status, COUNT\(\*\)\s+FROM work_orders\s+WHERE status <> \?`).WithArgs(global.StatusCompleted).
+			WillReturnRows(sqlmock.NewRows([]string{"unit", "status", "count"}).AddRow("IT", "Pending", 3).AddRow("IT", "In Progress", 1))
+
+		got, err := CountOpenWorkOrders(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []OpenWorkOrderCount{{"IT", "Pending", 3}, {"IT", "In Progress", 1}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("counts = %v, want %v", got, want)
+		}
+		checkSpan(t, exp, "workorders.count_open", 2, false)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery("FROM work_orders").WillReturnError(errors.New("connection refused"))
+		if _, err := CountOpenWorkOrders(ctx); err == nil {
+			t.Fatal("no error")
+		}
+		checkSpan(t, exp, "workorders.count_open", 0, true)
+	})
+
+	t.Run("scan error", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery("FROM work_orders").
+			WillReturnRows(sqlmock.NewRows([]string{"unit", "status", "count"}).AddRow("IT", "Pending", 3).AddRow("IT", "Pending", "many"))
+		if _, err := CountOpenWorkOrders(ctx); err == nil {
+			t.Fatal("no error")
+		}
+		checkSpan(t, exp, "workorders.count_open", 1, true)
+	})
+}
+
+// driverValues converts query arguments for sqlmock's WithArgs
+func driverValues(args []interface{}) []driver.Value {
+	values := make([]driver.Value, len(args))
+	for i, a := range args {
+		values[i] = a
+	}
+	return values
+}
+
+func TestCountSLABreaches(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counts", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		// Only open work orders, with the same breach condition as the sla_breached filter
+		cond, args := slaBreachCondition()
+		mock.ExpectQuery(regexp.QuoteMeta("SELECT w.unit, COUNT(*) FROM work_orders w WHERE w.status <> ? AND " + cond + " GROUP BY w.unit")).
+			WithArgs(append([]driver.Value{global.StatusCompleted}, driverValues(args)...)...).
+			WillReturnRows(sqlmock.NewRows([]string{"unit", "count"}).AddRow("IT", 2).AddRow("Facilities", 5))
+
+		got, err := CountSLABreaches(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := map[string]int{"IT": 2, "Facilities": 5}; !reflect.DeepEqual(got, want) {
+			t.Errorf("breaches = %v, want %v", got, want)
+		}
+		checkSpan(t, exp, "workorders.count_sla_breaches", 2, false)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery("FROM work_orders w").WillReturnError(errors.New("connection refused"))
+		if _, err := CountSLABreaches(ctx); err == nil {
+			t.Fatal("no error")
+		}
+		checkSpan(t, exp, "workorders.count_sla_breaches", 0, true)
+	})
+}
+
+func TestCountActiveSessions(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("count", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery(`SELECT COUNT\(\*\) FROM user_tokens WHERE rt_expires_at > NOW\(\)`).
+			WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(7))
+
+		got, err := CountActiveSessions(ctx)
+		if err != nil || got != 7 {
+			t.Fatalf("CountActiveSessions = %d, %v, want 7", got, err)
+		}
+		checkSpan(t, exp, "user_tokens.count_active", 1, false)
+	})
+
+	t.Run("query error", func(t *testing.T) {
+		exp := recordSpans(t)
+		mock := testutil.MockDB(t)
+		mock.ExpectQuery("FROM user_tokens").WillReturnError(errors.New("connection refused"))
+		if _, err := CountActiveSessions(ctx); err == nil {
+			t.Fatal("no error")
+		}
+		checkSpan(t, exp, "user_tokens.count_active", 0, true)
+	})
+}
@@ -0,0 +1,40 @@
+package repo
+
+import (
+	"context"
+	"siro-backend/migrations"
+	"siro-backend/pkg/setting"
+)
+
+// GetPendingMigrations returns migration files that are not recorded in schema_migrations
+func GetPendingMigrations(ctx context.Context) ([]string, error) {
+	ctx, span := startQuery(ctx, "schema_migrations.list")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT version FROM schema_migrations`)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := map[string]bool{}
+	for rows.Next() {
+		var v string
+		if err := rows.Scan(&v); err != nil {
+			endQuery(span, 0, err)
+			return nil, err
+		}
+		applied[v] = true
+	}
+	endQuery(span, int64(len(applied)), rows.Err())
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, v := range migrations.Versions() {
+		if !applied[v] {
+			pending = append(pending, v)
+		}
+	}
+	return pending, nil
+}
@@ -0,0 +1,101 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"time"
+)
+
+// CreateOIDCLogin stores a started single sign-on login until the provider sends the user back
+// Expired attempts of other users are cleaned up on the way
+func CreateOIDCLogin(ctx context.Context, stateHash, verifier, nonce string, expiresAt time.Time) error {
+	delCtx, span := startQuery(ctx, "oidc_logins.purge")
+	res, err := setting.DB.ExecContext(delCtx, "DELETE FROM oidc_logins WHERE expires_at <= NOW()")
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	insCtx, span := startQuery(ctx, "oidc_logins.create")
+	res, err = setting.DB.ExecContext(insCtx, `INSERT INTO oidc_logins (state_hash, code_verifier, nonce, expires_at)
+		VALUES (?, ?, ?, ?)`, stateHash, verifier, nonce, expiresAt)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+// TakeOIDCLogin returns the PKCE verifier and nonce of a started login and uses it up
+// Returns ErrOIDCLoginInvalid if the state is unknown, already used or expired
+func TakeOIDCLogin(ctx context.Context, stateHash string) (verifier, nonce string, err error) {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return "", "", err
+	}
+	defer tx.Rollback()
+
+	var (
+		id      uint
+		expired bool
+	)
+	// Locked, so the same callback can't be used twice
+	selCtx, span := startQuery(ctx, "oidc_logins.lock")
+	err = tx.QueryRowContext(selCtx, `SELECT id, code_verifier, nonce, expires_at <= NOW()
+		FROM oidc_logins WHERE state_hash = ? FOR UPDATE`, stateHash).Scan(&id, &verifier, &nonce, &expired)
+	endQuery(span, oneRow(err), err)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", "", ErrOIDCLoginInvalid
+	}
+	if err != nil {
+		return "", "", err
+	}
+
+	delCtx, span := startQuery(ctx, "oidc_logins.take")
+	res, err := tx.ExecContext(delCtx, "DELETE FROM oidc_logins WHERE id = ?", id)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return "", "", err
+	}
+	if err := tx.Commit(); err != nil {
+		return "", "", err
+	}
+	if expired {
+		return "", "", ErrOIDCLoginInvalid
+	}
+	return verifier, nonce, nil
+}
+
+// GetUserByOIDCSubject returns the user linked to a single sign-on identity
+// Returns sql.ErrNoRows if nobody is linked to it
+func GetUserByOIDCSubject(ctx context.Context, subject string) (*models.User, error) {
+	qCtx, span := startQuery(ctx, "users.get_by_oidc_subject")
+	var id uint
+	err := setting.DB.QueryRowContext(qCtx, "SELECT id FROM users WHERE oidc_subject = ?", subject).Scan(&id)
+	endQuery(span, oneRow(err), err)
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(ctx, id)
+}
+
+// LinkOIDCSubject links a user to a single sign-on identity
+// Returns ErrOIDCLinked if the user is already linked to another one,
+// ErrDuplicate if another user is linked to this one
+func LinkOIDCSubject(ctx context.Context, id uint, subject string) error {
+	ctx, span := startQuery(ctx, "users.link_oidc_subject")
+	res, err := setting.DB.ExecContext(ctx, `UPDATE users SET oidc_subject = ?, version = version + 1
+		WHERE id = ? AND oidc_subject IS NULL`, subject, id)
+	aff := rowsAffected(res, err)
+	endQuery(span, aff, err)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if aff == 0 {
+		return ErrOIDCLinked
+	}
+	return nil
+}
@@ -0,0 +1,161 @@
+package repo
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math"
+	"siro-backend/internal/models"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a cursor that can't be decoded or belongs to another sort order
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ErrCursorSort is returned when cursor pagination is used with a sort it can't follow
+var ErrCursorSort = errors.New("cursor pagination only supports sorting by created_at or updated_at")
+
+// Page selects one page of a list
+//
+// Offset mode (default): Number and Limit, with a COUNT(*) for total_items / total_pages
+// Cursor mode: Cursor is "" for the first page, then next_cursor / prev_cursor from the last response
+// Items are found by (timestamp, id), so new rows don't shift the pages and no COUNT(*) is needed
+type Page struct {
+	Number int
+	Limit  int
+
+	CursorMode   bool
+	Cursor       string
+	IncludeTotal bool // also count the total in cursor mode (slower)
+}
+
+// offset returns the OFFSET of an offset-mode page
+func (p Page) offset() int {
+	return (p.Number - 1) * p.Limit
+}
+
+// offsetMeta builds the meta of an offset-mode page
+func (p Page) offsetMeta(totalItems int) models.PaginationMeta {
+	totalPages := int(math.Ceil(float64(totalItems) / float64(p.Limit)))
+	return models.PaginationMeta{
+		CurrentPage: p.Number,
+		TotalPages:  &totalPages,
+		TotalItems:  &totalItems,
+		Limit:       p.Limit,
+	}
+}
+
+// cursor is the position of one row; it is sent to clients base64-encoded, so they treat it as opaque
+type cursor struct {
+	Sort     string    `json:"s"`           // sort the cursor was made for, e.g. "-created_at"
+	Time     time.Time `json:"t"`           // timestamp of the row
+	ID       uint      `json:"i"`           // id of the row (tie-breaker for equal timestamps)
+	Backward bool      `json:"b,omitempty"` // true for prev_cursor
+}
+
+func (c cursor) encode() string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(s, sort string) (*cursor, error) {
+	if s == "" {
+		return nil, nil
+	}
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil || c.Sort != sort {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// keyset builds the WHERE / ORDER BY parts of a cursor-mode query
+// timeCol and idCol are the columns the cursor points at, e.g. "w.created_at" and "w.id"
+type keyset struct {
+	sort    string // "created_at" or "-created_at"
+	timeCol string
+	idCol   string
+	desc    bool
+	cursor  *cursor
+	// timeArg converts the cursor time to a query argument; nil passes it as is
+	// (the driver writes it in the zone of the connection)
+	timeArg func(time.Time) interface{}
+}
+
+func newKeyset(page Page, sort, timeCol, idCol string, desc bool) (keyset, error) {
+	c, err := decodeCursor(page.Cursor, sort)
+	if err != nil {
+		return keyset{}, err
+	}
+	return keyset{sort: sort, timeCol: timeCol, idCol: idCol, desc: desc, cursor: c}, nil
+}
+
+// backward is true when reading the page before the cursor
+func (k keyset) backward() bool {
+	return k.cursor != nil && k.cursor.Backward
+}
+
+// addCondition adds "rows after the cursor" (in reading direction) to where
+func (k keyset) addCondition(where *conditions) {
+	if k.cursor == nil {
+		return
+	}
+	// Going forward in a DESC list, or backward in an ASC list, means smaller values
+	op := ">"
+	if k.desc != k.backward() {
+		op = "<"
+	}
+	var t interface{} = k.cursor.Time
+	if k.timeArg != nil {
+		t = k.timeArg(k.cursor.Time)
+	}
+	where.add("("+k.timeCol+" "+op+" ? OR ("+k.timeCol+" = ? AND "+k.idCol+" "+op+" ?))", t, t, k.cursor.ID)
+}
+
+// orderBy returns the ORDER BY clause; reversed when reading backward
+func (k keyset) orderBy() string {
+	dir := "ASC"
+	if k.desc != k.backward() {
+		dir = "DESC"
+	}
+	return " ORDER BY " + k.timeCol + " " + dir + ", " + k.idCol + " " + dir
+}
+
+// keysetPage trims the limit+1 rows that were read, restores the display order
+// and builds next_cursor / prev_cursor
+// key returns the (timestamp, id) of an item
+func keysetPage[T any](items []T, k keyset, limit int, key func(T) (time.Time, uint)) ([]T, models.PaginationMeta) {
+	more := len(items) > limit
+	if more {
+		items = items[:limit]
+	}
+	if k.backward() {
+		for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+			items[i], items[j] = items[j], items[i]
+		}
+	}
+
+	meta := models.PaginationMeta{Limit: limit}
+	if len(items) == 0 {
+		return items, meta
+	}
+
+	makeCursor := func(item T, backward bool) string {
+		t, id := key(item)
+		return cursor{Sort: k.sort, Time: t, ID: id, Backward: backward}.encode()
+	}
+
+	// There is a next page if we read forward and found more, or if we came back from it
+	if more || k.backward() {
+		meta.NextCursor = makeCursor(items[len(items)-1], false)
+	}
+	// There is a previous page if we came from one, or read backward and found more
+	if (k.cursor != nil && !k.backward()) || (k.backward() && more) {
+		meta.PrevCursor = makeCursor(items[0], true)
+	}
+	return items, meta
+}
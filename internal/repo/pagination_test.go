@@ -0,0 +1,277 @@
+package repo
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	jakarta := time.FixedZone("WIB", 7*3600)
+	tests := []cursor{
+		{Sort: "-created_at", Time: time.Date(2026, 10, 19, 8, 30, 0, 123456000, time.UTC), ID: 42},
+		{Sort: "updated_at", Time: time.Date(2026, 1, 2, 3, 4, 5, 999999999, jakarta), ID: 1, Backward: true},
+		{Sort: "-timestamp", Time: time.Time{}, ID: 0},
+	}
+	for _, c := range tests {
+		s := c.encode()
+		if strings.ContainsAny(s, "+/=") {
+			t.Errorf("cursor %q is not URL-safe", s)
+		}
+		got, err := decodeCursor(s, c.Sort)
+		if err != nil {
+			t.Fatalf("decodeCursor(%q): %v", s, err)
+		}
+		if !got.Time.Equal(c.Time) || got.ID != c.ID || got.Sort != c.Sort || got.Backward != c.Backward {
+			t.Errorf("decodeCursor(encode(%+v)) = %+v", c, *got)
+		}
+	}
+
+	if c, err := decodeCursor("", "-created_at"); c != nil || err != nil {
+		t.Errorf(`decodeCursor("") = %v, %v, want nil, nil`, c, err)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	valid := cursor{Sort: "-created_at", Time: time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC), ID: 7}.encode()
+	raw := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	tests := map[string]string{
+		"not base64":               "!!!",
+		"base64 with padding":      base64.URLEncoding.EncodeToString([]byte(`{"s":"-created_at","t":"2026-10-19T08:00:00Z","i":7}`)),
+		"cut short":                valid[:len(valid)/2],
+		"one character changed":    strings.Replace(valid, valid[:1], string(valid[0]^1), 1),
+		"not JSON":                 raw("nope"),
+		"JSON array":               raw(`[1, 2]`),
+		"sort of the wrong type":   raw(`{"s":1}`),
+		"time of the wrong type":   raw(`{"s":"-created_at","t":"yesterday","i":7}`),
+		"negative id":              raw(`{"s":"-created_at","t":"2026-10-19T08:00:00Z","i":-1}`),
+		"made for another sort":    cursor{Sort: "created_at", Time: time.Now(), ID: 7}.encode(),
+		"sort changed by hand":     raw(`{"s":"-updated_at","t":"2026-10-19T08:00:00Z","i":7}`),
+		"sort missing":             raw(`{"t":"2026-10-19T08:00:00Z","i":7}`),
+		"sort in a different case": raw(`{"s":"-CREATED_AT","t":"2026-10-19T08:00:00Z","i":7}`),
+	}
+	for name, s := range tests {
+		c, err := decodeCursor(s, "-created_at")
+		if !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: decodeCursor(%q) = %+v, %v, want ErrInvalidCursor", name, s, c, err)
+		}
+	}
+
+	if _, err := newKeyset(Page{CursorMode: true, Cursor: "!!!"}, "-created_at", "created_at", "id", true); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("newKeyset with a garbage cursor: err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestKeysetSQL(t *testing.T) {
+	at := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name     string
+		desc     bool
+		cursor   *cursor
+		where    string
+		orderBy  string
+		wantArgs []interface{}
+	}{
+		{"first page, newest first", true, nil, "", " ORDER BY w.created_at DESC, w.id DESC", nil},
+		{"first page, oldest first", false, nil, "", " ORDER BY w.created_at ASC, w.id ASC", nil},
+		{
+			"next page, newest first", true, &cursor{Time: at, ID: 5},
+			" WHERE (w.created_at < ? OR (w.created_at = ? AND w.id < ?))", " ORDER BY w.created_at DESC, w.id DESC",
+			[]interface{}{at, at, uint(5)},
+		},
+		{
+			"previous page, newest first", true, &cursor{Time: at, ID: 5, Backward: true},
+			" WHERE (w.created_at > ? OR (w.created_at = ? AND w.id > ?))", " ORDER BY w.created_at ASC, w.id ASC",
+			[]interface{}{at, at, uint(5)},
+		},
+		{
+			"next page, oldest first", false, &cursor{Time: at, ID: 5},
+			" WHERE (w.created_at > ? OR (w.created_at = ? AND w.id > ?))", " ORDER BY w.created_at ASC, w.id ASC",
+			[]interface{}{at, at, uint(5)},
+		},
+		{
+			"previous page, oldest first", false, &cursor{Time: at, ID: 5, Backward: true},
+			" WHERE (w.created_at < ? OR (w.created_at = ? AND w.id < ?))", " ORDER BY w.created_at DESC, w.id DESC",
+			[]interface{}{at, at, uint(5)},
+		},
+	}
+	for _, tt := range tests {
+		k := keyset{timeCol: "w.created_at", idCol: "w.id", desc: tt.desc, cursor: tt.cursor}
+		var where conditions
+		k.addCondition(&where)
+		if where.sql() != tt.where || !reflect.DeepEqual(where.args, tt.wantArgs) {
+			t.Errorf("%s: where = %q %v, want %q %v", tt.name, where.sql(), where.args, tt.where, tt.wantArgs)
+		}
+		if got := k.orderBy(); got != tt.orderBy {
+			t.Errorf("%s: orderBy = %q, want %q", tt.name, got, tt.orderBy)
+		}
+	}
+
+	// timeArg converts the cursor time, as the audit log does
+	k := keyset{timeCol: "created_at", idCol: "id", desc: true, cursor: &cursor{Time: at, ID: 5},
+		timeArg: func(t time.Time) interface{} { return t.Format(time.DateTime) }}
+	var where conditions
+	k.addCondition(&where)
+	if want := []interface{}{"2026-10-19 08:00:00", "2026-10-19 08:00:00", uint(5)}; !reflect.DeepEqual(where.args, want) {
+		t.Errorf("args with timeArg = %v, want %v", where.args, want)
+	}
+}
+
+// pageRow is a row of the list the paging tests walk through
+type pageRow struct {
+	at time.Time
+	id uint
+}
+
+func (r pageRow) String() string { return fmt.Sprintf("%d@%s", r.id, r.at.Format("15:04")) }
+
+func pageRowKey(r pageRow) (time.Time, uint) { return r.at, r.id }
+
+// selectPage runs the keyset query on rows like MySQL would: the WHERE built by addCondition,
+// the ORDER BY from orderBy and LIMIT limit+1
+func selectPage(t *testing.T, rows []pageRow, k keyset, limit int) []pageRow {
+	t.Helper()
+	var where conditions
+	k.addCondition(&where)
+
+	var out []pageRow
+	for _, r := range rows {
+		if len(where.parts) > 0 {
+			at, id := where.args[0].(time.Time), where.args[2].(uint)
+			less := r.at.Before(at) || (r.at.Equal(at) && r.id < id)
+			greater := r.at.After(at) || (r.at.Equal(at) && r.id > id)
+			switch {
+			case strings.Contains(where.sql(), "< ?") && !less:
+				continue
+			case strings.Contains(where.sql(), "> ?") && !greater:
+				continue
+			}
+		}
+		out = append(out, r)
+	}
+
+	desc := strings.HasSuffix(k.orderBy(), "DESC")
+	sort.Slice(out, func(i, j int) bool {
+		a, b := out[i], out[j]
+		if !a.at.Equal(b.at) {
+			return a.at.Before(b.at) != desc
+		}
+		return (a.id < b.id) != desc
+	})
+	if len(out) > limit+1 {
+		out = out[:limit+1]
+	}
+	return out
+}
+
+func TestKeysetPaging(t *testing.T) {
+	base := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	at := func(minutes int) time.Time { return base.Add(time.Duration(minutes) * time.Minute) }
+	// Many rows share a timestamp, and ids don't follow the time order
+	rows := []pageRow{
+		{at(0), 4}, {at(0), 2}, {at(0), 9}, {at(5), 1}, {at(5), 3}, {at(5), 8}, {at(5), 6}, {at(10), 5}, {at(20), 7},
+	}
+
+	for _, desc := range []bool{true, false} {
+		sortName := "created_at"
+		if desc {
+			sortName = "-created_at"
+		}
+		// The whole list in display order
+		all := selectPage(t, rows, keyset{timeCol: "created_at", idCol: "id", desc: desc}, len(rows))
+
+		for _, limit := range []int{1, 2, 3, 4, 8, 9, 10} {
+			t.Run(fmt.Sprintf("%s limit %d", sortName, limit), func(t *testing.T) {
+				read := func(cursor string) ([]pageRow, string, string) {
+					t.Helper()
+					k, err := newKeyset(Page{CursorMode: true, Cursor: cursor, Limit: limit}, sortName, "created_at", "id", desc)
+					if err != nil {
+						t.Fatal(err)
+					}
+					items, meta := keysetPage(selectPage(t, rows, k, limit), k, limit, pageRowKey)
+					if meta.Limit != limit {
+						t.Errorf("meta.limit = %d, want %d", meta.Limit, limit)
+					}
+					return items, meta.NextCursor, meta.PrevCursor
+				}
+
+				// Forward from the first page to the last
+				var pages [][]pageRow
+				var seen []pageRow
+				prevCursors := []string{}
+				next := ""
+				for i := 0; ; i++ {
+					if i > len(rows) {
+						t.Fatal("next_cursor never ends")
+					}
+					items, nextCursor, prevCursor := read(next)
+					if i == 0 && prevCursor != "" {
+						t.Errorf("first page has prev_cursor")
+					}
+					if i > 0 && prevCursor == "" {
+						t.Errorf("page %d has no prev_cursor", i+1)
+					}
+					if len(items) == 0 || len(items) > limit {
+						t.Fatalf("page %d has %d items", i+1, len(items))
+					}
+					pages = append(pages, items)
+					prevCursors = append(prevCursors, prevCursor)
+					seen = append(seen, items...)
+					if nextCursor == "" {
+						break
+					}
+					if len(items) != limit {
+						t.Errorf("page %d has next_cursor but only %d items", i+1, len(items))
+					}
+					next = nextCursor
+				}
+				if !reflect.DeepEqual(seen, all) {
+					t.Fatalf("pages %v, want every row once in order %v", pages, all)
+				}
+				if want := (len(rows) + limit - 1) / limit; len(pages) != want {
+					t.Errorf("%d pages, want %d", len(pages), want)
+				}
+
+				// Backward from the last page to the first, then forward again
+				for i := len(pages) - 1; i > 0; i-- {
+					items, nextCursor, prevCursor := read(prevCursors[i])
+					if !reflect.DeepEqual(items, pages[i-1]) {
+						t.Errorf("prev_cursor of page %d gives %v, want %v", i+1, items, pages[i-1])
+					}
+					if nextCursor == "" {
+						t.Errorf("page %d read backward has no next_cursor", i)
+					}
+					if (i-1 == 0) != (prevCursor == "") {
+						t.Errorf("page %d read backward: prev_cursor %q", i, prevCursor)
+					}
+					if again, _, _ := read(nextCursor); !reflect.DeepEqual(again, pages[i]) {
+						t.Errorf("next_cursor of page %d read backward gives %v, want %v", i, again, pages[i])
+					}
+				}
+			})
+		}
+	}
+
+	t.Run("empty list", func(t *testing.T) {
+		k, _ := newKeyset(Page{CursorMode: true, Limit: 5}, "-created_at", "created_at", "id", true)
+		items, meta := keysetPage([]pageRow{}, k, 5, pageRowKey)
+		if len(items) != 0 || meta.NextCursor != "" || meta.PrevCursor != "" || meta.Limit != 5 {
+			t.Errorf("empty list: %v %+v", items, meta)
+		}
+	})
+
+	t.Run("past the last row", func(t *testing.T) {
+		last := cursor{Sort: "-created_at", Time: at(0), ID: 2}.encode()
+		k, _ := newKeyset(Page{CursorMode: true, Cursor: last, Limit: 5}, "-created_at", "created_at", "id", true)
+		items, meta := keysetPage(selectPage(t, rows, k, 5), k, 5, pageRowKey)
+		if len(items) != 0 || meta.NextCursor != "" || meta.PrevCursor != "" {
+			t.Errorf("after the last row: %v %+v", items, meta)
+		}
+	})
+}
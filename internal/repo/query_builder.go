@@ -0,0 +1,96 @@
+package repo
+
+import (
+	"fmt"
+	"strings"
+)
+
+// conditions collects the parts of a WHERE clause together with their arguments
+// Values are always passed as ? placeholders, never pasted into the SQL
+//
+//	var where conditions
+//	where.add("w.unit = ?", unit)
+//	where.in("w.status", statuses)
+//	rows, err := db.Query("SELECT ... FROM work_orders w"+where.sql(), where.args...)
+type conditions struct {
+	parts []string
+	args  []interface{}
+}
+
+// add appends one condition, e.g. add("w.created_at >= ?", from)
+func (c *conditions) add(cond string, args ...interface{}) {
+	c.parts = append(c.parts, cond)
+	c.args = append(c.args, args...)
+}
+
+// in appends "column IN (?, ?, ...)"; does nothing when values is empty
+func (c *conditions) in(column string, values []string) {
+	if len(values) == 0 {
+		return
+	}
+	c.add(column+" IN ("+placeholders(len(values))+")", toArgs(values)...)
+}
+
+// sql returns " WHERE a AND b", or "" when there are no conditions
+func (c *conditions) sql() string {
+	if len(c.parts) == 0 {
+		return ""
+	}
+	return " WHERE " + strings.Join(c.parts, " AND ")
+}
+
+// sortExpr is an ORDER BY expression that may need arguments
+type sortExpr struct {
+	sql  string
+	args []interface{}
+}
+
+// ordering collects ORDER BY expressions, like conditions does for WHERE
+type ordering struct {
+	parts []string
+	args  []interface{}
+}
+
+func (o *ordering) add(expr sortExpr, desc bool) {
+	dir := " ASC"
+	if desc {
+		dir = " DESC"
+	}
+	o.parts = append(o.parts, expr.sql+dir)
+	o.args = append(o.args, expr.args...)
+}
+
+// addSorts adds "field" / "-field" entries; only fields in allowed are accepted
+func (o *ordering) addSorts(sorts []string, allowed map[string]sortExpr) error {
+	for _, s := range sorts {
+		desc := strings.HasPrefix(s, "-")
+		expr, ok := allowed[strings.TrimPrefix(s, "-")]
+		if !ok {
+			return fmt.Errorf("cannot sort by %q", s)
+		}
+		o.add(expr, desc)
+	}
+	return nil
+}
+
+// sql returns " ORDER BY a, b", or "" when empty
+func (o *ordering) sql() string {
+	if len(o.parts) == 0 {
+		return ""
+	}
+	return " ORDER BY " + strings.Join(o.parts, ", ")
+}
+
+// placeholders returns "?, ?, ?" for n values
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// toArgs converts strings to query arguments
+func toArgs(values []string) []interface{} {
+	args := make([]interface{}, len(values))
+	for i, v := range values {
+		args[i] = v
+	}
+	return args
+}
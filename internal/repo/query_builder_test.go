@@ -0,0 +1,63 @@
+package repo
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestConditions(t *testing.T) {
+	var c conditions
+	if c.sql() != "" || c.args != nil {
+		t.Errorf("empty: %q %v", c.sql(), c.args)
+	}
+
+	c.add("w.unit = ?", "IT")
+	c.in("w.status", nil)
+	c.add("w.assignee_id IS NULL")
+	c.in("w.priority", []string{"High", "Low"})
+	c.add("w.created_at BETWEEN ? AND ?", 1, 2)
+
+	if want := " WHERE w.unit = ? AND w.assignee_id IS NULL AND w.priority IN (?, ?) AND w.created_at BETWEEN ? AND ?"; c.sql() != want {
+		t.Errorf("sql %q, want %q", c.sql(), want)
+	}
+	if want := []interface{}{"IT", "High", "Low", 1, 2}; !reflect.DeepEqual(c.args, want) {
+		t.Errorf("args %v, want %v", c.args, want)
+	}
+}
+
+func TestOrdering(t *testing.T) {
+	allowed := map[string]sortExpr{
+		"name":  {sql: "u.name"},
+		"first": {sql: "FIELD(u.role, ?, ?)", args: []interface{}{"Admin", "Staff"}},
+	}
+
+	var o ordering
+	if o.sql() != "" {
+		t.Errorf("empty: %q", o.sql())
+	}
+	if err := o.addSorts([]string{"-first", "name"}, allowed); err != nil {
+		t.Fatal(err)
+	}
+	o.add(sortExpr{sql: "u.id"}, true)
+	if want := " ORDER BY FIELD(u.role, ?, ?) DESC, u.name ASC, u.id DESC"; o.sql() != want {
+		t.Errorf("sql %q, want %q", o.sql(), want)
+	}
+	if want := []interface{}{"Admin", "Staff"}; !reflect.DeepEqual(o.args, want) {
+		t.Errorf("args %v, want %v", o.args, want)
+	}
+
+	for _, bad := range []string{"email", "--name", "+name", "name ", "u.name", "name; DROP TABLE users", ""} {
+		var o ordering
+		if err := o.addSorts([]string{"name", bad}, allowed); err == nil {
+			t.Errorf("sort %q accepted", bad)
+		}
+	}
+}
+
+func TestPlaceholders(t *testing.T) {
+	for n, want := range map[int]string{0: "", 1: "?", 3: "?, ?, ?"} {
+		if got := placeholders(n); got != want {
+			t.Errorf("placeholders(%d) = %q, want %q", n, got, want)
+		}
+	}
+}
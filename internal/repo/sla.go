@@ -0,0 +1,65 @@
+package repo
+
+import (
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/config"
+	"time"
+)
+
+// slaTargets is how long an open work order may stay unfinished, per priority
+// Set once at startup by InitSLA
+var slaTargets = map[string]time.Duration{
+	global.PriorityHigh:   4 * time.Hour,
+	global.PriorityMedium: 24 * time.Hour,
+	global.PriorityLow:    72 * time.Hour,
+}
+
+// InitSLA sets the SLA targets from the config
+func InitSLA(cfg config.SLAConfig) {
+	slaTargets = map[string]time.Duration{
+		global.PriorityHigh:   cfg.High.Duration,
+		global.PriorityMedium: cfg.Medium.Duration,
+		global.PriorityLow:    cfg.Low.Duration,
+	}
+}
+
+// SLATarget returns the allowed time for a priority (unknown priorities use the Low target)
+func SLATarget(priority string) time.Duration {
+	if d, ok := slaTargets[priority]; ok {
+		return d
+	}
+	return slaTargets[global.PriorityLow]
+}
+
+// SLABreached reports whether wo breached its SLA: it was completed after its due time
+// (created_at + the target of its priority), or it is still open at now and past it
+// A completed work order without a completion time counts as on time
+// This is the one definition of a breach: the sla_breached list filter (slaBreachCondition),
+// the workorders_sla_breached gauge (open work orders only) and the timeline all follow it
+func SLABreached(wo models.WorkOrder, now time.Time) bool {
+	due := wo.CreatedAt.Add(SLATarget(wo.Priority))
+	if wo.Status == global.StatusCompleted {
+		return wo.CompletedAt != nil && wo.CompletedAt.After(due)
+	}
+	return now.After(due)
+}
+
+// slaBreachCondition returns SLABreached as a SQL condition (for alias "w")
+func slaBreachCondition() (string, []interface{}) {
+	target, targetArgs := slaTargetExpr()
+	cond := `TIMESTAMPDIFF(SECOND, w.created_at, CASE WHEN w.status = ? THEN COALESCE(w.completed_at, w.created_at) ELSE NOW() END) > ` + target
+	args := append([]interface{}{global.StatusCompleted}, targetArgs...)
+	return cond, args
+}
+
+// slaTargetExpr returns a SQL expression (for alias "w") with the SLA target in seconds
+func slaTargetExpr() (string, []interface{}) {
+	expr := `CASE w.priority WHEN ? THEN ? WHEN ? THEN ? ELSE ? END`
+	args := []interface{}{
+		global.PriorityHigh, int64(SLATarget(global.PriorityHigh).Seconds()),
+		global.PriorityMedium, int64(SLATarget(global.PriorityMedium).Seconds()),
+		int64(SLATarget(global.PriorityLow).Seconds()),
+	}
+	return expr, args
+}
@@ -0,0 +1,94 @@
+package repo
+
+import (
+	"reflect"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"testing"
+	"time"
+)
+
+func TestSLATarget(t *testing.T) {
+	for priority, want := range map[string]time.Duration{
+		global.PriorityHigh:   4 * time.Hour,
+		global.PriorityMedium: 24 * time.Hour,
+		global.PriorityLow:    72 * time.Hour,
+		"Urgent":              72 * time.Hour, // unknown priorities use the Low target
+	} {
+		if got := SLATarget(priority); got != want {
+			t.Errorf("SLATarget(%s) = %v, want %v", priority, got, want)
+		}
+	}
+}
+
+func TestSLABreached(t *testing.T) {
+	created := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC) // High: due at 12:00
+	at := func(hour, min int) *time.Time {
+		t := time.Date(2026, 10, 19, hour, min, 0, 0, time.UTC)
+		return &t
+	}
+	tests := []struct {
+		name     string
+		status   string
+		priority string
+		done     *time.Time
+		now      time.Time
+		want     bool
+	}{
+		{"open, before due", global.StatusPending, global.PriorityHigh, nil, *at(11, 59), false},
+		{"open, exactly due", global.StatusInProgress, global.PriorityHigh, nil, *at(12, 0), false},
+		{"open, past due", global.StatusInProgress, global.PriorityHigh, nil, *at(12, 1), true},
+		{"open, past due of another priority", global.StatusPending, global.PriorityMedium, nil, *at(12, 1), false},
+		{"completed on time, looked at later", global.StatusCompleted, global.PriorityHigh, at(11, 0), *at(23, 0), false},
+		{"completed late", global.StatusCompleted, global.PriorityHigh, at(12, 30), *at(13, 0), true},
+		{"completed without a completion time", global.StatusCompleted, global.PriorityHigh, nil, *at(23, 0), false},
+	}
+	for _, tt := range tests {
+		wo := models.WorkOrder{Status: tt.status, Priority: tt.priority, CreatedAt: created, CompletedAt: tt.done}
+		if got := SLABreached(wo, tt.now); got != tt.want {
+			t.Errorf("%s: SLABreached = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSLABreachCondition(t *testing.T) {
+	cond, args := slaBreachCondition()
+	want := "TIMESTAMPDIFF(SECOND, w.created_at, CASE WHEN w.status = ? THEN COALESCE(w.completed_at, w.created_at) ELSE NOW() END) > " +
+		"CASE w.priority WHEN ? THEN ? WHEN ? THEN ? ELSE ? END"
+	if cond != want {
+		t.Errorf("condition\n%s\nwant\n%s", cond, want)
+	}
+	wantArgs := []interface{}{global.StatusCompleted, global.PriorityHigh, int64(4 * 3600), global.PriorityMedium, int64(24 * 3600), int64(72 * 3600)}
+	if !reflect.DeepEqual(args, wantArgs) {
+		t.Errorf("args %v, want %v", args, wantArgs)
+	}
+}
+
+// The timeline shows a breach exactly when the sla_breached filter would list the work order
+func TestTimelineSLABreach(t *testing.T) {
+	created := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	late := created.Add(5 * time.Hour)
+	onTime := created.Add(time.Hour)
+	now := created.Add(48 * time.Hour)
+
+	for _, done := range []*time.Time{nil, &onTime, &late} {
+		wo := models.WorkOrder{ID: 1, Status: global.StatusInProgress, Priority: global.PriorityHigh, CreatedAt: created, CompletedAt: done}
+		if done != nil {
+			wo.Status = global.StatusCompleted
+		}
+		wo.DueAt = created.Add(SLATarget(wo.Priority))
+
+		var flagged bool
+		for _, e := range buildTimeline(wo, nil, now) {
+			if e.Type == EventSLABreached {
+				flagged = true
+				if !e.At.Equal(wo.DueAt) || e.Message != "SLA target of 4h for High priority exceeded" {
+					t.Errorf("breach event %+v", e)
+				}
+			}
+		}
+		if flagged != SLABreached(wo, now) {
+			t.Errorf("completed at %v: timeline breach %v, SLABreached %v", done, flagged, SLABreached(wo, now))
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+)
+
+// insertTags saves the tags of a new work order inside the caller's transaction
+func insertTags(ctx context.Context, tx *sql.Tx, woID uint, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	ctx, span := startQuery(ctx, "work_order_tags.insert")
+
+	query := "INSERT IGNORE INTO work_order_tags (work_order_id, tag) VALUES "
+	args := make([]interface{}, 0, len(tags)*2)
+	for i, tag := range tags {
+		if i > 0 {
+			query += ", "
+		}
+		query += "(?, ?)"
+		args = append(args, woID, tag)
+	}
+
+	res, err := tx.ExecContext(ctx, query, args...)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+// loadTags fills the Tags of the given work orders with a single query
+func loadTags(ctx context.Context, wos []models.WorkOrder) error {
+	if len(wos) == 0 {
+		return nil
+	}
+	ctx, span := startQuery(ctx, "work_order_tags.list")
+
+	index := make(map[uint]int, len(wos))
+	args := make([]interface{}, len(wos))
+	for i, wo := range wos {
+		index[wo.ID] = i
+		args[i] = wo.ID
+	}
+
+	rows, err := setting.DB.QueryContext(ctx,
+		"SELECT work_order_id, tag FROM work_order_tags WHERE work_order_id IN ("+placeholders(len(wos))+") ORDER BY tag", args...)
+	if err != nil {
+		endQuery(span, 0, err)
+		return err
+	}
+	defer rows.Close()
+
+	var n int64
+	for rows.Next() {
+		var id uint
+		var tag string
+		if err := rows.Scan(&id, &tag); err != nil {
+			endQuery(span, n, err)
+			return err
+		}
+		if i, ok := index[id]; ok {
+			wos[i].Tags = append(wos[i].Tags, tag)
+		}
+		n++
+	}
+	endQuery(span, n, rows.Err())
+	return rows.Err()
+}
+
+// GetTags returns all tags in use, for autocomplete in the frontend
+func GetTags(ctx context.Context, viewer Viewer) ([]string, error) {
+	var where conditions
+	viewer.addCondition(&where)
+
+	ctx, span := startQuery(ctx, "work_order_tags.distinct")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT DISTINCT t.tag FROM work_order_tags t
+		INNER JOIN work_orders w ON t.work_order_id = w.id
+		LEFT JOIN users req ON w.requester_id = req.id`+where.sql()+" ORDER BY t.tag", where.args...)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []string{}
+	for rows.Next() {
+		var tag string
+		if err := rows.Scan(&tag); err == nil {
+			tags = append(tags, tag)
+		}
+	}
+	endQuery(span, int64(len(tags)), rows.Err())
+	return tags, rows.Err()
+}
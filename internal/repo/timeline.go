@@ -0,0 +1,167 @@
+package repo
+
+import (
+	"context"
+	"fmt"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Timeline event types
+const (
+	EventCreated     = "created"
+	EventTaken       = "taken"
+	EventAssigned    = "assigned"
+	EventCompleted   = "completed"
+	EventAttachment  = "attachment"
+	EventSLABreached = "sla_breached"
+	EventActivity    = "activity" // any other activity log entry
+)
+
+// GetWorkOrderDetail returns a work order with the full requester, assignee and completer
+// and its timeline (see buildTimeline)
+func GetWorkOrderDetail(ctx context.Context, id uint) (models.WorkOrder, error) {
+	wo, err := GetWorkOrderById(ctx, id)
+	if err != nil {
+		return wo, err
+	}
+
+	// The list query only joins a few user columns; the detail view shows everything
+	if u, err := GetUserByID(ctx, wo.RequesterID); err == nil {
+		wo.RequesterData = *u
+	}
+	if wo.AssigneeID != nil {
+		if u, err := GetUserByID(ctx, *wo.AssigneeID); err == nil {
+			wo.Assignee = *u
+		}
+	}
+	if wo.CompletedByID != nil {
+		if u, err := GetUserByID(ctx, *wo.CompletedByID); err == nil {
+			wo.CompletedBy = *u
+		}
+	}
+
+	logs, err := getWorkOrderActivities(ctx, id)
+	if err != nil {
+		return wo, err
+	}
+	wo.Timeline = buildTimeline(wo, logs, time.Now())
+	return wo, nil
+}
+
+// getWorkOrderActivities returns the activity logs of one work order, oldest first
+func getWorkOrderActivities(ctx context.Context, woID uint) ([]models.ActivityLog, error) {
+	ctx, span := startQuery(ctx, "activity_logs.by_request")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT id, user_id, user_name, action, request_id, details, status, timestamp
+		FROM activity_logs WHERE request_id = ? ORDER BY timestamp, id`, woID)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var logs []models.ActivityLog
+	for rows.Next() {
+		var l models.ActivityLog
+		if err := rows.Scan(&l.ID, &l.UserID, &l.UserName, &l.Action, &l.RequestID, &l.Details, &l.Status, &l.Timestamp); err == nil {
+			logs = append(logs, l)
+		}
+	}
+	endQuery(span, int64(len(logs)), rows.Err())
+	return logs, rows.Err()
+}
+
+// buildTimeline merges the activity log with events derived from the work order itself:
+// the attached photo and the moment the SLA target was exceeded
+// There are no comments yet; they can be added here once they are stored
+func buildTimeline(wo models.WorkOrder, logs []models.ActivityLog, now time.Time) []models.TimelineEvent {
+	events := make([]models.TimelineEvent, 0, len(logs)+3)
+	created := false
+
+	for _, l := range logs {
+		userID := l.UserID
+		e := models.TimelineEvent{
+			Type:    activityEventType(l.Action),
+			At:      l.Timestamp,
+			ActorID: &userID,
+			Actor:   l.UserName,
+			Message: l.UserName + " " + strings.TrimSuffix(l.Action, ":"),
+			Status:  l.Status,
+		}
+		if e.Type == EventCreated {
+			created = true
+		}
+		if e.Type == EventCompleted && wo.CompletionNote != "" {
+			e.Message += ": " + wo.CompletionNote
+		}
+		events = append(events, e)
+	}
+
+	// Activity logs are written in the background and may be missing for old rows
+	if !created {
+		requesterID := wo.RequesterID
+		events = append(events, models.TimelineEvent{
+			Type:    EventCreated,
+			At:      wo.CreatedAt,
+			ActorID: &requesterID,
+			Actor:   wo.RequesterData.Name,
+			Message: fmt.Sprintf("%s created request to %s", wo.RequesterData.Name, wo.Unit),
+		})
+	}
+
+	if wo.PhotoURL != "" {
+		requesterID := wo.RequesterID
+		events = append(events, models.TimelineEvent{
+			Type:    EventAttachment,
+			At:      wo.CreatedAt,
+			ActorID: &requesterID,
+			Actor:   wo.RequesterData.Name,
+			Message: wo.RequesterData.Name + " attached a photo",
+			URL:     wo.PhotoURL,
+		})
+	}
+
+	if SLABreached(wo, now) {
+		events = append(events, models.TimelineEvent{
+			Type:    EventSLABreached,
+			At:      wo.DueAt,
+			Message: fmt.Sprintf("SLA target of %s for %s priority exceeded", shortDuration(SLATarget(wo.Priority)), wo.Priority),
+		})
+	}
+
+	// Stable, so events with the same time keep the order above (e.g. created before attachment)
+	sort.SliceStable(events, func(i, j int) bool { return events[i].At.Before(events[j].At) })
+	return events
+}
+
+// activityEventType maps the free-text action of an activity log to a timeline event type
+func activityEventType(action string) string {
+	switch {
+	case strings.HasPrefix(action, "created"):
+		return EventCreated
+	case strings.HasPrefix(action, "is working on"):
+		return EventTaken
+	case strings.HasPrefix(action, "assigned"):
+		return EventAssigned
+	case strings.HasPrefix(action, "completed"):
+		return EventCompleted
+	}
+	return EventActivity
+}
+
+// shortDuration formats 24h0m0s as 24h, 1h30m0s as 1h30m and 30m0s as 30m (seconds are dropped)
+func shortDuration(d time.Duration) string {
+	hours := int(d.Hours())
+	minutes := int(d.Minutes()) % 60
+	switch {
+	case hours > 0 && minutes > 0:
+		return fmt.Sprintf("%dh%dm", hours, minutes)
+	case hours > 0:
+		return fmt.Sprintf("%dh", hours)
+	default:
+		return fmt.Sprintf("%dm", minutes)
+	}
+}
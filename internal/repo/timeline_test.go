@@ -0,0 +1,27 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestShortDuration(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{10 * time.Minute, "10m"},
+		{30 * time.Minute, "30m"},
+		{90 * time.Minute, "1h30m"},
+		{4 * time.Hour, "4h"},
+		{24 * time.Hour, "24h"},
+		{72 * time.Hour, "72h"},
+		{100 * time.Minute, "1h40m"},
+		{0, "0m"},
+	}
+	for _, tt := range tests {
+		if got := shortDuration(tt.d); got != tt.want {
+			t.Errorf("shortDuration(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
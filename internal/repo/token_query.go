@@ -1,43 +1,57 @@
 package repo
 
 import (
+	"context"
+	"crypto/subtle"
 	"database/sql"
 	"siro-backend/pkg/setting"
 	"time"
 )
 
-// SaveToken: Menyimpan token baru atau mengupdate yang lama (Login/Register)
-func SaveToken(userID uint, access, refresh string, atExp, rtExp time.Time) error {
+// SaveToken: Menyimpan sesi baru atau mengganti yang lama (Login/Register)
+// Only the token IDs (jti) are stored, so a copy of the table holds no usable tokens
+func SaveToken(ctx context.Context, userID uint, accessJTI, refreshJTI string, atExp, rtExp time.Time) error {
+	ctx, span := startQuery(ctx, "user_tokens.save")
 	// Fitur spesial MySQL: Insert Or Update (Upsert)
-	query := `INSERT INTO user_tokens (user_id, access_token, refresh_token, at_expires_at, rt_expires_at)
+	query := `INSERT INTO user_tokens (user_id, access_jti, refresh_jti, at_expires_at, rt_expires_at)
 			  VALUES (?, ?, ?, ?, ?)
 			  ON DUPLICATE KEY UPDATE 
-			  access_token = VALUES(access_token), 
-			  refresh_token = VALUES(refresh_token),
+			  access_jti = VALUES(access_jti), 
+			  refresh_jti = VALUES(refresh_jti),
 			  at_expires_at = VALUES(at_expires_at), 
 			  rt_expires_at = VALUES(rt_expires_at)`
 
-	_, err := setting.DB.Exec(query, userID, access, refresh, atExp, rtExp)
+	res, err := setting.DB.ExecContext(ctx, query, userID, accessJTI, refreshJTI, atExp, rtExp)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
 
 // UpdateAccessTokenOnly: Hanya rotasi access token baru (digunakan saat Refresh Token)
-func UpdateAccessTokenOnly(userID uint, newAccess string, newAtExp time.Time) error {
-	query := `UPDATE user_tokens SET access_token = ?, at_expires_at = ? WHERE user_id = ?`
+func UpdateAccessTokenOnly(ctx context.Context, userID uint, accessJTI string, newAtExp time.Time) error {
+	ctx, span := startQuery(ctx, "user_tokens.update_access")
+	query := `UPDATE user_tokens SET access_jti = ?, at_expires_at = ? WHERE user_id = ?`
 
-	_, err := setting.DB.Exec(query, newAccess, newAtExp, userID)
+	res, err := setting.DB.ExecContext(ctx, query, accessJTI, newAtExp, userID)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
 
-// CheckRefreshTokenValid: Memeriksa apakah refresh token valid dan belum expired
-func CheckRefreshTokenValid(userID uint, refreshString string) (bool, time.Time) {
-	var dbRefreshToken string
+// sameTokenID compares token IDs in constant time; an empty ID (token without jti) never matches
+func sameTokenID(stored, jti string) bool {
+	return jti != "" && subtle.ConstantTimeCompare([]byte(stored), []byte(jti)) == 1
+}
+
+// CheckRefreshTokenValid: Memeriksa apakah refresh token (jti) masih milik sesi user dan belum expired
+func CheckRefreshTokenValid(ctx context.Context, userID uint, refreshJTI string) (bool, time.Time) {
+	ctx, span := startQuery(ctx, "user_tokens.get_refresh")
+	var dbRefreshJTI string
 	var rtExpiresAt time.Time
 
-	// Ambil refresh token & expiry dari DB
-	query := `SELECT refresh_token, rt_expires_at FROM user_tokens WHERE user_id = ?`
+	// Ambil refresh jti & expiry dari DB
+	query := `SELECT refresh_jti, rt_expires_at FROM user_tokens WHERE user_id = ?`
 
-	err := setting.DB.QueryRow(query, userID).Scan(&dbRefreshToken, &rtExpiresAt)
+	err := setting.DB.QueryRowContext(ctx, query, userID).Scan(&dbRefreshJTI, &rtExpiresAt)
+	endQuery(span, oneRow(err), err)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return false, time.Time{} // User tidak punya token session
@@ -46,30 +60,52 @@ func CheckRefreshTokenValid(userID uint, refreshString string) (bool, time.Time)
 	}
 
 	// Logic Validasi
-	isTokenMatch := (dbRefreshToken == refreshString)
+	isTokenMatch := sameTokenID(dbRefreshJTI, refreshJTI)
 	isNotExpired := time.Now().Before(rtExpiresAt)
 
 	return (isTokenMatch && isNotExpired), rtExpiresAt
 }
 
-// CheckAccessTokenValid: (Opsional) Validasi tambahan untuk middleware jika diperlukan
-// Berguna untuk fitur "Force Logout" (mendeteksi jika token di DB sudah berubah/dihapus)
-func CheckAccessTokenValid(userID uint, tokenString string) bool {
-	var dbAccessToken string
+// CheckAccessTokenValid: Validasi tambahan untuk middleware
+// Berguna untuk fitur "Force Logout" (mendeteksi jika jti di DB sudah berubah/dihapus)
+func CheckAccessTokenValid(ctx context.Context, userID uint, accessJTI string) bool {
+	ctx, span := startQuery(ctx, "user_tokens.get_access")
+	var dbAccessJTI string
 
-	query := `SELECT access_token FROM user_tokens WHERE user_id = ?`
+	query := `SELECT access_jti FROM user_tokens WHERE user_id = ?`
 
-	err := setting.DB.QueryRow(query, userID).Scan(&dbAccessToken)
+	err := setting.DB.QueryRowContext(ctx, query, userID).Scan(&dbAccessJTI)
+	endQuery(span, oneRow(err), err)
 	if err != nil {
 		return false // Token tidak ditemukan
 	}
 
-	return dbAccessToken == tokenString
+	return sameTokenID(dbAccessJTI, accessJTI)
+}
+
+// RevokeSession ends the session that issued the token with this jti (access or refresh)
+// A jti of an older, already replaced session changes nothing
+func RevokeSession(ctx context.Context, userID uint, jti string) error {
+	ctx, span := startQuery(ctx, "user_tokens.revoke")
+	res, err := setting.DB.ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = ? AND (access_jti = ? OR refresh_jti = ?)",
+		userID, jti, jti)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
+}
+
+// deleteTokensTx ends all sessions of a user inside tx
+func deleteTokensTx(ctx context.Context, tx *sql.Tx, userID uint) error {
+	ctx, span := startQuery(ctx, "user_tokens.delete")
+	res, err := tx.ExecContext(ctx, "DELETE FROM user_tokens WHERE user_id = ?", userID)
+	endQuery(span, rowsAffected(res, err), err)
+	return err
 }
 
-// DeleteToken: Untuk Logout
-func DeleteToken(userID uint) error {
+// DeleteToken ends every session of a user (e.g. after an admin resets their password)
+func DeleteToken(ctx context.Context, userID uint) error {
+	ctx, span := startQuery(ctx, "user_tokens.delete")
 	query := `DELETE FROM user_tokens WHERE user_id = ?`
-	_, err := setting.DB.Exec(query, userID)
+	res, err := setting.DB.ExecContext(ctx, query, userID)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
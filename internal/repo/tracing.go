@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("siro-backend/internal/repo")
+
+// startQuery starts a span for one SQL statement
+// name identifies the statement in traces, e.g. "workorders.count"
+func startQuery(ctx context.Context, name string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "db "+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "mysql"),
+			attribute.String("db.statement.name", name),
+		),
+	)
+}
+
+// endQuery records the number of rows read or affected and the error (if any), then ends the span
+// sql.ErrNoRows is not treated as a failure
+func endQuery(span trace.Span, rows int64, err error) {
+	span.SetAttributes(attribute.Int64("db.rows", rows))
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// rowsAffected returns the affected row count of an Exec result (0 on error)
+func rowsAffected(res sql.Result, err error) int64 {
+	if err != nil {
+		return 0
+	}
+	n, _ := res.RowsAffected()
+	return n
+}
+
+// oneRow returns 1 if a single-row query found its row, 0 otherwise
+func oneRow(err error) int64 {
+	if err != nil {
+		return 0
+	}
+	return 1
+}
@@ -0,0 +1,54 @@
+package repo
+
+import (
+	"context"
+	"siro-backend/internal/models"
+	"siro-backend/pkg/setting"
+	"time"
+)
+
+func GetUnits(ctx context.Context) ([]models.Unit, error) {
+	ctx, span := startQuery(ctx, "units.list")
+	rows, err := setting.DB.QueryContext(ctx, `SELECT id, name, created_at FROM units ORDER BY name`)
+	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	units := []models.Unit{}
+	for rows.Next() {
+		var u models.Unit
+		if err := rows.Scan(&u.ID, &u.Name, &u.CreatedAt); err == nil {
+			units = append(units, u)
+		}
+	}
+	endQuery(span, int64(len(units)), rows.Err())
+	return units, rows.Err()
+}
+
+// UnitExists checks the exact spelling (BINARY), because unit names are compared
+// case-sensitively in Go, e.g. order.Unit != user.Unit
+func UnitExists(ctx context.Context, name string) (bool, error) {
+	ctx, span := startQuery(ctx, "units.exists")
+	var exists bool
+	err := setting.DB.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM units WHERE BINARY name = ?)`, name).Scan(&exists)
+	endQuery(span, oneRow(err), err)
+	return exists, err
+}
+
+func CreateUnit(ctx context.Context, u *models.Unit) error {
+	ctx, span := startQuery(ctx, "units.create")
+	res, err := setting.DB.ExecContext(ctx, `INSERT INTO units (name, created_at) VALUES (?, NOW())`, u.Name)
+	endQuery(span, rowsAffected(res, err), err)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	id, _ := res.LastInsertId()
+	u.ID = uint(id)
+	u.CreatedAt = time.Now()
+	return nil
+}
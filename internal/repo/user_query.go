@@ -1,54 +1,155 @@
 package repo
 
 import (
+	"context"
+	"database/sql"
+	"fmt"
+	"siro-backend/global"
 	"siro-backend/internal/models"
 	"siro-backend/pkg/setting"
+	"strings"
 )
 
-func GetUserByEmail(email string) (*models.User, error) {
-	query := `SELECT id, name, email, password_hash, role, unit, availability, can_crud, COALESCE(avatar_url, '') 
+func GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	ctx, span := startQuery(ctx, "users.get_by_email")
+	query := `SELECT id, name, email, password_hash, role, unit, availability, can_crud, COALESCE(avatar_url, ''), version,
+              deactivated_at, anonymized_at, must_change_password, (password_hash = '' AND oidc_subject IS NULL AND NOT service_account AND anonymized_at IS NULL)
+              service_account
               FROM users WHERE email = ?`
 	var u models.User
-	err := setting.DB.QueryRow(query, email).Scan(
-		&u.ID, &u.Name, &u.Email, &u.PasswordHash, &u.Role, &u.Unit, &u.Availability, &u.CanCRUD, &u.AvatarURL,
+	err := setting.DB.QueryRowContext(ctx, query, email).Scan(
+		&u.ID, &u.Name, &u.Email, &u.PasswordHash, &u.Role, &u.Unit, &u.Availability, &u.CanCRUD, &u.AvatarURL, &u.Version,
+		&u.DeactivatedAt, &u.AnonymizedAt, &u.MustChangePassword, &u.Invited, &u.ServiceAccount,
 	)
+	endQuery(span, oneRow(err), err)
 	if err != nil {
 		return nil, err
 	}
 	return &u, nil
 }
 
-func GetUserByID(id uint) (*models.User, error) {
-	query := `SELECT id, name, email, role, unit, COALESCE(phone, ''), COALESCE(avatar_url, ''), availability, can_crud 
+func GetUserByID(ctx context.Context, id uint) (*models.User, error) {
+	ctx, span := startQuery(ctx, "users.get_by_id")
+	query := `SELECT id, name, email, role, unit, COALESCE(phone, ''), COALESCE(avatar_url, ''), availability, can_crud, version,
+              deactivated_at, anonymized_at, must_change_password, (password_hash = '' AND oidc_subject IS NULL AND NOT service_account AND anonymized_at IS NULL),
+              COALESCE(external_id, ''), service_account, created_at, updated_at
               FROM users WHERE id = ?`
 	var u models.User
-	err := setting.DB.QueryRow(query, id).Scan(
-		&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Phone, &u.AvatarURL, &u.Availability, &u.CanCRUD,
+	err := setting.DB.QueryRowContext(ctx, query, id).Scan(
+		&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Phone, &u.AvatarURL, &u.Availability, &u.CanCRUD, &u.Version,
+		&u.DeactivatedAt, &u.AnonymizedAt, &u.MustChangePassword, &u.Invited,
+		&u.ExternalID, &u.ServiceAccount, &u.CreatedAt, &u.UpdatedAt,
 	)
+	endQuery(span, oneRow(err), err)
 	if err != nil {
 		return nil, err
 	}
 	return &u, nil
 }
 
-func CreateUser(u *models.User) error {
-	query := `INSERT INTO users (name, email, password_hash, role, unit, phone, can_crud, availability, avatar_url, created_at) 
-              VALUES (?, ?, ?, ?, ?, ?, ?, 'Online', ?, NOW())`
-	res, err := setting.DB.Exec(query, u.Name, u.Email, u.PasswordHash, u.Role, u.Unit, u.Phone, u.CanCRUD, u.AvatarURL)
+func CreateUser(ctx context.Context, u *models.User) error {
+	return insertUser(ctx, setting.DB, u)
+}
+
+// CreateUsers creates all users in one transaction: either all of them are saved or none
+// Returns ErrDuplicate if one of the emails is already taken
+func CreateUsers(ctx context.Context, users []*models.User) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, u := range users {
+		if err := insertUser(ctx, tx, u); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// execer is implemented by both *sql.DB and *sql.Tx
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+}
+
+func insertUser(ctx context.Context, db execer, u *models.User) error {
+	ctx, span := startQuery(ctx, "users.create")
+	query := `INSERT INTO users (name, email, password_hash, must_change_password, role, unit, phone, can_crud, availability, avatar_url,
+              external_id, oidc_subject, service_account, created_at) 
+              VALUES (?, ?, ?, ?, ?, ?, ?, ?, 'Online', ?, NULLIF(?, ''), NULLIF(?, ''), ?, NOW())`
+	res, err := db.ExecContext(ctx, query, u.Name, u.Email, u.PasswordHash, u.MustChangePassword, u.Role, u.Unit, u.Phone, u.CanCRUD, u.AvatarURL,
+		u.ExternalID, u.OIDCSubject, u.ServiceAccount)
+	endQuery(span, rowsAffected(res, err), err)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
 	if err != nil {
 		return err
 	}
 	id, _ := res.LastInsertId()
 	u.ID = uint(id)
+	u.Version = 1
 	return nil
 }
 
-func GetAllUsers() ([]models.User, error) {
-	rows, err := setting.DB.Query(`
-        SELECT id, name, email, role, unit, availability, can_crud, COALESCE(avatar_url, '') 
-        FROM users
-    `)
+// ExistingEmails returns which of the emails already belong to a user (lowercased keys)
+// Deactivated users count too, because their row still holds the email
+func ExistingEmails(ctx context.Context, emails []string) (map[string]bool, error) {
+	existing := map[string]bool{}
+	if len(emails) == 0 {
+		return existing, nil
+	}
+
+	var where conditions
+	where.in("email", emails)
+	ctx, span := startQuery(ctx, "users.existing_emails")
+	rows, err := setting.DB.QueryContext(ctx, "SELECT email FROM users"+where.sql(), where.args...)
 	if err != nil {
+		endQuery(span, 0, err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			existing[strings.ToLower(email)] = true
+		}
+	}
+	endQuery(span, int64(len(existing)), rows.Err())
+	return existing, rows.Err()
+}
+
+// UserQuery filters the admin user list and export; empty fields don't filter
+type UserQuery struct {
+	Roles  []string
+	Units  []string
+	Status string // "active", "deactivated" or "" for both
+}
+
+// GetAllUsers returns the users matching q, including deactivated ones unless filtered (see DeactivatedAt)
+// Service accounts are not listed, see GetServiceAccounts
+func GetAllUsers(ctx context.Context, q UserQuery) ([]models.User, error) {
+	var where conditions
+	where.add("service_account = FALSE")
+	where.in("role", q.Roles)
+	where.in("unit", q.Units)
+	switch q.Status {
+	case "active":
+		where.add("deactivated_at IS NULL")
+	case "deactivated":
+		where.add("deactivated_at IS NOT NULL")
+	}
+
+	ctx, span := startQuery(ctx, "users.list")
+	rows, err := setting.DB.QueryContext(ctx, `
+        SELECT id, name, email, role, unit, COALESCE(phone, ''), availability, can_crud, COALESCE(avatar_url, ''), version,
+               deactivated_at, anonymized_at, must_change_password, (password_hash = '' AND oidc_subject IS NULL AND NOT service_account AND anonymized_at IS NULL),
+               COALESCE(external_id, ''), created_at, updated_at
+        FROM users`+where.sql()+" ORDER BY id", where.args...)
+	if err != nil {
+		endQuery(span, 0, err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -56,20 +157,27 @@ func GetAllUsers() ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Availability, &u.CanCRUD, &u.AvatarURL); err == nil {
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Phone, &u.Availability, &u.CanCRUD, &u.AvatarURL, &u.Version,
+			&u.DeactivatedAt, &u.AnonymizedAt, &u.MustChangePassword, &u.Invited,
+			&u.ExternalID, &u.CreatedAt, &u.UpdatedAt); err == nil {
 			users = append(users, u)
 		}
 	}
+	endQuery(span, int64(len(users)), rows.Err())
 	return users, nil
 }
 
 // GetUsersByUnit: Filter langsung di DB (Optimasi RAM & Performance)
-func GetUsersByUnit(unit string) ([]models.User, error) {
-	query := `SELECT id, name, email, role, unit, availability, can_crud, COALESCE(avatar_url, '') 
-              FROM users WHERE unit = ?`
+// Deactivated users and service accounts are left out
+func GetUsersByUnit(ctx context.Context, unit string) ([]models.User, error) {
+	ctx, span := startQuery(ctx, "users.list_by_unit")
+	query := `SELECT id, name, email, role, unit, availability, can_crud, COALESCE(avatar_url, ''), version,
+              must_change_password, (password_hash = '' AND oidc_subject IS NULL AND NOT service_account)
+              FROM users WHERE unit = ? AND deactivated_at IS NULL AND service_account = FALSE`
 
-	rows, err := setting.DB.Query(query, unit)
+	rows, err := setting.DB.QueryContext(ctx, query, unit)
 	if err != nil {
+		endQuery(span, 0, err)
 		return nil, err
 	}
 	defer rows.Close()
@@ -77,25 +185,128 @@ func GetUsersByUnit(unit string) ([]models.User, error) {
 	var users []models.User
 	for rows.Next() {
 		var u models.User
-		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Availability, &u.CanCRUD, &u.AvatarURL); err == nil {
+		if err := rows.Scan(&u.ID, &u.Name, &u.Email, &u.Role, &u.Unit, &u.Availability, &u.CanCRUD, &u.AvatarURL, &u.Version,
+			&u.MustChangePassword, &u.Invited); err == nil {
 			users = append(users, u)
 		}
 	}
+	endQuery(span, int64(len(users)), rows.Err())
 	return users, nil
 }
 
-func UpdateUser(id uint, u models.User) error {
-	query := `UPDATE users SET name=?, unit=?, phone=?, role=?, can_crud=?, avatar_url=? WHERE id=?`
-	_, err := setting.DB.Exec(query, u.Name, u.Unit, u.Phone, u.Role, u.CanCRUD, u.AvatarURL, id)
+// UpdateUser saves the user only if its version still matches u.Version
+// The password hash is only changed when u.PasswordHash is set (GetUserByID doesn't load it)
+// Returns ErrVersionConflict if someone else updated the row first, ErrDuplicate if the email is taken
+func UpdateUser(ctx context.Context, id uint, u models.User) error {
+	ctx, span := startQuery(ctx, "users.update")
+	query := `UPDATE users SET name=?, email=?, unit=?, phone=?, role=?, can_crud=?, avatar_url=?,
+              password_hash=COALESCE(NULLIF(?, ''), password_hash), must_change_password=?, external_id=NULLIF(?, ''),
+              version=version+1 
+              WHERE id=? AND version=?`
+	res, err := setting.DB.ExecContext(ctx, query, u.Name, u.Email, u.Unit, u.Phone, u.Role, u.CanCRUD, u.AvatarURL, u.PasswordHash,
+		u.MustChangePassword, u.ExternalID, id, u.Version)
+	aff := rowsAffected(res, err)
+	endQuery(span, aff, err)
+	if isDuplicate(err) {
+		return ErrDuplicate
+	}
+	if err != nil {
+		return err
+	}
+	if aff == 0 {
+		return ErrVersionConflict
+	}
+	return nil
+}
+
+// SetPassword replaces the password and clears must_change_password
+func SetPassword(ctx context.Context, id uint, passwordHash string) error {
+	ctx, span := startQuery(ctx, "users.set_password")
+	res, err := setting.DB.ExecContext(ctx, `UPDATE users SET password_hash = ?, must_change_password = FALSE, version = version + 1
+		WHERE id = ?`, passwordHash, id)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
 
-func UpdateAvailability(userID uint, status string) error {
-	_, err := setting.DB.Exec("UPDATE users SET availability = ? WHERE id = ?", status, userID)
+// UpdateAvailability sets the availability status; like every user write it bumps the version,
+// so the user's ETag changes and a client holding the old one is told to reload
+func UpdateAvailability(ctx context.Context, userID uint, status string) error {
+	ctx, span := startQuery(ctx, "users.update_availability")
+	res, err := setting.DB.ExecContext(ctx, "UPDATE users SET availability = ?, version = version + 1 WHERE id = ?", status, userID)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
 
-func DeleteUser(id uint) error {
-	_, err := setting.DB.Exec("DELETE FROM users WHERE id = ?", id)
+// DeactivateUser blocks a user from logging in and ends their sessions and API keys in one transaction
+// The row stays, so work orders and logs still show who did what; doing it twice is harmless
+func DeactivateUser(ctx context.Context, id uint) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	updCtx, span := startQuery(ctx, "users.deactivate")
+	res, err := tx.ExecContext(updCtx, `UPDATE users SET deactivated_at=NOW(), availability=?, version=version+1
+		WHERE id=? AND deactivated_at IS NULL`, global.AvailOffline, id)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+	if err := deleteTokensTx(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := revokeAPIKeysTx(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReactivateUser lets a deactivated user log in again
+// Anonymized users are never reactivated (the caller should answer ErrUserAnonymized)
+func ReactivateUser(ctx context.Context, id uint) error {
+	ctx, span := startQuery(ctx, "users.reactivate")
+	res, err := setting.DB.ExecContext(ctx, `UPDATE users SET deactivated_at=NULL, version=version+1
+		WHERE id=? AND deactivated_at IS NOT NULL AND anonymized_at IS NULL`, id)
+	endQuery(span, rowsAffected(res, err), err)
 	return err
 }
+
+// AnonymizeUser erases the personal data of a user (for erasure requests); this can't be undone
+// The row and its id stay so history keeps working, but it shows "Deleted user #id".
+// The copied names in activity_logs are replaced too. The audit log is append-only, so it holds no
+// personal values: only actor IDs, and user diffs that mark personal fields as changed (see audit.DiffRedacted).
+func AnonymizeUser(ctx context.Context, id uint) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	name := fmt.Sprintf("Deleted user #%d", id)
+	email := fmt.Sprintf("deleted-%d@anonymized.invalid", id)
+
+	updCtx, span := startQuery(ctx, "users.anonymize")
+	res, err := tx.ExecContext(updCtx, `UPDATE users SET name=?, email=?, phone=NULL, avatar_url=NULL, password_hash='', external_id=NULL, oidc_subject=NULL,
+		can_crud=FALSE, availability=?, deactivated_at=COALESCE(deactivated_at, NOW()), anonymized_at=NOW(), version=version+1
+		WHERE id=?`, name, email, global.AvailOffline, id)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	logCtx, span := startQuery(ctx, "activity_logs.anonymize")
+	res, err = tx.ExecContext(logCtx, "UPDATE activity_logs SET user_name=? WHERE user_id=?", name, id)
+	endQuery(span, rowsAffected(res, err), err)
+	if err != nil {
+		return err
+	}
+
+	if err := deleteTokensTx(ctx, tx, id); err != nil {
+		return err
+	}
+	if err := revokeAPIKeysTx(ctx, tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,144 @@
+package repo
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/go-sql-driver/mysql"
+)
+
+func TestUpdateUserVersion(t *testing.T) {
+	ctx := context.Background()
+	u := models.User{Name: "Budi", Email: "budi@example.com", Unit: "IT", Role: "Staff", Version: 3}
+	update := `version=version\+1\s+WHERE id=\? AND version=\?`
+
+	tests := []struct {
+		name     string
+		affected int64
+		err      error
+		want     error
+	}{
+		{"current version", 1, nil, nil},
+		{"changed by someone else", 0, nil, ErrVersionConflict},
+		{"email taken", 0, &mysql.MySQLError{Number: 1062, Message: "Duplicate entry"}, ErrDuplicate},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			exec := mock.ExpectExec(update).WithArgs("Budi", "budi@example.com", "IT", "", "Staff", false, "", "", false, "", 9, 3)
+			if tt.err != nil {
+				exec.WillReturnError(tt.err)
+			} else {
+				exec.WillReturnResult(sqlmock.NewResult(0, tt.affected))
+			}
+			if err := UpdateUser(ctx, 9, u); !errors.Is(err, tt.want) {
+				t.Errorf("err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// Availability is part of the user, so changing it changes the ETag too
+func TestUpdateAvailability(t *testing.T) {
+	mock := testutil.MockDB(t)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET availability = ?, version = version + 1 WHERE id = ?")).WithArgs("Busy", 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := UpdateAvailability(context.Background(), 9, "Busy"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// sqlPattern matches query exactly, whatever whitespace separates its words
+func sqlPattern(query string) string {
+	words := strings.Fields(query)
+	for i, w := range words {
+		words[i] = regexp.QuoteMeta(w)
+	}
+	return "^" + strings.Join(words, `\s+`) + "$"
+}
+
+// expectEndSessions expects the sessions and API keys of user 9 to be ended
+func expectEndSessions(mock sqlmock.Sqlmock) {
+	mock.ExpectExec(sqlPattern("DELETE FROM user_tokens WHERE user_id = ?")).WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sqlPattern("UPDATE api_keys SET revoked_at = NOW() WHERE user_id = ? AND revoked_at IS NULL")).WithArgs(9).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+}
+
+const deactivateQuery = `UPDATE users SET deactivated_at=NOW(), availability=?, version=version+1
+	WHERE id=? AND deactivated_at IS NULL`
+
+func TestDeactivateUser(t *testing.T) {
+	ctx := context.Background()
+
+	// Sessions and keys end in the transaction of the update
+	t.Run("ends sessions and keys", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(sqlPattern(deactivateQuery)).WithArgs(global.AvailOffline, 9).WillReturnResult(sqlmock.NewResult(0, 1))
+		expectEndSessions(mock)
+		mock.ExpectCommit()
+		if err := DeactivateUser(ctx, 9); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	// Already deactivated: nothing changes, but leftover sessions are still ended
+	t.Run("twice", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(sqlPattern(deactivateQuery)).WithArgs(global.AvailOffline, 9).WillReturnResult(sqlmock.NewResult(0, 0))
+		expectEndSessions(mock)
+		mock.ExpectCommit()
+		if err := DeactivateUser(ctx, 9); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("keys fail", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(sqlPattern(deactivateQuery)).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("DELETE FROM user_tokens").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE api_keys").WillReturnError(errors.New("lock wait timeout"))
+		mock.ExpectRollback()
+		if err := DeactivateUser(ctx, 9); err == nil {
+			t.Fatal("expected the database error")
+		}
+	})
+}
+
+func TestReactivateUser(t *testing.T) {
+	mock := testutil.MockDB(t)
+	mock.ExpectExec(sqlPattern(`UPDATE users SET deactivated_at=NULL, version=version+1
+		WHERE id=? AND deactivated_at IS NOT NULL AND anonymized_at IS NULL`)).WithArgs(9).WillReturnResult(sqlmock.NewResult(0, 1))
+	if err := ReactivateUser(context.Background(), 9); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// Anonymizing overwrites exactly the personal columns of the user and the names copied into
+// activity_logs. The mock fails on any other statement, so work orders, their events and the
+// audit log keep referring to the user by ID.
+func TestAnonymizeUser(t *testing.T) {
+	mock := testutil.MockDB(t)
+	mock.ExpectBegin()
+	mock.ExpectExec(sqlPattern(`UPDATE users SET name=?, email=?, phone=NULL, avatar_url=NULL, password_hash='', external_id=NULL, oidc_subject=NULL,
+		can_crud=FALSE, availability=?, deactivated_at=COALESCE(deactivated_at, NOW()), anonymized_at=NOW(), version=version+1
+		WHERE id=?`)).
+		WithArgs("Deleted user #9", "deleted-9@anonymized.invalid", global.AvailOffline, 9).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(sqlPattern("UPDATE activity_logs SET user_name=? WHERE user_id=?")).WithArgs("Deleted user #9", 9).
+		WillReturnResult(sqlmock.NewResult(0, 4))
+	expectEndSessions(mock)
+	mock.ExpectCommit()
+	if err := AnonymizeUser(context.Background(), 9); err != nil {
+		t.Fatal(err)
+	}
+}
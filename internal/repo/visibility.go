@@ -0,0 +1,36 @@
+package repo
+
+import (
+	"siro-backend/global"
+	"siro-backend/internal/models"
+)
+
+// Viewer is the user a work order list or fetch is made for
+//
+// Visibility policy:
+//   - Admins see every work order
+//   - Everyone else sees work orders targeted at their unit or requested by their unit,
+//     plus the ones marked public (is_public)
+type Viewer struct {
+	Unit  string
+	Admin bool
+}
+
+// ViewerOf returns the viewer for a logged-in user
+func ViewerOf(user *models.User) Viewer {
+	return Viewer{Unit: user.Unit, Admin: user.Role == global.RoleAdmin}
+}
+
+// CanView reports whether the viewer may see wo (for records that are already loaded)
+func (v Viewer) CanView(wo models.WorkOrder) bool {
+	return v.Admin || wo.IsPublic || wo.Unit == v.Unit || wo.RequesterData.Unit == v.Unit
+}
+
+// addCondition limits where to the work orders the viewer may see
+// Expects the aliases w = work_orders, req = requester
+func (v Viewer) addCondition(where *conditions) {
+	if v.Admin {
+		return
+	}
+	where.add("(w.is_public = TRUE OR w.unit = ? OR req.unit = ?)", v.Unit, v.Unit)
+}
@@ -0,0 +1,109 @@
+package repo
+
+import (
+	"context"
+	"database/sql/driver"
+	"reflect"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/models"
+	"siro-backend/internal/testutil"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// visibilityCases are the viewers and work orders the policy in visibility.go is pinned with
+var visibilityCases = []struct {
+	name   string
+	viewer Viewer
+	wo     models.WorkOrder
+	want   bool
+}{
+	{"admin of another unit", Viewer{Unit: "HR", Admin: true}, workOrderFor("Facilities", "Facilities", false), true},
+	{"target unit", Viewer{Unit: "IT"}, workOrderFor("IT", "Facilities", false), true},
+	{"requester unit", Viewer{Unit: "IT"}, workOrderFor("Facilities", "IT", false), true},
+	{"public", Viewer{Unit: "IT"}, workOrderFor("Facilities", "HR", true), true},
+	{"other unit", Viewer{Unit: "IT"}, workOrderFor("Facilities", "HR", false), false},
+	{"user without a unit", Viewer{}, workOrderFor("Facilities", "HR", false), false},
+}
+
+func workOrderFor(unit, requesterUnit string, public bool) models.WorkOrder {
+	return models.WorkOrder{Unit: unit, RequesterData: models.User{Unit: requesterUnit}, IsPublic: public}
+}
+
+func TestViewerOf(t *testing.T) {
+	if got := ViewerOf(&models.User{Unit: "IT", Role: global.RoleAdmin}); got != (Viewer{Unit: "IT", Admin: true}) {
+		t.Errorf("admin: %+v", got)
+	}
+	if got := ViewerOf(&models.User{Unit: "IT", Role: global.RoleStaff}); got != (Viewer{Unit: "IT"}) {
+		t.Errorf("staff: %+v", got)
+	}
+}
+
+func TestCanView(t *testing.T) {
+	for _, tt := range visibilityCases {
+		if got := tt.viewer.CanView(tt.wo); got != tt.want {
+			t.Errorf("%s: CanView = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVisibilityCondition(t *testing.T) {
+	var where conditions
+	Viewer{Unit: "IT", Admin: true}.addCondition(&where)
+	if where.sql() != "" || len(where.args) != 0 {
+		t.Errorf("admin: %q %v, want no condition", where.sql(), where.args)
+	}
+
+	where = conditions{}
+	Viewer{Unit: "IT"}.addCondition(&where)
+	if want := " WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?)"; where.sql() != want {
+		t.Errorf("staff: %q, want %q", where.sql(), want)
+	}
+	if want := []interface{}{"IT", "IT"}; !reflect.DeepEqual(where.args, want) {
+		t.Errorf("staff args %v, want %v", where.args, want)
+	}
+}
+
+// The condition has to come before every other filter, so an OR in a filter can't widen it
+func TestWorkOrderListVisibility(t *testing.T) {
+	const from = " FROM work_orders w LEFT JOIN users req ON w.requester_id = req.id"
+	tests := []struct {
+		name  string
+		q     WorkOrderQuery
+		where string
+		args  []driver.Value
+	}{
+		{"admin", WorkOrderQuery{Viewer: Viewer{Unit: "IT", Admin: true}}, "", nil},
+		{"staff", WorkOrderQuery{Viewer: Viewer{Unit: "IT"}},
+			" WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?)", []driver.Value{"IT", "IT"}},
+		{"staff filtering by another unit", WorkOrderQuery{Viewer: Viewer{Unit: "IT"}, Units: []string{"Facilities"}},
+			" WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?) AND w.unit IN (?)", []driver.Value{"IT", "IT", "Facilities"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mock := testutil.MockDB(t)
+			mock.ExpectQuery("^" + regexp.QuoteMeta("SELECT COUNT(*)"+from+tt.where) + "$").WithArgs(tt.args...).
+				WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(0))
+			mock.ExpectQuery(regexp.QuoteMeta(tt.where+" ORDER BY w.created_at DESC, w.id DESC LIMIT ? OFFSET ?") + "$").
+				WithArgs(append(tt.args, 10, 0)...).
+				WillReturnRows(sqlmock.NewRows(nil))
+
+			if _, _, err := GetWorkOrders(context.Background(), tt.q, Page{Number: 1, Limit: 10}); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestTagVisibility(t *testing.T) {
+	mock := testutil.MockDB(t)
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN users req ON w.requester_id = req.id WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?) ORDER BY t.tag")).
+		WithArgs("IT", "IT").
+		WillReturnRows(sqlmock.NewRows([]string{"tag"}).AddRow("network"))
+	tags, err := GetTags(context.Background(), Viewer{Unit: "IT"})
+	if err != nil || !reflect.DeepEqual(tags, []string{"network"}) {
+		t.Errorf("GetTags = %v, %v", tags, err)
+	}
+}
@@ -0,0 +1,153 @@
+package repo
+
+import (
+	"siro-backend/global"
+	"siro-backend/pkg/search"
+	"strings"
+	"time"
+)
+
+// WorkOrderQuery describes which work orders to list and in which order
+// Empty fields don't filter; Viewer always applies (see visibility.go)
+type WorkOrderQuery struct {
+	Viewer Viewer
+
+	Statuses       []string // may contain "active" (= Pending or In Progress)
+	Priorities     []string
+	Units          []string // target unit
+	RequesterUnits []string
+	Tags           []string // any of these tags
+
+	AssigneeID  *uint
+	Unassigned  bool
+	RequesterID *uint
+
+	CreatedFrom   *time.Time // inclusive
+	CreatedBefore *time.Time // exclusive
+	DoneFrom      *time.Time // completed_at, inclusive
+	DoneBefore    *time.Time // completed_at, exclusive
+	Today         bool
+
+	SLABreached *bool
+	Search      string   // full-text search, see migrations/009
+	Sort        []string // e.g. ["priority", "-updated_at"], see validation.WorkOrderSorts
+}
+
+// workOrderSortExprs maps the sort= fields to SQL ("-field" sorts descending)
+// priority sorts High first, due sorts the soonest SLA deadline first
+func workOrderSortExprs() map[string]sortExpr {
+	target, targetArgs := slaTargetExpr()
+	return map[string]sortExpr{
+		"created_at": {sql: "w.created_at"},
+		"updated_at": {sql: "w.updated_at"},
+		"priority":   {sql: "FIELD(w.priority, ?, ?, ?)", args: []interface{}{global.PriorityHigh, global.PriorityMedium, global.PriorityLow}},
+		"due":        {sql: "DATE_ADD(w.created_at, INTERVAL " + target + " SECOND)", args: targetArgs},
+	}
+}
+
+// where builds the WHERE conditions for the query (aliases: w = work_orders, req = requester)
+func (q WorkOrderQuery) where() conditions {
+	var where conditions
+	q.Viewer.addCondition(&where)
+
+	statuses := make([]string, 0, len(q.Statuses))
+	for _, s := range q.Statuses {
+		if s == "active" {
+			statuses = append(statuses, global.StatusPending, global.StatusInProgress)
+		} else {
+			statuses = append(statuses, s)
+		}
+	}
+	where.in("w.status", statuses)
+	where.in("w.priority", q.Priorities)
+	where.in("w.unit", q.Units)
+	where.in("req.unit", q.RequesterUnits)
+
+	if len(q.Tags) > 0 {
+		where.add("EXISTS (SELECT 1 FROM work_order_tags t WHERE t.work_order_id = w.id AND t.tag IN ("+
+			placeholders(len(q.Tags))+"))", toArgs(q.Tags)...)
+	}
+
+	if q.Unassigned {
+		where.add("w.assignee_id IS NULL")
+	} else if q.AssigneeID != nil {
+		where.add("w.assignee_id = ?", *q.AssigneeID)
+	}
+	if q.RequesterID != nil {
+		where.add("w.requester_id = ?", *q.RequesterID)
+	}
+
+	if q.CreatedFrom != nil {
+		where.add("w.created_at >= ?", *q.CreatedFrom)
+	}
+	if q.CreatedBefore != nil {
+		where.add("w.created_at < ?", *q.CreatedBefore)
+	}
+	if q.DoneFrom != nil {
+		where.add("w.completed_at >= ?", *q.DoneFrom)
+	}
+	if q.DoneBefore != nil {
+		where.add("w.completed_at < ?", *q.DoneBefore)
+	}
+	if q.Today {
+		where.add("DATE(w.created_at) = CURDATE()")
+	}
+
+	if q.SLABreached != nil {
+		cond, args := slaBreachCondition()
+		if *q.SLABreached {
+			where.add("("+cond+")", args...)
+		} else {
+			where.add("NOT ("+cond+")", args...)
+		}
+	}
+
+	if terms := search.Terms(q.Search); len(terms) > 0 {
+		where.add(fullTextMatch, search.BooleanQuery(terms))
+	}
+	return where
+}
+
+// fullTextMatch uses the ft_work_orders_search index
+// Comments aren't stored yet, so they aren't searched; they will need their own index
+const fullTextMatch = "MATCH(w.title, w.description, w.completion_note) AGAINST (? IN BOOLEAN MODE)"
+
+// orderBy builds the ORDER BY clause
+// Without sort=, search results are ranked by relevance and everything else is newest first
+// w.id is always the last tie-breaker, so the order is stable between pages
+func (q WorkOrderQuery) orderBy() (ordering, error) {
+	var order ordering
+
+	if len(q.Sort) > 0 {
+		if err := order.addSorts(q.Sort, workOrderSortExprs()); err != nil {
+			return order, err
+		}
+	} else {
+		if terms := search.Terms(q.Search); len(terms) > 0 {
+			order.add(sortExpr{sql: fullTextMatch, args: []interface{}{search.BooleanQuery(terms)}}, true)
+		}
+		order.add(sortExpr{sql: "w.created_at"}, true)
+	}
+
+	order.add(sortExpr{sql: "w.id"}, true)
+	return order, nil
+}
+
+// keyset returns the cursor-mode ordering
+// Only one created_at / updated_at sort can be followed by a cursor; the default is -created_at
+// Search results are then listed newest first instead of by relevance
+func (q WorkOrderQuery) keyset(page Page) (keyset, error) {
+	sort := "-created_at"
+	if len(q.Sort) > 1 {
+		return keyset{}, ErrCursorSort
+	}
+	if len(q.Sort) == 1 {
+		sort = q.Sort[0]
+	}
+	switch strings.TrimPrefix(sort, "-") {
+	case "created_at", "updated_at":
+		col := "w." + strings.TrimPrefix(sort, "-")
+		return newKeyset(page, sort, col, "w.id", strings.HasPrefix(sort, "-"))
+	}
+	return keyset{}, ErrCursorSort
+}
@@ -0,0 +1,107 @@
+package repo
+
+import (
+	"reflect"
+	"siro-backend/global"
+	"testing"
+	"time"
+)
+
+func TestWorkOrderQueryWhere(t *testing.T) {
+	admin := Viewer{Unit: "IT", Admin: true}
+	id := uint(12)
+	day := time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	sla, slaArgs := slaBreachCondition()
+
+	tests := []struct {
+		name  string
+		q     WorkOrderQuery
+		where string
+		args  []interface{}
+	}{
+		{"nothing", WorkOrderQuery{Viewer: admin}, "", nil},
+		{"visibility first", WorkOrderQuery{Viewer: Viewer{Unit: "IT"}, Priorities: []string{"High"}},
+			" WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?) AND w.priority IN (?)", []interface{}{"IT", "IT", "High"}},
+		{"statuses", WorkOrderQuery{Viewer: admin, Statuses: []string{"Pending", "Completed"}},
+			" WHERE w.status IN (?, ?)", []interface{}{"Pending", "Completed"}},
+		{"active is pending or in progress", WorkOrderQuery{Viewer: admin, Statuses: []string{"active", "Completed"}},
+			" WHERE w.status IN (?, ?, ?)", []interface{}{global.StatusPending, global.StatusInProgress, "Completed"}},
+		{"units", WorkOrderQuery{Viewer: admin, Units: []string{"IT", "HR"}, RequesterUnits: []string{"Facilities"}},
+			" WHERE w.unit IN (?, ?) AND req.unit IN (?)", []interface{}{"IT", "HR", "Facilities"}},
+		{"tags", WorkOrderQuery{Viewer: admin, Tags: []string{"printer", "network"}},
+			" WHERE EXISTS (SELECT 1 FROM work_order_tags t WHERE t.work_order_id = w.id AND t.tag IN (?, ?))", []interface{}{"printer", "network"}},
+		{"assignee", WorkOrderQuery{Viewer: admin, AssigneeID: &id}, " WHERE w.assignee_id = ?", []interface{}{id}},
+		{"unassigned wins over an assignee", WorkOrderQuery{Viewer: admin, Unassigned: true, AssigneeID: &id}, " WHERE w.assignee_id IS NULL", nil},
+		{"requester", WorkOrderQuery{Viewer: admin, RequesterID: &id}, " WHERE w.requester_id = ?", []interface{}{id}},
+		{"created range", WorkOrderQuery{Viewer: admin, CreatedFrom: &day, CreatedBefore: &day},
+			" WHERE w.created_at >= ? AND w.created_at < ?", []interface{}{day, day}},
+		{"completed range", WorkOrderQuery{Viewer: admin, DoneFrom: &day, DoneBefore: &day},
+			" WHERE w.completed_at >= ? AND w.completed_at < ?", []interface{}{day, day}},
+		{"today", WorkOrderQuery{Viewer: admin, Today: true}, " WHERE DATE(w.created_at) = CURDATE()", nil},
+		{"sla breached", WorkOrderQuery{Viewer: admin, SLABreached: &yes}, " WHERE (" + sla + ")", slaArgs},
+		{"sla not breached", WorkOrderQuery{Viewer: admin, SLABreached: &no}, " WHERE NOT (" + sla + ")", slaArgs},
+		{"search", WorkOrderQuery{Viewer: admin, Search: "printer rusak"}, " WHERE " + fullTextMatch, []interface{}{"+printer* +rusak*"}},
+		{"search without words", WorkOrderQuery{Viewer: admin, Search: ` "" - `}, "", nil},
+		{"combined", WorkOrderQuery{Viewer: Viewer{Unit: "IT"}, Statuses: []string{"active"}, Tags: []string{"printer"}, Unassigned: true, Today: true},
+			" WHERE (w.is_public = TRUE OR w.unit = ? OR req.unit = ?) AND w.status IN (?, ?)" +
+				" AND EXISTS (SELECT 1 FROM work_order_tags t WHERE t.work_order_id = w.id AND t.tag IN (?))" +
+				" AND w.assignee_id IS NULL AND DATE(w.created_at) = CURDATE()",
+			[]interface{}{"IT", "IT", global.StatusPending, global.StatusInProgress, "printer"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			where := tt.q.where()
+			if where.sql() != tt.where {
+				t.Errorf("sql\n%q\nwant\n%q", where.sql(), tt.where)
+			}
+			if !reflect.DeepEqual(where.args, tt.args) {
+				t.Errorf("args %v, want %v", where.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestWorkOrderQueryOrderBy(t *testing.T) {
+	due, dueArgs := slaTargetExpr()
+	priorities := []interface{}{global.PriorityHigh, global.PriorityMedium, global.PriorityLow}
+
+	tests := []struct {
+		name    string
+		q       WorkOrderQuery
+		orderBy string
+		args    []interface{}
+	}{
+		{"newest first", WorkOrderQuery{}, " ORDER BY w.created_at DESC, w.id DESC", nil},
+		{"search by relevance", WorkOrderQuery{Search: "printer"},
+			" ORDER BY " + fullTextMatch + " DESC, w.created_at DESC, w.id DESC", []interface{}{"+printer*"}},
+		{"sort wins over relevance", WorkOrderQuery{Search: "printer", Sort: []string{"updated_at"}},
+			" ORDER BY w.updated_at ASC, w.id DESC", nil},
+		{"priority then oldest", WorkOrderQuery{Sort: []string{"priority", "created_at"}},
+			" ORDER BY FIELD(w.priority, ?, ?, ?) ASC, w.created_at ASC, w.id DESC", priorities},
+		{"latest due first", WorkOrderQuery{Sort: []string{"-due"}},
+			" ORDER BY DATE_ADD(w.created_at, INTERVAL " + due + " SECOND) DESC, w.id DESC", dueArgs},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			order, err := tt.q.orderBy()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if order.sql() != tt.orderBy {
+				t.Errorf("sql\n%q\nwant\n%q", order.sql(), tt.orderBy)
+			}
+			if !reflect.DeepEqual(order.args, tt.args) {
+				t.Errorf("args %v, want %v", order.args, tt.args)
+			}
+		})
+	}
+}
+
+func TestWorkOrderQueryBadSort(t *testing.T) {
+	for _, sort := range []string{"title", "id", "--due", "+due", "due-", "w.created_at", "created_at DESC", "1"} {
+		if _, err := (WorkOrderQuery{Sort: []string{"priority", sort}}).orderBy(); err == nil {
+			t.Errorf("sort %q accepted", sort)
+		}
+	}
+}
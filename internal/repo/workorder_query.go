@@ -1,20 +1,21 @@
 package repo
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
-	"math"
 	"siro-backend/global"
 	"siro-backend/internal/models"
 	"siro-backend/pkg/setting"
 	"strings"
+	"time"
 )
 
 const selectWOQuery = `
     SELECT 
-        w.id, w.title, w.description, w.priority, w.status, w.unit, w.photo_url, 
+        w.id, w.title, w.description, w.priority, w.status, w.unit, w.photo_url, w.is_public,
         w.requester_id, w.assignee_id, w.taken_at, 
-        w.completed_at, w.completed_by_id, COALESCE(w.completion_note, ''), w.created_at, w.updated_at,
+        w.completed_at, w.completed_by_id, COALESCE(w.completion_note, ''), w.version, w.created_at, w.updated_at,
         req.name, req.unit, COALESCE(req.avatar_url, ''),     	 				  -- Requester Info
         COALESCE(asg.name, ''), COALESCE(asg.email, ''), COALESCE(asg.unit, ''),  -- Assignee Info
         COALESCE(cmp.name, '')                                  				  -- CompletedBy Info
@@ -31,8 +32,8 @@ func scanWO(rows *sql.Rows) (models.WorkOrder, error) {
 	var takenAt, completedAt sql.NullTime
 
 	err := rows.Scan(
-		&w.ID, &w.Title, &w.Description, &w.Priority, &w.Status, &w.Unit, &w.PhotoURL,
-		&w.RequesterID, &asgID, &takenAt, &completedAt, &cmpID, &w.CompletionNote, &w.CreatedAt, &w.UpdatedAt,
+		&w.ID, &w.Title, &w.Description, &w.Priority, &w.Status, &w.Unit, &w.PhotoURL, &w.IsPublic,
+		&w.RequesterID, &asgID, &takenAt, &completedAt, &cmpID, &w.CompletionNote, &w.Version, &w.CreatedAt, &w.UpdatedAt,
 		&w.RequesterData.Name, &w.RequesterData.Unit, &w.RequesterData.AvatarURL,
 		&w.Assignee.Name, &w.Assignee.Email, &w.Assignee.Unit,
 		&w.CompletedBy.Name,
@@ -62,11 +63,13 @@ func scanWO(rows *sql.Rows) (models.WorkOrder, error) {
 	if completedAt.Valid {
 		w.CompletedAt = &completedAt.Time
 	}
+	w.DueAt = w.CreatedAt.Add(SLATarget(w.Priority))
+	w.Tags = []string{}
 
 	return w, nil
 }
 
-func GetDashboardStats(userUnit string) (models.DashboardStats, error) {
+func GetDashboardStats(ctx context.Context, userUnit string) (models.DashboardStats, error) {
 	var stats models.DashboardStats
 
 	// 1. Hitung Incoming (Total, Pending, In Progress) untuk Unit Saya
@@ -79,8 +82,10 @@ func GetDashboardStats(userUnit string) (models.DashboardStats, error) {
 		FROM work_orders 
 		WHERE unit = ?`
 
-	err := setting.DB.QueryRow(queryIncoming, global.StatusPending, global.StatusInProgress, userUnit).
+	inCtx, inSpan := startQuery(ctx, "workorders.stats_incoming")
+	err := setting.DB.QueryRowContext(inCtx, queryIncoming, global.StatusPending, global.StatusInProgress, userUnit).
 		Scan(&stats.Incoming, &stats.Pending, &stats.InProgress)
+	endQuery(inSpan, oneRow(err), err)
 
 	if err != nil {
 		return stats, err
@@ -94,80 +99,116 @@ func GetDashboardStats(userUnit string) (models.DashboardStats, error) {
 		JOIN users req ON w.requester_id = req.id
 		WHERE req.unit = ?`
 
-	err = setting.DB.QueryRow(queryOutgoing, userUnit).Scan(&stats.Outgoing)
+	outCtx, outSpan := startQuery(ctx, "workorders.stats_outgoing")
+	err = setting.DB.QueryRowContext(outCtx, queryOutgoing, userUnit).Scan(&stats.Outgoing)
+	endQuery(outSpan, oneRow(err), err)
 
 	return stats, err
 }
 
-func CreateWorkOrder(wo *models.WorkOrder) error {
-	query := `INSERT INTO work_orders (title, description, priority, status, unit, photo_url, requester_id, created_at, updated_at) 
-			  VALUES (?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
-	res, err := setting.DB.Exec(query, wo.Title, wo.Description, wo.Priority, global.StatusPending, wo.Unit, wo.PhotoURL, wo.RequesterID)
+// CreateWorkOrder inserts the work order and its tags in one transaction
+func CreateWorkOrder(ctx context.Context, wo *models.WorkOrder, actor Actor) error {
+	tx, err := setting.DB.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	insCtx, span := startQuery(ctx, "workorders.create")
+	query := `INSERT INTO work_orders (title, description, priority, status, unit, photo_url, is_public, requester_id, created_at, updated_at) 
+			  VALUES (?, ?, ?, ?, ?, ?, ?, ?, NOW(), NOW())`
+	res, err := tx.ExecContext(insCtx, query, wo.Title, wo.Description, wo.Priority, global.StatusPending, wo.Unit, wo.PhotoURL, wo.IsPublic, wo.RequesterID)
+	endQuery(span, rowsAffected(res, err), err)
 	if err != nil {
 		return err
 	}
 	id, _ := res.LastInsertId()
+
+	if err := insertTags(ctx, tx, uint(id), wo.Tags); err != nil {
+		return err
+	}
+	if err := recordEvent(ctx, tx, uint(id), EventCreated, actor, nil, map[string]interface{}{
+		"title": wo.Title, "priority": wo.Priority, "unit": wo.Unit, "status": global.StatusPending,
+		"is_public": wo.IsPublic, "tags": wo.Tags,
+	}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
 	wo.ID = uint(id)
+	wo.Version = 1
 	return nil
 }
 
-func GetWorkOrderById(id uint) (models.WorkOrder, error) {
-	rows, err := setting.DB.Query(selectWOQuery+" WHERE w.id = ?", id)
+func GetWorkOrderById(ctx context.Context, id uint) (models.WorkOrder, error) {
+	ctx, span := startQuery(ctx, "workorders.get_by_id")
+	rows, err := setting.DB.QueryContext(ctx, selectWOQuery+" WHERE w.id = ?", id)
 	if err != nil {
+		endQuery(span, 0, err)
 		return models.WorkOrder{}, err
 	}
 	defer rows.Close()
 	if rows.Next() {
-		return scanWO(rows)
+		wo, err := scanWO(rows)
+		endQuery(span, oneRow(err), err)
+		if err != nil {
+			return wo, err
+		}
+		rows.Close()
+		wos := []models.WorkOrder{wo}
+		err = loadTags(ctx, wos)
+		return wos[0], err
 	}
+	endQuery(span, 0, nil)
 	return models.WorkOrder{}, fmt.Errorf("not found")
 }
 
-func GetWorkOrders(filters map[string]string, page, limit int) ([]models.WorkOrder, models.PaginationMeta, error) {
-	query := selectWOQuery
+// GetWorkOrders returns one page of work orders matching q
+// In cursor mode only created_at / updated_at sorts are allowed (ErrCursorSort otherwise)
+func GetWorkOrders(ctx context.Context, q WorkOrderQuery, page Page) ([]models.WorkOrder, models.PaginationMeta, error) {
 	countQuery := "SELECT COUNT(*) FROM work_orders w LEFT JOIN users req ON w.requester_id = req.id"
+	where := q.where()
 
-	var conditions []string
-	var args []interface{}
-
-	if s := filters["status"]; s != "" {
-		if s == "active" {
-			conditions = append(conditions, "w.status IN (?, ?)")
-			args = append(args, "Pending", "In Progress")
-		} else {
-			conditions = append(conditions, "w.status = ?")
-			args = append(args, s)
+	var totalItems int
+	if !page.CursorMode || page.IncludeTotal {
+		countCtx, countSpan := startQuery(ctx, "workorders.count")
+		err := setting.DB.QueryRowContext(countCtx, countQuery+where.sql(), where.args...).Scan(&totalItems)
+		endQuery(countSpan, oneRow(err), err)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
 		}
 	}
-	if u := filters["unit"]; u != "" {
-		conditions = append(conditions, "w.unit = ?")
-		args = append(args, u)
-	}
-	if ru := filters["requester_unit"]; ru != "" {
-		conditions = append(conditions, "req.unit = ?")
-		args = append(args, ru)
-	}
-	if filters["date"] == "today" {
-		conditions = append(conditions, "DATE(w.created_at) = CURDATE()")
-	}
 
-	whereClause := ""
-	if len(conditions) > 0 {
-		whereClause = " WHERE " + strings.Join(conditions, " AND ")
-	}
-
-	var totalItems int
-	err := setting.DB.QueryRow(countQuery+whereClause, args...).Scan(&totalItems)
-	if err != nil {
-		return nil, models.PaginationMeta{}, err
+	var (
+		query string
+		args  []interface{}
+		ks    keyset
+	)
+	if page.CursorMode {
+		var err error
+		ks, err = q.keyset(page)
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+		ks.addCondition(&where)
+		query = selectWOQuery + where.sql() + ks.orderBy() + " LIMIT ?"
+		args = append(where.args, page.Limit+1)
+	} else {
+		order, err := q.orderBy()
+		if err != nil {
+			return nil, models.PaginationMeta{}, err
+		}
+		query = selectWOQuery + where.sql() + order.sql() + " LIMIT ? OFFSET ?"
+		args = append(where.args, order.args...)
+		args = append(args, page.Limit, page.offset())
 	}
 
-	offset := (page - 1) * limit
-	query += whereClause + " ORDER BY w.created_at DESC LIMIT ? OFFSET ?"
-	args = append(args, limit, offset)
-
-	rows, err := setting.DB.Query(query, args...)
+	selectCtx, selectSpan := startQuery(ctx, "workorders.list")
+	rows, err := setting.DB.QueryContext(selectCtx, query, args...)
 	if err != nil {
+		endQuery(selectSpan, 0, err)
 		return nil, models.PaginationMeta{}, err
 	}
 	defer rows.Close()
@@ -178,38 +219,63 @@ func GetWorkOrders(filters map[string]string, page, limit int) ([]models.WorkOrd
 			wos = append(wos, wo)
 		}
 	}
+	endQuery(selectSpan, int64(len(wos)), rows.Err())
 
-	totalPages := int(math.Ceil(float64(totalItems) / float64(limit)))
-	meta := models.PaginationMeta{
-		CurrentPage: page,
-		TotalPages:  totalPages,
-		TotalItems:  totalItems,
-		Limit:       limit,
+	var meta models.PaginationMeta
+	if page.CursorMode {
+		byUpdated := strings.TrimPrefix(ks.sort, "-") == "updated_at"
+		wos, meta = keysetPage(wos, ks, page.Limit, func(wo models.WorkOrder) (time.Time, uint) {
+			if byUpdated {
+				return wo.UpdatedAt, wo.ID
+			}
+			return wo.CreatedAt, wo.ID
+		})
+		if page.IncludeTotal {
+			meta.TotalItems = &totalItems
+		}
+	} else {
+		meta = page.offsetMeta(totalItems)
 	}
 
+	if err := loadTags(ctx, wos); err != nil {
+		return nil, models.PaginationMeta{}, err
+	}
 	return wos, meta, nil
 }
 
-func TakeWorkOrder(woID, userID uint) error {
-	res, err := setting.DB.Exec("UPDATE work_orders SET status=?, assignee_id=?, taken_at=NOW(), updated_at=NOW() WHERE id=? AND assignee_id IS NULL",
-		global.StatusInProgress, userID, woID)
-	if err != nil {
-		return err
-	}
-	if aff, _ := res.RowsAffected(); aff == 0 {
-		return fmt.Errorf("tiket sudah diambil")
-	}
-	return nil
+// TakeWorkOrder claims an unassigned request for userID
+// version is the row version the caller last saw; ErrVersionConflict is returned if it changed
+func TakeWorkOrder(ctx context.Context, woID, userID, version uint, actor Actor) error {
+	return updateWorkOrder(ctx, woID, version, actor, woChange{
+		span:      "workorders.take",
+		eventType: EventTaken,
+		set:       "status=?, assignee_id=?, taken_at=NOW()",
+		args:      []interface{}{global.StatusInProgress, userID},
+		where:     "assignee_id IS NULL",
+		after:     map[string]interface{}{"status": global.StatusInProgress, "assignee_id": userID},
+	})
 }
 
-func AssignWorkOrder(woID, userID uint) error {
-	_, err := setting.DB.Exec("UPDATE work_orders SET status=?, assignee_id=?, updated_at=NOW() WHERE id=?",
-		global.StatusInProgress, userID, woID)
-	return err
+// AssignWorkOrder sets the assignee of a request
+// version is the row version the caller last saw; ErrVersionConflict is returned if it changed
+func AssignWorkOrder(ctx context.Context, woID, userID, version uint, actor Actor) error {
+	return updateWorkOrder(ctx, woID, version, actor, woChange{
+		span:      "workorders.assign",
+		eventType: EventAssigned,
+		set:       "status=?, assignee_id=?",
+		args:      []interface{}{global.StatusInProgress, userID},
+		after:     map[string]interface{}{"status": global.StatusInProgress, "assignee_id": userID},
+	})
 }
 
-func FinalizeWorkOrder(woID uint, note string, userID uint) error {
-	_, err := setting.DB.Exec("UPDATE work_orders SET status=?, completion_note=?, completed_at=NOW(), completed_by_id=?, updated_at=NOW() WHERE id=?",
-		global.StatusCompleted, note, userID, woID)
-	return err
+// FinalizeWorkOrder marks a request as completed
+// version is the row version the caller last saw; ErrVersionConflict is returned if it changed
+func FinalizeWorkOrder(ctx context.Context, woID uint, note string, userID, version uint, actor Actor) error {
+	return updateWorkOrder(ctx, woID, version, actor, woChange{
+		span:      "workorders.finalize",
+		eventType: EventCompleted,
+		set:       "status=?, completion_note=?, completed_at=NOW(), completed_by_id=?",
+		args:      []interface{}{global.StatusCompleted, note, userID},
+		after:     map[string]interface{}{"status": global.StatusCompleted, "completion_note": note, "completed_by_id": userID},
+	})
 }
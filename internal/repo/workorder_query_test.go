@@ -0,0 +1,79 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"regexp"
+	"siro-backend/global"
+	"siro-backend/internal/testutil"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// expectLock expects lockWorkOrder of work order 7 in a new transaction
+func expectLock(mock sqlmock.Sqlmock, status string, assignee interface{}) {
+	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT status, assignee_id, completed_by_id, COALESCE(completion_note, '') FROM work_orders WHERE id = ? FOR UPDATE")).
+		WithArgs(7).
+		WillReturnRows(sqlmock.NewRows([]string{"status", "assignee_id", "completed_by_id", "completion_note"}).AddRow(status, assignee, nil, ""))
+}
+
+func TestWorkOrderVersionCheck(t *testing.T) {
+	ctx := context.Background()
+	assign := regexp.QuoteMeta("UPDATE work_orders SET status=?, assignee_id=?, updated_at=NOW(), version=version+1 WHERE id=? AND version=?") + "$"
+
+	t.Run("current version", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusPending, nil)
+		mock.ExpectExec(assign).WithArgs(global.StatusInProgress, 6, 7, 3).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO work_order_events").WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		if err := AssignWorkOrder(ctx, 7, 6, 3, APIActor(5)); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("changed by someone else", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusInProgress, 8)
+		mock.ExpectExec(assign).WithArgs(global.StatusInProgress, 6, 7, 3).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		if err := AssignWorkOrder(ctx, 7, 6, 3, APIActor(5)); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("err = %v, want ErrVersionConflict", err)
+		}
+	})
+
+	// The extra condition of take (still unassigned) fails the same way as the version
+	t.Run("taken in the meantime", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusInProgress, 8)
+		mock.ExpectExec(regexp.QuoteMeta("WHERE id=? AND version=? AND assignee_id IS NULL")).WithArgs(global.StatusInProgress, 5, 7, 3).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+		if err := TakeWorkOrder(ctx, 7, 5, 3, APIActor(5)); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("err = %v, want ErrVersionConflict", err)
+		}
+	})
+
+	t.Run("deleted", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		mock.ExpectBegin()
+		mock.ExpectQuery("FOR UPDATE").WithArgs(7).WillReturnError(sql.ErrNoRows)
+		mock.ExpectRollback()
+		if err := FinalizeWorkOrder(ctx, 7, "done", 5, 3, APIActor(5)); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("err = %v, want ErrVersionConflict", err)
+		}
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		mock := testutil.MockDB(t)
+		expectLock(mock, global.StatusPending, nil)
+		mock.ExpectExec(assign).WillReturnError(errors.New("lock wait timeout"))
+		mock.ExpectRollback()
+		if err := AssignWorkOrder(ctx, 7, 6, 3, APIActor(5)); err == nil || errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("err = %v, want the database error", err)
+		}
+	})
+}
@@ -1,20 +1,66 @@
 package routers
 
 import (
+	"net/http"
 	"siro-backend/global"
 	"siro-backend/internal/controller"
+	"siro-backend/internal/metrics"
 	"siro-backend/internal/middlewares"
+	"siro-backend/internal/openapi"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/response"
 
 	"github.com/gin-gonic/gin"
 )
 
-func SetupRoutes(r *gin.Engine) {
+func SetupRoutes(r *gin.Engine, cfg *config.Config) {
 	r.Static("/"+global.DirUploads, "./"+global.DirUploads)
 
-	r.POST("/login", controller.LoginHandler)
-	r.POST("/refresh", controller.RefreshHandler)
+	// Probes for the load balancer / orchestrator (no auth)
+	r.GET("/healthz", controller.Healthz)
+	r.GET("/readyz", controller.Readyz)
+	r.GET("/version", controller.GetVersion)
 
-	api := r.Group("/")
+	// Public keys of our access tokens, for services that verify them
+	r.GET("/.well-known/jwks.json", controller.JWKS)
+
+	// API documentation
+	r.GET("/openapi.json", openapi.Handler(cfg.Server.BaseURL))
+	r.GET("/docs", openapi.SwaggerUI)
+
+	// Prometheus metrics (optionally protected by its own token)
+	if cfg.Metrics.Enabled {
+		r.GET("/metrics", middlewares.MetricsAuth(cfg.Metrics.Token), gin.WrapH(metrics.Handler()))
+	}
+
+	registerAPI(r.Group(global.APIPrefix))
+
+	// SCIM 2.0 provisioning for identity providers (Azure AD, Okta, ...)
+	if cfg.SCIM.Enabled {
+		registerSCIM(r.Group("/scim/v2", middlewares.SCIMAuth(cfg.SCIM.Token)))
+	}
+
+	// Old unversioned routes, kept until every client has moved to /api/v1
+	if cfg.Server.LegacyRoutes {
+		registerAPI(r.Group("/", response.Legacy()))
+	}
+
+	r.NoRoute(func(c *gin.Context) {
+		response.Error(c, http.StatusNotFound, response.CodeNotFound, "Route not found")
+	})
+}
+
+// registerAPI adds all application routes to the given group
+func registerAPI(g *gin.RouterGroup) {
+	g.POST("/login", controller.LoginHandler)
+	g.POST("/refresh", controller.RefreshHandler)
+	g.POST("/password/change", controller.ChangePasswordHandler)
+	g.POST("/invitations/check", controller.CheckInvitation)
+	g.POST("/invitations/accept", controller.AcceptInvitation)
+	g.POST("/oidc/authorize", controller.OIDCAuthorize)
+	g.POST("/oidc/callback", controller.OIDCCallback)
+
+	api := g.Group("/")
 
 	api.Use(middlewares.AuthMiddleware())
 
@@ -26,12 +72,16 @@ func SetupRoutes(r *gin.Engine) {
 		api.GET("/staff", controller.GetStaffList)
 		api.PATCH("/staff/:id/availability", controller.UpdateAvailability)
 		api.GET("/activities", controller.GetActivities)
+		api.GET("/units", controller.GetUnits)
 
 		wo := api.Group("/workorders")
 		{
 			wo.GET("/stats", controller.GetStats)
+			wo.GET("/tags", controller.GetTags)
 			wo.GET("", controller.GetWorkOrders)
 			wo.POST("", controller.CreateWorkOrder)
+			wo.GET("/:id", controller.GetWorkOrder)
+			wo.GET("/:id/events", controller.GetWorkOrderEvents)
 			wo.PATCH("/:id/take", controller.TakeRequest)
 			wo.PATCH("/:id/assign", controller.AssignStaff)
 			wo.PATCH("/:id/finalize", controller.FinalizeOrder)
@@ -42,9 +92,43 @@ func SetupRoutes(r *gin.Engine) {
 		admin.Use(middlewares.AdminOnly())
 		{
 			admin.GET("/users", controller.GetAllUsers)
+			admin.POST("/users/import", controller.ImportUsers)
+			admin.GET("/users/export", controller.ExportUsers)
+			admin.GET("/users/:id", controller.GetUser)
 			admin.POST("/users", controller.CreateUser)
 			admin.PUT("/users/:id", controller.UpdateUser)
 			admin.DELETE("/users/:id", controller.DeleteUser)
+			admin.POST("/users/:id/reactivate", controller.ReactivateUser)
+			admin.POST("/users/:id/anonymize", controller.AnonymizeUser)
+			admin.POST("/users/:id/invite", controller.InviteUser)
+			admin.GET("/service-accounts", controller.GetServiceAccounts)
+			admin.POST("/service-accounts", controller.CreateServiceAccount)
+			admin.DELETE("/service-accounts/:id", controller.DeactivateServiceAccount)
+			admin.POST("/service-accounts/:id/keys", controller.CreateAPIKey)
+			admin.DELETE("/service-accounts/:id/keys/:keyId", controller.RevokeAPIKey)
+			admin.POST("/units", controller.CreateUnit)
+			admin.GET("/events", controller.GetEvents)
+			admin.GET("/audit", controller.GetAudit)
 		}
 	}
 }
+
+// registerSCIM adds the SCIM endpoints to the given group
+func registerSCIM(g *gin.RouterGroup) {
+	g.GET("/ServiceProviderConfig", controller.SCIMServiceProviderConfig)
+	g.GET("/ResourceTypes", controller.SCIMResourceTypes)
+
+	g.GET("/Users", controller.SCIMListUsers)
+	g.POST("/Users", controller.SCIMCreateUser)
+	g.GET("/Users/:id", controller.SCIMGetUser)
+	g.PUT("/Users/:id", controller.SCIMReplaceUser)
+	g.PATCH("/Users/:id", controller.SCIMPatchUser)
+	g.DELETE("/Users/:id", controller.SCIMDeleteUser)
+
+	g.GET("/Groups", controller.SCIMListGroups)
+	g.POST("/Groups", controller.SCIMCreateGroup)
+	g.GET("/Groups/:id", controller.SCIMGetGroup)
+	g.PUT("/Groups/:id", controller.SCIMReplaceGroup)
+	g.PATCH("/Groups/:id", controller.SCIMPatchGroup)
+	g.DELETE("/Groups/:id", controller.SCIMDeleteGroup)
+}
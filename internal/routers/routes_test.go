@@ -0,0 +1,104 @@
+package routers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/global"
+	"siro-backend/internal/middlewares"
+	"siro-backend/internal/openapi"
+	"siro-backend/pkg/config"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newTestRouter registers all routes the way the server does, without legacy duplicates
+func newTestRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	cfg := config.Default()
+	cfg.Server.LegacyRoutes = false
+	cfg.Metrics.Enabled = true
+	cfg.SCIM.Enabled = true
+	cfg.SCIM.Token = strings.Repeat("x", 32)
+
+	r := gin.New()
+	SetupRoutes(r, &cfg)
+	return r
+}
+
+// TestAllRoutesDocumented fails when a route is added without an entry in openapi.Operations
+func TestAllRoutesDocumented(t *testing.T) {
+	documented := openapi.Documented()
+
+	for _, route := range newTestRouter().Routes() {
+		// r.Static registers HEAD next to GET for the same files
+		if route.Method == http.MethodHead {
+			continue
+		}
+		key := route.Method + " " + route.Path
+		if !documented[key] {
+			t.Errorf("route %s is not documented in internal/openapi/operations.go", key)
+		}
+	}
+}
+
+// TestNoStaleDocumentation fails when a documented route no longer exists
+func TestNoStaleDocumentation(t *testing.T) {
+	registered := map[string]bool{}
+	for _, route := range newTestRouter().Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	for _, op := range openapi.Operations {
+		if !registered[op.Key()] {
+			t.Errorf("documented route %s is not registered in SetupRoutes", op.Key())
+		}
+	}
+}
+
+// TestOpenAPIServed checks that /openapi.json returns a valid 3.1 document
+func TestOpenAPIServed(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/openapi.json", nil))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("GET /openapi.json: status %d", w.Code)
+	}
+
+	var doc struct {
+		OpenAPI string                     `json:"openapi"`
+		Paths   map[string]json.RawMessage `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid JSON: %v", err)
+	}
+	if doc.OpenAPI != "3.1.0" {
+		t.Errorf("openapi version = %q, want 3.1.0", doc.OpenAPI)
+	}
+	if _, ok := doc.Paths["/api/v1/workorders/{id}/take"]; !ok {
+		t.Errorf("path /api/v1/workorders/{id}/take missing from document")
+	}
+}
+
+// TestAPIKeyScopesDocumented fails when the scopes in the documentation and in the API key middleware differ
+func TestAPIKeyScopesDocumented(t *testing.T) {
+	documented := map[string]string{}
+	for _, op := range openapi.Operations {
+		if op.Scope != "" {
+			documented[op.Method+" "+strings.TrimPrefix(op.Path, global.APIPrefix)] = op.Scope
+		}
+	}
+
+	for route, scope := range middlewares.APIKeyRoutes {
+		if documented[route] != scope {
+			t.Errorf("route %s needs scope %q, documented as %q", route, scope, documented[route])
+		}
+	}
+	for route := range documented {
+		if _, ok := middlewares.APIKeyRoutes[route]; !ok {
+			t.Errorf("route %s is documented with a scope but not in middlewares.APIKeyRoutes", route)
+		}
+	}
+}
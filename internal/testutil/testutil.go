@@ -0,0 +1,55 @@
+// Package testutil holds the fixtures shared by the tests of the internal packages.
+// Only _test.go files import it.
+//
+//	mock := testutil.MockDB(t)
+//	mock.ExpectQuery("FROM users").WillReturnRows(...)
+package testutil
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"siro-backend/pkg/response"
+	"siro-backend/pkg/setting"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+// MockDB replaces setting.DB with a sqlmock for the test and checks all expectations were met
+func MockDB(t *testing.T) sqlmock.Sqlmock {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal(err)
+	}
+	old := setting.DB
+	setting.DB = db
+	t.Cleanup(func() {
+		setting.DB = old
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+		db.Close()
+	})
+	return mock
+}
+
+// DecodeEnvelope reads a /api/v1 response, decoding "data" into data if it isn't nil
+func DecodeEnvelope(t *testing.T, w *httptest.ResponseRecorder, data interface{}) response.Envelope {
+	t.Helper()
+	env := response.Envelope{Data: data}
+	if err := json.Unmarshal(w.Body.Bytes(), &env); err != nil {
+		t.Fatalf("response %q is not JSON: %v", w.Body.String(), err)
+	}
+	return env
+}
+
+// ErrorCode returns the error code of a /api/v1 response, "" on success
+func ErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	env := DecodeEnvelope(t, w, nil)
+	if env.Error == nil {
+		return ""
+	}
+	return env.Error.Code
+}
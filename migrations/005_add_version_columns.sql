@@ -0,0 +1,13 @@
+-- Migration: Add Version Columns
+-- Description: Adds a row version to users and work_orders for optimistic concurrency (ETag / If-Match)
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1 AFTER can_crud;
+
+ALTER TABLE work_orders
+ADD COLUMN version INT UNSIGNED NOT NULL DEFAULT 1 AFTER completion_note;
+
+-- ROLLBACK:
+-- ALTER TABLE users DROP COLUMN version;
+-- ALTER TABLE work_orders DROP COLUMN version;
@@ -0,0 +1,23 @@
+-- Migration: Create Schema Migrations Table
+-- Description: Records which migration files have been applied, so /readyz can report pending ones
+-- Date: 2026-10-19
+--
+-- From now on every migration must end with a line that records itself, e.g.:
+--   INSERT IGNORE INTO schema_migrations (version) VALUES ('007_add_something');
+
+CREATE TABLE IF NOT EXISTS schema_migrations (
+    version VARCHAR(255) NOT NULL PRIMARY KEY,
+    applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Backfill the migrations that existed before this table
+INSERT IGNORE INTO schema_migrations (version) VALUES
+    ('001_create_users_table'),
+    ('002_create_user_tokens_table'),
+    ('003_create_work_orders_table'),
+    ('004_create_activity_logs_table'),
+    ('005_add_version_columns'),
+    ('006_create_schema_migrations_table');
+
+-- ROLLBACK:
+-- DROP TABLE schema_migrations;
@@ -0,0 +1,18 @@
+-- Migration: Create Units Table
+-- Description: List of valid units, so user and work order input can be checked against it
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS units (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    name VARCHAR(255) NOT NULL UNIQUE,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Backfill the units that are already in use
+INSERT IGNORE INTO units (name) SELECT DISTINCT unit FROM users WHERE unit <> '';
+INSERT IGNORE INTO units (name) SELECT DISTINCT unit FROM work_orders WHERE unit <> '';
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('007_create_units_table');
+
+-- ROLLBACK:
+-- DROP TABLE units;
@@ -0,0 +1,12 @@
+-- Migration: Normalize User Roles
+-- Description: Fixes roles saved with the wrong case (e.g. "admin"), which failed the AdminOnly check
+-- Date: 2026-10-19
+
+-- The column collation is case-insensitive, so BINARY is needed to find the wrong spellings
+UPDATE users SET role = 'Admin' WHERE role = 'Admin' AND BINARY role <> 'Admin';
+UPDATE users SET role = 'Staff' WHERE BINARY role NOT IN ('Admin', 'Staff');
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('008_normalize_user_roles');
+
+-- ROLLBACK:
+-- Not reversible (the original spelling is not kept)
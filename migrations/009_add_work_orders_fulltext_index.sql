@@ -0,0 +1,11 @@
+-- Migration: Add Full-Text Index to Work Orders
+-- Description: Lets GET /workorders?q= search title, description and completion note with relevance ranking
+-- Date: 2026-10-19
+
+ALTER TABLE work_orders
+    ADD FULLTEXT INDEX ft_work_orders_search (title, description, completion_note);
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('009_add_work_orders_fulltext_index');
+
+-- ROLLBACK:
+-- ALTER TABLE work_orders DROP INDEX ft_work_orders_search;
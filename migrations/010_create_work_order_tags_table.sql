@@ -0,0 +1,24 @@
+-- Migration: Create Work Order Tags Table
+-- Description: Free-form tags on work orders (e.g. "printer", "network"), used by GET /workorders?tags=
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS work_order_tags (
+    work_order_id INT UNSIGNED NOT NULL,
+    tag VARCHAR(50) NOT NULL,
+
+    PRIMARY KEY (work_order_id, tag),
+    FOREIGN KEY (work_order_id) REFERENCES work_orders(id) ON DELETE CASCADE,
+    INDEX idx_tag (tag)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Indexes for the new filters and sort options
+ALTER TABLE work_orders
+    ADD INDEX idx_priority (priority),
+    ADD INDEX idx_completed_at (completed_at),
+    ADD INDEX idx_updated_at (updated_at);
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('010_create_work_order_tags_table');
+
+-- ROLLBACK:
+-- ALTER TABLE work_orders DROP INDEX idx_priority, DROP INDEX idx_completed_at, DROP INDEX idx_updated_at;
+-- DROP TABLE work_order_tags;
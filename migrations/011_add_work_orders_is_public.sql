@@ -0,0 +1,12 @@
+-- Migration: Add Public Flag to Work Orders
+-- Description: Work orders are only visible to the target unit and the requester's unit (and admins).
+--              is_public = TRUE makes one visible to everyone in the organisation (read only)
+-- Date: 2026-10-19
+
+ALTER TABLE work_orders
+ADD COLUMN is_public BOOLEAN NOT NULL DEFAULT FALSE AFTER photo_url;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('011_add_work_orders_is_public');
+
+-- ROLLBACK:
+-- ALTER TABLE work_orders DROP COLUMN is_public;
@@ -0,0 +1,52 @@
+-- Migration: Create Work Order Events Table
+-- Description: Structured change history of work orders. Every mutation stores the changed fields
+--              before and after as JSON, who did it and where it came from (api or migration).
+--              Unlike activity_logs (free text for the feed) this is meant for history and reporting.
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS work_order_events (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    work_order_id INT UNSIGNED NOT NULL,
+    event_type VARCHAR(50) NOT NULL,
+    actor_id INT UNSIGNED NULL,
+    source VARCHAR(20) NOT NULL DEFAULT 'api',
+    old_values JSON NULL,
+    new_values JSON NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    FOREIGN KEY (work_order_id) REFERENCES work_orders(id) ON DELETE CASCADE,
+    FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_work_order (work_order_id, created_at),
+    INDEX idx_actor (actor_id, created_at),
+    INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Backfill history of existing work orders from their timestamps (source 'migration')
+-- Skipped for orders that already have events, so running the file twice is safe
+INSERT INTO work_order_events (work_order_id, event_type, actor_id, source, old_values, new_values, created_at)
+SELECT w.id, 'created', w.requester_id, 'migration', NULL,
+       JSON_OBJECT('title', w.title, 'priority', w.priority, 'unit', w.unit, 'status', 'Pending'), w.created_at
+FROM work_orders w
+WHERE NOT EXISTS (SELECT 1 FROM work_order_events e WHERE e.work_order_id = w.id);
+
+INSERT INTO work_order_events (work_order_id, event_type, actor_id, source, old_values, new_values, created_at)
+SELECT w.id, 'taken', w.assignee_id, 'migration',
+       JSON_OBJECT('status', 'Pending', 'assignee_id', NULL),
+       JSON_OBJECT('status', 'In Progress', 'assignee_id', w.assignee_id), w.taken_at
+FROM work_orders w
+WHERE w.taken_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM work_order_events e WHERE e.work_order_id = w.id AND e.event_type <> 'created');
+
+INSERT INTO work_order_events (work_order_id, event_type, actor_id, source, old_values, new_values, created_at)
+SELECT w.id, 'completed', w.completed_by_id, 'migration',
+       JSON_OBJECT('status', 'In Progress'),
+       JSON_OBJECT('status', 'Completed', 'completed_by_id', w.completed_by_id, 'completion_note', COALESCE(w.completion_note, '')),
+       w.completed_at
+FROM work_orders w
+WHERE w.completed_at IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM work_order_events e WHERE e.work_order_id = w.id AND e.event_type = 'completed');
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('012_create_work_order_events_table');
+
+-- ROLLBACK:
+-- DROP TABLE work_order_events;
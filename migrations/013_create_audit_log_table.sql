@@ -0,0 +1,44 @@
+-- Migration: Create Audit Log Table
+-- Description: Append-only log of administrative actions (user create/update/delete, password resets, ...)
+--              Every row stores the SHA-256 hash of its content and of the previous row (see pkg/audit),
+--              so edited or deleted rows are detected by `go run ./cmd/auditverify`.
+--              actor_id has no foreign key on purpose: the log must outlive the users it mentions.
+--              diff is TEXT instead of JSON because MySQL reformats JSON, which would change the hash.
+--              created_at is always UTC with microseconds (written as text by the server, not as a
+--              local time), because the hash covers it: a time zone change must not alter it.
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS audit_log (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    actor_id INT UNSIGNED NULL,
+    actor_name VARCHAR(255) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    target_type VARCHAR(32) NOT NULL,
+    target_id VARCHAR(64) NOT NULL,
+    diff TEXT NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    user_agent VARCHAR(500) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    prev_hash CHAR(64) NOT NULL,
+    hash CHAR(64) NOT NULL,
+
+    INDEX idx_actor (actor_id, created_at),
+    INDEX idx_action (action, created_at),
+    INDEX idx_target (target_type, target_id),
+    INDEX idx_created_at (created_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+-- Hash of the newest entry. Writers lock this row, so entries are chained one at a time
+-- even with several server instances, and cutting rows off the end is detected too
+CREATE TABLE IF NOT EXISTS audit_chain_head (
+    id TINYINT UNSIGNED PRIMARY KEY,
+    last_hash CHAR(64) NOT NULL
+) ENGINE=InnoDB;
+
+INSERT IGNORE INTO audit_chain_head (id, last_hash) VALUES (1, REPEAT('0', 64));
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('013_create_audit_log_table');
+
+-- ROLLBACK:
+-- DROP TABLE audit_chain_head;
+-- DROP TABLE audit_log;
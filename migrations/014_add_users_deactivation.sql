@@ -0,0 +1,15 @@
+-- Migration: Add User Deactivation
+-- Description: Users are deactivated instead of deleted, so work orders and logs keep pointing at them.
+--              deactivated_at set = can't log in; anonymized_at set = personal data was erased (GDPR-style
+--              request) and the account can't be reactivated.
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN deactivated_at DATETIME NULL AFTER version,
+ADD COLUMN anonymized_at DATETIME NULL AFTER deactivated_at,
+ADD INDEX idx_deactivated_at (deactivated_at);
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('014_add_users_deactivation');
+
+-- ROLLBACK:
+-- ALTER TABLE users DROP INDEX idx_deactivated_at, DROP COLUMN anonymized_at, DROP COLUMN deactivated_at;
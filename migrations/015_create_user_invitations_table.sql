@@ -0,0 +1,29 @@
+-- Migration: Create User Invitations Table
+-- Description: Admins can create users without a password and invite them instead. The invitee gets a
+--              link with a random token and sets their own password; only the SHA-256 hash of the token
+--              is stored. must_change_password forces a new password at the next login.
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN must_change_password BOOLEAN NOT NULL DEFAULT FALSE AFTER password_hash;
+
+CREATE TABLE IF NOT EXISTS user_invitations (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT UNSIGNED NOT NULL,
+    token_hash CHAR(64) NOT NULL,
+    invited_by INT UNSIGNED NULL,
+    expires_at DATETIME NOT NULL,
+    accepted_at DATETIME NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE KEY uq_token_hash (token_hash),
+    FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY (invited_by) REFERENCES users(id) ON DELETE SET NULL,
+    INDEX idx_user_id (user_id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('015_create_user_invitations_table');
+
+-- ROLLBACK:
+-- DROP TABLE IF EXISTS user_invitations;
+-- ALTER TABLE users DROP COLUMN must_change_password;
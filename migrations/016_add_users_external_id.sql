@@ -0,0 +1,13 @@
+-- Migration: Add External ID to Users
+-- Description: ID of the user in the identity provider that provisions accounts over SCIM
+--              (externalId). Unique, so a provisioning client can't create the same person twice.
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN external_id VARCHAR(255) NULL AFTER id,
+ADD UNIQUE INDEX uq_external_id (external_id);
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('016_add_users_external_id');
+
+-- ROLLBACK:
+-- ALTER TABLE users DROP INDEX uq_external_id, DROP COLUMN external_id;
@@ -0,0 +1,28 @@
+-- Migration: Create OIDC Logins Table
+-- Description: Single sign-on with an OpenID Connect provider. oidc_logins holds the login attempts
+--              that were started but not finished yet: the SHA-256 hash of the state, and the PKCE
+--              code verifier and nonce that belong to it. users.oidc_subject links a user to their
+--              identity at the provider (the "sub" claim).
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN oidc_subject VARCHAR(255) NULL AFTER external_id,
+ADD UNIQUE INDEX uq_oidc_subject (oidc_subject);
+
+CREATE TABLE IF NOT EXISTS oidc_logins (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    state_hash CHAR(64) NOT NULL,
+    code_verifier VARCHAR(128) NOT NULL,
+    nonce VARCHAR(128) NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE KEY uq_state_hash (state_hash),
+    INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('017_create_oidc_logins_table');
+
+-- ROLLBACK:
+-- DROP TABLE IF EXISTS oidc_logins;
+-- ALTER TABLE users DROP INDEX uq_oidc_subject, DROP COLUMN oidc_subject;
@@ -0,0 +1,24 @@
+-- Migration: Create JWT Keys Table
+-- Description: Key pairs that sign access and refresh tokens when jwt.algorithm is RS256 or EdDSA.
+--              The server creates them itself and rotates them on a schedule (JWT_KEY_ROTATION).
+--              A key is published at /.well-known/jwks.json before activates_at and until
+--              expires_at, so every token it signed can still be verified. private_key is the
+--              PKCS #8 key sealed with a key derived from JWT_SECRET; public_key is PKIX DER.
+-- Date: 2026-10-19
+
+CREATE TABLE IF NOT EXISTS jwt_keys (
+    kid VARCHAR(32) NOT NULL PRIMARY KEY,
+    algorithm VARCHAR(16) NOT NULL,
+    public_key VARBINARY(1024) NOT NULL,
+    private_key VARBINARY(2048) NOT NULL,
+    activates_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    INDEX idx_expires_at (expires_at)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('018_create_jwt_keys_table');
+
+-- ROLLBACK:
+-- DROP TABLE IF EXISTS jwt_keys;
@@ -0,0 +1,38 @@
+-- Migration: Create API Keys Table
+-- Description: Service accounts for integrations (e.g. the building management system) and their
+--              API keys. A service account is a row in users with service_account = TRUE, so the
+--              work orders it creates have a requester like any other; it has no password and
+--              can't log in. api_keys stores only the SHA-256 hash of each key (the key is shown
+--              once), its scopes with optional unit limits and IP allowlist as JSON, and when and
+--              from where it was last used.
+-- Date: 2026-10-19
+
+ALTER TABLE users
+ADD COLUMN service_account BOOLEAN NOT NULL DEFAULT FALSE AFTER oidc_subject;
+
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INT UNSIGNED AUTO_INCREMENT PRIMARY KEY,
+    user_id INT UNSIGNED NOT NULL,
+    name VARCHAR(100) NOT NULL,
+    prefix VARCHAR(16) NOT NULL,
+    key_hash CHAR(64) NOT NULL,
+    scopes JSON NOT NULL,
+    allowed_ips JSON NOT NULL,
+    expires_at DATETIME NULL,
+    last_used_at DATETIME NULL,
+    last_used_ip VARCHAR(45) NULL,
+    revoked_at DATETIME NULL,
+    created_by INT UNSIGNED NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    UNIQUE KEY uq_key_hash (key_hash),
+    INDEX idx_user_id (user_id),
+    FOREIGN KEY (user_id) REFERENCES users(id),
+    FOREIGN KEY (created_by) REFERENCES users(id)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8mb4 COLLATE=utf8mb4_unicode_ci;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('019_create_api_keys_table');
+
+-- ROLLBACK:
+-- DROP TABLE IF EXISTS api_keys;
+-- ALTER TABLE users DROP COLUMN service_account;
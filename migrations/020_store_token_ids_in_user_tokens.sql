@@ -0,0 +1,22 @@
+-- Migration: Store Token IDs In user_tokens
+-- Description: user_tokens kept the full access and refresh JWTs, so a copy of the database
+--              contained working sessions. It now keeps only their IDs (the jti claim), which are
+--              compared in constant time and can't be turned back into tokens without the signing
+--              key. The existing sessions are deleted first: their tokens have no jti, so they
+--              would be refused anyway, and everyone simply logs in again.
+-- Date: 2026-10-19
+
+DELETE FROM user_tokens;
+
+ALTER TABLE user_tokens
+DROP COLUMN access_token,
+DROP COLUMN refresh_token,
+ADD COLUMN access_jti VARCHAR(64) NOT NULL AFTER user_id,
+ADD COLUMN refresh_jti VARCHAR(64) NOT NULL AFTER access_jti;
+
+INSERT IGNORE INTO schema_migrations (version) VALUES ('020_store_token_ids_in_user_tokens');
+
+-- ROLLBACK (everyone logs in again):
+-- DELETE FROM user_tokens;
+-- ALTER TABLE user_tokens DROP COLUMN access_jti, DROP COLUMN refresh_jti,
+--     ADD COLUMN access_token TEXT NOT NULL AFTER user_id, ADD COLUMN refresh_token TEXT NOT NULL AFTER access_token;
@@ -0,0 +1,31 @@
+package migrations
+
+import (
+	"embed"
+	"path"
+	"sort"
+	"strings"
+)
+
+//go:embed *.sql
+var files embed.FS
+
+// Versions returns the names (without .sql) of all numbered migration files, in order
+// Example files such as EXAMPLE_how_to_add_new_feature.sql are skipped
+func Versions() []string {
+	entries, err := files.ReadDir(".")
+	if err != nil {
+		return nil
+	}
+
+	var versions []string
+	for _, e := range entries {
+		name := e.Name()
+		if name == "" || name[0] < '0' || name[0] > '9' {
+			continue
+		}
+		versions = append(versions, strings.TrimSuffix(name, path.Ext(name)))
+	}
+	sort.Strings(versions)
+	return versions
+}
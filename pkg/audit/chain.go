@@ -0,0 +1,126 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// GenesisHash is the prev_hash of the first entry
+var GenesisHash = strings.Repeat("0", 64)
+
+// LogEntry is one audit_log row
+// Hash covers every field except ID and Hash itself, plus the hash of the previous entry,
+// so changing, removing or reordering a row breaks the chain from that row on
+type LogEntry struct {
+	ID         uint      `json:"id"`
+	ActorID    *uint     `json:"actorId"`
+	ActorName  string    `json:"actor"`
+	Action     string    `json:"action"` // e.g. user.update, user.password_reset
+	TargetType string    `json:"targetType"`
+	TargetID   string    `json:"targetId"`
+	Diff       string    `json:"diff"` // JSON text, see Diff
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"created_at"`
+	PrevHash   string    `json:"prevHash"`
+	Hash       string    `json:"hash"`
+}
+
+// ComputeHash returns the SHA-256 of the entry's content chained to e.PrevHash
+func (e LogEntry) ComputeHash() string {
+	// A fixed struct keeps the encoding stable; time is in UTC with microseconds like DATETIME(6)
+	content, _ := json.Marshal(struct {
+		Prev       string
+		At         string
+		ActorID    *uint
+		ActorName  string
+		Action     string
+		TargetType string
+		TargetID   string
+		Diff       string
+		IP         string
+		UserAgent  string
+	}{e.PrevHash, e.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z"), e.ActorID, e.ActorName,
+		e.Action, e.TargetType, e.TargetID, e.Diff, e.IP, e.UserAgent})
+
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Chain checks entries one after another in id order, starting at GenesisHash
+type Chain struct {
+	head string
+}
+
+// NewChain returns a Chain before the first entry
+func NewChain() *Chain {
+	return &Chain{head: GenesisHash}
+}
+
+// Check returns what is wrong with e, the next entry, or "" if it continues the chain
+func (c *Chain) Check(e LogEntry) string {
+	switch {
+	case e.PrevHash != c.head:
+		return "prev_hash does not match the previous entry (entry removed or reordered)"
+	case e.ComputeHash() != e.Hash:
+		return "content does not match its hash (entry modified)"
+	}
+	c.head = e.Hash
+	return ""
+}
+
+// Head is the hash of the last intact entry, to compare with audit_chain_head
+func (c *Chain) Head() string {
+	return c.head
+}
+
+// Change is the old and new value of one field
+type Change struct {
+	From interface{} `json:"from,omitempty"`
+	To   interface{} `json:"to,omitempty"`
+}
+
+// Redacted replaces the value of a personal field in a diff, see DiffRedacted
+const Redacted = "[redacted]"
+
+// Diff returns the fields whose value differs between before and after (nil maps are allowed,
+// e.g. before = nil for a create) as JSON text
+func Diff(before, after map[string]interface{}) string {
+	return DiffRedacted(before, after)
+}
+
+// DiffRedacted is Diff, but the values of the personal fields are replaced by Redacted
+// The entry still shows which of them changed. Entries can't be edited later, so personal data
+// written here could never be erased.
+func DiffRedacted(before, after map[string]interface{}, personal ...string) string {
+	changes := map[string]Change{}
+	for field, old := range before {
+		if neu, ok := after[field]; !ok || !reflect.DeepEqual(neu, old) {
+			changes[field] = Change{From: old, To: after[field]}
+		}
+	}
+	for field, neu := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = Change{To: neu}
+		}
+	}
+	for _, field := range personal {
+		if ch, ok := changes[field]; ok {
+			changes[field] = Change{From: redact(ch.From), To: redact(ch.To)}
+		}
+	}
+	b, _ := json.Marshal(changes)
+	return string(b)
+}
+
+// redact hides v; an empty value stays empty, so setting or clearing a field is still visible
+func redact(v interface{}) interface{} {
+	if v == nil || v == "" {
+		return v
+	}
+	return Redacted
+}
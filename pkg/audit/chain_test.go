@@ -0,0 +1,180 @@
+package audit
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func decodeDiff(t *testing.T, diff string) map[string]Change {
+	t.Helper()
+	var changes map[string]Change
+	if err := json.Unmarshal([]byte(diff), &changes); err != nil {
+		t.Fatalf("diff %q is not JSON: %v", diff, err)
+	}
+	return changes
+}
+
+func TestDiffRedacted(t *testing.T) {
+	before := map[string]interface{}{"name": "Budi", "email": "budi@example.com", "phone": "", "role": "Staff"}
+	after := map[string]interface{}{"name": "Budi Santoso", "email": "budi@example.com", "phone": "0812", "role": "Admin"}
+
+	diff := DiffRedacted(before, after, "name", "email", "phone")
+	for _, secret := range []string{"Budi", "budi@example.com", "0812"} {
+		if strings.Contains(diff, secret) {
+			t.Errorf("diff %s contains personal value %q", diff, secret)
+		}
+	}
+
+	want := map[string]Change{
+		"name":  {From: Redacted, To: Redacted},
+		"phone": {From: "", To: Redacted}, // was empty, so setting it stays visible
+		"role":  {From: "Staff", To: "Admin"},
+	}
+	if got := decodeDiff(t, diff); !reflect.DeepEqual(got, want) {
+		t.Errorf("DiffRedacted = %v, want %v", got, want)
+	}
+}
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name          string
+		before, after map[string]interface{}
+		want          map[string]Change
+	}{
+		{"create", nil, map[string]interface{}{"role": "Staff"}, map[string]Change{"role": {To: "Staff"}}},
+		{"unchanged", map[string]interface{}{"role": "Staff"}, map[string]interface{}{"role": "Staff"}, map[string]Change{}},
+		{"changed", map[string]interface{}{"role": "Staff", "unit": "IT"}, map[string]interface{}{"role": "Admin", "unit": "IT"},
+			map[string]Change{"role": {From: "Staff", To: "Admin"}}},
+		{"removed", map[string]interface{}{"unit": "IT"}, map[string]interface{}{}, map[string]Change{"unit": {From: "IT"}}},
+		{"bool", map[string]interface{}{"can_crud": false}, map[string]interface{}{"can_crud": true},
+			map[string]Change{"can_crud": {From: false, To: true}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := decodeDiff(t, Diff(tt.before, tt.after)); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func testEntry(prev string, at time.Time) LogEntry {
+	actor := uint(7)
+	e := LogEntry{
+		ActorID:    &actor,
+		Action:     "user.update",
+		TargetType: "user",
+		TargetID:   "12",
+		Diff:       `{"role":{"from":"Staff","to":"Admin"}}`,
+		IP:         "10.0.0.1",
+		UserAgent:  "curl/8.0",
+		CreatedAt:  at,
+		PrevHash:   prev,
+	}
+	e.Hash = e.ComputeHash()
+	return e
+}
+
+func TestComputeHash(t *testing.T) {
+	at := time.Date(2026, 10, 19, 8, 30, 0, 123456000, time.UTC)
+	e := testEntry(GenesisHash, at)
+	if len(e.Hash) != 64 {
+		t.Fatalf("hash %q is not hex SHA-256", e.Hash)
+	}
+
+	// The same instant read back in another zone hashes the same
+	jakarta := time.FixedZone("WIB", 7*3600)
+	if got := testEntry(GenesisHash, at.In(jakarta)).Hash; got != e.Hash {
+		t.Errorf("hash changed with the time zone: %s != %s", got, e.Hash)
+	}
+
+	// Every hashed field changes the hash
+	changes := map[string]func(*LogEntry){
+		"prev":   func(e *LogEntry) { e.PrevHash = strings.Repeat("1", 64) },
+		"time":   func(e *LogEntry) { e.CreatedAt = e.CreatedAt.Add(time.Microsecond) },
+		"actor":  func(e *LogEntry) { e.ActorID = nil },
+		"name":   func(e *LogEntry) { e.ActorName = "scim" },
+		"action": func(e *LogEntry) { e.Action = "user.create" },
+		"target": func(e *LogEntry) { e.TargetID = "13" },
+		"diff":   func(e *LogEntry) { e.Diff = "{}" },
+		"ip":     func(e *LogEntry) { e.IP = "10.0.0.2" },
+		"agent":  func(e *LogEntry) { e.UserAgent = "" },
+	}
+	for name, change := range changes {
+		changed := e
+		change(&changed)
+		if changed.ComputeHash() == e.Hash {
+			t.Errorf("changing %s does not change the hash", name)
+		}
+	}
+
+	// ID and Hash are not part of the content
+	other := e
+	other.ID, other.Hash = 99, ""
+	if other.ComputeHash() != e.Hash {
+		t.Error("ID or Hash is part of the hash")
+	}
+}
+
+// testChain returns n chained entries with ids 1..n
+func testChain(n int) []LogEntry {
+	entries := make([]LogEntry, n)
+	prev := GenesisHash
+	at := time.Date(2026, 10, 19, 8, 0, 0, 0, time.UTC)
+	for i := range entries {
+		entries[i] = testEntry(prev, at.Add(time.Duration(i)*time.Minute))
+		entries[i].ID = uint(i + 1)
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+// walk checks entries like auditverify; it returns the id of the first bad entry (0 = none)
+func walk(entries []LogEntry) (uint, string, string) {
+	chain := NewChain()
+	for _, e := range entries {
+		if problem := chain.Check(e); problem != "" {
+			return e.ID, problem, chain.Head()
+		}
+	}
+	return 0, "", chain.Head()
+}
+
+func TestChain(t *testing.T) {
+	intact := testChain(4)
+	if id, problem, head := walk(intact); id != 0 || head != intact[3].Hash {
+		t.Fatalf("intact chain: broken at %d (%s), head %.12s", id, problem, head)
+	}
+
+	tests := []struct {
+		name     string
+		tamper   func([]LogEntry) []LogEntry
+		brokenAt uint
+		problem  string
+	}{
+		{"modified", func(e []LogEntry) []LogEntry { e[1].Diff = "{}"; return e }, 2, "modified"},
+		{"modified and rehashed", func(e []LogEntry) []LogEntry {
+			e[1].Diff = "{}"
+			e[1].Hash = e[1].ComputeHash()
+			return e
+		}, 3, "removed or reordered"},
+		{"removed", func(e []LogEntry) []LogEntry { return append(e[:1], e[2:]...) }, 3, "removed or reordered"},
+		{"reordered", func(e []LogEntry) []LogEntry { e[1], e[2] = e[2], e[1]; return e }, 3, "removed or reordered"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, problem, _ := walk(tt.tamper(testChain(4)))
+			if id != tt.brokenAt || !strings.Contains(problem, tt.problem) {
+				t.Errorf("broken at %d (%q), want %d (%q)", id, problem, tt.brokenAt, tt.problem)
+			}
+		})
+	}
+
+	// Cutting entries off the end keeps the rest intact; only audit_chain_head shows it
+	if id, _, head := walk(intact[:3]); id != 0 || head == intact[3].Hash {
+		t.Errorf("truncated chain: broken at %d, head %.12s", id, head)
+	}
+}
@@ -0,0 +1,25 @@
+package buildinfo
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestGetLdflags(t *testing.T) {
+	oldVersion, oldCommit, oldTime := Version, Commit, BuildTime
+	t.Cleanup(func() { Version, Commit, BuildTime = oldVersion, oldCommit, oldTime })
+
+	// values set with -ldflags win over the VCS data
+	Version, Commit, BuildTime = "1.2.0", "abc123", "2026-01-02T03:04:05Z"
+	want := Info{Version: "1.2.0", Commit: "abc123", BuildTime: "2026-01-02T03:04:05Z", GoVersion: runtime.Version()}
+	if got := Get(); got != want {
+		t.Errorf("Get() = %+v, want %+v", got, want)
+	}
+}
+
+func TestGetDefaults(t *testing.T) {
+	got := Get()
+	if got.Version != "dev" || got.GoVersion != runtime.Version() {
+		t.Errorf("Get() = %+v, want version dev and %s", got, runtime.Version())
+	}
+}
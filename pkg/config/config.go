@@ -0,0 +1,689 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"siro-backend/global"
+	"siro-backend/pkg/jwtkeys"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/goccy/go-yaml"
+	"github.com/pelletier/go-toml/v2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Config holds every setting the application needs
+// It is loaded once at startup and passed to each module
+type Config struct {
+	Server   ServerConfig   `yaml:"server" toml:"server"`
+	Database DatabaseConfig `yaml:"database" toml:"database"`
+	JWT      JWTConfig      `yaml:"jwt" toml:"jwt"`
+	Password PasswordConfig `yaml:"password" toml:"password"`
+	Upload   UploadConfig   `yaml:"upload" toml:"upload"`
+	Log      LogConfig      `yaml:"log" toml:"log"`
+	SLA      SLAConfig      `yaml:"sla" toml:"sla"`
+	Metrics  MetricsConfig  `yaml:"metrics" toml:"metrics"`
+	Tracing  TracingConfig  `yaml:"tracing" toml:"tracing"`
+	Mail     MailConfig     `yaml:"mail" toml:"mail"`
+	Invite   InviteConfig   `yaml:"invite" toml:"invite"`
+	SCIM     SCIMConfig     `yaml:"scim" toml:"scim"`
+	OIDC     OIDCConfig     `yaml:"oidc" toml:"oidc"`
+	Auth     AuthConfig     `yaml:"auth" toml:"auth"`
+	LDAP     LDAPConfig     `yaml:"ldap" toml:"ldap"`
+}
+
+// ServerConfig holds HTTP server settings
+type ServerConfig struct {
+	Host        string `yaml:"host" toml:"host"`
+	Port        int    `yaml:"port" toml:"port"`
+	BaseURL     string `yaml:"base_url" toml:"base_url"`         // Public URL of this backend (used for upload links)
+	FrontendURL string `yaml:"frontend_url" toml:"frontend_url"` // Allowed CORS origin
+
+	// ShutdownTimeout is how long SIGTERM waits for requests and background jobs to finish
+	ShutdownTimeout Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+
+	// LegacyRoutes keeps the old unversioned routes (/login, /workorders, ...) next to /api/v1
+	// They answer with the old response shape and a Deprecation header
+	LegacyRoutes bool `yaml:"legacy_routes" toml:"legacy_routes"`
+
+	// TrustedProxies are the reverse proxies (IPs or CIDRs) whose X-Forwarded-For is believed
+	// Empty = the client address is the connection's address (used for audit and API key allowlists)
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+}
+
+// Address returns host:port for the HTTP listener
+func (s ServerConfig) Address() string {
+	return fmt.Sprintf("%s:%d", s.Host, s.Port)
+}
+
+// DatabaseConfig holds MySQL connection and pool settings
+type DatabaseConfig struct {
+	Host            string   `yaml:"host" toml:"host"`
+	Port            int      `yaml:"port" toml:"port"`
+	User            string   `yaml:"user" toml:"user"`
+	Password        string   `yaml:"password" toml:"password"`
+	Name            string   `yaml:"name" toml:"name"`
+	MaxOpenConns    int      `yaml:"max_open_conns" toml:"max_open_conns"`
+	MaxIdleConns    int      `yaml:"max_idle_conns" toml:"max_idle_conns"`
+	ConnMaxLifetime Duration `yaml:"conn_max_lifetime" toml:"conn_max_lifetime"`
+}
+
+// JWTConfig holds token signing settings
+type JWTConfig struct {
+	Secret          string   `yaml:"secret" toml:"secret"` // HS256 key; with RS256/EdDSA it seals the stored private keys
+	AccessTokenTTL  Duration `yaml:"access_token_ttl" toml:"access_token_ttl"`
+	RefreshTokenTTL Duration `yaml:"refresh_token_ttl" toml:"refresh_token_ttl"`
+	Algorithm       string   `yaml:"algorithm" toml:"algorithm"`       // HS256, RS256 or EdDSA
+	KeyRotation     Duration `yaml:"key_rotation" toml:"key_rotation"` // How long an RS256/EdDSA key pair signs before the next one
+}
+
+// PasswordConfig holds password hashing settings
+type PasswordConfig struct {
+	BcryptCost int `yaml:"bcrypt_cost" toml:"bcrypt_cost"`
+}
+
+// UploadConfig holds file upload settings
+type UploadConfig struct {
+	MaxFileSize int64 `yaml:"max_file_size" toml:"max_file_size"` // In bytes
+}
+
+// LogConfig holds logging settings
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`   // debug, info, warn or error
+	Format string `yaml:"format" toml:"format"` // json or text
+}
+
+// SlogLevel converts Level to a slog.Level (defaults to info)
+func (l LogConfig) SlogLevel() slog.Level {
+	switch strings.ToLower(l.Level) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	default:
+		return slog.LevelInfo
+	}
+}
+
+// SLAConfig holds how long an open work order may stay unfinished, per priority
+type SLAConfig struct {
+	High   Duration `yaml:"high" toml:"high"`
+	Medium Duration `yaml:"medium" toml:"medium"`
+	Low    Duration `yaml:"low" toml:"low"`
+}
+
+// MetricsConfig holds settings for the Prometheus /metrics endpoint
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"`
+	Token   string `yaml:"token" toml:"token"` // Optional bearer token required to scrape
+}
+
+// TracingConfig holds OpenTelemetry tracing settings
+type TracingConfig struct {
+	Exporter     string  `yaml:"exporter" toml:"exporter"`           // none, otlp, stdout or file
+	OTLPEndpoint string  `yaml:"otlp_endpoint" toml:"otlp_endpoint"` // host:port of the collector (OTLP/HTTP), empty = OTEL_EXPORTER_OTLP_ENDPOINT
+	OTLPInsecure bool    `yaml:"otlp_insecure" toml:"otlp_insecure"` // Use plain HTTP instead of HTTPS
+	FilePath     string  `yaml:"file_path" toml:"file_path"`         // Used by the "file" exporter
+	SampleRatio  float64 `yaml:"sample_ratio" toml:"sample_ratio"`   // 0.0 - 1.0
+	ServiceName  string  `yaml:"service_name" toml:"service_name"`
+}
+
+// MailConfig holds SMTP settings for outgoing email (invitations)
+// Without a host no email is sent: the invitation link is only shown to the admin
+type MailConfig struct {
+	SMTPHost string `yaml:"smtp_host" toml:"smtp_host"`
+	SMTPPort int    `yaml:"smtp_port" toml:"smtp_port"`
+	Username string `yaml:"username" toml:"username"`
+	Password string `yaml:"password" toml:"password"`
+	From     string `yaml:"from" toml:"from"` // e.g. "SIRO <noreply@example.com>"
+}
+
+// Enabled reports whether an SMTP server is configured
+func (m MailConfig) Enabled() bool {
+	return m.SMTPHost != ""
+}
+
+// InviteConfig holds settings for user invitations
+type InviteConfig struct {
+	TTL Duration `yaml:"ttl" toml:"ttl"` // How long an invitation link works
+	URL string   `yaml:"url" toml:"url"` // Frontend page that accepts invitations, empty = frontend_url + "/invite"
+}
+
+// SCIMConfig holds settings for the SCIM 2.0 provisioning endpoint (/scim/v2)
+type SCIMConfig struct {
+	Enabled     bool   `yaml:"enabled" toml:"enabled"`
+	Token       string `yaml:"token" toml:"token"`               // Bearer token of the provisioning client
+	DefaultUnit string `yaml:"default_unit" toml:"default_unit"` // Unit for users without a department, empty = department required
+}
+
+// OIDCConfig holds settings for single sign-on with an OpenID Connect provider
+type OIDCConfig struct {
+	Enabled      bool     `yaml:"enabled" toml:"enabled"`
+	Issuer       string   `yaml:"issuer" toml:"issuer"` // e.g. https://login.microsoftonline.com/<tenant>/v2.0
+	ClientID     string   `yaml:"client_id" toml:"client_id"`
+	ClientSecret string   `yaml:"client_secret" toml:"client_secret"` // empty for public clients (PKCE only)
+	RedirectURL  string   `yaml:"redirect_url" toml:"redirect_url"`   // Frontend page that receives ?code&state, empty = frontend_url + "/oidc/callback"
+	Scopes       string   `yaml:"scopes" toml:"scopes"`               // Space-separated, must include openid
+	LoginTTL     Duration `yaml:"login_ttl" toml:"login_ttl"`         // How long the user has to finish logging in at the provider
+
+	// Linking and provisioning
+	LinkByEmail               bool     `yaml:"link_by_email" toml:"link_by_email"`                               // Link the first login to the user with the same email
+	TrustMissingEmailVerified bool     `yaml:"trust_missing_email_verified" toml:"trust_missing_email_verified"` // Count ID tokens without email_verified as verified (e.g. Azure AD)
+	AutoProvision             bool     `yaml:"auto_provision" toml:"auto_provision"`                             // Create unknown users on their first login
+	UnitClaim                 string   `yaml:"unit_claim" toml:"unit_claim"`                                     // Claim with the unit name, e.g. department
+	DefaultUnit               string   `yaml:"default_unit" toml:"default_unit"`                                 // Unit when the claim is missing or unknown
+	RoleClaim                 string   `yaml:"role_claim" toml:"role_claim"`                                     // Claim (string or list) checked for admin_values, e.g. groups or roles
+	AdminValues               []string `yaml:"admin_values" toml:"admin_values"`                                 // Values of role_claim that make a new user Admin
+}
+
+// AuthConfig selects how POST /login checks passwords
+type AuthConfig struct {
+	Backends []string `yaml:"backends" toml:"backends"` // Tried in order: bcrypt (users.password_hash) and/or ldap
+}
+
+// LDAPConfig holds settings for logging in against LDAP / Active Directory
+type LDAPConfig struct {
+	URL                string   `yaml:"url" toml:"url"`                                   // ldap://dc1.corp.local:389 or ldaps://dc1.corp.local:636
+	StartTLS           bool     `yaml:"start_tls" toml:"start_tls"`                       // Upgrade ldap:// connections with StartTLS
+	InsecureSkipVerify bool     `yaml:"insecure_skip_verify" toml:"insecure_skip_verify"` // Don't check the server certificate (testing only)
+	Timeout            Duration `yaml:"timeout" toml:"timeout"`
+
+	// Finding the user: bind as the service account, search BaseDN with UserFilter, then bind as the user
+	BindDN       string `yaml:"bind_dn" toml:"bind_dn"` // Empty = anonymous search
+	BindPassword string `yaml:"bind_password" toml:"bind_password"`
+	BaseDN       string `yaml:"base_dn" toml:"base_dn"`
+	UserFilter   string `yaml:"user_filter" toml:"user_filter"` // {login} is replaced by the escaped login
+
+	// Attributes read from the user's entry
+	EmailAttribute string `yaml:"email_attribute" toml:"email_attribute"`
+	NameAttribute  string `yaml:"name_attribute" toml:"name_attribute"`
+	PhoneAttribute string `yaml:"phone_attribute" toml:"phone_attribute"`
+	GroupAttribute string `yaml:"group_attribute" toml:"group_attribute"`
+
+	// Mapping to roles and units
+	GroupRoles  map[string]string `yaml:"group_roles" toml:"group_roles"` // Group DN -> role; members of no listed group are Staff
+	OUUnits     map[string]string `yaml:"ou_units" toml:"ou_units"`       // OU name in the user's DN -> unit; empty = an OU named like a unit
+	DefaultUnit string            `yaml:"default_unit" toml:"default_unit"`
+
+	AutoProvision  bool `yaml:"auto_provision" toml:"auto_provision"`   // Create users on their first LDAP login
+	SyncAttributes bool `yaml:"sync_attributes" toml:"sync_attributes"` // Copy name, phone, role and unit from LDAP on every login
+}
+
+// Duration is a time.Duration that can be written as "20m" or "168h" in config files
+type Duration struct {
+	time.Duration
+}
+
+// UnmarshalText parses a duration string like "20m"
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = parsed
+	return nil
+}
+
+// MarshalText writes the duration back as a string
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.Duration.String()), nil
+}
+
+// Default returns the built-in settings used when nothing else is configured
+func Default() Config {
+	return Config{
+		Server: ServerConfig{
+			Host:            "localhost",
+			Port:            8080,
+			BaseURL:         "http://localhost:8080",
+			FrontendURL:     "http://localhost:3000",
+			ShutdownTimeout: Duration{15 * time.Second},
+			LegacyRoutes:    true,
+		},
+		Database: DatabaseConfig{
+			Port:            3306,
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: Duration{5 * time.Minute},
+		},
+		JWT: JWTConfig{
+			AccessTokenTTL:  Duration{20 * time.Minute},
+			RefreshTokenTTL: Duration{7 * 24 * time.Hour},
+			Algorithm:       jwtkeys.AlgHS256,
+			KeyRotation:     Duration{30 * 24 * time.Hour},
+		},
+		Password: PasswordConfig{
+			BcryptCost: 14,
+		},
+		Upload: UploadConfig{
+			MaxFileSize: 2 * 1024 * 1024, // 2MB
+		},
+		Log: LogConfig{
+			Level:  "info",
+			Format: "json",
+		},
+		SLA: SLAConfig{
+			High:   Duration{4 * time.Hour},
+			Medium: Duration{24 * time.Hour},
+			Low:    Duration{72 * time.Hour},
+		},
+		Metrics: MetricsConfig{
+			Enabled: true,
+		},
+		Tracing: TracingConfig{
+			Exporter:    "none",
+			FilePath:    "traces.json",
+			SampleRatio: 1.0,
+			ServiceName: "siro-backend",
+		},
+		Mail: MailConfig{
+			SMTPPort: 587,
+		},
+		Invite: InviteConfig{
+			TTL: Duration{72 * time.Hour},
+		},
+		Auth: AuthConfig{
+			Backends: []string{"bcrypt"},
+		},
+		LDAP: LDAPConfig{
+			Timeout:        Duration{5 * time.Second},
+			UserFilter:     "(|(mail={login})(userPrincipalName={login})(sAMAccountName={login})(uid={login}))",
+			EmailAttribute: "mail",
+			NameAttribute:  "displayName",
+			PhoneAttribute: "telephoneNumber",
+			GroupAttribute: "memberOf",
+		},
+		OIDC: OIDCConfig{
+			Scopes:      "openid email profile",
+			LoginTTL:    Duration{10 * time.Minute},
+			LinkByEmail: true,
+		},
+	}
+}
+
+// Load builds the configuration from (lowest to highest priority):
+// built-in defaults, an optional YAML/TOML file, environment variables and command line flags
+// args are the command line arguments without the program name
+func Load(args []string) (*Config, error) {
+	cfg := Default()
+
+	// Flags are parsed first so -config can point at the file,
+	// but their values are applied last so they win over everything else
+	fs := flag.NewFlagSet("server", flag.ContinueOnError)
+	configFile := fs.String("config", os.Getenv("CONFIG_FILE"), "path to a YAML or TOML config file")
+	host := fs.String("host", "", "server host (overrides SERVER_HOST)")
+	port := fs.Int("port", 0, "server port (overrides PORT)")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *configFile != "" {
+		if err := loadFile(*configFile, &cfg); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := loadEnv(&cfg); err != nil {
+		return nil, err
+	}
+
+	if *host != "" {
+		cfg.Server.Host = *host
+	}
+	if *port != 0 {
+		cfg.Server.Port = *port
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return &cfg, nil
+}
+
+// loadFile reads a YAML or TOML file into cfg, chosen by file extension
+func loadFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %w", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, cfg)
+	case ".toml":
+		err = toml.Unmarshal(data, cfg)
+	default:
+		return fmt.Errorf("unsupported config file type %q (use .yaml, .yml or .toml)", path)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// loadEnv overrides cfg with any environment variables that are set
+func loadEnv(cfg *Config) error {
+	var errs []error
+
+	setString := func(key string, dst *string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = v
+		}
+	}
+	setInt := func(key string, dst *int) {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setInt64 := func(key string, dst *int64) {
+		if v := os.Getenv(key); v != "" {
+			n, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", key, v))
+				return
+			}
+			*dst = n
+		}
+	}
+	setBool := func(key string, dst *bool) {
+		if v := os.Getenv(key); v != "" {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be true or false, got %q", key, v))
+				return
+			}
+			*dst = b
+		}
+	}
+	setFloat := func(key string, dst *float64) {
+		if v := os.Getenv(key); v != "" {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a number, got %q", key, v))
+				return
+			}
+			*dst = f
+		}
+	}
+	setList := func(key string, dst *[]string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = nil
+			for _, item := range strings.Split(v, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					*dst = append(*dst, item)
+				}
+			}
+		}
+	}
+	// KEY=value pairs separated by ";", split at the last "=" because DNs contain "=" and ","
+	setMap := func(key string, dst *map[string]string) {
+		if v := os.Getenv(key); v != "" {
+			*dst = map[string]string{}
+			for _, pair := range strings.Split(v, ";") {
+				if strings.TrimSpace(pair) == "" {
+					continue
+				}
+				i := strings.LastIndex(pair, "=")
+				if i <= 0 {
+					errs = append(errs, fmt.Errorf("%s must look like key=value;key=value, got %q", key, pair))
+					continue
+				}
+				(*dst)[strings.TrimSpace(pair[:i])] = strings.TrimSpace(pair[i+1:])
+			}
+		}
+	}
+	setDuration := func(key string, dst *Duration) {
+		if v := os.Getenv(key); v != "" {
+			if err := dst.UnmarshalText([]byte(v)); err != nil {
+				errs = append(errs, fmt.Errorf("%s must be a duration like 20m or 168h, got %q", key, v))
+			}
+		}
+	}
+
+	// Server
+	setString("SERVER_HOST", &cfg.Server.Host)
+	setInt("PORT", &cfg.Server.Port)
+	setString("BACKEND_URL", &cfg.Server.BaseURL)
+	setString("FRONTEND_URL", &cfg.Server.FrontendURL)
+	setDuration("SHUTDOWN_TIMEOUT", &cfg.Server.ShutdownTimeout)
+	setBool("LEGACY_ROUTES", &cfg.Server.LegacyRoutes)
+	setList("TRUSTED_PROXIES", &cfg.Server.TrustedProxies)
+
+	// Database
+	setString("DB_HOST", &cfg.Database.Host)
+	setInt("DB_PORT", &cfg.Database.Port)
+	setString("DB_USER", &cfg.Database.User)
+	setString("DB_PASSWORD", &cfg.Database.Password)
+	setString("DB_NAME", &cfg.Database.Name)
+	setInt("DB_MAX_OPEN_CONNS", &cfg.Database.MaxOpenConns)
+	setInt("DB_MAX_IDLE_CONNS", &cfg.Database.MaxIdleConns)
+	setDuration("DB_CONN_MAX_LIFETIME", &cfg.Database.ConnMaxLifetime)
+
+	// JWT
+	setString("JWT_SECRET", &cfg.JWT.Secret)
+	setDuration("JWT_ACCESS_TTL", &cfg.JWT.AccessTokenTTL)
+	setDuration("JWT_REFRESH_TTL", &cfg.JWT.RefreshTokenTTL)
+	setString("JWT_ALGORITHM", &cfg.JWT.Algorithm)
+	setDuration("JWT_KEY_ROTATION", &cfg.JWT.KeyRotation)
+
+	// Passwords and uploads
+	setInt("BCRYPT_COST", &cfg.Password.BcryptCost)
+	setInt64("UPLOAD_MAX_FILE_SIZE", &cfg.Upload.MaxFileSize)
+
+	// Logging
+	setString("LOG_LEVEL", &cfg.Log.Level)
+	setString("LOG_FORMAT", &cfg.Log.Format)
+
+	// SLA targets
+	setDuration("SLA_HIGH", &cfg.SLA.High)
+	setDuration("SLA_MEDIUM", &cfg.SLA.Medium)
+	setDuration("SLA_LOW", &cfg.SLA.Low)
+
+	// Metrics
+	setBool("METRICS_ENABLED", &cfg.Metrics.Enabled)
+	setString("METRICS_TOKEN", &cfg.Metrics.Token)
+
+	// Tracing
+	setString("TRACING_EXPORTER", &cfg.Tracing.Exporter)
+	setString("TRACING_OTLP_ENDPOINT", &cfg.Tracing.OTLPEndpoint)
+	setBool("TRACING_OTLP_INSECURE", &cfg.Tracing.OTLPInsecure)
+	setString("TRACING_FILE", &cfg.Tracing.FilePath)
+	setFloat("TRACING_SAMPLE_RATIO", &cfg.Tracing.SampleRatio)
+	setString("TRACING_SERVICE_NAME", &cfg.Tracing.ServiceName)
+
+	// Mail and invitations
+	setString("SMTP_HOST", &cfg.Mail.SMTPHost)
+	setInt("SMTP_PORT", &cfg.Mail.SMTPPort)
+	setString("SMTP_USERNAME", &cfg.Mail.Username)
+	setString("SMTP_PASSWORD", &cfg.Mail.Password)
+	setString("MAIL_FROM", &cfg.Mail.From)
+	setDuration("INVITE_TTL", &cfg.Invite.TTL)
+	setString("INVITE_URL", &cfg.Invite.URL)
+
+	// SCIM provisioning
+	setBool("SCIM_ENABLED", &cfg.SCIM.Enabled)
+	setString("SCIM_TOKEN", &cfg.SCIM.Token)
+	setString("SCIM_DEFAULT_UNIT", &cfg.SCIM.DefaultUnit)
+
+	// Single sign-on
+	setBool("OIDC_ENABLED", &cfg.OIDC.Enabled)
+	setString("OIDC_ISSUER", &cfg.OIDC.Issuer)
+	setString("OIDC_CLIENT_ID", &cfg.OIDC.ClientID)
+	setString("OIDC_CLIENT_SECRET", &cfg.OIDC.ClientSecret)
+	setString("OIDC_REDIRECT_URL", &cfg.OIDC.RedirectURL)
+	setString("OIDC_SCOPES", &cfg.OIDC.Scopes)
+	setDuration("OIDC_LOGIN_TTL", &cfg.OIDC.LoginTTL)
+	setBool("OIDC_LINK_BY_EMAIL", &cfg.OIDC.LinkByEmail)
+	setBool("OIDC_TRUST_MISSING_EMAIL_VERIFIED", &cfg.OIDC.TrustMissingEmailVerified)
+	setBool("OIDC_AUTO_PROVISION", &cfg.OIDC.AutoProvision)
+	setString("OIDC_UNIT_CLAIM", &cfg.OIDC.UnitClaim)
+	setString("OIDC_DEFAULT_UNIT", &cfg.OIDC.DefaultUnit)
+	setString("OIDC_ROLE_CLAIM", &cfg.OIDC.RoleClaim)
+	setList("OIDC_ADMIN_VALUES", &cfg.OIDC.AdminValues)
+
+	// Login backends
+	setList("AUTH_BACKENDS", &cfg.Auth.Backends)
+	setString("LDAP_URL", &cfg.LDAP.URL)
+	setBool("LDAP_START_TLS", &cfg.LDAP.StartTLS)
+	setBool("LDAP_INSECURE_SKIP_VERIFY", &cfg.LDAP.InsecureSkipVerify)
+	setDuration("LDAP_TIMEOUT", &cfg.LDAP.Timeout)
+	setString("LDAP_BIND_DN", &cfg.LDAP.BindDN)
+	setString("LDAP_BIND_PASSWORD", &cfg.LDAP.BindPassword)
+	setString("LDAP_BASE_DN", &cfg.LDAP.BaseDN)
+	setString("LDAP_USER_FILTER", &cfg.LDAP.UserFilter)
+	setString("LDAP_EMAIL_ATTRIBUTE", &cfg.LDAP.EmailAttribute)
+	setString("LDAP_NAME_ATTRIBUTE", &cfg.LDAP.NameAttribute)
+	setString("LDAP_PHONE_ATTRIBUTE", &cfg.LDAP.PhoneAttribute)
+	setString("LDAP_GROUP_ATTRIBUTE", &cfg.LDAP.GroupAttribute)
+	setMap("LDAP_GROUP_ROLES", &cfg.LDAP.GroupRoles)
+	setMap("LDAP_OU_UNITS", &cfg.LDAP.OUUnits)
+	setString("LDAP_DEFAULT_UNIT", &cfg.LDAP.DefaultUnit)
+	setBool("LDAP_AUTO_PROVISION", &cfg.LDAP.AutoProvision)
+	setBool("LDAP_SYNC_ATTRIBUTES", &cfg.LDAP.SyncAttributes)
+
+	return errors.Join(errs...)
+}
+
+// Validate checks every setting and returns all problems at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	// Server
+	check(c.Server.Host != "", "server.host is required (SERVER_HOST)")
+	check(c.Server.Port > 0 && c.Server.Port < 65536, "server.port must be between 1 and 65535 (PORT), got %d", c.Server.Port)
+	check(isHTTPURL(c.Server.BaseURL), "server.base_url must be an http(s) URL (BACKEND_URL), got %q", c.Server.BaseURL)
+	check(isHTTPURL(c.Server.FrontendURL), "server.frontend_url must be an http(s) URL (FRONTEND_URL), got %q", c.Server.FrontendURL)
+	check(c.Server.ShutdownTimeout.Duration > 0, "server.shutdown_timeout must be positive (SHUTDOWN_TIMEOUT)")
+	for _, p := range c.Server.TrustedProxies {
+		_, prefixErr := netip.ParsePrefix(p)
+		_, addrErr := netip.ParseAddr(p)
+		check(prefixErr == nil || addrErr == nil, "server.trusted_proxies must be IPs or CIDRs (TRUSTED_PROXIES), got %q", p)
+	}
+
+	// Database
+	check(c.Database.Host != "", "database.host is required (DB_HOST)")
+	check(c.Database.Port > 0 && c.Database.Port < 65536, "database.port must be between 1 and 65535 (DB_PORT), got %d", c.Database.Port)
+	check(c.Database.User != "", "database.user is required (DB_USER)")
+	check(c.Database.Password != "", "database.password is required (DB_PASSWORD)")
+	check(c.Database.Name != "", "database.name is required (DB_NAME)")
+	check(c.Database.MaxOpenConns > 0, "database.max_open_conns must be positive (DB_MAX_OPEN_CONNS), got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must be between 0 and max_open_conns (DB_MAX_IDLE_CONNS), got %d", c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime.Duration >= 0, "database.conn_max_lifetime must not be negative (DB_CONN_MAX_LIFETIME)")
+
+	// JWT
+	check(c.JWT.Secret != "", "jwt.secret is required (JWT_SECRET)")
+	check(c.JWT.Secret == "" || len(c.JWT.Secret) >= 32, "jwt.secret must be at least 32 characters long (JWT_SECRET)")
+	check(c.JWT.AccessTokenTTL.Duration > 0, "jwt.access_token_ttl must be positive (JWT_ACCESS_TTL)")
+	check(c.JWT.RefreshTokenTTL.Duration > c.JWT.AccessTokenTTL.Duration,
+		"jwt.refresh_token_ttl must be longer than access_token_ttl (JWT_REFRESH_TTL)")
+	check(slices.Contains(jwtkeys.Algorithms, c.JWT.Algorithm), "jwt.algorithm must be one of %s (JWT_ALGORITHM), got %q",
+		strings.Join(jwtkeys.Algorithms, ", "), c.JWT.Algorithm)
+	check(c.JWT.Algorithm == jwtkeys.AlgHS256 || c.JWT.KeyRotation.Duration >= 10*time.Minute,
+		"jwt.key_rotation must be at least 10m (JWT_KEY_ROTATION)")
+
+	// Passwords and uploads
+	check(c.Password.BcryptCost >= bcrypt.MinCost && c.Password.BcryptCost <= bcrypt.MaxCost,
+		"password.bcrypt_cost must be between %d and %d (BCRYPT_COST), got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Password.BcryptCost)
+	check(c.Upload.MaxFileSize > 0, "upload.max_file_size must be positive (UPLOAD_MAX_FILE_SIZE), got %d", c.Upload.MaxFileSize)
+
+	// Logging
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		check(false, "log.level must be debug, info, warn or error (LOG_LEVEL), got %q", c.Log.Level)
+	}
+	check(c.Log.Format == "json" || c.Log.Format == "text", "log.format must be json or text (LOG_FORMAT), got %q", c.Log.Format)
+
+	// SLA targets
+	check(c.SLA.High.Duration > 0, "sla.high must be positive (SLA_HIGH)")
+	check(c.SLA.Medium.Duration > 0, "sla.medium must be positive (SLA_MEDIUM)")
+	check(c.SLA.Low.Duration > 0, "sla.low must be positive (SLA_LOW)")
+
+	// Tracing
+	switch c.Tracing.Exporter {
+	case "none", "otlp", "stdout":
+	case "file":
+		check(c.Tracing.FilePath != "", "tracing.file_path is required for the file exporter (TRACING_FILE)")
+	default:
+		check(false, "tracing.exporter must be none, otlp, stdout or file (TRACING_EXPORTER), got %q", c.Tracing.Exporter)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1,
+		"tracing.sample_ratio must be between 0 and 1 (TRACING_SAMPLE_RATIO), got %v", c.Tracing.SampleRatio)
+	check(c.Tracing.ServiceName != "", "tracing.service_name is required (TRACING_SERVICE_NAME)")
+
+	// Mail and invitations
+	if c.Mail.Enabled() {
+		check(c.Mail.SMTPPort > 0 && c.Mail.SMTPPort < 65536, "mail.smtp_port must be between 1 and 65535 (SMTP_PORT), got %d", c.Mail.SMTPPort)
+		check(c.Mail.From != "", "mail.from is required when mail.smtp_host is set (MAIL_FROM)")
+	}
+	check(c.Invite.TTL.Duration > 0, "invite.ttl must be positive (INVITE_TTL)")
+	check(c.Invite.URL == "" || isHTTPURL(c.Invite.URL), "invite.url must be an http(s) URL (INVITE_URL), got %q", c.Invite.URL)
+
+	// SCIM provisioning
+	check(!c.SCIM.Enabled || len(c.SCIM.Token) >= 32, "scim.token must be at least 32 characters long when SCIM is enabled (SCIM_TOKEN)")
+
+	// Single sign-on
+	if c.OIDC.Enabled {
+		check(isHTTPURL(c.OIDC.Issuer), "oidc.issuer must be an http(s) URL (OIDC_ISSUER), got %q", c.OIDC.Issuer)
+		check(c.OIDC.ClientID != "", "oidc.client_id is required when OIDC is enabled (OIDC_CLIENT_ID)")
+		check(c.OIDC.RedirectURL == "" || isHTTPURL(c.OIDC.RedirectURL), "oidc.redirect_url must be an http(s) URL (OIDC_REDIRECT_URL), got %q", c.OIDC.RedirectURL)
+		check(slices.Contains(strings.Fields(c.OIDC.Scopes), "openid"), "oidc.scopes must include openid (OIDC_SCOPES), got %q", c.OIDC.Scopes)
+		check(c.OIDC.LoginTTL.Duration > 0, "oidc.login_ttl must be positive (OIDC_LOGIN_TTL)")
+		check(!c.OIDC.AutoProvision || c.OIDC.UnitClaim != "" || c.OIDC.DefaultUnit != "",
+			"oidc.unit_claim or oidc.default_unit is required with auto_provision (OIDC_UNIT_CLAIM, OIDC_DEFAULT_UNIT)")
+		check(len(c.OIDC.AdminValues) == 0 || c.OIDC.RoleClaim != "", "oidc.role_claim is required with admin_values (OIDC_ROLE_CLAIM)")
+	}
+
+	// Login backends
+	check(len(c.Auth.Backends) > 0, "auth.backends must list at least one of bcrypt, ldap (AUTH_BACKENDS)")
+	for i, b := range c.Auth.Backends {
+		check(b == "bcrypt" || b == "ldap", "auth.backends must only contain bcrypt and ldap (AUTH_BACKENDS), got %q", b)
+		check(!slices.Contains(c.Auth.Backends[:i], b), "auth.backends lists %q twice (AUTH_BACKENDS)", b)
+	}
+	if slices.Contains(c.Auth.Backends, "ldap") {
+		u, err := url.Parse(c.LDAP.URL)
+		check(err == nil && (u.Scheme == "ldap" || u.Scheme == "ldaps") && u.Host != "", "ldap.url must be an ldap:// or ldaps:// URL (LDAP_URL), got %q", c.LDAP.URL)
+		check(!c.LDAP.StartTLS || strings.HasPrefix(c.LDAP.URL, "ldap://"), "ldap.start_tls only works with an ldap:// URL (LDAP_START_TLS)")
+		check(c.LDAP.Timeout.Duration > 0, "ldap.timeout must be positive (LDAP_TIMEOUT)")
+		check(c.LDAP.BaseDN != "", "ldap.base_dn is required (LDAP_BASE_DN)")
+		check(strings.Contains(c.LDAP.UserFilter, "{login}"), "ldap.user_filter must contain {login} (LDAP_USER_FILTER), got %q", c.LDAP.UserFilter)
+		check(c.LDAP.EmailAttribute != "", "ldap.email_attribute is required (LDAP_EMAIL_ATTRIBUTE)")
+		for group, role := range c.LDAP.GroupRoles {
+			check(role == global.RoleAdmin || role == global.RoleStaff, "ldap.group_roles: role of %q must be %s or %s (LDAP_GROUP_ROLES), got %q",
+				group, global.RoleAdmin, global.RoleStaff, role)
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// isHTTPURL reports whether s is an absolute http or https URL
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
@@ -0,0 +1,423 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+// validConfig is the default configuration with every required setting filled in
+func validConfig() Config {
+	cfg := Default()
+	cfg.Database.Host = "db"
+	cfg.Database.User = "siro"
+	cfg.Database.Password = "secret"
+	cfg.Database.Name = "siro"
+	cfg.JWT.Secret = testSecret
+	return cfg
+}
+
+// requiredEnv sets the settings that have no default
+func requiredEnv(t *testing.T) {
+	t.Setenv("DB_HOST", "db")
+	t.Setenv("DB_USER", "siro")
+	t.Setenv("DB_PASSWORD", "secret")
+	t.Setenv("DB_NAME", "siro")
+	t.Setenv("JWT_SECRET", testSecret)
+}
+
+// writeFile writes a config file into a temporary directory and returns its path
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestValidate(t *testing.T) {
+	cfg := validConfig()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("valid config: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		change func(c *Config)
+		want   []string // parts of the error, empty = valid
+	}{
+		{"no host", func(c *Config) { c.Server.Host = "" }, []string{"server.host is required"}},
+		{"port zero", func(c *Config) { c.Server.Port = 0 }, []string{"server.port must be between 1 and 65535 (PORT), got 0"}},
+		{"port too high", func(c *Config) { c.Server.Port = 65536 }, []string{"server.port"}},
+		{"base url without scheme", func(c *Config) { c.Server.BaseURL = "localhost:8080" }, []string{`server.base_url must be an http(s) URL (BACKEND_URL), got "localhost:8080"`}},
+		{"frontend url ftp", func(c *Config) { c.Server.FrontendURL = "ftp://example.com" }, []string{"server.frontend_url"}},
+		{"no shutdown timeout", func(c *Config) { c.Server.ShutdownTimeout = Duration{} }, []string{"server.shutdown_timeout"}},
+		{"trusted proxies", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "10.0.0.0/8", "::1", "fd00::/8"} }, nil},
+		{"bad trusted proxy", func(c *Config) { c.Server.TrustedProxies = []string{"10.0.0.1", "proxy.local"} },
+			[]string{`server.trusted_proxies must be IPs or CIDRs (TRUSTED_PROXIES), got "proxy.local"`}},
+
+		{"database settings missing", func(c *Config) { c.Database = Default().Database }, []string{
+			"database.host is required (DB_HOST)", "database.user is required (DB_USER)",
+			"database.password is required (DB_PASSWORD)", "database.name is required (DB_NAME)",
+		}},
+		{"no open conns", func(c *Config) { c.Database.MaxOpenConns = 0; c.Database.MaxIdleConns = 0 }, []string{"database.max_open_conns"}},
+		{"more idle than open", func(c *Config) { c.Database.MaxIdleConns = 26 }, []string{"database.max_idle_conns must be between 0 and max_open_conns (DB_MAX_IDLE_CONNS), got 26"}},
+		{"negative idle", func(c *Config) { c.Database.MaxIdleConns = -1 }, []string{"database.max_idle_conns"}},
+		{"negative lifetime", func(c *Config) { c.Database.ConnMaxLifetime = Duration{-time.Second} }, []string{"database.conn_max_lifetime"}},
+		{"zero lifetime", func(c *Config) { c.Database.ConnMaxLifetime = Duration{} }, nil},
+
+		{"no secret", func(c *Config) { c.JWT.Secret = "" }, []string{"jwt.secret is required (JWT_SECRET)"}},
+		{"short secret", func(c *Config) { c.JWT.Secret = testSecret[:31] }, []string{"jwt.secret must be at least 32 characters long"}},
+		{"no access ttl", func(c *Config) { c.JWT.AccessTokenTTL = Duration{} }, []string{"jwt.access_token_ttl"}},
+		{"refresh not longer than access", func(c *Config) { c.JWT.RefreshTokenTTL = c.JWT.AccessTokenTTL }, []string{"jwt.refresh_token_ttl must be longer than access_token_ttl"}},
+		{"unknown algorithm", func(c *Config) { c.JWT.Algorithm = "HS512" }, []string{`jwt.algorithm must be one of HS256, RS256, EdDSA (JWT_ALGORITHM), got "HS512"`}},
+		{"RS256", func(c *Config) { c.JWT.Algorithm = "RS256" }, nil},
+		{"EdDSA rotation too short", func(c *Config) { c.JWT.Algorithm = "EdDSA"; c.JWT.KeyRotation = Duration{9 * time.Minute} },
+			[]string{"jwt.key_rotation must be at least 10m"}},
+		{"HS256 ignores rotation", func(c *Config) { c.JWT.KeyRotation = Duration{} }, nil},
+
+		{"bcrypt cost too low", func(c *Config) { c.Password.BcryptCost = 3 }, []string{"password.bcrypt_cost must be between 4 and 31 (BCRYPT_COST), got 3"}},
+		{"bcrypt cost too high", func(c *Config) { c.Password.BcryptCost = 32 }, []string{"password.bcrypt_cost"}},
+		{"no upload size", func(c *Config) { c.Upload.MaxFileSize = 0 }, []string{"upload.max_file_size"}},
+
+		{"log level case", func(c *Config) { c.Log.Level = "WARN" }, nil},
+		{"unknown log level", func(c *Config) { c.Log.Level = "trace" }, []string{`log.level must be debug, info, warn or error (LOG_LEVEL), got "trace"`}},
+		{"unknown log format", func(c *Config) { c.Log.Format = "logfmt" }, []string{"log.format"}},
+
+		{"SLA targets", func(c *Config) { c.SLA = SLAConfig{} }, []string{"sla.high", "sla.medium", "sla.low"}},
+
+		{"file exporter without path", func(c *Config) { c.Tracing.Exporter = "file"; c.Tracing.FilePath = "" }, []string{"tracing.file_path is required"}},
+		{"otlp exporter", func(c *Config) { c.Tracing.Exporter = "otlp" }, nil},
+		{"unknown exporter", func(c *Config) { c.Tracing.Exporter = "jaeger" }, []string{`tracing.exporter must be none, otlp, stdout or file (TRACING_EXPORTER), got "jaeger"`}},
+		{"sample ratio above 1", func(c *Config) { c.Tracing.SampleRatio = 1.5 }, []string{"tracing.sample_ratio must be between 0 and 1 (TRACING_SAMPLE_RATIO), got 1.5"}},
+		{"negative sample ratio", func(c *Config) { c.Tracing.SampleRatio = -0.1 }, []string{"tracing.sample_ratio"}},
+		{"no service name", func(c *Config) { c.Tracing.ServiceName = "" }, []string{"tracing.service_name"}},
+
+		{"mail without from", func(c *Config) { c.Mail.SMTPHost = "smtp.example.com" }, []string{"mail.from is required when mail.smtp_host is set"}},
+		{"mail bad port", func(c *Config) { c.Mail = MailConfig{SMTPHost: "smtp.example.com", From: "noreply@example.com"} }, []string{"mail.smtp_port"}},
+		{"mail port unchecked without host", func(c *Config) { c.Mail.SMTPPort = 0 }, nil},
+		{"no invite ttl", func(c *Config) { c.Invite.TTL = Duration{} }, []string{"invite.ttl"}},
+		{"bad invite url", func(c *Config) { c.Invite.URL = "/invite" }, []string{"invite.url"}},
+
+		{"SCIM without token", func(c *Config) { c.SCIM.Enabled = true }, []string{"scim.token must be at least 32 characters long"}},
+		{"SCIM with token", func(c *Config) { c.SCIM.Enabled = true; c.SCIM.Token = testSecret }, nil},
+		{"SCIM token unchecked when disabled", func(c *Config) { c.SCIM.Token = "short" }, nil},
+
+		{"OIDC checked only when enabled", func(c *Config) { c.OIDC.Issuer = "nope"; c.OIDC.Scopes = "" }, nil},
+		{"OIDC enabled", func(c *Config) {
+			c.OIDC.Enabled = true
+			c.OIDC.Issuer = "https://login.example.com"
+			c.OIDC.ClientID = "siro"
+		}, nil},
+		{"OIDC missing settings", func(c *Config) {
+			c.OIDC.Enabled = true
+			c.OIDC.RedirectURL = "callback"
+			c.OIDC.Scopes = "email profile"
+			c.OIDC.LoginTTL = Duration{}
+			c.OIDC.AutoProvision = true
+			c.OIDC.AdminValues = []string{"admins"}
+		}, []string{
+			`oidc.issuer must be an http(s) URL (OIDC_ISSUER), got ""`, "oidc.client_id is required", "oidc.redirect_url",
+			`oidc.scopes must include openid (OIDC_SCOPES), got "email profile"`, "oidc.login_ttl",
+			"oidc.unit_claim or oidc.default_unit is required with auto_provision", "oidc.role_claim is required with admin_values",
+		}},
+
+		{"no backends", func(c *Config) { c.Auth.Backends = nil }, []string{"auth.backends must list at least one"}},
+		{"unknown backend", func(c *Config) { c.Auth.Backends = []string{"bcrypt", "kerberos"} }, []string{`auth.backends must only contain bcrypt and ldap (AUTH_BACKENDS), got "kerberos"`}},
+		{"backend twice", func(c *Config) { c.Auth.Backends = []string{"bcrypt", "bcrypt"} }, []string{`auth.backends lists "bcrypt" twice`}},
+		{"LDAP checked only when used", func(c *Config) { c.LDAP.URL = "nope" }, nil},
+		{"LDAP", func(c *Config) {
+			c.Auth.Backends = []string{"ldap", "bcrypt"}
+			c.LDAP.URL = "ldap://dc1.corp.local:389"
+			c.LDAP.StartTLS = true
+			c.LDAP.BaseDN = "dc=corp,dc=local"
+			c.LDAP.GroupRoles = map[string]string{"cn=admins,dc=corp,dc=local": "Admin"}
+		}, nil},
+		{"LDAP missing settings", func(c *Config) {
+			c.Auth.Backends = []string{"ldap"}
+			c.LDAP.URL = "ldaps://dc1.corp.local"
+			c.LDAP.StartTLS = true
+			c.LDAP.Timeout = Duration{}
+			c.LDAP.UserFilter = "(mail=*)"
+			c.LDAP.EmailAttribute = ""
+			c.LDAP.GroupRoles = map[string]string{"cn=admins": "Root"}
+		}, []string{
+			"ldap.start_tls only works with an ldap:// URL", "ldap.timeout", "ldap.base_dn is required",
+			`ldap.user_filter must contain {login} (LDAP_USER_FILTER), got "(mail=*)"`, "ldap.email_attribute",
+			`ldap.group_roles: role of "cn=admins" must be Admin or Staff (LDAP_GROUP_ROLES), got "Root"`,
+		}},
+		{"LDAP bad url", func(c *Config) {
+			c.Auth.Backends = []string{"ldap"}
+			c.LDAP.URL = "https://dc1"
+			c.LDAP.BaseDN = "dc=corp"
+		},
+			[]string{`ldap.url must be an ldap:// or ldaps:// URL (LDAP_URL), got "https://dc1"`}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := validConfig()
+			tt.change(&cfg)
+			err := cfg.Validate()
+			if len(tt.want) == 0 {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil {
+				t.Fatalf("no error, want %q", tt.want)
+			}
+			msg := err.Error()
+			if !strings.HasPrefix(msg, "invalid configuration:\n") {
+				t.Errorf("error %q does not start with the heading", msg)
+			}
+			// one line per problem, and nothing else wrong
+			if lines := strings.Count(msg, "\n"); lines != len(tt.want) {
+				t.Errorf("%d problems, want %d:\n%s", lines, len(tt.want), msg)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(msg, part) {
+					t.Errorf("error does not mention %q:\n%s", part, msg)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	requiredEnv(t)
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := validConfig(); !reflect.DeepEqual(*cfg, want) {
+		t.Errorf("Load() = %+v\nwant %+v", *cfg, want)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	yamlFile := writeFile(t, "config.yaml", `
+server:
+  host: file-host
+  port: 9000
+  frontend_url: https://app.example.com
+  trusted_proxies: [10.0.0.1]
+database:
+  max_open_conns: 50
+jwt:
+  access_token_ttl: 15m
+sla:
+  high: 2h
+log:
+  level: debug
+`)
+
+	t.Run("file over defaults", func(t *testing.T) {
+		requiredEnv(t)
+		cfg, err := Load([]string{"-config", yamlFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Server.Host != "file-host" || cfg.Server.Port != 9000 || cfg.Server.FrontendURL != "https://app.example.com" {
+			t.Errorf("server = %+v", cfg.Server)
+		}
+		if !reflect.DeepEqual(cfg.Server.TrustedProxies, []string{"10.0.0.1"}) || cfg.Database.MaxOpenConns != 50 {
+			t.Errorf("proxies = %v, max_open_conns = %d", cfg.Server.TrustedProxies, cfg.Database.MaxOpenConns)
+		}
+		if cfg.JWT.AccessTokenTTL.Duration != 15*time.Minute || cfg.SLA.High.Duration != 2*time.Hour || cfg.Log.Level != "debug" {
+			t.Errorf("access ttl = %v, sla.high = %v, log.level = %q", cfg.JWT.AccessTokenTTL, cfg.SLA.High, cfg.Log.Level)
+		}
+		// settings missing from the file keep their defaults
+		if cfg.SLA.Medium.Duration != 24*time.Hour || cfg.Server.BaseURL != "http://localhost:8080" || cfg.Database.MaxIdleConns != 5 {
+			t.Errorf("defaults lost: sla.medium = %v, base_url = %q, max_idle_conns = %d",
+				cfg.SLA.Medium, cfg.Server.BaseURL, cfg.Database.MaxIdleConns)
+		}
+	})
+
+	t.Run("env over file", func(t *testing.T) {
+		requiredEnv(t)
+		t.Setenv("CONFIG_FILE", yamlFile)
+		t.Setenv("SERVER_HOST", "env-host")
+		t.Setenv("JWT_ACCESS_TTL", "10m")
+		cfg, err := Load(nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Server.Host != "env-host" || cfg.Server.Port != 9000 || cfg.JWT.AccessTokenTTL.Duration != 10*time.Minute {
+			t.Errorf("host = %q, port = %d, access ttl = %v", cfg.Server.Host, cfg.Server.Port, cfg.JWT.AccessTokenTTL)
+		}
+	})
+
+	t.Run("flags over env", func(t *testing.T) {
+		requiredEnv(t)
+		t.Setenv("SERVER_HOST", "env-host")
+		t.Setenv("PORT", "9100")
+		cfg, err := Load([]string{"-config", yamlFile, "-host", "flag-host", "-port", "9200"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Server.Host != "flag-host" || cfg.Server.Port != 9200 {
+			t.Errorf("host = %q, port = %d", cfg.Server.Host, cfg.Server.Port)
+		}
+	})
+
+	t.Run("-config over CONFIG_FILE", func(t *testing.T) {
+		requiredEnv(t)
+		t.Setenv("CONFIG_FILE", filepath.Join(t.TempDir(), "missing.yaml"))
+		cfg, err := Load([]string{"-config", yamlFile})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cfg.Server.Host != "file-host" {
+			t.Errorf("host = %q", cfg.Server.Host)
+		}
+	})
+}
+
+func TestLoadTOML(t *testing.T) {
+	requiredEnv(t)
+	path := writeFile(t, "config.toml", `
+[server]
+port = 9000
+legacy_routes = false
+
+[jwt]
+algorithm = "EdDSA"
+key_rotation = "168h"
+
+[ldap.group_roles]
+"cn=admins,dc=corp" = "Admin"
+`)
+	cfg, err := Load([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Port != 9000 || cfg.Server.LegacyRoutes || cfg.JWT.Algorithm != "EdDSA" || cfg.JWT.KeyRotation.Duration != 168*time.Hour {
+		t.Errorf("server = %+v, jwt = %+v", cfg.Server, cfg.JWT)
+	}
+	if !reflect.DeepEqual(cfg.LDAP.GroupRoles, map[string]string{"cn=admins,dc=corp": "Admin"}) {
+		t.Errorf("group roles = %v", cfg.LDAP.GroupRoles)
+	}
+}
+
+func TestLoadEnvTypes(t *testing.T) {
+	requiredEnv(t)
+	t.Setenv("LEGACY_ROUTES", "false")
+	t.Setenv("UPLOAD_MAX_FILE_SIZE", "10485760")
+	t.Setenv("TRACING_SAMPLE_RATIO", "0.25")
+	t.Setenv("TRUSTED_PROXIES", " 10.0.0.1 ,, 192.168.0.0/16 ")
+	t.Setenv("AUTH_BACKENDS", "ldap,bcrypt")
+	t.Setenv("LDAP_URL", "ldap://dc1.corp.local")
+	t.Setenv("LDAP_BASE_DN", "dc=corp,dc=local")
+	t.Setenv("LDAP_GROUP_ROLES", "cn=admins,ou=groups,dc=corp=Admin; ;cn=it,dc=corp = Staff")
+	t.Setenv("OIDC_ADMIN_VALUES", "admins")
+	t.Setenv("SLA_LOW", "96h")
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.LegacyRoutes || cfg.Upload.MaxFileSize != 10<<20 || cfg.Tracing.SampleRatio != 0.25 || cfg.SLA.Low.Duration != 96*time.Hour {
+		t.Errorf("legacy = %v, upload = %d, ratio = %v, sla.low = %v",
+			cfg.Server.LegacyRoutes, cfg.Upload.MaxFileSize, cfg.Tracing.SampleRatio, cfg.SLA.Low)
+	}
+	if !reflect.DeepEqual(cfg.Server.TrustedProxies, []string{"10.0.0.1", "192.168.0.0/16"}) {
+		t.Errorf("trusted proxies = %q", cfg.Server.TrustedProxies)
+	}
+	if !reflect.DeepEqual(cfg.Auth.Backends, []string{"ldap", "bcrypt"}) || !reflect.DeepEqual(cfg.OIDC.AdminValues, []string{"admins"}) {
+		t.Errorf("backends = %q, admin values = %q", cfg.Auth.Backends, cfg.OIDC.AdminValues)
+	}
+	// split at the last "=", because DNs contain "=" themselves
+	want := map[string]string{"cn=admins,ou=groups,dc=corp": "Admin", "cn=it,dc=corp": "Staff"}
+	if !reflect.DeepEqual(cfg.LDAP.GroupRoles, want) {
+		t.Errorf("group roles = %v, want %v", cfg.LDAP.GroupRoles, want)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		args []string
+		want []string
+	}{
+		{"bad number", map[string]string{"PORT": "http"}, nil, []string{`PORT must be a number, got "http"`}},
+		{"bad int64", map[string]string{"UPLOAD_MAX_FILE_SIZE": "2MB"}, nil, []string{"UPLOAD_MAX_FILE_SIZE must be a number"}},
+		{"bad float", map[string]string{"TRACING_SAMPLE_RATIO": "half"}, nil, []string{"TRACING_SAMPLE_RATIO must be a number"}},
+		{"bad bool", map[string]string{"METRICS_ENABLED": "ya"}, nil, []string{`METRICS_ENABLED must be true or false, got "ya"`}},
+		{"bad duration", map[string]string{"JWT_ACCESS_TTL": "20"}, nil, []string{`JWT_ACCESS_TTL must be a duration like 20m or 168h, got "20"`}},
+		{"bad map", map[string]string{"LDAP_OU_UNITS": "IT"}, nil, []string{`LDAP_OU_UNITS must look like key=value;key=value, got "IT"`}},
+		{"all env errors at once", map[string]string{"PORT": "x", "DB_PORT": "y", "SLA_HIGH": "z"}, nil,
+			[]string{"PORT must be a number", "DB_PORT must be a number", "SLA_HIGH must be a duration"}},
+		{"validation", map[string]string{"JWT_SECRET": "short"}, nil, []string{"invalid configuration", "jwt.secret must be at least 32 characters"}},
+		{"flag validated", nil, []string{"-port", "70000"}, []string{"server.port must be between 1 and 65535 (PORT), got 70000"}},
+		{"unknown flag", nil, []string{"-verbose"}, []string{"flag provided but not defined: -verbose"}},
+		{"missing file", nil, []string{"-config", "/nonexistent/config.yaml"}, []string{"failed to read config file /nonexistent/config.yaml"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requiredEnv(t)
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			cfg, err := Load(tt.args)
+			if err == nil {
+				t.Fatalf("no error, got %+v", cfg)
+			}
+			for _, part := range tt.want {
+				if !strings.Contains(err.Error(), part) {
+					t.Errorf("error does not mention %q:\n%v", part, err)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadFileErrors(t *testing.T) {
+	tests := []struct {
+		name, file, content, want string
+	}{
+		{"unsupported type", "config.json", `{}`, `unsupported config file type`},
+		{"bad yaml", "config.yml", "server: [", "failed to parse config file"},
+		{"bad toml", "config.toml", "[server\n", "failed to parse config file"},
+		{"bad duration", "config.yaml", "jwt:\n  access_token_ttl: soon\n", "failed to parse config file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requiredEnv(t)
+			_, err := Load([]string{"-config", writeFile(t, tt.file, tt.content)})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("err = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlogLevel(t *testing.T) {
+	tests := map[string]string{"debug": "DEBUG", "Warn": "WARN", "ERROR": "ERROR", "info": "INFO", "": "INFO", "trace": "INFO"}
+	for level, want := range tests {
+		if got := (LogConfig{Level: level}).SlogLevel().String(); got != want {
+			t.Errorf("SlogLevel(%q) = %s, want %s", level, got, want)
+		}
+	}
+}
+
+func TestDurationText(t *testing.T) {
+	var d Duration
+	if err := d.UnmarshalText([]byte("1h30m")); err != nil || d.Duration != 90*time.Minute {
+		t.Fatalf("UnmarshalText = %v, %v", d, err)
+	}
+	text, err := d.MarshalText()
+	if err != nil || string(text) != "1h30m0s" {
+		t.Errorf("MarshalText = %q, %v", text, err)
+	}
+	if err := d.UnmarshalText([]byte("90")); err == nil {
+		t.Error("UnmarshalText(90) accepted a number without a unit")
+	}
+}
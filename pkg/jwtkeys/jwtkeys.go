@@ -0,0 +1,423 @@
+// Package jwtkeys signs and verifies our JWTs
+// HS256 uses the shared secret; RS256 and EdDSA use key pairs that are stored in the database
+// (private keys sealed with the secret), rotated on a schedule and published as a JWKS
+package jwtkeys
+
+import (
+	"context"
+	"crypto"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ed25519"
+	"crypto/hkdf"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Signing algorithms, as used in jwt.algorithm (JWT_ALGORITHM)
+const (
+	AlgHS256 = "HS256"
+	AlgRS256 = "RS256"
+	AlgEdDSA = "EdDSA"
+)
+
+// Algorithms lists the supported signing algorithms
+var Algorithms = []string{AlgHS256, AlgRS256, AlgEdDSA}
+
+var (
+	// ErrUnknownKey is returned for a token whose kid is not one of our keys
+	ErrUnknownKey = errors.New("unknown signing key")
+	// ErrNoSigningKey is returned when no key can sign right now (the database was unreachable)
+	ErrNoSigningKey = errors.New("no signing key available")
+)
+
+const (
+	checkInterval  = time.Minute // how often Run looks for keys to rotate and for keys of other instances
+	reloadInterval = time.Minute // an unknown kid reloads the keys at most this often
+	rsaBits        = 2048
+)
+
+// Record is a key pair as stored in the database
+type Record struct {
+	ID          string
+	Algorithm   string
+	PublicKey   []byte // PKIX DER
+	PrivateKey  []byte // PKCS #8 DER, sealed with the secret (nonce + AES-GCM ciphertext)
+	ActivatesAt time.Time
+	ExpiresAt   time.Time
+}
+
+// Store keeps the key pairs; Keys returns those that have not expired yet
+type Store interface {
+	Keys(ctx context.Context) ([]Record, error)
+	Add(ctx context.Context, r Record) error
+}
+
+// Options configures a Set
+type Options struct {
+	Algorithm string
+	Secret    []byte        // HS256 key, and the key that seals stored private keys
+	Rotation  time.Duration // how long a key pair signs before the next one takes over
+	TokenTTL  time.Duration // longest token lifetime; a key stays published this long after it stops signing
+}
+
+// key is a loaded key pair
+type key struct {
+	id          string
+	alg         string
+	public      crypto.PublicKey
+	private     crypto.Signer
+	activatesAt time.Time
+	expiresAt   time.Time
+}
+
+// Set holds the keys of one algorithm
+type Set struct {
+	opts  Options
+	store Store
+	aead  cipher.AEAD
+
+	mu       sync.RWMutex
+	keys     []*key // sorted by activatesAt
+	reloaded time.Time
+}
+
+// New returns a Set; for RS256 and EdDSA call Rotate before signing so a key pair exists
+func New(opts Options, store Store) (*Set, error) {
+	if !slices.Contains(Algorithms, opts.Algorithm) {
+		return nil, fmt.Errorf("unsupported algorithm %q", opts.Algorithm)
+	}
+	s := &Set{opts: opts, store: store}
+	if opts.Algorithm == AlgHS256 {
+		return s, nil
+	}
+
+	sealKey, err := hkdf.Key(sha256.New, opts.Secret, nil, "siro jwt signing keys", 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(sealKey)
+	if err != nil {
+		return nil, err
+	}
+	if s.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Algorithm returns the signing algorithm
+func (s *Set) Algorithm() string { return s.opts.Algorithm }
+
+// Sign signs the claims with the current key; asymmetric tokens carry its kid
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	if s.opts.Algorithm == AlgHS256 {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(s.opts.Secret)
+	}
+
+	k := s.signingKey()
+	if k == nil {
+		// Rotation is overdue (e.g. every instance was down); create the key now
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		if err := s.Rotate(ctx); err != nil {
+			return "", fmt.Errorf("%w: %v", ErrNoSigningKey, err)
+		}
+		if k = s.signingKey(); k == nil {
+			return "", ErrNoSigningKey
+		}
+	}
+
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims)
+	token.Header["kid"] = k.id
+	return token.SignedString(k.private)
+}
+
+// signingKey returns the newest active key that stays published as long as the tokens it signs live
+func (s *Set) signingKey() *key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	now := time.Now()
+	for i := len(s.keys) - 1; i >= 0; i-- {
+		k := s.keys[i]
+		if k.alg == s.opts.Algorithm && !k.activatesAt.After(now) && k.expiresAt.After(now.Add(s.opts.TokenTTL)) {
+			return k
+		}
+	}
+	return nil
+}
+
+// Parse verifies a token signed by us and returns its claims
+// Only the configured algorithm is accepted, and asymmetric tokens must name a known kid
+func (s *Set) Parse(tokenString string) (jwt.MapClaims, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(tokenString, claims, s.keyFunc,
+		jwt.WithValidMethods([]string{s.opts.Algorithm}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (s *Set) keyFunc(t *jwt.Token) (interface{}, error) {
+	if s.opts.Algorithm == AlgHS256 {
+		return s.opts.Secret, nil
+	}
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		return nil, ErrUnknownKey
+	}
+	if k := s.find(kid); k != nil {
+		return k.public, nil
+	}
+
+	// Possibly a key another instance just created
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if s.reloadIfStale(ctx) {
+		if k := s.find(kid); k != nil {
+			return k.public, nil
+		}
+	}
+	return nil, ErrUnknownKey
+}
+
+func (s *Set) find(kid string) *key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	now := time.Now()
+	for _, k := range s.keys {
+		if k.id == kid && k.expiresAt.After(now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// reloadIfStale reloads the keys unless that happened within reloadInterval
+func (s *Set) reloadIfStale(ctx context.Context) bool {
+	s.mu.RLock()
+	stale := time.Since(s.reloaded) >= reloadInterval
+	s.mu.RUnlock()
+	if !stale {
+		return false
+	}
+	if err := s.reload(ctx); err != nil {
+		slog.ErrorContext(ctx, "failed to reload jwt keys", "error", err)
+		return false
+	}
+	return true
+}
+
+// reload replaces the loaded keys with the unexpired ones from the store
+func (s *Set) reload(ctx context.Context) error {
+	records, err := s.store.Keys(ctx)
+	if err != nil {
+		return err
+	}
+	keys := make([]*key, 0, len(records))
+	for _, r := range records {
+		k, err := s.open(r)
+		if err != nil {
+			// e.g. sealed with an earlier JWT_SECRET; its tokens can't be verified any more either way
+			slog.WarnContext(ctx, "skipping unreadable jwt key", "kid", r.ID, "error", err)
+			continue
+		}
+		keys = append(keys, k)
+	}
+	slices.SortFunc(keys, func(a, b *key) int { return a.activatesAt.Compare(b.activatesAt) })
+
+	s.mu.Lock()
+	s.keys = keys
+	s.reloaded = time.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// prepublish is how long a new key is in the JWKS before it signs,
+// so services that cache the JWKS know it before they see its first token
+func (s *Set) prepublish() time.Duration {
+	return min(time.Hour, s.opts.Rotation/2)
+}
+
+// Rotate reloads the keys and adds the next key pair when the current one is due to be replaced
+// The new key activates when the current one has signed for the rotation interval
+func (s *Set) Rotate(ctx context.Context) error {
+	if s.opts.Algorithm == AlgHS256 {
+		return nil
+	}
+	if err := s.reload(ctx); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	activatesAt := now
+	s.mu.RLock()
+	for _, k := range s.keys {
+		if k.alg == s.opts.Algorithm {
+			activatesAt = k.activatesAt.Add(s.opts.Rotation)
+		}
+	}
+	s.mu.RUnlock()
+	if activatesAt.Sub(now) > s.prepublish() && s.signingKey() != nil {
+		return nil
+	}
+	if activatesAt.Before(now) || s.signingKey() == nil {
+		activatesAt = now
+	}
+
+	r, err := s.generate(activatesAt)
+	if err != nil {
+		return err
+	}
+	if err := s.store.Add(ctx, r); err != nil {
+		return err
+	}
+	slog.InfoContext(ctx, "jwt signing key created", "kid", r.ID, "algorithm", r.Algorithm, "activates_at", r.ActivatesAt)
+	return s.reload(ctx)
+}
+
+// Run rotates the keys every minute until ctx is done, which also picks up keys of other instances
+func (s *Set) Run(ctx context.Context) {
+	if s.opts.Algorithm == AlgHS256 {
+		return
+	}
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Rotate(ctx); err != nil {
+				slog.ErrorContext(ctx, "jwt key rotation failed", "error", err)
+			}
+		}
+	}
+}
+
+// generate creates a key pair that signs from activatesAt
+func (s *Set) generate(activatesAt time.Time) (Record, error) {
+	var signer crypto.Signer
+	var err error
+	switch s.opts.Algorithm {
+	case AlgRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case AlgEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	}
+	if err != nil {
+		return Record{}, err
+	}
+
+	public, err := x509.MarshalPKIXPublicKey(signer.Public())
+	if err != nil {
+		return Record{}, err
+	}
+	private, err := x509.MarshalPKCS8PrivateKey(signer)
+	if err != nil {
+		return Record{}, err
+	}
+	id := make([]byte, 12)
+	if _, err := rand.Read(id); err != nil {
+		return Record{}, err
+	}
+	kid := base64.RawURLEncoding.EncodeToString(id)
+
+	nonce := make([]byte, s.aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return Record{}, err
+	}
+	return Record{
+		ID:          kid,
+		Algorithm:   s.opts.Algorithm,
+		PublicKey:   public,
+		PrivateKey:  s.aead.Seal(nonce, nonce, private, []byte(kid)),
+		ActivatesAt: activatesAt.Truncate(time.Second),
+		ExpiresAt:   activatesAt.Add(s.opts.Rotation + s.opts.TokenTTL).Truncate(time.Second),
+	}, nil
+}
+
+// open unseals a stored key pair
+func (s *Set) open(r Record) (*key, error) {
+	n := s.aead.NonceSize()
+	if len(r.PrivateKey) < n {
+		return nil, errors.New("sealed private key too short")
+	}
+	der, err := s.aead.Open(nil, r.PrivateKey[:n], r.PrivateKey[n:], []byte(r.ID))
+	if err != nil {
+		return nil, fmt.Errorf("unseal private key: %w", err)
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(der)
+	if err != nil {
+		return nil, err
+	}
+	signer, ok := parsed.(crypto.Signer)
+	if !ok {
+		return nil, errors.New("private key can't sign")
+	}
+	public, err := x509.ParsePKIXPublicKey(r.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	return &key{id: r.ID, alg: r.Algorithm, public: public, private: signer, activatesAt: r.ActivatesAt, expiresAt: r.ExpiresAt}, nil
+}
+
+// JWKS is a JSON Web Key Set (RFC 7517)
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWK is a public key of the set
+type JWK struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JWKS returns the public keys that verify tokens now or will sign soon; empty for HS256
+func (s *Set) JWKS() JWKS {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	set := JWKS{Keys: []JWK{}}
+	now := time.Now()
+	for _, k := range s.keys {
+		if !k.expiresAt.After(now) {
+			continue
+		}
+		jwk := JWK{KeyID: k.id, Use: "sig", Algorithm: k.alg}
+		switch pub := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
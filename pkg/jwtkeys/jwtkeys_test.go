@@ -0,0 +1,440 @@
+package jwtkeys
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// memStore is a Store in memory
+type memStore struct {
+	mu      sync.Mutex
+	records []Record
+	loads   int // calls to Keys
+}
+
+func (m *memStore) Keys(ctx context.Context) ([]Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.loads++
+	var out []Record
+	for _, r := range m.records {
+		if r.ExpiresAt.After(time.Now()) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+func (m *memStore) Add(ctx context.Context, r Record) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.records = append(m.records, r)
+	return nil
+}
+
+func (m *memStore) loadCount() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.loads
+}
+
+var testSecret = []byte(strings.Repeat("s", 32))
+
+func newSet(t *testing.T, alg string, store Store) *Set {
+	t.Helper()
+	s, err := New(Options{Algorithm: alg, Secret: testSecret, Rotation: time.Hour, TokenTTL: time.Hour}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// claims are valid for ten minutes
+func claims() jwt.MapClaims {
+	return jwt.MapClaims{"sub": "12", "exp": time.Now().Add(10 * time.Minute).Unix()}
+}
+
+// signWith signs claims with a loaded key of the set, whether or not it is the current one
+func signWith(t *testing.T, s *Set, kid string) string {
+	t.Helper()
+	k := s.find(kid)
+	if k == nil {
+		t.Fatalf("key %s is not loaded", kid)
+	}
+	token := jwt.NewWithClaims(jwt.GetSigningMethod(k.alg), claims())
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(k.private)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// kidOf returns the kid header of a token
+func kidOf(t *testing.T, token string) string {
+	t.Helper()
+	parsed, _, err := jwt.NewParser().ParseUnverified(token, jwt.MapClaims{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid
+}
+
+// retire makes a key expire as if its time had passed
+func retire(s *Set, store *memStore, kid string) {
+	past := time.Now().Add(-time.Second)
+	store.mu.Lock()
+	for i := range store.records {
+		if store.records[i].ID == kid {
+			store.records[i].ExpiresAt = past
+		}
+	}
+	store.mu.Unlock()
+	s.mu.Lock()
+	for _, k := range s.keys {
+		if k.id == kid {
+			k.expiresAt = past
+		}
+	}
+	s.mu.Unlock()
+}
+
+func jwksKIDs(s *Set) []string {
+	var kids []string
+	for _, k := range s.JWKS().Keys {
+		kids = append(kids, k.KeyID)
+	}
+	return kids
+}
+
+func TestSignAndParse(t *testing.T) {
+	for _, alg := range Algorithms {
+		t.Run(alg, func(t *testing.T) {
+			store := &memStore{}
+			s := newSet(t, alg, store)
+			if err := s.Rotate(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+			token, err := s.Sign(claims())
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := s.Parse(token)
+			if err != nil {
+				t.Fatalf("Parse: %v", err)
+			}
+			if got["sub"] != "12" {
+				t.Errorf("sub = %v", got["sub"])
+			}
+
+			kid := kidOf(t, token)
+			jwks := s.JWKS()
+			if alg == AlgHS256 {
+				if kid != "" || len(jwks.Keys) != 0 || len(store.records) != 0 {
+					t.Errorf("HS256: kid %q, %d published keys, %d stored keys", kid, len(jwks.Keys), len(store.records))
+				}
+				return
+			}
+			if len(jwks.Keys) != 1 || jwks.Keys[0].KeyID != kid || jwks.Keys[0].Algorithm != alg {
+				t.Fatalf("JWKS = %+v, want the key %s", jwks, kid)
+			}
+			switch alg {
+			case AlgRS256:
+				if jwks.Keys[0].KeyType != "RSA" || jwks.Keys[0].N == "" || jwks.Keys[0].E != "AQAB" {
+					t.Errorf("RSA JWK = %+v", jwks.Keys[0])
+				}
+			case AlgEdDSA:
+				if jwks.Keys[0].KeyType != "OKP" || jwks.Keys[0].Curve != "Ed25519" || jwks.Keys[0].X == "" {
+					t.Errorf("EdDSA JWK = %+v", jwks.Keys[0])
+				}
+			}
+
+			// The private key is stored sealed, not as plain PKCS #8
+			if _, err := x509.ParsePKCS8PrivateKey(store.records[0].PrivateKey); err == nil {
+				t.Error("the stored private key is not sealed")
+			}
+		})
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	store := &memStore{}
+	s := newSet(t, AlgRS256, store)
+	if err := s.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	valid, err := s.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	kid := kidOf(t, valid)
+	publicDER := store.records[0].PublicKey
+
+	sign := func(method jwt.SigningMethod, c jwt.MapClaims, header map[string]interface{}, key interface{}) string {
+		t.Helper()
+		token := jwt.NewWithClaims(method, c)
+		for k, v := range header {
+			token.Header[k] = v
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	own := s.find(kid).private
+	other, err := New(Options{Algorithm: AlgRS256, Secret: testSecret, Rotation: time.Hour, TokenTTL: time.Hour}, &memStore{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherRecord, err := other.generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherKey, err := other.open(otherRecord)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		want  error
+	}{
+		{"HS256 with the secret", sign(jwt.SigningMethodHS256, claims(), nil, testSecret), jwt.ErrTokenSignatureInvalid},
+		{"HS256 with the secret and a known kid", sign(jwt.SigningMethodHS256, claims(), map[string]interface{}{"kid": kid}, testSecret), jwt.ErrTokenSignatureInvalid},
+		{"HS256 with the public key as secret", sign(jwt.SigningMethodHS256, claims(), map[string]interface{}{"kid": kid}, publicDER), jwt.ErrTokenSignatureInvalid},
+		{"alg none", sign(jwt.SigningMethodNone, claims(), map[string]interface{}{"kid": kid}, jwt.UnsafeAllowNoneSignatureType), jwt.ErrTokenSignatureInvalid},
+		{"EdDSA with a known kid", sign(jwt.SigningMethodEdDSA, claims(), map[string]interface{}{"kid": kid}, ed25519.NewKeyFromSeed(make([]byte, 32))), jwt.ErrTokenSignatureInvalid},
+		{"unknown kid", sign(jwt.SigningMethodRS256, claims(), map[string]interface{}{"kid": "not-ours"}, own), ErrUnknownKey},
+		{"no kid", sign(jwt.SigningMethodRS256, claims(), nil, own), ErrUnknownKey},
+		{"kid of the wrong type", sign(jwt.SigningMethodRS256, claims(), map[string]interface{}{"kid": 7}, own), ErrUnknownKey},
+		{"known kid, other key", sign(jwt.SigningMethodRS256, claims(), map[string]interface{}{"kid": kid}, otherKey.private.(*rsa.PrivateKey)), jwt.ErrTokenSignatureInvalid},
+		{"expired", sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "12", "exp": time.Now().Add(-time.Minute).Unix()}, map[string]interface{}{"kid": kid}, own), jwt.ErrTokenExpired},
+		{"no exp", sign(jwt.SigningMethodRS256, jwt.MapClaims{"sub": "12"}, map[string]interface{}{"kid": kid}, own), jwt.ErrTokenRequiredClaimMissing},
+		{"signature changed", valid[:len(valid)-4] + "AAAA", jwt.ErrTokenSignatureInvalid},
+		{"garbage", "not.a.token", jwt.ErrTokenMalformed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := s.Parse(tt.token)
+			if err == nil {
+				t.Fatalf("Parse accepted the token: %v", claims)
+			}
+			if !errors.Is(err, tt.want) {
+				t.Errorf("Parse error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+
+	t.Run("RS256 token on an HS256 set", func(t *testing.T) {
+		hs := newSet(t, AlgHS256, nil)
+		if _, err := hs.Parse(valid); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+			t.Errorf("Parse error = %v, want ErrTokenSignatureInvalid", err)
+		}
+	})
+}
+
+func TestUnknownKidReload(t *testing.T) {
+	store := &memStore{}
+	s := newSet(t, AlgEdDSA, store)
+	if err := s.Rotate(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	// Another instance with the same secret adds a key
+	other := newSet(t, AlgEdDSA, store)
+	r, err := other.generate(time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Add(context.Background(), r); err != nil {
+		t.Fatal(err)
+	}
+	if err := other.reload(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	token := signWith(t, other, r.ID)
+
+	// Keys were just loaded, so an unknown kid doesn't reload them again
+	loads := store.loadCount()
+	if _, err := s.Parse(token); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("right after loading: err = %v, want ErrUnknownKey", err)
+	}
+	if store.loadCount() != loads {
+		t.Errorf("an unknown kid reloaded the keys within reloadInterval")
+	}
+
+	// After reloadInterval it does, and finds the new key
+	s.mu.Lock()
+	s.reloaded = time.Now().Add(-reloadInterval)
+	s.mu.Unlock()
+	if _, err := s.Parse(token); err != nil {
+		t.Fatalf("after reloadInterval: %v", err)
+	}
+	if store.loadCount() != loads+1 {
+		t.Errorf("keys loaded %d times, want once", store.loadCount()-loads)
+	}
+
+	// A flood of unknown kids reloads at most once per interval
+	s.mu.Lock()
+	s.reloaded = time.Now().Add(-reloadInterval)
+	s.mu.Unlock()
+	forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims())
+	_, priv, _ := ed25519.GenerateKey(nil)
+	for i := 0; i < 20; i++ {
+		forged.Header["kid"] = "forged-" + string(rune('a'+i))
+		signed, _ := forged.SignedString(priv)
+		if _, err := s.Parse(signed); !errors.Is(err, ErrUnknownKey) {
+			t.Fatalf("forged kid: err = %v, want ErrUnknownKey", err)
+		}
+	}
+	if n := store.loadCount() - loads - 1; n != 1 {
+		t.Errorf("20 unknown kids reloaded the keys %d times, want 1", n)
+	}
+}
+
+func TestRotationGraceWindow(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	s := newSet(t, AlgRS256, store)
+	now := time.Now()
+
+	// Rotation and TokenTTL are an hour: the previous key signed until 30 minutes ago,
+	// and stays valid for another 30 minutes so its tokens can run out
+	previous, err := s.generate(now.Add(-90 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := s.generate(now.Add(-30 * time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	store.records = []Record{previous, current}
+	if err := s.reload(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	token, err := s.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := kidOf(t, token); kid != current.ID {
+		t.Errorf("signed with %s, want the current key %s", kid, current.ID)
+	}
+
+	old := signWith(t, s, previous.ID)
+	if _, err := s.Parse(old); err != nil {
+		t.Errorf("token of the previous key in its grace window: %v", err)
+	}
+	if kids := jwksKIDs(s); len(kids) != 2 {
+		t.Errorf("JWKS has %v, want the previous and the current key", kids)
+	}
+
+	// Once the previous key is retired its tokens are rejected and it leaves the JWKS
+	retire(s, store, previous.ID)
+	if _, err := s.Parse(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a retired key: err = %v, want ErrUnknownKey", err)
+	}
+	if kids := jwksKIDs(s); len(kids) != 1 || kids[0] != current.ID {
+		t.Errorf("JWKS has %v, want only the current key", kids)
+	}
+	if _, err := s.Parse(token); err != nil {
+		t.Errorf("token of the current key: %v", err)
+	}
+
+	// Also after a reload, which only returns unexpired keys
+	s.mu.Lock()
+	s.reloaded = time.Now().Add(-reloadInterval)
+	s.mu.Unlock()
+	if _, err := s.Parse(old); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of a retired key after a reload: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	s := newSet(t, AlgEdDSA, store)
+
+	if err := s.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.records) != 1 {
+		t.Fatalf("%d keys after two rotations in a row, want 1", len(store.records))
+	}
+	first := store.records[0]
+
+	// Close to the end of its rotation, the next key is created and published before it signs
+	store.records[0].ActivatesAt = time.Now().Add(-time.Hour + 10*time.Minute)
+	store.records[0].ExpiresAt = store.records[0].ActivatesAt.Add(2 * time.Hour)
+	if err := s.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if len(store.records) != 2 {
+		t.Fatalf("%d keys, want a second one", len(store.records))
+	}
+	next := store.records[1]
+	if want := store.records[0].ActivatesAt.Add(time.Hour); !next.ActivatesAt.Equal(want.Truncate(time.Second)) {
+		t.Errorf("next key activates at %v, want %v", next.ActivatesAt, want)
+	}
+	if kids := jwksKIDs(s); len(kids) != 2 {
+		t.Errorf("JWKS has %v, want both keys", kids)
+	}
+	token, err := s.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if kid := kidOf(t, token); kid != first.ID {
+		t.Errorf("signed with %s before the next key activates, want %s", kid, first.ID)
+	}
+}
+
+func TestSealedWithAnotherSecret(t *testing.T) {
+	ctx := context.Background()
+	store := &memStore{}
+	old, err := New(Options{Algorithm: AlgRS256, Secret: []byte(strings.Repeat("o", 32)), Rotation: time.Hour, TokenTTL: time.Hour}, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	token, err := old.Sign(claims())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// After JWT_SECRET changed the stored key can't be opened; a new one is made instead
+	s := newSet(t, AlgRS256, store)
+	if err := s.Rotate(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if kids := jwksKIDs(s); len(kids) != 1 || kids[0] == kidOf(t, token) {
+		t.Errorf("JWKS has %v, want only the new key", kids)
+	}
+	if _, err := s.Parse(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token of the unreadable key: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestNewUnsupportedAlgorithm(t *testing.T) {
+	for _, alg := range []string{"", "none", "HS512", "ES256", "rs256"} {
+		if _, err := New(Options{Algorithm: alg, Secret: testSecret}, nil); err == nil {
+			t.Errorf("New accepted algorithm %q", alg)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// record logs one line through contextHandler and returns it decoded
+func record(t *testing.T, ctx context.Context, log func(l *slog.Logger)) map[string]interface{} {
+	t.Helper()
+	var buf bytes.Buffer
+	log(slog.New(contextHandler{slog.NewJSONHandler(&buf, nil)}))
+	var line map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &line); err != nil {
+		t.Fatalf("log line %q: %v", buf.String(), err)
+	}
+	return line
+}
+
+func TestContextHandler(t *testing.T) {
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+	sc := trace.NewSpanContext(trace.SpanContextConfig{TraceID: traceID, SpanID: spanID, TraceFlags: trace.FlagsSampled})
+
+	ctx := WithUserID(WithRequestID(context.Background(), "req-1"), 42)
+	ctx = trace.ContextWithSpanContext(ctx, sc)
+
+	line := record(t, ctx, func(l *slog.Logger) { l.InfoContext(ctx, "hello", "unit", "IT") })
+	want := map[string]interface{}{
+		"msg": "hello", "unit": "IT", "request_id": "req-1", "user_id": float64(42),
+		"trace_id": "4bf92f3577b34da6a3ce929d0e0e4736", "span_id": "00f067aa0ba902b7",
+	}
+	for k, v := range want {
+		if line[k] != v {
+			t.Errorf("%s = %v, want %v", k, line[k], v)
+		}
+	}
+}
+
+func TestContextHandlerWithoutValues(t *testing.T) {
+	line := record(t, context.Background(), func(l *slog.Logger) { l.Info("hello") })
+	for _, k := range []string{"request_id", "user_id", "trace_id", "span_id"} {
+		if _, ok := line[k]; ok {
+			t.Errorf("%s logged without a value in the context", k)
+		}
+	}
+}
+
+func TestContextHandlerWithAttrsAndGroup(t *testing.T) {
+	ctx := WithRequestID(context.Background(), "req-2")
+	// loggers derived with With and WithGroup still add the request values
+	line := record(t, ctx, func(l *slog.Logger) {
+		l.With("component", "mailer").WithGroup("smtp").InfoContext(ctx, "sent", "host", "smtp.example.com")
+	})
+	if line["component"] != "mailer" {
+		t.Errorf("component = %v", line["component"])
+	}
+	group, _ := line["smtp"].(map[string]interface{})
+	if group["host"] != "smtp.example.com" || group["request_id"] != "req-2" {
+		t.Errorf("smtp group = %v", line["smtp"])
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	if got := RequestID(context.Background()); got != "" {
+		t.Errorf("RequestID of an empty context = %q", got)
+	}
+	if got := RequestID(WithRequestID(context.Background(), "req-3")); got != "req-3" {
+		t.Errorf("RequestID = %q", got)
+	}
+}
@@ -0,0 +1,146 @@
+package mailer
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"mime"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"siro-backend/pkg/config"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Message is a plain text email
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers emails
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrDisabled is returned by the default mailer when no SMTP server is configured
+var ErrDisabled = errors.New("email is not configured")
+
+// current is the mailer used by Send, set by Init
+var current Mailer = disabled{}
+
+// Init chooses the mailer from the config: SMTP when a host is set, otherwise none
+func Init(cfg config.MailConfig) {
+	if cfg.Enabled() {
+		current = &SMTP{cfg: cfg}
+	} else {
+		current = disabled{}
+	}
+}
+
+// Set replaces the mailer, e.g. with a fake in tests or another provider
+func Set(m Mailer) {
+	current = m
+}
+
+// Enabled reports whether emails are actually delivered
+func Enabled() bool {
+	_, off := current.(disabled)
+	return !off
+}
+
+// Send delivers msg with the configured mailer
+func Send(ctx context.Context, msg Message) error {
+	return current.Send(ctx, msg)
+}
+
+// disabled is used without SMTP settings: nothing is sent
+type disabled struct{}
+
+func (disabled) Send(ctx context.Context, msg Message) error {
+	slog.DebugContext(ctx, "email not sent, no SMTP server configured", "subject", msg.Subject)
+	return ErrDisabled
+}
+
+// SMTP sends email through an SMTP server, with STARTTLS when the server offers it
+type SMTP struct {
+	cfg config.MailConfig
+}
+
+// Send delivers msg; the context deadline (or 30 seconds) limits the whole exchange
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	from, err := mail.ParseAddress(s.cfg.From)
+	if err != nil {
+		return fmt.Errorf("invalid sender %q: %w", s.cfg.From, err)
+	}
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("invalid recipient %q: %w", msg.To, err)
+	}
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	addr := net.JoinHostPort(s.cfg.SMTPHost, strconv.Itoa(s.cfg.SMTPPort))
+	dialer := net.Dialer{Deadline: deadline}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return err
+	}
+	_ = conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.cfg.SMTPHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.cfg.SMTPHost}); err != nil {
+			return err
+		}
+	}
+	if s.cfg.Username != "" {
+		if err := c.Auth(smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.SMTPHost)); err != nil {
+			return err
+		}
+	}
+	if err := c.Mail(from.Address); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to.Address); err != nil {
+		return err
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(format(from, to, msg)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// format builds the raw message with headers (the body is sent as UTF-8 text)
+func format(from, to *mail.Address, msg Message) []byte {
+	var b strings.Builder
+	b.WriteString("From: " + from.String() + "\r\n")
+	b.WriteString("To: " + to.String() + "\r\n")
+	b.WriteString("Subject: " + mime.QEncoding.Encode("UTF-8", msg.Subject) + "\r\n")
+	b.WriteString("Date: " + time.Now().Format(time.RFC1123Z) + "\r\n")
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	b.WriteString("Content-Transfer-Encoding: 8bit\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(msg.Body, "\r\n", "\n"), "\n", "\r\n"))
+	return []byte(b.String())
+}
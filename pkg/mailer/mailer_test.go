@@ -0,0 +1,240 @@
+package mailer
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"errors"
+	"mime"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"siro-backend/pkg/config"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpSession is what the fake server received
+type smtpSession struct {
+	auth string // decoded AUTH PLAIN credentials
+	from string
+	rcpt []string
+	data string
+}
+
+// fakeSMTP accepts one connection on localhost and answers like a minimal SMTP server without STARTTLS
+// rejectRcpt makes it refuse every recipient
+func fakeSMTP(t *testing.T, rejectRcpt bool) (config.MailConfig, <-chan smtpSession) {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	sessions := make(chan smtpSession, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		_ = conn.SetDeadline(time.Now().Add(5 * time.Second))
+		tp := textproto.NewConn(conn)
+		var s smtpSession
+		defer func() { sessions <- s }()
+
+		_ = tp.PrintfLine("220 localhost ESMTP")
+		for {
+			line, err := tp.ReadLine()
+			if err != nil {
+				return
+			}
+			cmd, arg, _ := strings.Cut(line, " ")
+			switch strings.ToUpper(cmd) {
+			case "EHLO":
+				_ = tp.PrintfLine("250-localhost")
+				_ = tp.PrintfLine("250 AUTH PLAIN")
+			case "AUTH":
+				creds, _ := base64.StdEncoding.DecodeString(strings.TrimPrefix(arg, "PLAIN "))
+				s.auth = string(creds)
+				_ = tp.PrintfLine("235 OK")
+			case "MAIL":
+				s.from = arg
+				_ = tp.PrintfLine("250 OK")
+			case "RCPT":
+				if rejectRcpt {
+					_ = tp.PrintfLine("550 no such user")
+					continue
+				}
+				s.rcpt = append(s.rcpt, arg)
+				_ = tp.PrintfLine("250 OK")
+			case "DATA":
+				_ = tp.PrintfLine("354 go ahead")
+				data, err := tp.ReadDotBytes()
+				if err != nil {
+					return
+				}
+				s.data = string(data)
+				_ = tp.PrintfLine("250 OK")
+			case "QUIT":
+				_ = tp.PrintfLine("221 bye")
+				return
+			default:
+				_ = tp.PrintfLine("502 not implemented")
+			}
+		}
+	}()
+
+	_, port, _ := net.SplitHostPort(ln.Addr().String())
+	p, _ := strconv.Atoi(port)
+	return config.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: p, From: "SIRO <noreply@example.com>"}, sessions
+}
+
+func TestSMTPSend(t *testing.T) {
+	cfg, sessions := fakeSMTP(t, false)
+	cfg.Username = "siro"
+	cfg.Password = "secret"
+
+	msg := Message{To: "Budi Santoso <budi@example.com>", Subject: "Undangan ke SIRO – aktifkan akun", Body: "Halo,\nklik tautan ini.\r\nTerima kasih"}
+	if err := (&SMTP{cfg: cfg}).Send(context.Background(), msg); err != nil {
+		t.Fatal(err)
+	}
+	s := <-sessions
+
+	if s.auth != "\x00siro\x00secret" {
+		t.Errorf("auth = %q", s.auth)
+	}
+	if s.from != "FROM:<noreply@example.com>" || len(s.rcpt) != 1 || s.rcpt[0] != "TO:<budi@example.com>" {
+		t.Errorf("envelope = %q -> %q", s.from, s.rcpt)
+	}
+
+	// the message must parse as mail, with an encoded subject and the body as sent
+	m, err := mail.ReadMessage(bufio.NewReader(strings.NewReader(s.data)))
+	if err != nil {
+		t.Fatalf("invalid message %q: %v", s.data, err)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(m.Header.Get("Subject"))
+	if err != nil || subject != msg.Subject {
+		t.Errorf("subject = %q (%q), %v", subject, m.Header.Get("Subject"), err)
+	}
+	if strings.ContainsRune(m.Header.Get("Subject"), '–') {
+		t.Errorf("subject %q is not encoded", m.Header.Get("Subject"))
+	}
+	if got := m.Header.Get("From"); got != `"SIRO" <noreply@example.com>` {
+		t.Errorf("From = %q", got)
+	}
+	if got := m.Header.Get("To"); got != `"Budi Santoso" <budi@example.com>` {
+		t.Errorf("To = %q", got)
+	}
+	if _, err := m.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if got := m.Header.Get("Content-Type"); got != "text/plain; charset=UTF-8" {
+		t.Errorf("Content-Type = %q", got)
+	}
+	// textproto.ReadDotBytes turns CRLF into LF, so every line ending arrived as CRLF
+	if !strings.HasSuffix(s.data, "\n\nHalo,\nklik tautan ini.\nTerima kasih\n") {
+		t.Errorf("data = %q", s.data)
+	}
+}
+
+func TestSMTPSendWithoutAuth(t *testing.T) {
+	cfg, sessions := fakeSMTP(t, false)
+	if err := (&SMTP{cfg: cfg}).Send(context.Background(), Message{To: "budi@example.com", Subject: "Hi"}); err != nil {
+		t.Fatal(err)
+	}
+	if s := <-sessions; s.auth != "" || len(s.rcpt) != 1 {
+		t.Errorf("session = %+v, want no AUTH", s)
+	}
+}
+
+func TestSMTPSendErrors(t *testing.T) {
+	t.Run("recipient rejected", func(t *testing.T) {
+		cfg, _ := fakeSMTP(t, true)
+		err := (&SMTP{cfg: cfg}).Send(context.Background(), Message{To: "nobody@example.com"})
+		if err == nil || !strings.Contains(err.Error(), "550") {
+			t.Errorf("err = %v, want the 550 reply", err)
+		}
+	})
+
+	t.Run("invalid addresses", func(t *testing.T) {
+		cfg := config.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: 1, From: "SIRO <noreply@example.com>"}
+		if err := (&SMTP{cfg: cfg}).Send(context.Background(), Message{To: "not an address"}); err == nil || !strings.Contains(err.Error(), "invalid recipient") {
+			t.Errorf("err = %v", err)
+		}
+		cfg.From = "noreply"
+		if err := (&SMTP{cfg: cfg}).Send(context.Background(), Message{To: "budi@example.com"}); err == nil || !strings.Contains(err.Error(), "invalid sender") {
+			t.Errorf("err = %v", err)
+		}
+	})
+
+	t.Run("server down", func(t *testing.T) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		port := ln.Addr().(*net.TCPAddr).Port
+		ln.Close()
+		cfg := config.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: port, From: "noreply@example.com"}
+		if err := (&SMTP{cfg: cfg}).Send(context.Background(), Message{To: "budi@example.com"}); err == nil {
+			t.Error("no error")
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		// the server accepts the connection but never greets
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer ln.Close()
+		cfg := config.MailConfig{SMTPHost: "127.0.0.1", SMTPPort: ln.Addr().(*net.TCPAddr).Port, From: "noreply@example.com"}
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		start := time.Now()
+		err = (&SMTP{cfg: cfg}).Send(ctx, Message{To: "budi@example.com"})
+		var netErr net.Error
+		if !errors.As(err, &netErr) || !netErr.Timeout() {
+			t.Errorf("err = %v, want a timeout", err)
+		}
+		if time.Since(start) > 2*time.Second {
+			t.Errorf("Send took %v", time.Since(start))
+		}
+	})
+}
+
+func TestInit(t *testing.T) {
+	t.Cleanup(func() { Set(disabled{}) })
+
+	Init(config.MailConfig{})
+	if Enabled() {
+		t.Error("enabled without a host")
+	}
+	if err := Send(context.Background(), Message{To: "budi@example.com"}); !errors.Is(err, ErrDisabled) {
+		t.Errorf("Send = %v, want ErrDisabled", err)
+	}
+
+	Init(config.MailConfig{SMTPHost: "smtp.example.com", SMTPPort: 587, From: "noreply@example.com"})
+	if _, ok := current.(*SMTP); !ok || !Enabled() {
+		t.Errorf("mailer = %T, want SMTP", current)
+	}
+
+	fake := &recorder{}
+	Set(fake)
+	if err := Send(context.Background(), Message{To: "budi@example.com", Subject: "Hi"}); err != nil || len(fake.sent) != 1 || !Enabled() {
+		t.Errorf("Send = %v, sent %v", err, fake.sent)
+	}
+}
+
+// recorder is a Mailer that keeps the messages
+type recorder struct {
+	sent []Message
+}
+
+func (r *recorder) Send(_ context.Context, msg Message) error {
+	r.sent = append(r.sent, msg)
+	return nil
+}
@@ -0,0 +1,277 @@
+// Package oidctest is a minimal OpenID Connect provider for tests and for trying single sign-on
+// locally (cmd/mockidp). Never use it in production: anyone can log in as anyone.
+//
+//	idp, _ := oidctest.New("", "siro", "")
+//	srv := httptest.NewServer(idp.Handler())
+//	idp.Issuer = srv.URL
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID is the kid of the provider's signing key
+const KeyID = "mockidp-1"
+
+// Identity is who signs in at the provider
+type Identity struct {
+	Subject string
+	Email   string
+	Name    string
+	// Claims are added to the ID token. email_verified is true unless set here; null removes it.
+	Claims map[string]interface{}
+}
+
+// Provider is the identity provider; its fields may be changed between requests
+type Provider struct {
+	Issuer       string // base URL, must match OIDC_ISSUER
+	ClientID     string // accepted client_id
+	ClientSecret string // required client secret, empty = public client
+	Auto         bool   // skip the login page and sign in Identity right away
+	Identity     Identity
+	Key          *rsa.PrivateKey
+	Logf         func(format string, args ...interface{}) // optional, e.g. log.Printf
+
+	mu     sync.Mutex
+	grants map[string]grant
+}
+
+// grant is an issued authorization code waiting to be exchanged
+type grant struct {
+	claims      jwt.MapClaims
+	clientID    string
+	redirectURI string
+	challenge   string
+	expires     time.Time
+}
+
+// New returns a provider with a fresh RSA key that signs in a default identity
+func New(issuer, clientID, clientSecret string) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return &Provider{
+		Issuer:       strings.TrimRight(issuer, "/"),
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Identity:     Identity{Subject: "mock-user-1", Email: "admin@example.com", Name: "Mock User"},
+		Key:          key,
+		grants:       map[string]grant{},
+	}, nil
+}
+
+// Handler serves discovery, the login page, the token endpoint and the JWKS
+func (p *Provider) Handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/authorize", p.authorize)
+	mux.HandleFunc("/token", p.token)
+	mux.HandleFunc("/jwks", p.jwks)
+	return mux
+}
+
+// Sign signs claims as an ID token with the provider's key
+func (p *Provider) Sign(claims jwt.MapClaims) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	t.Header["kid"] = KeyID
+	return t.SignedString(p.Key)
+}
+
+func (p *Provider) logf(format string, args ...interface{}) {
+	if p.Logf != nil {
+		p.Logf(format, args...)
+	}
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                p.Issuer,
+		"authorization_endpoint":                p.Issuer + "/authorize",
+		"token_endpoint":                        p.Issuer + "/token",
+		"jwks_uri":                              p.Issuer + "/jwks",
+		"response_types_supported":              []string{"code"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"S256"},
+	})
+}
+
+var loginPage = template.Must(template.New("login").Parse(`<!doctype html>
+<title>Mock identity provider</title>
+<h1>Sign in as</h1>
+<form method="post"> <!-- posts back to this URL, query string included -->
+<p><label>sub <input name="login_sub" value="{{.Subject}}"></label></p>
+<p><label>email <input name="login_email" value="{{.Email}}"></label></p>
+<p><label>name <input name="login_name" value="{{.Name}}"></label></p>
+<p><label>extra claims (JSON) <input name="login_claims" size="60" value="{{.Claims}}"></label></p>
+<button>Sign in</button>
+</form>`))
+
+// authorize shows the login page (GET) and issues a code (POST, or GET with Auto)
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+	if q.Get("client_id") != p.ClientID || q.Get("response_type") != "code" {
+		http.Error(w, "unknown client_id or response_type is not code", http.StatusBadRequest)
+		return
+	}
+	if q.Get("code_challenge") == "" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "PKCE with S256 is required", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	identity := p.Identity
+	if r.Method == http.MethodPost {
+		identity = Identity{Subject: q.Get("login_sub"), Email: q.Get("login_email"), Name: q.Get("login_name")}
+		if err := json.Unmarshal([]byte(q.Get("login_claims")), &identity.Claims); err != nil {
+			http.Error(w, "extra claims must be a JSON object", http.StatusBadRequest)
+			return
+		}
+	} else if !p.Auto {
+		extra, _ := json.Marshal(identity.Claims)
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		_ = loginPage.Execute(w, map[string]string{
+			"Subject": identity.Subject, "Email": identity.Email, "Name": identity.Name, "Claims": string(extra),
+		})
+		return
+	}
+
+	claims := jwt.MapClaims{"email_verified": true}
+	for k, v := range identity.Claims {
+		if v == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = v
+		}
+	}
+	claims["sub"] = identity.Subject
+	claims["email"] = identity.Email
+	claims["name"] = identity.Name
+	if nonce := q.Get("nonce"); nonce != "" {
+		claims["nonce"] = nonce
+	}
+
+	code := randomString()
+	p.mu.Lock()
+	p.grants[code] = grant{
+		claims:      claims,
+		clientID:    q.Get("client_id"),
+		redirectURI: q.Get("redirect_uri"),
+		challenge:   q.Get("code_challenge"),
+		expires:     time.Now().Add(time.Minute),
+	}
+	p.mu.Unlock()
+
+	back := redirectURI.Query()
+	back.Set("code", code)
+	back.Set("state", q.Get("state"))
+	redirectURI.RawQuery = back.Encode()
+	p.logf("signed in %s (%s), redirecting to %s", identity.Email, identity.Subject, redirectURI.Redacted())
+	http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+}
+
+// token exchanges a code for an ID token after checking the client and the PKCE verifier
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost || r.ParseForm() != nil || r.Form.Get("grant_type") != "authorization_code" {
+		tokenError(w, "unsupported_grant_type")
+		return
+	}
+
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		clientID, _ = url.QueryUnescape(clientID)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		clientID = r.Form.Get("client_id")
+	}
+	if clientID != p.ClientID || (p.ClientSecret != "" && subtle.ConstantTimeCompare([]byte(secret), []byte(p.ClientSecret)) != 1) {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	p.mu.Lock()
+	g, ok := p.grants[r.Form.Get("code")]
+	delete(p.grants, r.Form.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	switch {
+	case !ok || time.Now().After(g.expires) || g.clientID != clientID:
+		tokenError(w, "invalid_grant")
+		return
+	case g.redirectURI != r.Form.Get("redirect_uri"):
+		tokenError(w, "invalid_grant")
+		return
+	case base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge:
+		tokenError(w, "invalid_grant") // wrong PKCE verifier
+		return
+	}
+
+	now := time.Now()
+	g.claims["iss"] = p.Issuer
+	g.claims["aud"] = clientID
+	g.claims["iat"] = now.Unix()
+	g.claims["exp"] = now.Add(5 * time.Minute).Unix()
+	signed, err := p.Sign(g.claims)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, map[string]string{"error": "server_error"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     signed,
+	})
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.Key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{"keys": []map[string]string{{
+		"kty": "RSA",
+		"kid": KeyID,
+		"use": "sig",
+		"alg": "RS256",
+		"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+		"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+	}}})
+}
+
+func tokenError(w http.ResponseWriter, code string) {
+	writeJSON(w, http.StatusBadRequest, map[string]string{"error": code})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 24)
+	_, _ = rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
@@ -0,0 +1,144 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"net/http/httptest"
+	"siro-backend/pkg/oidc/oidctest"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestEmailVerified(t *testing.T) {
+	tests := []struct {
+		name         string
+		claim        interface{} // nil = missing
+		trustMissing bool
+		want         bool
+	}{
+		{"true", true, false, true},
+		{"false", false, true, false},
+		{"string true", "true", false, true},
+		{"string false", "False", true, false},
+		{"other string", "yes", false, false},
+		{"number", float64(1), true, false},
+		{"missing", nil, false, false},
+		{"missing trusted", nil, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := Claims{"sub": "1", "email": "budi@example.com"}
+			if tt.claim != nil {
+				c["email_verified"] = tt.claim
+			}
+			if got := c.EmailVerified(tt.trustMissing); got != tt.want {
+				t.Errorf("EmailVerified(%v) = %v, want %v", tt.trustMissing, got, tt.want)
+			}
+		})
+	}
+}
+
+// newTestProvider starts the mock identity provider and returns a client for it
+func newTestProvider(t *testing.T) (*oidctest.Provider, *Provider) {
+	t.Helper()
+	idp, err := oidctest.New("", "siro", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := httptest.NewServer(idp.Handler())
+	t.Cleanup(srv.Close)
+	idp.Issuer = srv.URL
+	return idp, New(Config{Issuer: srv.URL, ClientID: "siro", RedirectURL: "http://app.test/oidc/callback", Scopes: []string{"openid"}})
+}
+
+func TestVerify(t *testing.T) {
+	idp, p := newTestProvider(t)
+	const nonce = "n-0S6_WzA2Mj"
+
+	claims := func(change func(jwt.MapClaims)) jwt.MapClaims {
+		now := time.Now()
+		c := jwt.MapClaims{
+			"iss": idp.Issuer, "aud": "siro", "sub": "user-1", "nonce": nonce, "email": "budi@example.com",
+			"iat": now.Unix(), "exp": now.Add(5 * time.Minute).Unix(),
+		}
+		if change != nil {
+			change(c)
+		}
+		return c
+	}
+	signed := func(change func(jwt.MapClaims)) string {
+		token, err := idp.Sign(claims(change))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicDER, err := x509.MarshalPKIXPublicKey(&idp.Key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKey := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims(nil))
+		token.Header["kid"] = kid
+		s, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+
+	tests := []struct {
+		name  string
+		token string
+		nonce string
+		ok    bool
+	}{
+		{"valid", signed(nil), nonce, true},
+		{"wrong aud", signed(func(c jwt.MapClaims) { c["aud"] = "other-client" }), nonce, false},
+		{"wrong iss", signed(func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }), nonce, false},
+		{"expired", signed(func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }), nonce, false},
+		{"no exp", signed(func(c jwt.MapClaims) { delete(c, "exp") }), nonce, false},
+		{"no sub", signed(func(c jwt.MapClaims) { delete(c, "sub") }), nonce, false},
+		{"nonce mismatch", signed(nil), "another-nonce", false},
+		{"alg none", withKey(jwt.SigningMethodNone, oidctest.KeyID, jwt.UnsafeAllowNoneSignatureType), nonce, false},
+		// HS256 with the public key as secret (algorithm confusion)
+		{"alg HS256", withKey(jwt.SigningMethodHS256, oidctest.KeyID, publicDER), nonce, false},
+		{"unknown kid", withKey(jwt.SigningMethodRS256, "other-key", otherKey), nonce, false},
+		{"known kid, wrong key", withKey(jwt.SigningMethodRS256, oidctest.KeyID, otherKey), nonce, false},
+		{"garbage", "not.a.token", nonce, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, err := p.Verify(context.Background(), tt.token, tt.nonce)
+			if tt.ok {
+				if err != nil {
+					t.Fatalf("Verify: %v", err)
+				}
+				if c.Subject() != "user-1" || c.Email() != "budi@example.com" {
+					t.Errorf("claims = %v", c)
+				}
+				return
+			}
+			if !errors.Is(err, ErrInvalidToken) {
+				t.Errorf("Verify error = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestDiscoveryIssuerMismatch(t *testing.T) {
+	idp, p := newTestProvider(t)
+	idp.Issuer += "/other"
+	if _, err := p.AuthURL(context.Background(), "state", "nonce", "verifier"); !errors.Is(err, ErrProvider) {
+		t.Errorf("AuthURL error = %v, want ErrProvider", err)
+	}
+}
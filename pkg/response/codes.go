@@ -0,0 +1,69 @@
+package response
+
+// Machine-readable error codes returned in error.code
+// Clients should switch on these, never on the human-readable message
+const (
+	// Generic
+	CodeBadRequest       = "BAD_REQUEST"
+	CodeValidationFailed = "VALIDATION_FAILED"
+	CodeInvalidJSON      = "INVALID_JSON"
+	CodeInvalidID        = "INVALID_ID"
+	CodeInvalidCursor    = "INVALID_CURSOR"
+	CodeNotFound         = "NOT_FOUND"
+	CodePermissionDenied = "PERMISSION_DENIED"
+	CodeAdminOnly        = "ADMIN_ONLY"
+	CodeVersionConflict  = "VERSION_CONFLICT"
+	CodeInternal         = "INTERNAL_ERROR"
+
+	// Authentication
+	CodeUnauthorized       = "UNAUTHORIZED"
+	CodeInvalidCredentials = "INVALID_CREDENTIALS"
+	CodeTokenMissing       = "TOKEN_MISSING"
+	CodeTokenInvalid       = "TOKEN_INVALID"
+	CodeTokenExpired       = "TOKEN_EXPIRED"
+	CodeSessionRevoked     = "SESSION_REVOKED"
+	CodeAuthUnavailable    = "AUTH_UNAVAILABLE" // a login backend (e.g. LDAP) could not be reached
+
+	// Passwords and invitations
+	CodePasswordChangeRequired = "PASSWORD_CHANGE_REQUIRED"
+	CodeInvitationInvalid      = "INVITATION_INVALID"
+	CodeInvitationExpired      = "INVITATION_EXPIRED"
+
+	// Single sign-on
+	CodeSSODisabled     = "SSO_DISABLED"      // OIDC is not configured
+	CodeSSOStateInvalid = "SSO_STATE_INVALID" // unknown, used or expired login attempt
+	CodeSSOFailed       = "SSO_FAILED"        // the provider rejected the code or sent an invalid ID token
+	CodeSSONoAccount    = "SSO_NO_ACCOUNT"    // no user is linked to this identity
+
+	// Service accounts and API keys
+	CodeAPIKeyInvalid          = "API_KEY_INVALID"        // unknown, revoked or expired key, or a deactivated service account
+	CodeAPIKeyForbidden        = "API_KEY_FORBIDDEN"      // the key's scopes don't allow this request
+	CodeAPIKeyIPNotAllowed     = "API_KEY_IP_NOT_ALLOWED" // the request comes from outside the key's allowlist
+	CodeServiceAccountNotFound = "SERVICE_ACCOUNT_NOT_FOUND"
+
+	// Users
+	CodeUserNotFound    = "USER_NOT_FOUND"
+	CodeEmailExists     = "EMAIL_EXISTS"
+	CodeUserDeactivated = "USER_DEACTIVATED"
+	CodeUserAnonymized  = "USER_ANONYMIZED"
+	CodeUserNotInvited  = "USER_NOT_INVITED"
+
+	// Work orders
+	CodeWorkOrderNotFound         = "WORKORDER_NOT_FOUND"
+	CodeWorkOrderAlreadyTaken     = "WORKORDER_ALREADY_TAKEN"
+	CodeWorkOrderAlreadyCompleted = "WORKORDER_ALREADY_COMPLETED"
+	CodeWorkOrderNotAssigned      = "WORKORDER_NOT_ASSIGNED"
+	CodeUnitMismatch              = "UNIT_MISMATCH"
+	CodeOwnUnitRequest            = "OWN_UNIT_REQUEST"
+	CodeUnitRequired              = "UNIT_REQUIRED"
+
+	// Units
+	CodeUnitExists = "UNIT_EXISTS"
+
+	// Files
+	CodeFileRequired = "FILE_REQUIRED"
+	CodeFileInvalid  = "FILE_INVALID"
+
+	// Import
+	CodeImportInvalid = "IMPORT_INVALID"
+)
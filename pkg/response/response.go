@@ -6,27 +6,126 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
-// Success sends a successful JSON response
+// Envelope is the single response shape of the /api/v1 routes
+//
+//	{"success": true,  "data": ..., "meta": ...}
+//	{"success": false, "error": {"code": "UNIT_MISMATCH", "message": "...", "details": [...]}}
+type Envelope struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data,omitempty"`
+	Meta    interface{} `json:"meta,omitempty"`
+	Error   *ErrorBody  `json:"error,omitempty"`
+}
+
+// ErrorBody describes what went wrong in a machine-readable way
+type ErrorBody struct {
+	Code    string       `json:"code"`
+	Message string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+}
+
+// FieldError describes one invalid input field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// legacyKey marks requests that came in through the old, unversioned routes
+const legacyKey = "legacyEnvelope"
+
+// Legacy marks every request of a route group as "legacy", so responses keep the
+// old {statusCode, data, error} shape while the frontend migrates to /api/v1
+func Legacy() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set(legacyKey, true)
+		c.Header("Deprecation", "true")
+		c.Header("Link", `</api/v1>; rel="successor-version"`)
+		c.Next()
+	}
+}
+
+// IsLegacy reports whether the request uses the old response shape
+func IsLegacy(c *gin.Context) bool {
+	return c.GetBool(legacyKey)
+}
+
+// Success sends 200 with data
 func Success(c *gin.Context, data interface{}) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    data,
-	})
+	JSON(c, http.StatusOK, data, nil)
 }
 
-// Error sends an error JSON response
-func Error(c *gin.Context, statusCode int, message string) {
-	c.JSON(statusCode, gin.H{
-		"success": false,
-		"error":   message,
-	})
+// Created sends 201 with the created resource
+func Created(c *gin.Context, data interface{}) {
+	JSON(c, http.StatusCreated, data, nil)
 }
 
-// Paginated sends a paginated JSON response
+// Paginated sends 200 with a page of data and its pagination meta
 func Paginated(c *gin.Context, data interface{}, meta interface{}) {
-	c.JSON(http.StatusOK, gin.H{
-		"success": true,
-		"data":    data,
-		"meta":    meta,
-	})
+	JSON(c, http.StatusOK, data, meta)
+}
+
+// JSON sends a successful response in the envelope matching the route version
+func JSON(c *gin.Context, statusCode int, data interface{}, meta interface{}) {
+	c.JSON(statusCode, successBody(c, statusCode, data, meta))
+}
+
+// Flat sends fields that legacy clients expect at the top level (e.g. accessToken on /login)
+// On /api/v1 the same fields are wrapped in "data" like every other response
+func Flat(c *gin.Context, statusCode int, fields gin.H) {
+	if IsLegacy(c) {
+		body := gin.H{"statusCode": statusCode}
+		for k, v := range fields {
+			body[k] = v
+		}
+		c.JSON(statusCode, body)
+		return
+	}
+	c.JSON(statusCode, Envelope{Success: true, Data: fields})
+}
+
+// Error sends an error with a machine-readable code
+func Error(c *gin.Context, statusCode int, code, message string) {
+	c.JSON(statusCode, errorBody(c, statusCode, ErrorBody{Code: code, Message: message}, nil))
+}
+
+// ErrorWithData sends an error together with a resource, e.g. the current version after a conflict
+func ErrorWithData(c *gin.Context, statusCode int, code, message string, data interface{}) {
+	c.JSON(statusCode, errorBody(c, statusCode, ErrorBody{Code: code, Message: message}, data))
+}
+
+// ValidationError sends 400 with one entry per invalid field
+func ValidationError(c *gin.Context, message string, details []FieldError) {
+	c.JSON(http.StatusBadRequest, errorBody(c, http.StatusBadRequest, ErrorBody{
+		Code:    CodeValidationFailed,
+		Message: message,
+		Details: details,
+	}, nil))
+}
+
+// Abort sends an error and stops the middleware chain (for use in middlewares)
+func Abort(c *gin.Context, statusCode int, code, message string) {
+	c.AbortWithStatusJSON(statusCode, errorBody(c, statusCode, ErrorBody{Code: code, Message: message}, nil))
+}
+
+func successBody(c *gin.Context, statusCode int, data interface{}, meta interface{}) interface{} {
+	if IsLegacy(c) {
+		body := gin.H{"statusCode": statusCode, "data": data}
+		if meta != nil {
+			body["meta"] = meta
+		}
+		return body
+	}
+	return Envelope{Success: true, Data: data, Meta: meta}
+}
+
+func errorBody(c *gin.Context, statusCode int, e ErrorBody, data interface{}) interface{} {
+	if IsLegacy(c) {
+		body := gin.H{"statusCode": statusCode, "error": e.Message}
+		if data != nil {
+			body["data"] = data
+		}
+		return body
+	}
+	return Envelope{Success: false, Data: data, Error: &e}
 }
@@ -0,0 +1,169 @@
+package response
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"siro-backend/pkg/validation"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var setupOnce sync.Once
+
+func setup(t *testing.T) {
+	t.Helper()
+	var err error
+	setupOnce.Do(func() {
+		gin.SetMode(gin.TestMode)
+		err = validation.Init(func(unit string) bool { return unit == "IT" })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// send runs handler on a fresh context, through Legacy first when legacy is set
+func send(legacy bool, req *http.Request, handler gin.HandlerFunc) *httptest.ResponseRecorder {
+	r := gin.New()
+	var chain []gin.HandlerFunc
+	if legacy {
+		chain = append(chain, Legacy())
+	}
+	r.Handle(req.Method, "/x", append(chain, handler)...)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestShapes(t *testing.T) {
+	setup(t)
+	type item struct {
+		ID int `json:"id"`
+	}
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		status  int
+		v1      string
+		legacy  string
+	}{
+		{"success", func(c *gin.Context) { Success(c, item{1}) }, http.StatusOK,
+			`{"success":true,"data":{"id":1}}`, `{"data":{"id":1},"statusCode":200}`},
+		{"created", func(c *gin.Context) { Created(c, item{2}) }, http.StatusCreated,
+			`{"success":true,"data":{"id":2}}`, `{"data":{"id":2},"statusCode":201}`},
+		{"paginated", func(c *gin.Context) { Paginated(c, []item{{1}}, gin.H{"total": 1}) }, http.StatusOK,
+			`{"success":true,"data":[{"id":1}],"meta":{"total":1}}`, `{"data":[{"id":1}],"meta":{"total":1},"statusCode":200}`},
+		{"flat", func(c *gin.Context) { Flat(c, http.StatusOK, gin.H{"accessToken": "t"}) }, http.StatusOK,
+			`{"success":true,"data":{"accessToken":"t"}}`, `{"accessToken":"t","statusCode":200}`},
+		{"error", func(c *gin.Context) { Error(c, http.StatusNotFound, CodeNotFound, "Not found") }, http.StatusNotFound,
+			`{"success":false,"error":{"code":"NOT_FOUND","message":"Not found"}}`, `{"error":"Not found","statusCode":404}`},
+		{"error with data", func(c *gin.Context) {
+			ErrorWithData(c, http.StatusConflict, CodeVersionConflict, "Changed", item{3})
+		}, http.StatusConflict,
+			`{"success":false,"data":{"id":3},"error":{"code":"VERSION_CONFLICT","message":"Changed"}}`,
+			`{"data":{"id":3},"error":"Changed","statusCode":409}`},
+		{"validation", func(c *gin.Context) {
+			ValidationError(c, "Invalid input", []FieldError{{Field: "title", Rule: "required", Message: "title is a required field"}})
+		}, http.StatusBadRequest,
+			`{"success":false,"error":{"code":"VALIDATION_FAILED","message":"Invalid input","details":[{"field":"title","rule":"required","message":"title is a required field"}]}}`,
+			`{"error":"Invalid input","statusCode":400}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, legacy := range []bool{false, true} {
+				w := send(legacy, httptest.NewRequest(http.MethodGet, "/x", nil), tt.handler)
+				want := tt.v1
+				if legacy {
+					want = tt.legacy
+				}
+				if w.Code != tt.status || w.Body.String() != want {
+					t.Errorf("legacy=%v: got %d %s, want %d %s", legacy, w.Code, w.Body.String(), tt.status, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLegacyHeaders(t *testing.T) {
+	setup(t)
+	w := send(true, httptest.NewRequest(http.MethodGet, "/x", nil), func(c *gin.Context) { Success(c, nil) })
+	if w.Header().Get("Deprecation") != "true" || w.Header().Get("Link") != `</api/v1>; rel="successor-version"` {
+		t.Errorf("headers %v", w.Header())
+	}
+	w = send(false, httptest.NewRequest(http.MethodGet, "/x", nil), func(c *gin.Context) { Success(c, nil) })
+	if w.Header().Get("Deprecation") != "" {
+		t.Errorf("v1 response marked deprecated")
+	}
+}
+
+func TestAbort(t *testing.T) {
+	setup(t)
+	r := gin.New()
+	r.GET("/x", func(c *gin.Context) { Abort(c, http.StatusForbidden, CodeAdminOnly, "Admins only") },
+		func(c *gin.Context) { t.Error("chain not stopped") })
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/x", nil))
+	want := `{"success":false,"error":{"code":"ADMIN_ONLY","message":"Admins only"}}`
+	if w.Code != http.StatusForbidden || w.Body.String() != want {
+		t.Errorf("got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestBindError(t *testing.T) {
+	setup(t)
+	type request struct {
+		Title    string `json:"title" binding:"required"`
+		Priority string `json:"priority" binding:"omitempty,priority"`
+		Count    int    `json:"count"`
+	}
+	tests := []struct {
+		name string
+		body string
+		lang string
+		want string
+	}{
+		{"validation", `{"priority":"Urgent"}`, "",
+			`{"success":false,"error":{"code":"VALIDATION_FAILED","message":"Invalid input","details":[` +
+				`{"field":"title","rule":"required","message":"title is a required field"},` +
+				`{"field":"priority","rule":"priority","message":"priority must be one of: High, Medium, Low"}]}}`},
+		{"validation in Indonesian", `{}`, "id-ID",
+			`{"success":false,"error":{"code":"VALIDATION_FAILED","message":"Invalid input","details":[` +
+				`{"field":"title","rule":"required","message":"title wajib diisi"}]}}`},
+		{"wrong type", `{"title":"x","count":"many"}`, "",
+			`{"success":false,"error":{"code":"VALIDATION_FAILED","message":"Invalid input","details":[` +
+				`{"field":"count","rule":"type","message":"count must be a int"}]}}`},
+		{"malformed", `{"title":`, "",
+			`{"success":false,"error":{"code":"BAD_REQUEST","message":"Invalid input: unexpected EOF"}}`},
+		{"syntax", `{"title" "x"}`, "",
+			`{"success":false,"error":{"code":"INVALID_JSON","message":"Request body is not valid JSON"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/x", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", "application/json")
+			req.Header.Set("Accept-Language", tt.lang)
+			w := send(false, req, func(c *gin.Context) {
+				var r request
+				if err := c.ShouldBindJSON(&r); err != nil {
+					BindError(c, err)
+					return
+				}
+				t.Error("bound without error")
+			})
+			if w.Code != http.StatusBadRequest || w.Body.String() != tt.want {
+				t.Errorf("got %d %s\nwant %s", w.Code, w.Body.String(), tt.want)
+			}
+		})
+	}
+
+	t.Run("other errors", func(t *testing.T) {
+		w := send(false, httptest.NewRequest(http.MethodGet, "/x", nil), func(c *gin.Context) { BindError(c, errors.New("boom")) })
+		if want := `{"success":false,"error":{"code":"BAD_REQUEST","message":"Invalid input: boom"}}`; w.Body.String() != want {
+			t.Errorf("got %s", w.Body.String())
+		}
+	})
+}
@@ -0,0 +1,47 @@
+package response
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"siro-backend/pkg/validation"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+)
+
+// BindError sends the right error for a failed ShouldBindJSON / ShouldBindQuery:
+// field details for validation errors, INVALID_JSON for malformed bodies
+// Messages follow the Accept-Language header (English or Indonesian)
+func BindError(c *gin.Context, err error) {
+	var verrs validator.ValidationErrors
+	if errors.As(err, &verrs) {
+		lang := c.GetHeader("Accept-Language")
+		details := make([]FieldError, 0, len(verrs))
+		for _, fe := range verrs {
+			details = append(details, FieldError{
+				Field:   fe.Field(),
+				Rule:    fe.Tag(),
+				Message: validation.Message(fe, lang),
+			})
+		}
+		ValidationError(c, "Invalid input", details)
+		return
+	}
+
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr):
+		ValidationError(c, "Invalid input", []FieldError{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s must be a %s", typeErr.Field, typeErr.Type.String()),
+		}})
+	case errors.As(err, &syntaxErr):
+		Error(c, http.StatusBadRequest, CodeInvalidJSON, "Request body is not valid JSON")
+	default:
+		Error(c, http.StatusBadRequest, CodeBadRequest, "Invalid input: "+err.Error())
+	}
+}
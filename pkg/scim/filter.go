@@ -0,0 +1,442 @@
+package scim
+
+import (
+	"encoding/json"
+	"strings"
+)
+
+// Filter is a parsed filter expression (RFC 7644 section 3.4.2.2)
+// Resources are matched as JSON objects (see ToMap); attribute names are case-insensitive
+type Filter interface {
+	Match(resource map[string]interface{}) bool
+}
+
+// ParseFilter parses expressions like
+//
+//	userName eq "bjensen" and (emails co "@example.com" or not (active eq false))
+//	emails[type eq "work" and value sw "j"]
+//
+// Supported operators: eq ne co sw ew gt ge lt le pr, and / or / not and grouping
+// Returns an invalidFilter error for anything else
+func ParseFilter(s string) (Filter, error) {
+	tokens, err := tokenize(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, BadRequest(ErrInvalidFilter, "unexpected %q in filter", p.peek().text)
+	}
+	return f, nil
+}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokString
+	tokOpen
+	tokClose
+	tokOpenBracket
+	tokCloseBracket
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch ch := s[i]; {
+		case ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r':
+			i++
+		case ch == '(':
+			tokens = append(tokens, token{tokOpen, "("})
+			i++
+		case ch == ')':
+			tokens = append(tokens, token{tokClose, ")"})
+			i++
+		case ch == '[':
+			tokens = append(tokens, token{tokOpenBracket, "["})
+			i++
+		case ch == ']':
+			tokens = append(tokens, token{tokCloseBracket, "]"})
+			i++
+		case ch == '"':
+			// JSON string, so escapes like \" work
+			j := i + 1
+			for j < len(s) && s[j] != '"' {
+				if s[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			if j >= len(s) {
+				return nil, BadRequest(ErrInvalidFilter, "unterminated string in filter")
+			}
+			var str string
+			if err := json.Unmarshal([]byte(s[i:j+1]), &str); err != nil {
+				return nil, BadRequest(ErrInvalidFilter, "invalid string %s in filter", s[i:j+1])
+			}
+			tokens = append(tokens, token{tokString, str})
+			i = j + 1
+		default:
+			j := i
+			for j < len(s) && !strings.ContainsRune(" \t\n\r()[]\"", rune(s[j])) {
+				j++
+			}
+			tokens = append(tokens, token{tokWord, s[i:j]})
+			i = j
+		}
+	}
+	return tokens, nil
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+func (p *parser) done() bool { return p.pos >= len(p.tokens) }
+
+func (p *parser) peek() token {
+	if p.done() {
+		return token{kind: -1}
+	}
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.peek()
+	p.pos++
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	t := p.peek()
+	if t.kind == tokWord && strings.EqualFold(t.text, word) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) or() (Filter, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Filter, error) {
+	left, err := p.factor()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.factor()
+		if err != nil {
+			return nil, err
+		}
+		left = andFilter{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) factor() (Filter, error) {
+	if p.keyword("not") {
+		if p.next().kind != tokOpen {
+			return nil, BadRequest(ErrInvalidFilter, "not must be followed by (")
+		}
+		f, err := p.group()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+	}
+	if p.peek().kind == tokOpen {
+		p.next()
+		return p.group()
+	}
+
+	attr := p.next()
+	if attr.kind != tokWord {
+		return nil, BadRequest(ErrInvalidFilter, "expected an attribute name in filter")
+	}
+	path := splitAttrPath(attr.text)
+
+	// emails[type eq "work"] matches resources with at least one matching email
+	if p.peek().kind == tokOpenBracket {
+		p.next()
+		inner, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.next().kind != tokCloseBracket {
+			return nil, BadRequest(ErrInvalidFilter, "missing ] in filter")
+		}
+		return valuePathFilter{path: path, filter: inner}, nil
+	}
+
+	op := p.next()
+	if op.kind != tokWord {
+		return nil, BadRequest(ErrInvalidFilter, "expected an operator after %s", attr.text)
+	}
+	opName := strings.ToLower(op.text)
+	if opName == "pr" {
+		return presentFilter{path}, nil
+	}
+	switch opName {
+	case "eq", "ne", "co", "sw", "ew", "gt", "ge", "lt", "le":
+	default:
+		return nil, BadRequest(ErrInvalidFilter, "unsupported operator %q", op.text)
+	}
+
+	v := p.next()
+	var value interface{}
+	switch {
+	case v.kind == tokString:
+		value = v.text
+	case v.kind == tokWord && strings.EqualFold(v.text, "true"):
+		value = true
+	case v.kind == tokWord && strings.EqualFold(v.text, "false"):
+		value = false
+	case v.kind == tokWord && strings.EqualFold(v.text, "null"):
+		value = nil
+	case v.kind == tokWord:
+		var n float64
+		if err := json.Unmarshal([]byte(v.text), &n); err != nil {
+			return nil, BadRequest(ErrInvalidFilter, "invalid value %q in filter", v.text)
+		}
+		value = n
+	default:
+		return nil, BadRequest(ErrInvalidFilter, "expected a value after %s %s", attr.text, op.text)
+	}
+	return compareFilter{path: path, op: opName, value: value}, nil
+}
+
+// group parses the rest of "( expr )" after the opening parenthesis
+func (p *parser) group() (Filter, error) {
+	f, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.next().kind != tokClose {
+		return nil, BadRequest(ErrInvalidFilter, "missing ) in filter")
+	}
+	return f, nil
+}
+
+// splitAttrPath turns "name.givenName" into ["name", "givenName"] and
+// "urn:...:enterprise:2.0:User:department" into ["urn:...:enterprise:2.0:User", "department"]
+// A core schema prefix (urn:...:core:2.0:User:userName) is dropped
+func splitAttrPath(s string) []string {
+	if strings.HasPrefix(strings.ToLower(s), "urn:") {
+		i := strings.LastIndex(s, ":")
+		urn, rest := s[:i], s[i+1:]
+		parts := strings.Split(rest, ".")
+		if strings.EqualFold(urn, SchemaUser) || strings.EqualFold(urn, SchemaGroup) {
+			return parts
+		}
+		return append([]string{urn}, parts...)
+	}
+	return strings.Split(s, ".")
+}
+
+type andFilter struct{ left, right Filter }
+type orFilter struct{ left, right Filter }
+type notFilter struct{ inner Filter }
+
+func (f andFilter) Match(r map[string]interface{}) bool { return f.left.Match(r) && f.right.Match(r) }
+func (f orFilter) Match(r map[string]interface{}) bool  { return f.left.Match(r) || f.right.Match(r) }
+func (f notFilter) Match(r map[string]interface{}) bool { return !f.inner.Match(r) }
+
+type presentFilter struct{ path []string }
+
+func (f presentFilter) Match(r map[string]interface{}) bool {
+	for _, v := range lookupRaw(r, f.path) {
+		switch v := v.(type) {
+		case nil:
+		case string:
+			if v != "" {
+				return true
+			}
+		case map[string]interface{}:
+			if len(v) > 0 {
+				return true
+			}
+		default:
+			return true
+		}
+	}
+	return false
+}
+
+type valuePathFilter struct {
+	path   []string
+	filter Filter
+}
+
+func (f valuePathFilter) Match(r map[string]interface{}) bool {
+	for _, v := range lookupRaw(r, f.path) {
+		if m, ok := v.(map[string]interface{}); ok && f.filter.Match(m) {
+			return true
+		}
+	}
+	return false
+}
+
+type compareFilter struct {
+	path  []string
+	op    string
+	value interface{}
+}
+
+func (f compareFilter) Match(r map[string]interface{}) bool {
+	values := lookup(r, f.path)
+	if f.op == "ne" {
+		for _, v := range values {
+			if compare(v, "eq", f.value) {
+				return false
+			}
+		}
+		return true
+	}
+	for _, v := range values {
+		if compare(v, f.op, f.value) {
+			return true
+		}
+	}
+	return false
+}
+
+// compare applies one operator; strings are compared case-insensitively
+func compare(actual interface{}, op string, expected interface{}) bool {
+	switch e := expected.(type) {
+	case nil:
+		return op == "eq" && actual == nil
+	case bool:
+		a, ok := actual.(bool)
+		return ok && op == "eq" && a == e
+	case float64:
+		a, ok := actual.(float64)
+		if !ok {
+			return false
+		}
+		switch op {
+		case "eq":
+			return a == e
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+		return false
+	case string:
+		a, ok := actual.(string)
+		if !ok {
+			return false
+		}
+		a, e = strings.ToLower(a), strings.ToLower(e)
+		switch op {
+		case "eq":
+			return a == e
+		case "co":
+			return strings.Contains(a, e)
+		case "sw":
+			return strings.HasPrefix(a, e)
+		case "ew":
+			return strings.HasSuffix(a, e)
+		case "gt":
+			return a > e
+		case "ge":
+			return a >= e
+		case "lt":
+			return a < e
+		case "le":
+			return a <= e
+		}
+	}
+	return false
+}
+
+// lookup returns the values at path; multi-valued attributes fan out, and for
+// complex values without a sub-attribute their "value" is used (emails eq "x")
+func lookup(r map[string]interface{}, path []string) []interface{} {
+	var out []interface{}
+	for _, v := range lookupRaw(r, path) {
+		if m, ok := v.(map[string]interface{}); ok {
+			if val, ok := getFold(m, "value"); ok {
+				out = append(out, val)
+			}
+			continue
+		}
+		out = append(out, v)
+	}
+	return out
+}
+
+// lookupRaw returns the values at path without unwrapping complex values
+func lookupRaw(r map[string]interface{}, path []string) []interface{} {
+	current := []interface{}{r}
+	for _, name := range path {
+		var next []interface{}
+		for _, c := range current {
+			m, ok := c.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			v, ok := getFold(m, name)
+			if !ok {
+				continue
+			}
+			if list, ok := v.([]interface{}); ok {
+				next = append(next, list...)
+			} else {
+				next = append(next, v)
+			}
+		}
+		current = next
+	}
+	return current
+}
+
+// getFold returns m[key] with a case-insensitive key
+func getFold(m map[string]interface{}, key string) (interface{}, bool) {
+	if v, ok := m[key]; ok {
+		return v, true
+	}
+	k, ok := keyFold(m, key)
+	if !ok {
+		return nil, false
+	}
+	return m[k], true
+}
+
+// keyFold returns the key of m that equals key ignoring case
+func keyFold(m map[string]interface{}, key string) (string, bool) {
+	for k := range m {
+		if strings.EqualFold(k, key) {
+			return k, true
+		}
+	}
+	return "", false
+}
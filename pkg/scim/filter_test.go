@@ -0,0 +1,208 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// testUser is a resource as ToMap returns it, decoded from JSON like a request body
+func testUser(t *testing.T) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	err := json.Unmarshal([]byte(`{
+		"userName": "bjensen@example.com",
+		"displayName": "Barbara \"Babs\" Jensen",
+		"title": "",
+		"active": true,
+		"name": {"givenName": "Barbara", "familyName": "Jensen"},
+		"emails": [
+			{"value": "bjensen@example.com", "type": "work", "primary": true},
+			{"value": "babs@home.example", "type": "home"}
+		],
+		"meta": {"version": 3},
+		"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "IT"}
+	}`), &m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestFilterMatch(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		// operators
+		{`userName eq "bjensen@example.com"`, true},
+		{`userName eq "BJENSEN@EXAMPLE.COM"`, true},
+		{`USERNAME eq "bjensen@example.com"`, true},
+		{`userName EQ "bjensen@example.com"`, true},
+		{`userName eq "bjensen"`, false},
+		{`userName ne "bjensen"`, true},
+		{`userName ne "bjensen@example.com"`, false},
+		{`userName co "jensen@"`, true},
+		{`userName sw "bjen"`, true},
+		{`userName sw "jen"`, false},
+		{`userName ew ".com"`, true},
+		{`userName gt "a"`, true},
+		{`userName lt "a"`, false},
+		{`userName ge "bjensen@example.com"`, true},
+		{`userName le "bjensen@example.com"`, true},
+		{`active eq true`, true},
+		{`active eq false`, false},
+		{`active eq "true"`, false},
+		{`meta.version eq 3`, true},
+		{`meta.version gt 2`, true},
+		{`meta.version ge 3.5`, false},
+		{`meta.version lt 4`, true},
+		{`meta.version le 2`, false},
+		{`meta.version eq "3"`, false},
+		{`nickName eq null`, false},
+		{`nickName ne "x"`, true},
+
+		// pr: missing, empty strings and empty objects are not present
+		{`userName pr`, true},
+		{`name pr`, true},
+		{`emails pr`, true},
+		{`nickName pr`, false},
+		{`title pr`, false},
+		{`not (nickName pr)`, true},
+
+		// sub-attributes and multi-valued attributes
+		{`name.givenName eq "barbara"`, true},
+		{`name.middleName pr`, false},
+		{`emails eq "babs@home.example"`, true},
+		{`emails.type eq "home"`, true},
+		{`emails.type eq "other"`, false},
+		{`emails.value ew "@home.example"`, true},
+		{`emails ne "babs@home.example"`, false},
+
+		// value paths match when one element matches the whole inner filter
+		{`emails[type eq "work"]`, true},
+		{`emails[type eq "work" and value co "home"]`, false},
+		{`emails[type eq "home" and value co "home"]`, true},
+		{`emails[type eq "work" or type eq "other"]`, true},
+		{`emails[primary eq true] and userName sw "b"`, true},
+		{`emails[type eq "other"]`, false},
+		{`name[givenName eq "Barbara"]`, true},
+
+		// schema URNs: the core prefix is dropped, extensions are an object
+		{`urn:ietf:params:scim:schemas:core:2.0:User:userName sw "bjensen"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "it"`, true},
+		{`urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department eq "HR"`, false},
+
+		// and, or, not and grouping
+		{`userName sw "b" and active eq true`, true},
+		{`userName sw "b" and active eq false`, false},
+		{`userName sw "x" or active eq true`, true},
+		{`userName sw "x" or active eq false`, false},
+		{`not (active eq false)`, true},
+		{`not (active eq true)`, false},
+		{`NOT (active eq true) OR userName pr`, true},
+		{`not (userName sw "b" and active eq true)`, false},
+		{`not (not (active eq true))`, true},
+
+		// and binds tighter than or: a or b and c is a or (b and c)
+		{`userName sw "b" or active eq false and nickName pr`, true},
+		{`(userName sw "b" or active eq false) and nickName pr`, false},
+		{`active eq false and nickName pr or userName sw "b"`, true},
+		{`active eq false and (nickName pr or userName sw "b")`, false},
+		{`userName sw "x" or userName sw "y" or name.familyName eq "jensen"`, true},
+		{`((userName pr))`, true},
+
+		// quoting: JSON strings with escapes, operators and brackets inside strings are plain text
+		{`displayName eq "Barbara \"Babs\" Jensen"`, true},
+		{`displayName co "\"babs\""`, true},
+		{`userName eq "a or b"`, false},
+		{`userName ne "x) or (userName pr"`, true},
+		{`displayName co "]["`, false},
+		{"userName\teq\n\"bjensen@example.com\"", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filter, func(t *testing.T) {
+			f, err := ParseFilter(tt.filter)
+			if err != nil {
+				t.Fatalf("ParseFilter: %v", err)
+			}
+			if got := f.Match(testUser(t)); got != tt.want {
+				t.Errorf("Match = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFilterInvalid(t *testing.T) {
+	tests := []string{
+		``,
+		`   `,
+		`userName`,
+		`userName eq`,
+		`userName eq "bjensen`,
+		`userName eq "ends with escape\"`,
+		`userName eq "bad \x escape"`,
+		`userName like "b"`,
+		`userName eq bjensen`,
+		`meta.version eq 1e`,
+		`userName eq "a" and`,
+		`userName eq "a" or or userName pr`,
+		`userName eq "a" xor userName pr`,
+		`userName eq "a" userName pr`,
+		`(userName pr`,
+		`userName pr)`,
+		`()`,
+		`not userName pr`,
+		`not`,
+		`emails[type eq "work"`,
+		`emails[]`,
+		`emails type eq "work"]`,
+		`"userName" eq "a"`,
+		`userName eq (`,
+		`userName pr pr`,
+	}
+	for _, filter := range tests {
+		t.Run(filter, func(t *testing.T) {
+			f, err := ParseFilter(filter)
+			if err == nil {
+				t.Fatalf("ParseFilter = %#v, want an error", f)
+			}
+			var scimErr *Error
+			if !errors.As(err, &scimErr) {
+				t.Fatalf("error %v is a %T, want *Error", err, err)
+			}
+			if scimErr.ScimType != ErrInvalidFilter || scimErr.StatusCode() != 400 {
+				t.Errorf("error = %d %s, want 400 %s", scimErr.StatusCode(), scimErr.ScimType, ErrInvalidFilter)
+			}
+		})
+	}
+}
+
+func TestSplitAttrPath(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"userName", []string{"userName"}},
+		{"name.givenName", []string{"name", "givenName"}},
+		{SchemaUser + ":userName", []string{"userName"}},
+		{SchemaUser + ":name.givenName", []string{"name", "givenName"}},
+		{SchemaGroup + ":displayName", []string{"displayName"}},
+		{SchemaEnterpriseUser + ":department", []string{SchemaEnterpriseUser, "department"}},
+		{SchemaEnterpriseUser + ":manager.value", []string{SchemaEnterpriseUser, "manager", "value"}},
+		{"URN:IETF:PARAMS:SCIM:SCHEMAS:CORE:2.0:USER:userName", []string{"userName"}},
+	}
+	for _, tt := range tests {
+		got := splitAttrPath(tt.path)
+		if len(got) != len(tt.want) {
+			t.Errorf("splitAttrPath(%q) = %q, want %q", tt.path, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("splitAttrPath(%q) = %q, want %q", tt.path, got, tt.want)
+				break
+			}
+		}
+	}
+}
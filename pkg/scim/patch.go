@@ -0,0 +1,279 @@
+package scim
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// ApplyPatch applies PATCH operations (RFC 7644 section 3.5.2) to a resource given as its JSON object
+// Supported paths: attr, attr.sub, urn:...:attr, attr[filter] and attr[filter].sub;
+// without a path the value is an object of attributes (or paths) to add or replace
+func ApplyPatch(resource map[string]interface{}, ops []PatchOp) error {
+	if len(ops) == 0 {
+		return BadRequest(ErrInvalidSyntax, "no Operations in PATCH request")
+	}
+	for _, op := range ops {
+		if err := applyOp(resource, op); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// patchPath is a parsed PATCH path
+type patchPath struct {
+	attr   []string // containers and the attribute, e.g. ["name", "givenName"]
+	filter Filter   // set for attr[filter]
+	sub    string   // sub-attribute after a filter, e.g. "value" in emails[type eq "work"].value
+}
+
+func parsePath(s string) (patchPath, error) {
+	var p patchPath
+	s = strings.TrimSpace(s)
+	if i := strings.Index(s, "["); i >= 0 {
+		j := strings.LastIndex(s, "]")
+		if j < i {
+			return p, BadRequest(ErrInvalidPath, "missing ] in path %q", s)
+		}
+		f, err := ParseFilter(s[i+1 : j])
+		if err != nil {
+			return p, BadRequest(ErrInvalidPath, "invalid filter in path %q: %v", s, err)
+		}
+		p.filter = f
+		if rest := s[j+1:]; rest != "" {
+			if !strings.HasPrefix(rest, ".") || len(rest) == 1 {
+				return p, BadRequest(ErrInvalidPath, "invalid path %q", s)
+			}
+			p.sub = rest[1:]
+		}
+		s = s[:i]
+	}
+	p.attr = splitAttrPath(s)
+	for _, a := range p.attr {
+		if a == "" {
+			return p, BadRequest(ErrInvalidPath, "invalid path %q", s)
+		}
+	}
+	return p, nil
+}
+
+func applyOp(resource map[string]interface{}, op PatchOp) error {
+	opName := strings.ToLower(op.Op)
+	switch opName {
+	case "add", "replace", "remove":
+	default:
+		return BadRequest(ErrInvalidSyntax, "unknown PATCH op %q", op.Op)
+	}
+
+	var value interface{}
+	if len(op.Value) > 0 {
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return BadRequest(ErrInvalidSyntax, "invalid value: %v", err)
+		}
+	}
+
+	if op.Path == "" {
+		if opName == "remove" {
+			return BadRequest(ErrNoTarget, "remove needs a path")
+		}
+		obj, ok := value.(map[string]interface{})
+		if !ok {
+			return BadRequest(ErrInvalidSyntax, "without a path the value must be an object")
+		}
+		for k, v := range obj {
+			// {"urn:...:enterprise:2.0:User": {"department": "IT"}} sets each attribute of the extension
+			if ext, ok := v.(map[string]interface{}); ok && strings.HasPrefix(strings.ToLower(k), "urn:") {
+				for sub, sv := range ext {
+					if err := applyValue(resource, opName, k+":"+sub, sv); err != nil {
+						return err
+					}
+				}
+				continue
+			}
+			if err := applyValue(resource, opName, k, v); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return applyValue(resource, opName, op.Path, value)
+}
+
+func applyValue(resource map[string]interface{}, op, path string, value interface{}) error {
+	p, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+
+	// Walk to the object that holds the attribute, creating it when adding
+	container := resource
+	for _, name := range p.attr[:len(p.attr)-1] {
+		key := foldKey(container, name)
+		next, ok := container[key].(map[string]interface{})
+		if !ok {
+			if op == "remove" {
+				return nil
+			}
+			next = map[string]interface{}{}
+			container[key] = next
+		}
+		container = next
+	}
+	key := foldKey(container, p.attr[len(p.attr)-1])
+
+	if p.filter == nil {
+		switch op {
+		case "remove":
+			list, isList := container[key].([]interface{})
+			removeList, hasValues := value.([]interface{})
+			if isList && hasValues {
+				// {"op": "remove", "path": "members", "value": [{"value": "12"}]}
+				container[key] = without(list, removeList)
+				return nil
+			}
+			delete(container, key)
+		case "replace":
+			if old, ok := container[key].(map[string]interface{}); ok {
+				if v, ok := value.(map[string]interface{}); ok {
+					merge(old, v)
+					return nil
+				}
+			}
+			container[key] = value
+		case "add":
+			switch old := container[key].(type) {
+			case []interface{}:
+				if add, ok := value.([]interface{}); ok {
+					container[key] = appendUnique(old, add...)
+				} else {
+					container[key] = appendUnique(old, value)
+				}
+			case map[string]interface{}:
+				if v, ok := value.(map[string]interface{}); ok {
+					merge(old, v)
+				} else {
+					container[key] = value
+				}
+			default:
+				container[key] = value
+			}
+		}
+		return nil
+	}
+
+	// attr[filter] and attr[filter].sub
+	list, _ := container[key].([]interface{})
+	matched := false
+	kept := make([]interface{}, 0, len(list))
+	for _, el := range list {
+		m, ok := el.(map[string]interface{})
+		if !ok || !p.filter.Match(m) {
+			kept = append(kept, el)
+			continue
+		}
+		matched = true
+		if op == "remove" {
+			if p.sub != "" {
+				delete(m, foldKey(m, p.sub))
+				kept = append(kept, m)
+			}
+			continue
+		}
+		setElement(m, p.sub, value)
+		kept = append(kept, m)
+	}
+
+	if !matched {
+		if op == "remove" {
+			return nil
+		}
+		// emails[type eq "work"].value on a user without a work email adds one
+		el, ok := seedElement(p.filter)
+		if !ok {
+			return BadRequest(ErrNoTarget, "no value matches %q", path)
+		}
+		setElement(el, p.sub, value)
+		kept = append(kept, el)
+	}
+	container[key] = kept
+	return nil
+}
+
+// setElement sets a sub-attribute of a multi-valued element, or merges an object into it
+func setElement(el map[string]interface{}, sub string, value interface{}) {
+	if sub != "" {
+		el[foldKey(el, sub)] = value
+		return
+	}
+	if v, ok := value.(map[string]interface{}); ok {
+		merge(el, v)
+	}
+}
+
+// seedElement returns a new element matching a simple filter such as type eq "work"
+func seedElement(f Filter) (map[string]interface{}, bool) {
+	c, ok := f.(compareFilter)
+	if !ok || c.op != "eq" || len(c.path) != 1 {
+		return nil, false
+	}
+	return map[string]interface{}{c.path[0]: c.value}, true
+}
+
+// foldKey returns the existing key of m that equals name ignoring case, or name itself
+func foldKey(m map[string]interface{}, name string) string {
+	if k, ok := keyFold(m, name); ok {
+		return k
+	}
+	return name
+}
+
+// merge copies the attributes of src into dst (case-insensitive keys)
+func merge(dst, src map[string]interface{}) {
+	for k, v := range src {
+		dst[foldKey(dst, k)] = v
+	}
+}
+
+// appendUnique appends the values that aren't in the list yet (complex values compare by "value")
+func appendUnique(list []interface{}, values ...interface{}) []interface{} {
+	for _, v := range values {
+		if indexOf(list, v) < 0 {
+			list = append(list, v)
+		}
+	}
+	return list
+}
+
+// without returns the list minus the given values (complex values compare by "value")
+func without(list, remove []interface{}) []interface{} {
+	kept := make([]interface{}, 0, len(list))
+	for _, el := range list {
+		if indexOf(remove, el) < 0 {
+			kept = append(kept, el)
+		}
+	}
+	return kept
+}
+
+func indexOf(list []interface{}, v interface{}) int {
+	for i, el := range list {
+		if sameValue(el, v) {
+			return i
+		}
+	}
+	return -1
+}
+
+func sameValue(a, b interface{}) bool {
+	am, aok := a.(map[string]interface{})
+	bm, bok := b.(map[string]interface{})
+	if aok && bok {
+		av, aHas := getFold(am, "value")
+		bv, bHas := getFold(bm, "value")
+		if aHas && bHas {
+			return reflect.DeepEqual(av, bv)
+		}
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,233 @@
+package scim
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// patchUser is the resource the PATCH tests start from
+const patchUser = `{
+	"userName": "bjensen@example.com",
+	"active": true,
+	"name": {"givenName": "Barbara", "familyName": "Jensen"},
+	"emails": [
+		{"value": "bjensen@example.com", "type": "work", "primary": true},
+		{"value": "babs@home.example", "type": "home"}
+	]
+}`
+
+func decodeObject(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("%s: %v", s, err)
+	}
+	return m
+}
+
+func TestApplyPatch(t *testing.T) {
+	tests := []struct {
+		name string
+		ops  string // the Operations array
+		want string // the resource afterwards
+	}{
+		{
+			name: "replace a simple attribute",
+			ops:  `[{"op": "replace", "path": "active", "value": false}]`,
+			want: `{"userName": "bjensen@example.com", "active": false,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "op and path are case-insensitive",
+			ops:  `[{"op": "Replace", "path": "ACTIVE", "value": false}]`,
+			want: `{"userName": "bjensen@example.com", "active": false,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "replace a sub-attribute",
+			ops:  `[{"op": "replace", "path": "name.familyName", "value": "Smith"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Smith"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "replace a complex attribute merges it",
+			ops:  `[{"op": "replace", "path": "name", "value": {"familyName": "Smith"}}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Smith"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "replace a multi-valued attribute",
+			ops:  `[{"op": "replace", "path": "emails", "value": [{"value": "b@new.example", "type": "work"}]}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "b@new.example", "type": "work"}]}`,
+		},
+		{
+			name: "add a new attribute",
+			ops:  `[{"op": "add", "path": "nickName", "value": "Babs"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true, "nickName": "Babs",
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "add a sub-attribute of a missing attribute creates it",
+			ops:  `[{"op": "add", "path": "urn:ietf:params:scim:schemas:extension:enterprise:2.0:User:department", "value": "IT"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}],
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "IT"}}`,
+		},
+		{
+			name: "add to a multi-valued attribute appends new values only",
+			ops: `[{"op": "add", "path": "emails", "value": [
+				{"value": "babs@home.example", "type": "home"},
+				{"value": "b@other.example", "type": "other"}]}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"},
+					{"value": "b@other.example", "type": "other"}]}`,
+		},
+		{
+			name: "add without a path sets each attribute",
+			ops: `[{"op": "add", "value": {"nickName": "Babs", "name.givenName": "Barb",
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "IT"}}}]`,
+			want: `{"userName": "bjensen@example.com", "active": true, "nickName": "Babs",
+				"name": {"givenName": "Barb", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}],
+				"urn:ietf:params:scim:schemas:extension:enterprise:2.0:User": {"department": "IT"}}`,
+		},
+		{
+			name: "remove an attribute",
+			ops:  `[{"op": "remove", "path": "name.givenName"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "remove values from a multi-valued attribute",
+			ops:  `[{"op": "remove", "path": "emails", "value": [{"value": "babs@home.example"}]}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}]}`,
+		},
+		{
+			name: "replace the value of the matching element",
+			ops:  `[{"op": "replace", "path": "emails[type eq \"work\"].value", "value": "b@new.example"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "b@new.example", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "replace the matching element merges it",
+			ops:  `[{"op": "replace", "path": "emails[value ew \"home.example\"]", "value": {"primary": true}}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home", "primary": true}]}`,
+		},
+		{
+			name: "a filter matching nothing adds an element",
+			ops:  `[{"op": "add", "path": "emails[type eq \"other\"].value", "value": "b@other.example"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"},
+					{"type": "other", "value": "b@other.example"}]}`,
+		},
+		{
+			name: "remove the matching element",
+			ops:  `[{"op": "remove", "path": "emails[type eq \"work\"]"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "remove a sub-attribute of the matching element",
+			ops:  `[{"op": "remove", "path": "emails[type eq \"work\"].primary"}]`,
+			want: `{"userName": "bjensen@example.com", "active": true,
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work"}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+		{
+			name: "removing a nonexistent path is a no-op",
+			ops: `[{"op": "remove", "path": "nickName"}, {"op": "remove", "path": "addresses.locality"},
+				{"op": "remove", "path": "emails[type eq \"other\"]"}, {"op": "remove", "path": "phoneNumbers[type eq \"work\"].value"}]`,
+			want: patchUser,
+		},
+		{
+			name: "operations apply in order",
+			ops:  `[{"op": "add", "path": "nickName", "value": "Babs"}, {"op": "replace", "path": "nickName", "value": "B"}, {"op": "remove", "path": "active"}]`,
+			want: `{"userName": "bjensen@example.com", "nickName": "B",
+				"name": {"givenName": "Barbara", "familyName": "Jensen"},
+				"emails": [{"value": "bjensen@example.com", "type": "work", "primary": true}, {"value": "babs@home.example", "type": "home"}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []PatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			got := decodeObject(t, patchUser)
+			if err := ApplyPatch(got, ops); err != nil {
+				t.Fatalf("ApplyPatch: %v", err)
+			}
+			if want := decodeObject(t, tt.want); !reflect.DeepEqual(got, want) {
+				gotJSON, _ := json.Marshal(got)
+				wantJSON, _ := json.Marshal(want)
+				t.Errorf("resource =\n%s\nwant\n%s", gotJSON, wantJSON)
+			}
+		})
+	}
+}
+
+func TestApplyPatchInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		ops      string
+		scimType string
+	}{
+		{"no operations", `[]`, ErrInvalidSyntax},
+		{"unknown op", `[{"op": "move", "path": "nickName", "value": "x"}]`, ErrInvalidSyntax},
+		{"no path and no object", `[{"op": "replace", "value": "Babs"}]`, ErrInvalidSyntax},
+		{"remove without a path", `[{"op": "remove"}]`, ErrNoTarget},
+		{"missing ]", `[{"op": "replace", "path": "emails[type eq \"work\".value", "value": "x"}]`, ErrInvalidPath},
+		{"invalid filter", `[{"op": "replace", "path": "emails[type xx \"work\"].value", "value": "x"}]`, ErrInvalidPath},
+		{"nothing after the dot", `[{"op": "replace", "path": "emails[type eq \"work\"].", "value": "x"}]`, ErrInvalidPath},
+		{"no dot after the filter", `[{"op": "replace", "path": "emails[type eq \"work\"]value", "value": "x"}]`, ErrInvalidPath},
+		{"empty attribute", `[{"op": "replace", "path": "name..givenName", "value": "x"}]`, ErrInvalidPath},
+		{"filter without an attribute", `[{"op": "replace", "path": "[type eq \"work\"]", "value": "x"}]`, ErrInvalidPath},
+		{"no match and no simple filter", `[{"op": "replace", "path": "emails[type eq \"other\" or type eq \"fax\"].value", "value": "x"}]`, ErrNoTarget},
+		{"no match and not eq", `[{"op": "add", "path": "emails[type ne \"work\" and type ne \"home\"].value", "value": "x"}]`, ErrNoTarget},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var ops []PatchOp
+			if err := json.Unmarshal([]byte(tt.ops), &ops); err != nil {
+				t.Fatal(err)
+			}
+			checkPatchError(t, ApplyPatch(decodeObject(t, patchUser), ops), tt.scimType)
+		})
+	}
+
+	t.Run("invalid value", func(t *testing.T) {
+		// a request body can't carry invalid JSON, so set the raw value by hand
+		ops := []PatchOp{{Op: "add", Path: "nickName", Value: json.RawMessage("nope")}}
+		checkPatchError(t, ApplyPatch(decodeObject(t, patchUser), ops), ErrInvalidSyntax)
+	})
+}
+
+func checkPatchError(t *testing.T, err error, scimType string) {
+	t.Helper()
+	var scimErr *Error
+	if !errors.As(err, &scimErr) {
+		t.Fatalf("ApplyPatch = %v, want a SCIM error", err)
+	}
+	if scimErr.ScimType != scimType || scimErr.StatusCode() != 400 {
+		t.Errorf("error = %d %s (%s), want 400 %s", scimErr.StatusCode(), scimErr.ScimType, scimErr.Detail, scimType)
+	}
+}
@@ -0,0 +1,127 @@
+package search
+
+import (
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxTerms limits how many words of a search are used
+const maxTerms = 10
+
+// stopWords is InnoDB's default full-text stopword list (INFORMATION_SCHEMA.INNODB_FT_DEFAULT_STOPWORD)
+// These words aren't indexed, so requiring one ("+the*") can make the whole search find nothing
+var stopWords = map[string]bool{
+	"a": true, "about": true, "an": true, "are": true, "as": true, "at": true, "be": true, "by": true,
+	"com": true, "de": true, "en": true, "for": true, "from": true, "how": true, "i": true, "in": true,
+	"is": true, "it": true, "la": true, "of": true, "on": true, "or": true, "that": true, "the": true,
+	"this": true, "to": true, "was": true, "what": true, "when": true, "where": true, "who": true,
+	"will": true, "with": true, "und": true, "www": true,
+}
+
+// Terms splits a search string into lowercase words
+// Everything that isn't a letter or digit is a separator, so MySQL boolean
+// operators (+ - < > ( ) ~ * " @) typed by the user can't change the query
+// Stop words are left out, unless the search has nothing else
+func Terms(q string) []string {
+	words := strings.FieldsFunc(strings.ToLower(q), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	var kept []string
+	for _, w := range words {
+		if !stopWords[w] {
+			kept = append(kept, w)
+		}
+	}
+	if len(kept) > 0 {
+		words = kept
+	}
+	if len(words) > maxTerms {
+		words = words[:maxTerms]
+	}
+	return words
+}
+
+// BooleanQuery builds the AGAINST(... IN BOOLEAN MODE) string for the terms
+// Every word must appear, as a prefix: "print rusak" -> "+print* +rusak*"
+func BooleanQuery(terms []string) string {
+	parts := make([]string, len(terms))
+	for i, t := range terms {
+		parts[i] = "+" + t + "*"
+	}
+	return strings.Join(parts, " ")
+}
+
+// Highlighter marks the search terms in result text
+type Highlighter struct {
+	re *regexp.Regexp
+}
+
+// NewHighlighter returns a highlighter for the terms (nil if there are none)
+func NewHighlighter(terms []string) *Highlighter {
+	if len(terms) == 0 {
+		return nil
+	}
+	quoted := make([]string, len(terms))
+	for i, t := range terms {
+		quoted[i] = regexp.QuoteMeta(t)
+	}
+	// Same prefix matching as BooleanQuery: the rest of the word is marked too
+	// \b and \w only know ASCII, so word boundaries are spelled out to work for "édition" or "über"
+	return &Highlighter{re: regexp.MustCompile(`(?i)(?:^|[^\pL\pN])((?:` + strings.Join(quoted, "|") + `)[\pL\pN]*)`)}
+}
+
+// Highlight returns text with every match wrapped in <mark></mark>
+// The text is HTML-escaped, so the result is safe to render as HTML
+// Text longer than maxLen characters is cut to a snippet around the first match
+// Returns "" when nothing matches
+func (h *Highlighter) Highlight(text string, maxLen int) string {
+	// Group 1 is the word, without the separator in front of it
+	first := h.re.FindStringSubmatchIndex(text)
+	if first == nil {
+		return ""
+	}
+	text = snippet(text, first[2], maxLen)
+
+	var b strings.Builder
+	last := 0
+	for _, m := range h.re.FindAllStringSubmatchIndex(text, -1) {
+		b.WriteString(html.EscapeString(text[last:m[2]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[m[2]:m[3]]))
+		b.WriteString("</mark>")
+		last = m[3]
+	}
+	b.WriteString(html.EscapeString(text[last:]))
+	return b.String()
+}
+
+// snippet cuts text to about maxLen characters, starting a bit before byte offset at
+func snippet(text string, at, maxLen int) string {
+	if utf8.RuneCountInString(text) <= maxLen {
+		return text
+	}
+
+	runes := []rune(text)
+	pos := utf8.RuneCountInString(text[:at])
+	start := pos - maxLen/4
+	if start < 0 {
+		start = 0
+	}
+	end := start + maxLen
+	if end > len(runes) {
+		end = len(runes)
+		start = end - maxLen
+	}
+
+	out := strings.TrimSpace(string(runes[start:end]))
+	if start > 0 {
+		out = "…" + out
+	}
+	if end < len(runes) {
+		out += "…"
+	}
+	return out
+}
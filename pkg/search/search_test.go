@@ -0,0 +1,182 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		q    string
+		want []string
+	}{
+		{"", nil},
+		{"   ", nil},
+		{"printer rusak", []string{"printer", "rusak"}},
+		{"  Printer   RUSAK\t", []string{"printer", "rusak"}},
+		{"lantai-2, ruang_rapat", []string{"lantai", "2", "ruang", "rapat"}},
+
+		// boolean operators are separators, so they never reach the query
+		{`+printer -rusak`, []string{"printer", "rusak"}},
+		{`"printer rusak"`, []string{"printer", "rusak"}},
+		{`print* (rusak) <lama >baru ~mati @3`, []string{"print", "rusak", "lama", "baru", "mati", "3"}},
+		{`'; DROP TABLE work_orders; --`, []string{"drop", "table", "work", "orders"}},
+		{`+-*~<>()"@`, nil},
+
+		// stop words are left out, unless there is nothing else
+		{"the printer is on the second floor", []string{"printer", "second", "floor"}},
+		{"The Printer", []string{"printer"}},
+		{"the", []string{"the"}},
+		{"to be or not to be", []string{"not"}},
+		{"of the", []string{"of", "the"}},
+		{"di lantai", []string{"di", "lantai"}},
+
+		// letters and digits of any script
+		{"café Ümlaut", []string{"café", "ümlaut"}},
+		{"ruang 会议室 ２", []string{"ruang", "会议室", "２"}},
+		{"printer🖨️rusak", []string{"printer", "rusak"}},
+
+		// at most maxTerms words, counted after the stop words are gone
+		{"a b c d e f g h i j k l m", []string{"b", "c", "d", "e", "f", "g", "h", "j", "k", "l"}},
+		{"the " + strings.Repeat("x ", 12), []string{"x", "x", "x", "x", "x", "x", "x", "x", "x", "x"}},
+	}
+	for _, tt := range tests {
+		got := Terms(tt.q)
+		if len(got) == 0 && len(tt.want) == 0 {
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Terms(%q) = %q, want %q", tt.q, got, tt.want)
+		}
+	}
+}
+
+func TestBooleanQuery(t *testing.T) {
+	tests := []struct {
+		q    string
+		want string
+	}{
+		{"", ""},
+		{"printer", "+printer*"},
+		{"printer rusak", "+printer* +rusak*"},
+		{`-printer +"rusak" (lama*)`, "+printer* +rusak* +lama*"},
+		{"café", "+café*"},
+	}
+	for _, tt := range tests {
+		got := BooleanQuery(Terms(tt.q))
+		if got != tt.want {
+			t.Errorf("BooleanQuery(Terms(%q)) = %q, want %q", tt.q, got, tt.want)
+		}
+		// Only our own operators: + in front and * at the end of every word
+		for _, part := range strings.Fields(got) {
+			word := strings.TrimSuffix(strings.TrimPrefix(part, "+"), "*")
+			if strings.ContainsAny(word, `+-*~<>()"@ `) {
+				t.Errorf("BooleanQuery(Terms(%q)) has an operator inside %q", tt.q, part)
+			}
+		}
+	}
+}
+
+func TestNewHighlighterWithoutTerms(t *testing.T) {
+	if h := NewHighlighter(nil); h != nil {
+		t.Errorf("NewHighlighter(nil) = %v, want nil", h)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		name string
+		q    string
+		text string
+		want string
+	}{
+		{"no match", "printer", "Monitor mati", ""},
+		{"word", "printer", "Printer rusak", "<mark>Printer</mark> rusak"},
+		{"prefix marks the whole word", "print", "Printernya rusak", "<mark>Printernya</mark> rusak"},
+		{"only at the start of a word", "print", "reprint the sprint", ""},
+		{"several terms and matches", "printer rusak", "printer rusak, printer lain tidak rusak",
+			"<mark>printer</mark> <mark>rusak</mark>, <mark>printer</mark> lain tidak <mark>rusak</mark>"},
+		{"next to punctuation", "rusak", "(rusak)/rusak.", "(<mark>rusak</mark>)/<mark>rusak</mark>."},
+		{"digits", "2", "Lantai 2, ruang 21", "Lantai <mark>2</mark>, ruang <mark>21</mark>"},
+		{"HTML is escaped", "script", `<script>alert("x")</script> & script`,
+			`&lt;<mark>script</mark>&gt;alert(&#34;x&#34;)&lt;/<mark>script</mark>&gt; &amp; <mark>script</mark>`},
+		{"regexp characters in the text", "harga", "harga.* (harga+)?", "<mark>harga</mark>.* (<mark>harga</mark>+)?"},
+
+		// non-ASCII letters belong to the word
+		{"accent inside the word", "caf", "Café buka", "<mark>Café</mark> buka"},
+		{"accent at the start", "édition", "Nouvelle édition", "Nouvelle <mark>édition</mark>"},
+		{"case folding beyond ASCII", "über", "ÜBER uns", "<mark>ÜBER</mark> uns"},
+		{"no match inside a non-ASCII word", "ber", "über", ""},
+		{"CJK", "会议", "预订会议室 会议室", "预订会议室 <mark>会议室</mark>"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewHighlighter(Terms(tt.q))
+			if got := h.Highlight(tt.text, 160); got != tt.want {
+				t.Errorf("Highlight(%q) = %q, want %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHighlightSnippet(t *testing.T) {
+	h := NewHighlighter(Terms("rusak"))
+	filler := strings.Repeat("kata ", 40) // 200 characters
+
+	t.Run("short text is not cut", func(t *testing.T) {
+		text := "printer rusak"
+		if got := h.Highlight(text, 13); got != "printer <mark>rusak</mark>" {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("match at the start", func(t *testing.T) {
+		got := h.Highlight("rusak "+filler, 40)
+		if !strings.HasPrefix(got, "<mark>rusak</mark> kata") || !strings.HasSuffix(got, "…") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("match in the middle", func(t *testing.T) {
+		got := h.Highlight(filler+"printer rusak "+filler, 40)
+		if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "…") || !strings.Contains(got, "<mark>rusak</mark>") {
+			t.Errorf("got %q", got)
+		}
+		if n := utf8.RuneCountInString(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(got)); n > 42 {
+			t.Errorf("snippet has %d characters, want at most 40 plus the ellipses", n)
+		}
+	})
+
+	t.Run("match at the end", func(t *testing.T) {
+		got := h.Highlight(filler+"rusak", 40)
+		if !strings.HasPrefix(got, "…") || !strings.HasSuffix(got, "<mark>rusak</mark>") {
+			t.Errorf("got %q", got)
+		}
+	})
+
+	t.Run("multi-byte characters are never split", func(t *testing.T) {
+		for _, fill := range []string{"é", "会", "🖨", "ü"} {
+			text := strings.Repeat(fill, 100) + " rusak " + strings.Repeat(fill, 100)
+			for _, maxLen := range []int{7, 10, 20, 33, 50} {
+				got := h.Highlight(text, maxLen)
+				if !utf8.ValidString(got) {
+					t.Fatalf("Highlight(%s…, %d) = %q is not valid UTF-8", fill, maxLen, got)
+				}
+				if !strings.Contains(got, "<mark>rusak</mark>") {
+					t.Errorf("Highlight(%s…, %d) = %q lost the match", fill, maxLen, got)
+				}
+			}
+		}
+	})
+
+	t.Run("match after multi-byte characters", func(t *testing.T) {
+		// byte offsets and character offsets differ here
+		text := strings.Repeat("会议室 ", 60) + "rusak"
+		got := h.Highlight(text, 30)
+		if !utf8.ValidString(got) || !strings.HasSuffix(got, "<mark>rusak</mark>") {
+			t.Errorf("got %q", got)
+		}
+	})
+}
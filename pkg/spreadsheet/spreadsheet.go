@@ -0,0 +1,219 @@
+package spreadsheet
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Supported formats
+const (
+	CSV  = "csv"
+	XLSX = "xlsx"
+)
+
+// Content types for downloads
+const (
+	CSVContentType  = "text/csv; charset=utf-8"
+	XLSXContentType = "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+)
+
+// MaxRows is the most rows (header included) Read accepts
+const MaxRows = 1001
+
+// ErrUnsupportedFormat is returned for files that are neither .csv nor .xlsx
+var ErrUnsupportedFormat = errors.New("only .csv and .xlsx files are supported")
+
+// ErrTooManyRows is returned when a file has more than MaxRows rows
+var ErrTooManyRows = fmt.Errorf("file has more than %d rows", MaxRows-1)
+
+// utf8BOM is written by Excel in front of "CSV UTF-8" files
+var utf8BOM = []byte{0xEF, 0xBB, 0xBF}
+
+// formulaStart are the first characters that make Excel, LibreOffice or Google Sheets
+// treat a cell as a formula
+const formulaStart = "=+-@\t\r"
+
+// FormatOf returns CSV or XLSX based on the file extension
+func FormatOf(filename string) (string, error) {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".csv":
+		return CSV, nil
+	case ".xlsx":
+		return XLSX, nil
+	}
+	return "", ErrUnsupportedFormat
+}
+
+// Read returns the rows of a CSV file or of the first sheet of an XLSX file
+// Row i of the result is row i+1 in the spreadsheet, so blank rows are kept (as empty slices)
+// The ' that Write puts in front of formula-like cells is removed, so exports can be imported again
+func Read(r io.Reader, format string) ([][]string, error) {
+	var (
+		rows [][]string
+		err  error
+	)
+	switch format {
+	case CSV:
+		rows, err = readCSV(r)
+	case XLSX:
+		rows, err = readXLSX(r)
+	default:
+		return nil, ErrUnsupportedFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) > MaxRows {
+		return nil, ErrTooManyRows
+	}
+	for _, row := range rows {
+		for j, v := range row {
+			row[j] = unescapeFormula(v)
+		}
+	}
+	return rows, nil
+}
+
+func readCSV(r io.Reader) ([][]string, error) {
+	br := bufio.NewReader(r)
+	if b, _ := br.Peek(3); bytes.Equal(b, utf8BOM) {
+		_, _ = br.Discard(3)
+	}
+
+	// Excel with an Indonesian (or other European) locale separates with ";"
+	delimiter := ','
+	if line, _ := br.Peek(4096); bytes.Count(firstLine(line), []byte(";")) > bytes.Count(firstLine(line), []byte(",")) {
+		delimiter = ';'
+	}
+
+	cr := csv.NewReader(br)
+	cr.Comma = delimiter
+	cr.FieldsPerRecord = -1 // rows may have fewer columns
+	cr.TrimLeadingSpace = true
+
+	var rows [][]string
+	for {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+		if len(rows) >= MaxRows {
+			return nil, ErrTooManyRows
+		}
+		rows = append(rows, row)
+	}
+}
+
+func firstLine(b []byte) []byte {
+	if i := bytes.IndexByte(b, '\n'); i >= 0 {
+		return b[:i]
+	}
+	return b
+}
+
+func readXLSX(r io.Reader) ([][]string, error) {
+	f, err := excelize.OpenReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	defer f.Close()
+
+	sheets := f.GetSheetList()
+	if len(sheets) == 0 {
+		return nil, nil
+	}
+	rows, err := f.GetRows(sheets[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid XLSX file: %w", err)
+	}
+	return rows, nil
+}
+
+// Write writes rows (the first one being the header) as CSV or XLSX
+// Cells that start like a formula (=, +, -, @, tab or CR) get a ' in front, so a value such as
+// =HYPERLINK(...) in a user's name is shown as text instead of run when the file is opened
+func Write(w io.Writer, format, sheetName string, rows [][]string) error {
+	escaped := make([][]string, len(rows))
+	for i, row := range rows {
+		escaped[i] = make([]string, len(row))
+		for j, v := range row {
+			escaped[i][j] = escapeFormula(v)
+		}
+	}
+	rows = escaped
+
+	switch format {
+	case CSV:
+		return writeCSV(w, rows)
+	case XLSX:
+		return writeXLSX(w, sheetName, rows)
+	}
+	return ErrUnsupportedFormat
+}
+
+func writeCSV(w io.Writer, rows [][]string) error {
+	// The BOM makes Excel open the file as UTF-8 instead of the local code page
+	if _, err := w.Write(utf8BOM); err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+func writeXLSX(w io.Writer, sheetName string, rows [][]string) error {
+	f := excelize.NewFile()
+	defer f.Close()
+
+	if err := f.SetSheetName(f.GetSheetName(0), sheetName); err != nil {
+		return err
+	}
+	sw, err := f.NewStreamWriter(sheetName)
+	if err != nil {
+		return err
+	}
+	for i, row := range rows {
+		cells := make([]interface{}, len(row))
+		for j, v := range row {
+			cells[j] = v
+		}
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		if err := sw.SetRow(cell, cells); err != nil {
+			return err
+		}
+	}
+	if err := sw.Flush(); err != nil {
+		return err
+	}
+	_, err = f.WriteTo(w)
+	return err
+}
+
+// escapeFormula prefixes a formula-like cell with '
+func escapeFormula(v string) string {
+	if v != "" && strings.IndexByte(formulaStart, v[0]) >= 0 {
+		return "'" + v
+	}
+	return v
+}
+
+// unescapeFormula undoes escapeFormula
+func unescapeFormula(v string) string {
+	if len(v) > 1 && v[0] == '\'' && strings.IndexByte(formulaStart, v[1]) >= 0 {
+		return v[1:]
+	}
+	return v
+}
@@ -0,0 +1,202 @@
+package spreadsheet
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+func TestReadCSV(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		want [][]string
+	}{
+		{
+			name: "comma",
+			file: "name,email\nBudi,budi@example.com\n",
+			want: [][]string{{"name", "email"}, {"Budi", "budi@example.com"}},
+		},
+		{
+			name: "BOM is dropped",
+			file: "\xEF\xBB\xBFname,email\nBudi,budi@example.com\n",
+			want: [][]string{{"name", "email"}, {"Budi", "budi@example.com"}},
+		},
+		{
+			name: "semicolon from a European Excel",
+			file: "\xEF\xBB\xBFname;email;unit\r\nSiti, S.Kom;siti@example.com;IT\r\n",
+			want: [][]string{{"name", "email", "unit"}, {"Siti, S.Kom", "siti@example.com", "IT"}},
+		},
+		{
+			name: "delimiter comes from the first line only",
+			file: "name,email\n\"a;b;c\",x@example.com\n",
+			want: [][]string{{"name", "email"}, {"a;b;c", "x@example.com"}},
+		},
+		{
+			name: "comma wins a tie",
+			file: "a;b,c\n",
+			want: [][]string{{"a;b", "c"}},
+		},
+		{
+			name: "quoted fields and leading spaces",
+			file: "name, email\n\"Budi \"\"B\"\" Santoso\", budi@example.com\n",
+			want: [][]string{{"name", "email"}, {`Budi "B" Santoso`, "budi@example.com"}},
+		},
+		{
+			name: "rows may have fewer columns",
+			file: "name,email,unit\nBudi\n",
+			want: [][]string{{"name", "email", "unit"}, {"Budi"}},
+		},
+		{
+			name: "escaped formulas are read back as written",
+			file: "name,phone\n'=1+1,'+62 812\n'hello,'\n",
+			want: [][]string{{"name", "phone"}, {"=1+1", "+62 812"}, {"'hello", "'"}},
+		},
+		{
+			name: "empty file",
+			file: "",
+			want: nil,
+		},
+		{
+			name: "only a BOM",
+			file: "\xEF\xBB\xBF",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Read(strings.NewReader(tt.file), CSV)
+			if err != nil {
+				t.Fatalf("Read: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Read = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReadErrors(t *testing.T) {
+	if _, err := Read(strings.NewReader("a,\"b\n"), CSV); err == nil || !strings.Contains(err.Error(), "invalid CSV") {
+		t.Errorf("unterminated quote: err = %v, want invalid CSV", err)
+	}
+	if _, err := Read(strings.NewReader("not a zip"), XLSX); err == nil || !strings.Contains(err.Error(), "invalid XLSX") {
+		t.Errorf("garbage XLSX: err = %v, want invalid XLSX", err)
+	}
+	if _, err := Read(strings.NewReader("a,b"), "ods"); !errors.Is(err, ErrUnsupportedFormat) {
+		t.Errorf("ods: err = %v, want ErrUnsupportedFormat", err)
+	}
+
+	full := strings.Repeat("a,b\n", MaxRows)
+	if rows, err := Read(strings.NewReader(full), CSV); err != nil || len(rows) != MaxRows {
+		t.Errorf("%d rows: got %d rows, err %v", MaxRows, len(rows), err)
+	}
+	if _, err := Read(strings.NewReader(full+"a,b\n"), CSV); !errors.Is(err, ErrTooManyRows) {
+		t.Errorf("%d rows: err = %v, want ErrTooManyRows", MaxRows+1, err)
+	}
+}
+
+func TestFormatOf(t *testing.T) {
+	tests := map[string]string{"users.csv": CSV, "Users.XLSX": XLSX, "a.b.csv": CSV}
+	for name, want := range tests {
+		if got, err := FormatOf(name); err != nil || got != want {
+			t.Errorf("FormatOf(%q) = %q, %v, want %q", name, got, err, want)
+		}
+	}
+	for _, name := range []string{"users.xls", "users", "csv", "users.csv.exe"} {
+		if _, err := FormatOf(name); !errors.Is(err, ErrUnsupportedFormat) {
+			t.Errorf("FormatOf(%q) err = %v, want ErrUnsupportedFormat", name, err)
+		}
+	}
+}
+
+// formulaRows have a cell for each character that starts a formula, and some that don't
+var formulaRows = [][]string{
+	{"name", "phone"},
+	{"=HYPERLINK(\"http://evil.example\",\"click\")", "+62 812 3456 7890"},
+	{"-2+3", "@SUM(A1:A2)"},
+	{"\t=1+1", "\r=1+1"},
+	{"Budi = Boss", "0812-3456"},
+	{"'quoted", ""},
+}
+
+// escapedRows are formulaRows as they must be stored in the file
+var escapedRows = [][]string{
+	{"name", "phone"},
+	{"'=HYPERLINK(\"http://evil.example\",\"click\")", "'+62 812 3456 7890"},
+	{"'-2+3", "'@SUM(A1:A2)"},
+	{"'\t=1+1", "'\r=1+1"},
+	{"Budi = Boss", "0812-3456"},
+	{"'quoted", ""},
+}
+
+func TestWriteCSVEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, CSV, "Users", formulaRows); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), utf8BOM) {
+		t.Error("CSV does not start with a BOM")
+	}
+
+	// Parse without Read, which would remove the '
+	got, err := readCSV(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, escapedRows) {
+		t.Errorf("file has %q, want %q", got, escapedRows)
+	}
+	if formulaRows[1][0][0] != '=' {
+		t.Error("Write changed the rows it was given")
+	}
+
+	back, err := Read(bytes.NewReader(buf.Bytes()), CSV)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, formulaRows) {
+		t.Errorf("Read = %q, want the rows that were written %q", back, formulaRows)
+	}
+}
+
+func TestWriteXLSXEscapesFormulas(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Write(&buf, XLSX, "Users", formulaRows); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := excelize.OpenReader(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if sheets := f.GetSheetList(); len(sheets) != 1 || sheets[0] != "Users" {
+		t.Fatalf("sheets = %q, want [Users]", sheets)
+	}
+	for i, row := range escapedRows {
+		for j, want := range row {
+			cell, _ := excelize.CoordinatesToCellName(j+1, i+1)
+			if formula, _ := f.GetCellFormula("Users", cell); formula != "" {
+				t.Errorf("%s has formula %q", cell, formula)
+			}
+			if got, _ := f.GetCellValue("Users", cell); got != want {
+				t.Errorf("%s = %q, want %q", cell, got, want)
+			}
+		}
+	}
+
+	back, err := Read(bytes.NewReader(buf.Bytes()), XLSX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// GetRows drops trailing empty cells
+	want := append(append([][]string{}, formulaRows[:5]...), []string{"'quoted"})
+	if !reflect.DeepEqual(back, want) {
+		t.Errorf("Read = %q, want %q", back, want)
+	}
+}
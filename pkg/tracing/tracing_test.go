@@ -0,0 +1,166 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"siro-backend/pkg/config"
+	"sort"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// exportedSpan is the part of a span written by the file exporter that the tests look at
+type exportedSpan struct {
+	Name     string
+	Resource []struct {
+		Key   string
+		Value struct{ Value interface{} }
+	}
+}
+
+// readSpans decodes the spans the file exporter wrote
+func readSpans(t *testing.T, path string) []exportedSpan {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var spans []exportedSpan
+	dec := json.NewDecoder(f)
+	for {
+		var s exportedSpan
+		if err := dec.Decode(&s); errors.Is(err, io.EOF) {
+			return spans
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		spans = append(spans, s)
+	}
+}
+
+// fileConfig exports to a file in a temporary directory
+func fileConfig(t *testing.T, ratio float64) config.TracingConfig {
+	t.Helper()
+	t.Cleanup(func() { otel.SetTracerProvider(noop.NewTracerProvider()) })
+	return config.TracingConfig{
+		Exporter:    "file",
+		FilePath:    filepath.Join(t.TempDir(), "traces.json"),
+		SampleRatio: ratio,
+		ServiceName: "siro-test",
+	}
+}
+
+func TestInitFile(t *testing.T) {
+	cfg := fileConfig(t, 1)
+	shutdown, err := Init(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span := otel.Tracer("test").Start(context.Background(), "GET /api/v1/workorders")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	spans := readSpans(t, cfg.FilePath)
+	if len(spans) != 1 || spans[0].Name != "GET /api/v1/workorders" {
+		t.Fatalf("spans = %+v", spans)
+	}
+	resource := map[string]interface{}{}
+	for _, kv := range spans[0].Resource {
+		resource[kv.Key] = kv.Value.Value
+	}
+	if resource["service.name"] != "siro-test" || resource["service.version"] != "dev" {
+		t.Errorf("resource = %v", resource)
+	}
+
+	// the file is appended to, not truncated, on the next start
+	shutdown, err = Init(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, span = otel.Tracer("test").Start(context.Background(), "second")
+	span.End()
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if spans := readSpans(t, cfg.FilePath); len(spans) != 2 {
+		t.Errorf("%d spans after restart, want 2", len(spans))
+	}
+}
+
+func TestInitSampling(t *testing.T) {
+	cfg := fileConfig(t, 0)
+	shutdown, err := Init(context.Background(), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tracer := otel.Tracer("test")
+
+	// new traces are dropped with ratio 0
+	_, span := tracer.Start(context.Background(), "dropped")
+	span.End()
+
+	// but a trace the caller sampled is kept (parent based)
+	header := http.Header{}
+	header.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx := otel.GetTextMapPropagator().Extract(context.Background(), propagation.HeaderCarrier(header))
+	_, span = tracer.Start(ctx, "kept")
+	span.End()
+
+	if err := shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	spans := readSpans(t, cfg.FilePath)
+	if len(spans) != 1 || spans[0].Name != "kept" {
+		t.Errorf("spans = %+v, want only the sampled parent's child", spans)
+	}
+}
+
+func TestInitNone(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator())
+	shutdown, err := Init(context.Background(), config.TracingConfig{Exporter: "none"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := shutdown(context.Background()); err != nil {
+		t.Error(err)
+	}
+	// trace headers are still read and passed on
+	fields := otel.GetTextMapPropagator().Fields()
+	sort.Strings(fields)
+	if !reflect.DeepEqual(fields, []string{"baggage", "traceparent", "tracestate"}) {
+		t.Errorf("propagated headers = %s", fields)
+	}
+}
+
+func TestInitErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.TracingConfig
+		want string
+	}{
+		{"unknown exporter", config.TracingConfig{Exporter: "jaeger"}, `unknown tracing exporter "jaeger"`},
+		{"file in a missing directory", config.TracingConfig{Exporter: "file", FilePath: filepath.Join(t.TempDir(), "missing", "traces.json")},
+			"failed to open trace file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			shutdown, err := Init(context.Background(), tt.cfg)
+			if err == nil || !strings.Contains(err.Error(), tt.want) || shutdown != nil {
+				t.Errorf("Init = %v, want %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -7,6 +7,7 @@ import (
 	"os"
 	"path/filepath"
 	"siro-backend/global"
+	"siro-backend/pkg/config"
 	"strings"
 	"time"
 )
@@ -18,10 +19,40 @@ type UploadConfig struct {
 	SubDir      string
 }
 
+// Upload settings, set by InitUploads
+var (
+	maxUploadSize int64 = 2 * 1024 * 1024 // 2MB
+	baseURL             = "http://localhost:8080"
+)
+
+// InitUploads sets the upload size limit and the public base URL from the config
+func InitUploads(cfg config.UploadConfig, serverCfg config.ServerConfig) {
+	maxUploadSize = cfg.MaxFileSize
+	baseURL = serverCfg.BaseURL
+}
+
+// MaxUploadSize returns the upload limit in bytes
+func MaxUploadSize() int64 {
+	return maxUploadSize
+}
+
+// MaxUploadSizeLabel returns the upload limit in a human readable form, e.g. "2MB"
+func MaxUploadSizeLabel() string {
+	return formatSize(maxUploadSize)
+}
+
+// formatSize formats a byte count as MB or KB
+func formatSize(size int64) string {
+	if size%(1024*1024) == 0 {
+		return fmt.Sprintf("%dMB", size/(1024*1024))
+	}
+	return fmt.Sprintf("%dKB", size/1024)
+}
+
 func DefaultImageConfig(subDir string) UploadConfig {
 	return UploadConfig{
 		AllowedExts: []string{".jpg", ".jpeg", ".png"},
-		MaxFileSize: 2 * 1024 * 1024, // 2MB
+		MaxFileSize: maxUploadSize,
 		SubDir:      subDir,
 	}
 }
@@ -29,7 +60,7 @@ func DefaultImageConfig(subDir string) UploadConfig {
 func SaveUploadedFile(file *multipart.FileHeader, config UploadConfig) (string, error) {
 	// Validasi Ukuran
 	if file.Size > config.MaxFileSize {
-		return "", fmt.Errorf("file too large (max 2MB)")
+		return "", fmt.Errorf("file too large (max %s)", formatSize(config.MaxFileSize))
 	}
 
 	// Validasi Ekstensi
@@ -80,10 +111,20 @@ func SaveUploadedFile(file *multipart.FileHeader, config UploadConfig) (string,
 }
 
 func GetBaseURL() string {
-	// Helper untuk mendapatkan base URL (bisa dari ENV)
-	host := os.Getenv("BACKEND_URL")
-	if host == "" {
-		return "http://localhost:8080"
+	// Helper untuk mendapatkan base URL (dari config: server.base_url / BACKEND_URL)
+	return baseURL
+}
+
+// CheckUploadDirWritable verifies that files can be created in the uploads directory
+func CheckUploadDirWritable() error {
+	if err := os.MkdirAll(global.DirUploads, os.ModePerm); err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(global.DirUploads, ".readyz-*")
+	if err != nil {
+		return err
 	}
-	return host
+	name := f.Name()
+	f.Close()
+	return os.Remove(name)
 }
@@ -0,0 +1,99 @@
+package utils
+
+import (
+	"bytes"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"siro-backend/global"
+	"siro-backend/pkg/config"
+	"strings"
+	"testing"
+)
+
+// fileHeader builds the multipart header of an uploaded file named name
+func fileHeader(t *testing.T, name string, content []byte) *multipart.FileHeader {
+	t.Helper()
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, err := mw.CreateFormFile("file", name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fw.Write(content)
+	mw.Close()
+
+	form, err := multipart.NewReader(&body, mw.Boundary()).ReadForm(1 << 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { form.RemoveAll() })
+	return form.File["file"][0]
+}
+
+func TestInitUploads(t *testing.T) {
+	oldSize, oldURL := maxUploadSize, baseURL
+	t.Cleanup(func() { maxUploadSize, baseURL = oldSize, oldURL })
+
+	InitUploads(config.UploadConfig{MaxFileSize: 5 << 20}, config.ServerConfig{BaseURL: "https://siro.example.com"})
+	if MaxUploadSize() != 5<<20 || MaxUploadSizeLabel() != "5MB" || DefaultImageConfig("avatar").MaxFileSize != 5<<20 {
+		t.Errorf("limit %d (%s)", MaxUploadSize(), MaxUploadSizeLabel())
+	}
+	if GetBaseURL() != "https://siro.example.com" {
+		t.Errorf("base URL %q", GetBaseURL())
+	}
+}
+
+func TestFormatSize(t *testing.T) {
+	for size, want := range map[int64]string{2 << 20: "2MB", 512 << 10: "512KB", 1536 << 10: "1536KB", 1500: "1KB"} {
+		if got := formatSize(size); got != want {
+			t.Errorf("formatSize(%d) = %s, want %s", size, got, want)
+		}
+	}
+}
+
+func TestSaveUploadedFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+	cfg := UploadConfig{AllowedExts: []string{".jpg", ".png"}, MaxFileSize: 10, SubDir: "avatar"}
+
+	url, err := SaveUploadedFile(fileHeader(t, "me.PNG", []byte("png bytes")), cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(url, "/"+global.DirUploads+"/avatar/") || !strings.HasSuffix(url, "_avatar.png") {
+		t.Errorf("url %q", url)
+	}
+	saved, err := os.ReadFile(filepath.FromSlash(strings.TrimPrefix(url, "/")))
+	if err != nil || string(saved) != "png bytes" {
+		t.Errorf("saved %q (%v)", saved, err)
+	}
+
+	if _, err := SaveUploadedFile(fileHeader(t, "big.png", []byte("12345678901")), cfg); err == nil || err.Error() != "file too large (max 0KB)" {
+		t.Errorf("too large: %v", err)
+	}
+	for _, name := range []string{"me.gif", "me", "me.png.exe"} {
+		if _, err := SaveUploadedFile(fileHeader(t, name, []byte("x")), cfg); err == nil {
+			t.Errorf("%s accepted", name)
+		}
+	}
+}
+
+func TestCheckUploadDirWritable(t *testing.T) {
+	t.Chdir(t.TempDir())
+	if err := CheckUploadDirWritable(); err != nil {
+		t.Fatal(err)
+	}
+	entries, err := os.ReadDir(global.DirUploads)
+	if err != nil || len(entries) != 0 {
+		t.Errorf("left %v in the uploads directory (%v)", entries, err)
+	}
+
+	// A file where the directory should be
+	t.Chdir(t.TempDir())
+	if err := os.WriteFile(global.DirUploads, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := CheckUploadDirWritable(); err == nil {
+		t.Error("no error when uploads is a file")
+	}
+}
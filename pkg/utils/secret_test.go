@@ -0,0 +1,34 @@
+package utils
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestRandomToken(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		tok, err := RandomToken()
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := base64.RawURLEncoding.DecodeString(tok)
+		if err != nil || len(b) != 32 {
+			t.Fatalf("%q is not 32 bytes of URL-safe base64 (%v)", tok, err)
+		}
+		if seen[tok] {
+			t.Fatalf("%q returned twice", tok)
+		}
+		seen[tok] = true
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// sha256("abc")
+	if got, want := HashToken("abc"), "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"; got != want {
+		t.Errorf("HashToken(abc) = %s, want %s", got, want)
+	}
+	if HashToken("abc") == HashToken("abd") {
+		t.Error("different tokens, same hash")
+	}
+}
@@ -1,37 +1,79 @@
 package utils
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"os"
+	"siro-backend/pkg/config"
+	"siro-backend/pkg/jwtkeys"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 )
 
-// JwtSecret stores the secret key for signing JWT tokens
-// This must be set before using any token functions
-var JwtSecret []byte
+// jwtSigner signs and verifies JWT tokens (HS256 secret or rotating RS256/EdDSA keys)
+// This must be set with InitJWT before using any token functions
+var jwtSigner *jwtkeys.Set
 
-// InitJWT reads JWT secret from environment and sets it up
-// This must be called when the application starts
-func InitJWT() {
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		log.Fatal("ERROR: JWT_SECRET is not set in .env file. This is required for security.")
+// Token lifetimes, set by InitJWT
+var (
+	accessTokenTTL  = 20 * time.Minute
+	refreshTokenTTL = 7 * 24 * time.Hour
+)
+
+// bcryptCost is the bcrypt cost factor, set by InitPassword
+var bcryptCost = 14
+
+// InitJWT sets up token signing and lifetimes from the config
+// This must be called when the application starts, after the database is connected:
+// with RS256/EdDSA it loads the key pairs from store (creating the first one) and starts the rotation
+// The config package has already validated the secret length and algorithm
+func InitJWT(cfg config.JWTConfig, store jwtkeys.Store) error {
+	accessTokenTTL = cfg.AccessTokenTTL.Duration
+	refreshTokenTTL = cfg.RefreshTokenTTL.Duration
+
+	signer, err := jwtkeys.New(jwtkeys.Options{
+		Algorithm: cfg.Algorithm,
+		Secret:    []byte(cfg.Secret),
+		Rotation:  cfg.KeyRotation.Duration,
+		TokenTTL:  max(accessTokenTTL, refreshTokenTTL),
+	}, store)
+	if err != nil {
+		return err
 	}
-	if len(secret) < 32 {
-		log.Fatal("ERROR: JWT_SECRET must be at least 32 characters long for security.")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := signer.Rotate(ctx); err != nil {
+		return fmt.Errorf("failed to load jwt signing keys: %w", err)
 	}
-	JwtSecret = []byte(secret)
+	go signer.Run(context.Background())
+
+	jwtSigner = signer
+	return nil
+}
+
+// ParseToken verifies a token issued by this server and returns its claims
+// Asymmetric tokens are checked with the key named by their kid header
+func ParseToken(tokenString string) (jwt.MapClaims, error) {
+	return jwtSigner.Parse(tokenString)
+}
+
+// JWKS returns the public keys that verify our tokens (empty with HS256)
+func JWKS() jwtkeys.JWKS {
+	return jwtSigner.JWKS()
+}
+
+// InitPassword sets the bcrypt cost factor from the config
+func InitPassword(cfg config.PasswordConfig) {
+	bcryptCost = cfg.BcryptCost
 }
 
 // HashPassword takes a plain text password and returns a secure hash
-// Uses bcrypt with cost factor 14 (good balance of security and speed)
+// Uses bcrypt with the configured cost factor (default 14)
 func HashPassword(password string) (string, error) {
 	// Generate hash from password
-	hash, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
 		return "", fmt.Errorf("failed to hash password: %w", err)
 	}
@@ -48,75 +90,73 @@ func VerifyPassword(hashedPassword, plainPassword string) error {
 	return nil
 }
 
-// GenerateAllTokens creates both access token and refresh token
-// Access token expires in 20 minutes, refresh token expires in 7 days
-// Returns: accessToken, refreshToken, accessExpiry, refreshExpiry, error
-func GenerateAllTokens(userID uint, role string, canCRUD bool) (string, string, time.Time, time.Time, error) {
-	// Create access token (expires in 20 minutes)
-	accessExpiry := time.Now().Add(20 * time.Minute)
-	accessClaims := jwt.MapClaims{
-		"user_id": userID,
-		"role":    role,
-		"canCRUD": canCRUD,
-		"exp":     accessExpiry.Unix(),
+// IssuedToken is a signed token and its ID (the jti claim)
+// Only the ID is stored in user_tokens: without the signing key it can't be turned back into a token
+type IssuedToken struct {
+	Token     string
+	ID        string
+	ExpiresAt time.Time
+}
+
+// TokenID returns the jti claim of a parsed token ("" for tokens issued before it existed)
+func TokenID(claims jwt.MapClaims) string {
+	jti, _ := claims["jti"].(string)
+	return jti
+}
+
+// signToken adds a random jti and the expiry to claims and signs them
+func signToken(claims jwt.MapClaims, ttl time.Duration) (IssuedToken, error) {
+	id, err := RandomToken()
+	if err != nil {
+		return IssuedToken{}, err
 	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(JwtSecret)
+	expiry := time.Now().Add(ttl)
+	claims["jti"] = id
+	claims["exp"] = expiry.Unix()
+
+	token, err := jwtSigner.Sign(claims)
 	if err != nil {
-		return "", "", time.Time{}, time.Time{}, fmt.Errorf("failed to create access token: %w", err)
+		return IssuedToken{}, err
 	}
+	return IssuedToken{Token: token, ID: id, ExpiresAt: expiry}, nil
+}
 
-	// Create refresh token (expires in 7 days)
-	refreshExpiry := time.Now().Add(7 * 24 * time.Hour)
-	refreshClaims := jwt.MapClaims{
-		"user_id": userID,
-		"exp":     refreshExpiry.Unix(),
+// GenerateAllTokens creates both access token and refresh token
+// Lifetimes come from the config (default: access 20 minutes, refresh 7 days)
+func GenerateAllTokens(userID uint, role string, canCRUD bool) (access, refresh IssuedToken, err error) {
+	access, err = GenerateAccessTokenOnly(userID, role, canCRUD)
+	if err != nil {
+		return IssuedToken{}, IssuedToken{}, err
 	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(JwtSecret)
+	refresh, err = GenerateRefreshTokenOnly(userID)
 	if err != nil {
-		return "", "", time.Time{}, time.Time{}, fmt.Errorf("failed to create refresh token: %w", err)
+		return IssuedToken{}, IssuedToken{}, err
 	}
-
-	return accessTokenString, refreshTokenString, accessExpiry, refreshExpiry, nil
+	return access, refresh, nil
 }
 
 // GenerateAccessTokenOnly creates only an access token (used when refreshing)
-// Access token expires in 20 minutes
-// Returns: accessToken, expiryTime, error
-func GenerateAccessTokenOnly(userID uint, role string, canCRUD bool) (string, time.Time, error) {
-	// Create access token (expires in 20 minutes)
-	accessExpiry := time.Now().Add(20 * time.Minute)
-	accessClaims := jwt.MapClaims{
+// Uses the configured access token lifetime
+func GenerateAccessTokenOnly(userID uint, role string, canCRUD bool) (IssuedToken, error) {
+	access, err := signToken(jwt.MapClaims{
 		"user_id": userID,
 		"role":    role,
 		"canCRUD": canCRUD,
-		"exp":     accessExpiry.Unix(),
-	}
-	accessToken := jwt.NewWithClaims(jwt.SigningMethodHS256, accessClaims)
-	accessTokenString, err := accessToken.SignedString(JwtSecret)
+	}, accessTokenTTL)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to create access token: %w", err)
+		return IssuedToken{}, fmt.Errorf("failed to create access token: %w", err)
 	}
-
-	return accessTokenString, accessExpiry, nil
+	return access, nil
 }
 
 // GenerateRefreshTokenOnly creates only a refresh token (used for token rotation)
-// Refresh token expires in 7 days
-// Returns: refreshToken, expiryTime, error
-func GenerateRefreshTokenOnly(userID uint) (string, time.Time, error) {
-	// Create refresh token (expires in 7 days)
-	refreshExpiry := time.Now().Add(7 * 24 * time.Hour)
-	refreshClaims := jwt.MapClaims{
+// Uses the configured refresh token lifetime
+func GenerateRefreshTokenOnly(userID uint) (IssuedToken, error) {
+	refresh, err := signToken(jwt.MapClaims{
 		"user_id": userID,
-		"exp":     refreshExpiry.Unix(),
-	}
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaims)
-	refreshTokenString, err := refreshToken.SignedString(JwtSecret)
+	}, refreshTokenTTL)
 	if err != nil {
-		return "", time.Time{}, fmt.Errorf("failed to create refresh token: %w", err)
+		return IssuedToken{}, fmt.Errorf("failed to create refresh token: %w", err)
 	}
-
-	return refreshTokenString, refreshExpiry, nil
+	return refresh, nil
 }
\ No newline at end of file
@@ -0,0 +1,144 @@
+package utils
+
+import (
+	"siro-backend/pkg/config"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var jwtOnce sync.Once
+
+// setupJWT signs tokens with HS256, a 5 minute access and 1 hour refresh lifetime
+func setupJWT(t *testing.T) {
+	t.Helper()
+	var err error
+	jwtOnce.Do(func() {
+		cfg := config.Default().JWT
+		cfg.Secret = strings.Repeat("s", 32)
+		cfg.AccessTokenTTL.Duration = 5 * time.Minute
+		cfg.RefreshTokenTTL.Duration = time.Hour
+		err = InitJWT(cfg, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGenerateAllTokens(t *testing.T) {
+	setupJWT(t)
+	start := time.Now()
+	access, refresh, err := GenerateAllTokens(7, "Staff", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claims, err := ParseToken(access.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims["user_id"] != float64(7) || claims["role"] != "Staff" || claims["canCRUD"] != true {
+		t.Errorf("access claims %v", claims)
+	}
+	if TokenID(claims) != access.ID || access.ID == "" {
+		t.Errorf("access jti %q, issued %q", TokenID(claims), access.ID)
+	}
+	if d := access.ExpiresAt.Sub(start); d < 5*time.Minute || d > 5*time.Minute+time.Second {
+		t.Errorf("access token lives %v", d)
+	}
+	if exp := int64(claims["exp"].(float64)); exp != access.ExpiresAt.Unix() {
+		t.Errorf("exp %d, want %d", exp, access.ExpiresAt.Unix())
+	}
+
+	claims, err = ParseToken(refresh.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := claims["role"]; ok || claims["user_id"] != float64(7) {
+		t.Errorf("refresh claims %v", claims)
+	}
+	if TokenID(claims) != refresh.ID || refresh.ID == access.ID {
+		t.Errorf("refresh jti %q, access jti %q", refresh.ID, access.ID)
+	}
+	if d := refresh.ExpiresAt.Sub(start); d < time.Hour || d > time.Hour+time.Second {
+		t.Errorf("refresh token lives %v", d)
+	}
+
+	// The stored jti must not be usable as a token
+	if _, err := ParseToken(access.ID); err == nil {
+		t.Error("jti parsed as a token")
+	}
+}
+
+func TestTokenIDsAreUnique(t *testing.T) {
+	setupJWT(t)
+	seen := map[string]bool{}
+	for i := 0; i < 50; i++ {
+		tok, err := GenerateAccessTokenOnly(1, "Admin", false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if seen[tok.ID] {
+			t.Fatalf("jti %q issued twice", tok.ID)
+		}
+		seen[tok.ID] = true
+	}
+}
+
+func TestParseTokenRejects(t *testing.T) {
+	setupJWT(t)
+	tok, err := GenerateAccessTokenOnly(1, "Admin", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := strings.Split(tok.Token, ".")
+	for name, s := range map[string]string{
+		"empty":           "",
+		"garbage":         "abc.def.ghi",
+		"bad signature":   parts[0] + "." + parts[1] + "." + strings.Repeat("A", len(parts[2])),
+		"missing part":    parts[0] + "." + parts[1],
+		"unsigned (none)": "eyJhbGciOiJub25lIiwidHlwIjoiSldUIn0." + parts[1] + ".",
+	} {
+		if _, err := ParseToken(s); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
+
+func TestTokenIDOfOldTokens(t *testing.T) {
+	if got := TokenID(map[string]interface{}{"user_id": float64(1)}); got != "" {
+		t.Errorf("TokenID without jti = %q", got)
+	}
+	if got := TokenID(map[string]interface{}{"jti": 12}); got != "" {
+		t.Errorf("TokenID with a numeric jti = %q", got)
+	}
+}
+
+func TestPassword(t *testing.T) {
+	old := bcryptCost
+	t.Cleanup(func() { bcryptCost = old })
+	InitPassword(config.PasswordConfig{BcryptCost: bcrypt.MinCost + 1})
+
+	hash, err := HashPassword("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cost, err := bcrypt.Cost([]byte(hash)); err != nil || cost != bcrypt.MinCost+1 {
+		t.Errorf("cost %d (%v), want %d", cost, err, bcrypt.MinCost+1)
+	}
+	if err := VerifyPassword(hash, "correct horse"); err != nil {
+		t.Error(err)
+	}
+	if err := VerifyPassword(hash, "correct horse "); err == nil {
+		t.Error("wrong password accepted")
+	}
+	if err := VerifyPassword("not a hash", "correct horse"); err == nil {
+		t.Error("invalid hash accepted")
+	}
+	if _, err := HashPassword(strings.Repeat("x", 73)); err == nil {
+		t.Error("password over 72 bytes hashed")
+	}
+}
@@ -0,0 +1,224 @@
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"regexp"
+	"siro-backend/global"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/locales/en"
+	"github.com/go-playground/locales/id"
+	ut "github.com/go-playground/universal-translator"
+	"github.com/go-playground/validator/v10"
+	en_translations "github.com/go-playground/validator/v10/translations/en"
+	id_translations "github.com/go-playground/validator/v10/translations/id"
+)
+
+// Allowed values for the enum tags, taken from the domain constants
+var (
+	Priorities     = []string{global.PriorityHigh, global.PriorityMedium, global.PriorityLow}
+	Roles          = []string{global.RoleAdmin, global.RoleStaff}
+	Statuses       = []string{global.StatusPending, global.StatusInProgress, global.StatusCompleted}
+	Availabilities = []string{global.AvailOnline, global.AvailBusy, global.AvailAway, global.AvailOffline}
+
+	// StatusFilters are the values of ?status= on the work order list ("active" = not completed)
+	StatusFilters = append([]string{"active"}, Statuses...)
+
+	// APIScopes are the scopes an API key can be given
+	APIScopes = []string{global.ScopeWorkOrdersRead, global.ScopeWorkOrdersCreate, global.ScopeUnitsRead}
+
+	// WorkOrderSorts are the fields accepted by ?sort= on the work order list
+	WorkOrderSorts = []string{"created_at", "updated_at", "priority", "due"}
+)
+
+// phonePattern accepts numbers like 0812-3456-7890, +62 812 3456 7890 or (021) 555-1234
+var phonePattern = regexp.MustCompile(`^\+?[0-9(]([0-9 ()\-]*[0-9])?$`)
+
+// Default language when the client sends no (or an unknown) Accept-Language
+const defaultLang = "en"
+
+var translators *ut.UniversalTranslator
+
+// customTag is a validation tag with its English and Indonesian message
+// {0} is replaced by the field name
+type customTag struct {
+	name string
+	fn   validator.Func
+	en   string
+	id   string
+}
+
+// Init registers the domain tags (priority, role, status, availability, unit, phone, ...)
+// with gin's validator and loads English and Indonesian error messages
+// unitExists is called for the "unit" tag, so units are checked against the database
+func Init(unitExists func(unit string) bool) error {
+	v, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return fmt.Errorf("unexpected validator engine %T", binding.Validator.Engine())
+	}
+
+	// Report "assigneeId" instead of "AssigneeID" in errors
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name == "" {
+			return f.Name
+		}
+		return name
+	})
+
+	tags := []customTag{
+		{"priority", oneOf(Priorities),
+			"{0} must be one of: " + strings.Join(Priorities, ", "),
+			"{0} harus salah satu dari: " + strings.Join(Priorities, ", ")},
+		{"role", oneOf(Roles),
+			"{0} must be one of: " + strings.Join(Roles, ", "),
+			"{0} harus salah satu dari: " + strings.Join(Roles, ", ")},
+		{"status", oneOf(Statuses),
+			"{0} must be one of: " + strings.Join(Statuses, ", "),
+			"{0} harus salah satu dari: " + strings.Join(Statuses, ", ")},
+		{"statusfilter", oneOf(StatusFilters),
+			"{0} must be one of: " + strings.Join(StatusFilters, ", "),
+			"{0} harus salah satu dari: " + strings.Join(StatusFilters, ", ")},
+		{"availability", oneOf(Availabilities),
+			"{0} must be one of: " + strings.Join(Availabilities, ", "),
+			"{0} harus salah satu dari: " + strings.Join(Availabilities, ", ")},
+		{"apiscope", oneOf(APIScopes),
+			"{0} must be one of: " + strings.Join(APIScopes, ", "),
+			"{0} harus salah satu dari: " + strings.Join(APIScopes, ", ")},
+		{"wosort", isSort(WorkOrderSorts),
+			"{0} can only use: " + strings.Join(WorkOrderSorts, ", ") + " (with - for descending)",
+			"{0} hanya boleh: " + strings.Join(WorkOrderSorts, ", ") + " (pakai - untuk urutan menurun)"},
+		{"userref", isUserRef(false),
+			`{0} must be "me" or a user ID`,
+			`{0} harus "me" atau ID pengguna`},
+		{"assigneeref", isUserRef(true),
+			`{0} must be "me", "unassigned" or a user ID`,
+			`{0} harus "me", "unassigned" atau ID pengguna`},
+		{"unit", func(fl validator.FieldLevel) bool { return unitExists(fl.Field().String()) },
+			"{0} is not a known unit",
+			"{0} bukan unit yang terdaftar"},
+		{"phone", func(fl validator.FieldLevel) bool { return isPhone(fl.Field().String()) },
+			"{0} must be a valid phone number",
+			"{0} harus berupa nomor telepon yang valid"},
+	}
+
+	for _, t := range tags {
+		if err := v.RegisterValidation(t.name, t.fn); err != nil {
+			return err
+		}
+	}
+
+	// Messages for the built-in tags (required, email, max, ...) plus ours
+	enLocale := en.New()
+	translators = ut.New(enLocale, enLocale, id.New())
+
+	enTrans, _ := translators.GetTranslator("en")
+	if err := en_translations.RegisterDefaultTranslations(v, enTrans); err != nil {
+		return err
+	}
+	idTrans, _ := translators.GetTranslator("id")
+	if err := id_translations.RegisterDefaultTranslations(v, idTrans); err != nil {
+		return err
+	}
+
+	for _, t := range tags {
+		if err := registerMessage(v, enTrans, t.name, t.en); err != nil {
+			return err
+		}
+		if err := registerMessage(v, idTrans, t.name, t.id); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Message returns the error message for one invalid field in the language
+// requested by the Accept-Language header (English or Indonesian)
+func Message(fe validator.FieldError, acceptLanguage string) string {
+	if translators == nil {
+		return fe.Error()
+	}
+	trans, _ := translators.FindTranslator(languages(acceptLanguage)...)
+	return fe.Translate(trans)
+}
+
+// languages turns "id-ID,id;q=0.9,en;q=0.8" into ["id", "id", "en", "en"]
+func languages(header string) []string {
+	var langs []string
+	for _, part := range strings.Split(header, ",") {
+		tag := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if tag == "" || tag == "*" {
+			continue
+		}
+		primary := strings.ToLower(strings.SplitN(tag, "-", 2)[0])
+		langs = append(langs, primary)
+	}
+	return append(langs, defaultLang)
+}
+
+func registerMessage(v *validator.Validate, trans ut.Translator, tag, text string) error {
+	return v.RegisterTranslation(tag, trans,
+		func(trans ut.Translator) error { return trans.Add(tag, text, true) },
+		func(trans ut.Translator, fe validator.FieldError) string {
+			msg, err := trans.T(tag, fe.Field())
+			if err != nil {
+				return fe.Error()
+			}
+			return msg
+		})
+}
+
+// oneOf returns a case-sensitive enum check, so "admin" is rejected when "Admin" is expected
+func oneOf(allowed []string) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		return contains(allowed, fl.Field().String())
+	}
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// isSort accepts "field" or "-field" for the allowed fields
+func isSort(fields []string) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		return contains(fields, strings.TrimPrefix(fl.Field().String(), "-"))
+	}
+}
+
+// isUserRef accepts "me", a positive user ID and, if allowUnassigned, "unassigned"
+func isUserRef(allowUnassigned bool) validator.Func {
+	return func(fl validator.FieldLevel) bool {
+		value := fl.Field().String()
+		if value == "me" || (allowUnassigned && value == "unassigned") {
+			return true
+		}
+		id, err := strconv.ParseUint(value, 10, 32)
+		return err == nil && id > 0
+	}
+}
+
+// isPhone checks the format and requires 7 to 15 digits (the E.164 maximum)
+func isPhone(value string) bool {
+	if !phonePattern.MatchString(value) {
+		return false
+	}
+	digits := 0
+	for _, r := range value {
+		if r >= '0' && r <= '9' {
+			digits++
+		}
+	}
+	return digits >= 7 && digits <= 15
+}
@@ -0,0 +1,173 @@
+package validation
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+var initOnce sync.Once
+
+// setup registers the tags once, with IT and Facilities as the known units
+func setup(t *testing.T) {
+	t.Helper()
+	var err error
+	initOnce.Do(func() {
+		err = Init(func(unit string) bool { return unit == "IT" || unit == "Facilities" })
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+type testRequest struct {
+	Title        string `json:"title" binding:"required,max=10"`
+	Priority     string `json:"priority" binding:"omitempty,priority"`
+	Role         string `json:"role" binding:"omitempty,role"`
+	Status       string `json:"status" binding:"omitempty,status"`
+	StatusFilter string `json:"statusFilter" binding:"omitempty,statusfilter"`
+	Availability string `json:"availability" binding:"omitempty,availability"`
+	Scope        string `json:"scope" binding:"omitempty,apiscope"`
+	Sort         string `json:"sort" binding:"omitempty,wosort"`
+	Creator      string `json:"creator" binding:"omitempty,userref"`
+	AssigneeID   string `json:"assigneeId" binding:"omitempty,assigneeref"`
+	Unit         string `json:"unit" binding:"omitempty,unit"`
+	Phone        string `json:"phone" binding:"omitempty,phone"`
+	NoTag        string `binding:"omitempty,max=1"`
+}
+
+// fieldErrors validates req and returns its errors by field name
+func fieldErrors(t *testing.T, req testRequest) map[string]validator.FieldError {
+	t.Helper()
+	errs := map[string]validator.FieldError{}
+	err := binding.Validator.ValidateStruct(req)
+	if err == nil {
+		return errs
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		t.Fatalf("unexpected error %T: %v", err, err)
+	}
+	for _, fe := range verrs {
+		errs[fe.Field()] = fe
+	}
+	return errs
+}
+
+func TestTags(t *testing.T) {
+	setup(t)
+	tests := []struct {
+		field string
+		set   func(r *testRequest, v string)
+		valid []string
+		wrong []string
+	}{
+		{"priority", func(r *testRequest, v string) { r.Priority = v }, []string{"High", "Medium", "Low"}, []string{"high", "Urgent", " Low"}},
+		{"role", func(r *testRequest, v string) { r.Role = v }, []string{"Admin", "Staff"}, []string{"admin", "Root"}},
+		{"status", func(r *testRequest, v string) { r.Status = v }, []string{"Pending", "In Progress", "Completed"}, []string{"active", "Done"}},
+		{"statusFilter", func(r *testRequest, v string) { r.StatusFilter = v }, []string{"active", "Pending", "Completed"}, []string{"Active", "open"}},
+		{"availability", func(r *testRequest, v string) { r.Availability = v }, []string{"Online", "Busy", "Away", "Offline"}, []string{"online", "Free"}},
+		{"scope", func(r *testRequest, v string) { r.Scope = v }, APIScopes, []string{"admin", "workorders:delete"}},
+		{"sort", func(r *testRequest, v string) { r.Sort = v }, []string{"created_at", "-created_at", "priority", "-due"}, []string{"title", "--due", "+due", "due-"}},
+		{"creator", func(r *testRequest, v string) { r.Creator = v }, []string{"me", "1", "4294967295"}, []string{"unassigned", "0", "-1", "4294967296", "me2", "1.5"}},
+		{"assigneeId", func(r *testRequest, v string) { r.AssigneeID = v }, []string{"me", "unassigned", "42"}, []string{"Unassigned", "0", "none"}},
+		{"unit", func(r *testRequest, v string) { r.Unit = v }, []string{"IT", "Facilities"}, []string{"it", "HR"}},
+		{"phone", func(r *testRequest, v string) { r.Phone = v }, []string{"0812-3456-7890", "+62 812 3456 7890", "(021) 555-1234"}, []string{"123abc", "12345"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.field, func(t *testing.T) {
+			for _, v := range tt.valid {
+				req := testRequest{Title: "ok"}
+				tt.set(&req, v)
+				if errs := fieldErrors(t, req); len(errs) != 0 {
+					t.Errorf("%q rejected: %v", v, errs)
+				}
+			}
+			for _, v := range tt.wrong {
+				req := testRequest{Title: "ok"}
+				tt.set(&req, v)
+				if _, ok := fieldErrors(t, req)[tt.field]; !ok {
+					t.Errorf("%q accepted", v)
+				}
+			}
+		})
+	}
+}
+
+func TestMessage(t *testing.T) {
+	setup(t)
+	errs := fieldErrors(t, testRequest{Priority: "Urgent", AssigneeID: "x", Unit: "HR", Phone: "1", NoTag: "ab"})
+
+	tests := []struct {
+		field string
+		lang  string
+		want  string
+	}{
+		// built-in tags, and the JSON name in the message
+		{"title", "", "title is a required field"},
+		{"title", "id", "title wajib diisi"},
+		{"NoTag", "en", "NoTag must be a maximum of 1 character in length"},
+
+		// domain tags
+		{"priority", "en-US", "priority must be one of: High, Medium, Low"},
+		{"priority", "id-ID,id;q=0.9,en;q=0.8", "priority harus salah satu dari: High, Medium, Low"},
+		{"assigneeId", "en", `assigneeId must be "me", "unassigned" or a user ID`},
+		{"assigneeId", "ID", `assigneeId harus "me", "unassigned" atau ID pengguna`},
+		{"unit", "en", "unit is not a known unit"},
+		{"unit", "id", "unit bukan unit yang terdaftar"},
+		{"phone", "en", "phone must be a valid phone number"},
+		{"phone", "id", "phone harus berupa nomor telepon yang valid"},
+
+		// unknown languages fall back to the next one, then to English
+		{"phone", "fr-FR,id;q=0.5", "phone harus berupa nomor telepon yang valid"},
+		{"phone", "fr-FR, *", "phone must be a valid phone number"},
+	}
+	for _, tt := range tests {
+		fe, ok := errs[tt.field]
+		if !ok {
+			t.Fatalf("no error for %s (got %v)", tt.field, errs)
+		}
+		if got := Message(fe, tt.lang); got != tt.want {
+			t.Errorf("Message(%s, %q) = %q, want %q", tt.field, tt.lang, got, tt.want)
+		}
+	}
+}
+
+func TestLanguages(t *testing.T) {
+	tests := map[string][]string{
+		"":                        {"en"},
+		"id":                      {"id", "en"},
+		"id-ID,id;q=0.9,en;q=0.8": {"id", "id", "en", "en"},
+		" EN-gb , *;q=0.1":        {"en", "en"},
+		"fr;q=1,,de":              {"fr", "de", "en"},
+	}
+	for header, want := range tests {
+		if got := languages(header); !reflect.DeepEqual(got, want) {
+			t.Errorf("languages(%q) = %q, want %q", header, got, want)
+		}
+	}
+}
+
+func TestIsPhone(t *testing.T) {
+	valid := []string{
+		"0812-3456-7890", "+62 812 3456 7890", "(021) 555-1234", "5551234", "+123456789012345", "021 5551234",
+	}
+	wrong := []string{
+		"", "123456", "+1234567890123456", "0812-3456-789-", "-0812345678", "0812 3456 78a0", "++62812345678",
+		"+62-812-3456-7890 ext 1", "0812.3456.7890", "(021) 555-1234 ",
+	}
+	for _, v := range valid {
+		if !isPhone(v) {
+			t.Errorf("isPhone(%q) = false", v)
+		}
+	}
+	for _, v := range wrong {
+		if isPhone(v) {
+			t.Errorf("isPhone(%q) = true", v)
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Background jobs started with Go; idle is closed when the last one finishes
+var (
+	mu      sync.Mutex
+	running int
+	idle    chan struct{}
+)
+
+var tracer = otel.Tracer("siro-backend/pkg/worker")
+
+// Go runs fn in a background goroutine that graceful shutdown waits for
+// name is used in logs and as the trace span name; ctx should not be tied to the
+// HTTP request (use context.WithoutCancel), but its trace becomes the parent of the job span
+// A panic inside fn is logged instead of crashing the server
+func Go(ctx context.Context, name string, fn func(ctx context.Context)) {
+	mu.Lock()
+	if running == 0 {
+		idle = make(chan struct{})
+	}
+	running++
+	mu.Unlock()
+
+	go func() {
+		defer done()
+
+		ctx, span := tracer.Start(ctx, "job "+name, trace.WithAttributes(attribute.String("job.name", name)))
+		defer span.End()
+
+		defer func() {
+			if r := recover(); r != nil {
+				span.SetStatus(codes.Error, fmt.Sprint(r))
+				slog.ErrorContext(ctx, "background job panicked", "job", name, "panic", r)
+			}
+		}()
+		fn(ctx)
+	}()
+}
+
+// done marks one job as finished
+func done() {
+	mu.Lock()
+	defer mu.Unlock()
+	running--
+	if running == 0 {
+		close(idle)
+	}
+}
+
+// Wait blocks until all background jobs have finished or ctx is done
+// Returns ctx.Err() if the deadline was reached first; jobs can still be started afterwards
+func Wait(ctx context.Context) error {
+	mu.Lock()
+	if running == 0 {
+		mu.Unlock()
+		return nil
+	}
+	ch := idle
+	mu.Unlock()
+
+	select {
+	case <-ch:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,127 @@
+package worker
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var (
+	spansOnce sync.Once
+	spans     *tracetest.InMemoryExporter
+	provider  *sdktrace.TracerProvider
+)
+
+// recordSpans makes the worker tracer record into an in-memory exporter, emptied for each test
+func recordSpans(t *testing.T) (*tracetest.InMemoryExporter, *sdktrace.TracerProvider) {
+	t.Helper()
+	spansOnce.Do(func() {
+		spans = tracetest.NewInMemoryExporter()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSyncer(spans))
+		otel.SetTracerProvider(provider)
+	})
+	spans.Reset()
+	return spans, provider
+}
+
+func TestWaitForJobs(t *testing.T) {
+	var finished atomic.Int32
+	release := make(chan struct{})
+	for i := 0; i < 5; i++ {
+		Go(context.Background(), "test", func(ctx context.Context) {
+			<-release
+			finished.Add(1)
+		})
+	}
+
+	// the jobs are still blocked, so the deadline comes first
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want DeadlineExceeded", err)
+	}
+
+	close(release)
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := Wait(ctx); err != nil {
+		t.Fatalf("Wait = %v", err)
+	}
+	if n := finished.Load(); n != 5 {
+		t.Errorf("%d jobs finished, want 5", n)
+	}
+}
+
+func TestWaitWithoutJobs(t *testing.T) {
+	if err := Wait(context.Background()); err != nil {
+		t.Errorf("Wait = %v", err)
+	}
+}
+
+func TestJobSpan(t *testing.T) {
+	exp, tp := recordSpans(t)
+
+	// the job span continues the request's trace, even when the request context is canceled
+	reqCtx, cancel := context.WithCancel(context.Background())
+	reqCtx, parent := tp.Tracer("test").Start(reqCtx, "request")
+	var jobCtxErr error
+	Go(context.WithoutCancel(reqCtx), "send invitation", func(ctx context.Context) {
+		jobCtxErr = ctx.Err()
+	})
+	cancel()
+	parent.End()
+	if err := Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if jobCtxErr != nil {
+		t.Errorf("job context error %v", jobCtxErr)
+	}
+
+	var job *tracetest.SpanStub
+	for _, s := range exp.GetSpans() {
+		if s.Name == "job send invitation" {
+			job = &s
+		}
+	}
+	if job == nil {
+		t.Fatalf("no job span in %v", exp.GetSpans())
+	}
+	if job.Parent.SpanID() != parent.SpanContext().SpanID() || job.SpanContext.TraceID() != parent.SpanContext().TraceID() {
+		t.Error("job span is not a child of the request span")
+	}
+	if len(job.Attributes) != 1 || job.Attributes[0].Key != "job.name" || job.Attributes[0].Value.AsString() != "send invitation" {
+		t.Errorf("attributes = %v", job.Attributes)
+	}
+	if job.Status.Code == codes.Error {
+		t.Errorf("status = %v", job.Status)
+	}
+}
+
+func TestJobPanic(t *testing.T) {
+	exp, _ := recordSpans(t)
+	ran := false
+	Go(context.Background(), "broken", func(ctx context.Context) { panic("boom") })
+	Go(context.Background(), "after", func(ctx context.Context) { ran = true })
+	if err := Wait(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if !ran {
+		t.Error("the job after the panic did not run")
+	}
+	for _, s := range exp.GetSpans() {
+		if s.Name == "job broken" && (s.Status.Code != codes.Error || s.Status.Description != "boom") {
+			t.Errorf("status = %v, want an error with the panic value", s.Status)
+		}
+	}
+	if len(exp.GetSpans()) != 2 {
+		t.Errorf("%d spans, want 2", len(exp.GetSpans()))
+	}
+}